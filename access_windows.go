@@ -0,0 +1,258 @@
+package winfsp
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	accessCheckEx            *syscall.Proc
+	createSecurityDescriptor *syscall.Proc
+)
+
+var (
+	advapi32        = windows.NewLazySystemDLL("advapi32.dll")
+	procAccessCheck = advapi32.NewProc("AccessCheck")
+)
+
+// AccessCheck performs the access check of WinFSP against
+// the security descriptor returned by GetSecurityByName,
+// returning the access granted to the originating process.
+//
+// The checkParentOrMain checks the parent directory instead
+// of the file itself, e.g. while creating files, and the
+// allowTraverseCheck checks the traverse access of the
+// ancestor directories when the process lacks the bypass
+// traverse checking privilege.
+//
+// This must only be called inside the Open, Create and
+// CreateEx behaviours, and on the goroutine which the
+// behaviour is invoked, since the request is tracked by
+// the dispatcher thread.
+func (ref *FileSystemRef) AccessCheck(
+	checkParentOrMain, allowTraverseCheck bool,
+	desiredAccess uint32,
+) (uint32, error) {
+	request := operationRequest()
+	if request == nil || request.Kind != FspFsctlTransactCreateKind {
+		return 0, errors.New("access check requires create request")
+	}
+	var checkParent, allowTraverse uintptr
+	if checkParentOrMain {
+		checkParent = 1
+	}
+	if allowTraverseCheck {
+		allowTraverse = 1
+	}
+	var grantedAccess uint32
+	if err := callNTStatus(accessCheckEx,
+		uintptr(unsafe.Pointer(ref.fileSystem)),
+		uintptr(unsafe.Pointer(request)),
+		checkParent, allowTraverse, uintptr(desiredAccess),
+		uintptr(unsafe.Pointer(&grantedAccess)), 0,
+	); err != nil {
+		return 0, err
+	}
+	return grantedAccess, nil
+}
+
+// CreateSecurityDescriptor creates the security descriptor
+// of the file being created, which inherits from the parent
+// descriptor and merges the descriptor requested by the
+// originating process, just like the native file systems.
+//
+// The returned security descriptor is self-relative and is
+// allocated by Go. This must only be called inside the
+// Create and CreateEx behaviours, and on the goroutine which
+// the behaviour is invoked.
+func (ref *FileSystemRef) CreateSecurityDescriptor(
+	parent *windows.SECURITY_DESCRIPTOR,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	request := operationRequest()
+	if request == nil || request.Kind != FspFsctlTransactCreateKind {
+		return nil, errors.New(
+			"create security descriptor requires create request")
+	}
+	var sd *windows.SECURITY_DESCRIPTOR
+	if err := callNTStatus(createSecurityDescriptor,
+		uintptr(unsafe.Pointer(ref.fileSystem)),
+		uintptr(unsafe.Pointer(request)),
+		uintptr(unsafe.Pointer(parent)),
+		uintptr(unsafe.Pointer(&sd)),
+	); err != nil {
+		return nil, errors.Wrap(err, "create security descriptor")
+	}
+	defer func() {
+		_, _, _ = deleteSecurityDescriptor.Call(uintptr(unsafe.Pointer(sd)),
+			createSecurityDescriptor.Addr())
+	}()
+	buf := make([]byte, int(sd.Length()))
+	copy(buf, enforceBytePtr(uintptr(unsafe.Pointer(sd)), len(buf)))
+	return (*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(&buf[0])), nil
+}
+
+// SecuritySource supplies the security descriptors of the
+// files to the access check middleware.
+type SecuritySource func(
+	fs *FileSystemRef, name string,
+) (*windows.SECURITY_DESCRIPTOR, error)
+
+// CheckAccess performs the access checks of windows against
+// the security descriptors supplied by the source before
+// dispatching Open, Create and CreateEx, and the operations
+// will fail with STATUS_ACCESS_DENIED when the originating
+// process is not granted the access.
+//
+// Opening files checks their own descriptors, while creating
+// files checks the descriptors of their parent directories
+// for adding files or subdirectories.
+//
+// WinFSP performs the same checks against the descriptors
+// returned by GetSecurityByName already, so this is meant for
+// the file systems which do not implement it, e.g. those that
+// keep the descriptors apart from the file attributes.
+func CheckAccess(source SecuritySource) Option {
+	return func(o *option) {
+		o.securitySource = source
+	}
+}
+
+const (
+	fileAllAccess       = 0x001F01FF
+	fileAddFile         = windows.FILE_WRITE_DATA
+	fileAddSubdirectory = windows.FILE_APPEND_DATA
+)
+
+// fileGenericMapping is the GENERIC_MAPPING of files.
+var fileGenericMapping = struct {
+	read, write, execute, all uint32
+}{
+	read:    windows.FILE_GENERIC_READ,
+	write:   windows.FILE_GENERIC_WRITE,
+	execute: windows.FILE_GENERIC_EXECUTE,
+	all:     fileAllAccess,
+}
+
+// mapGenericAccess maps the generic rights in the access mask
+// into the specific rights of files, which AccessCheck requires.
+func mapGenericAccess(access uint32) uint32 {
+	if access&windows.GENERIC_READ != 0 {
+		access |= fileGenericMapping.read
+	}
+	if access&windows.GENERIC_WRITE != 0 {
+		access |= fileGenericMapping.write
+	}
+	if access&windows.GENERIC_EXECUTE != 0 {
+		access |= fileGenericMapping.execute
+	}
+	if access&windows.GENERIC_ALL != 0 {
+		access |= fileGenericMapping.all
+	}
+	return access &^ (windows.GENERIC_READ | windows.GENERIC_WRITE |
+		windows.GENERIC_EXECUTE | windows.GENERIC_ALL)
+}
+
+// accessCheck evaluates the access of the token against the
+// security descriptor with the windows' AccessCheck.
+//
+// The MAXIMUM_ALLOWED is evaluated by AccessCheck itself, which
+// grants the access when any right is granted, in addition to
+// the other rights requested.
+func accessCheck(
+	sd *windows.SECURITY_DESCRIPTOR, token windows.Token,
+	desiredAccess uint32,
+) (bool, error) {
+	desiredAccess = mapGenericAccess(desiredAccess)
+	if desiredAccess == 0 {
+		// Opening files without any access is always allowed.
+		return true, nil
+	}
+	var privileges [256]byte
+	privilegesLength := uint32(len(privileges))
+	var grantedAccess uint32
+	var accessStatus int32
+	result, _, err := procAccessCheck.Call(
+		uintptr(unsafe.Pointer(sd)), uintptr(token),
+		uintptr(desiredAccess),
+		uintptr(unsafe.Pointer(&fileGenericMapping)),
+		uintptr(unsafe.Pointer(&privileges[0])),
+		uintptr(unsafe.Pointer(&privilegesLength)),
+		uintptr(unsafe.Pointer(&grantedAccess)),
+		uintptr(unsafe.Pointer(&accessStatus)),
+	)
+	if result == 0 {
+		return false, errors.Wrap(err, "access check")
+	}
+	return accessStatus != 0, nil
+}
+
+// parentName returns the name of the parent directory.
+func parentName(name string) string {
+	index := strings.LastIndexByte(name, '\\')
+	if index <= 0 {
+		return `\`
+	}
+	return name[:index]
+}
+
+// checkSecurityAccess evaluates the security descriptors of
+// the security source against the originating process.
+//
+// The access is evaluated against the access desired by the
+// process rather than the one granted by WinFSP, which maps
+// the MAXIMUM_ALLOWED into all access when the file system
+// does not implement GetSecurityByName.
+func (ref *FileSystemRef) checkSecurityAccess(
+	name string, create bool,
+) error {
+	if ref.securitySource == nil {
+		return nil
+	}
+	request := operationCreateRequest()
+	if request == nil {
+		return nil
+	}
+	return ref.checkTokenAccess(
+		FSP_FSCTL_TRANSACT_REQ_TOKEN_HANDLE(request.AccessToken),
+		name, request.CreateOptions, request.DesiredAccess, create)
+}
+
+// checkTokenAccess evaluates the security descriptors of the
+// security source against the token. The create disposition
+// is carried by the highest byte of createOptions, just like
+// the create request of WinFSP.
+func (ref *FileSystemRef) checkTokenAccess(
+	token windows.Token, name string,
+	createOptions, desiredAccess uint32, create bool,
+) error {
+	if create {
+		name = parentName(name)
+		desiredAccess = fileAddFile
+		if createOptions&windows.FILE_DIRECTORY_FILE != 0 {
+			desiredAccess = fileAddSubdirectory
+		}
+	} else {
+		switch createOptions >> 24 {
+		case windows.FILE_SUPERSEDE, windows.FILE_OVERWRITE,
+			windows.FILE_OVERWRITE_IF:
+			// The existing file is to be truncated.
+			desiredAccess |= windows.FILE_WRITE_DATA
+		}
+	}
+	sd, err := ref.securitySource(ref, name)
+	if err != nil {
+		return err
+	}
+	allowed, err := accessCheck(sd, token, desiredAccess)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return windows.STATUS_ACCESS_DENIED
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestParentName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`\`, parentName(`\`))
+	assert.Equal(`\`, parentName(`\file`))
+	assert.Equal(`\dir`, parentName(`\dir\file`))
+	assert.Equal(`\a\b`, parentName(`\a\b\c`))
+}
+
+// impersonationToken duplicates the token of the process into
+// the impersonation token required by AccessCheck.
+func impersonationToken(t *testing.T) windows.Token {
+	t.Helper()
+	process, err := windows.OpenCurrentProcessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = process.Close() }()
+	var token windows.Token
+	if err := windows.DuplicateTokenEx(process,
+		windows.TOKEN_QUERY|windows.TOKEN_DUPLICATE|windows.TOKEN_IMPERSONATE,
+		nil, windows.SecurityImpersonation, windows.TokenImpersonation,
+		&token); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = token.Close() })
+	return token
+}
+
+func TestCheckTokenAccess(t *testing.T) {
+	assert := assert.New(t)
+	token := impersonationToken(t)
+	sds := make(map[string]*windows.SECURITY_DESCRIPTOR)
+	for name, sddl := range map[string]string{
+		`\`:         "O:SYG:SYD:P(A;;FA;;;WD)",
+		`\writable`: "O:SYG:SYD:P(A;;FA;;;WD)",
+		`\readonly`: "O:SYG:SYD:P(A;;FR;;;WD)",
+		`\denied`:   "O:SYG:SYD:P",
+	} {
+		sd, err := windows.SecurityDescriptorFromString(sddl)
+		if !assert.NoError(err) {
+			return
+		}
+		sds[name] = sd
+	}
+	ref := &FileSystemRef{}
+	ref.securitySource = func(
+		fs *FileSystemRef, name string,
+	) (*windows.SECURITY_DESCRIPTOR, error) {
+		return sds[name], nil
+	}
+	check := func(
+		name string, createOptions, desiredAccess uint32, create bool,
+	) error {
+		return ref.checkTokenAccess(
+			token, name, createOptions, desiredAccess, create)
+	}
+	open := uint32(windows.FILE_OPEN) << 24
+
+	// Reading the read-only file is allowed, including opening
+	// it with MAXIMUM_ALLOWED and generic rights.
+	assert.NoError(check(`\readonly`, open, windows.FILE_GENERIC_READ, false))
+	assert.NoError(check(`\readonly`, open, windows.GENERIC_READ, false))
+	assert.NoError(check(`\readonly`, open, windows.MAXIMUM_ALLOWED, false))
+	assert.NoError(check(`\readonly`, open, 0, false))
+	assert.Equal(windows.STATUS_ACCESS_DENIED, check(
+		`\readonly`, open, windows.FILE_WRITE_DATA, false))
+	assert.Equal(windows.STATUS_ACCESS_DENIED, check(
+		`\readonly`, open, windows.MAXIMUM_ALLOWED|windows.DELETE, false))
+	assert.Equal(windows.STATUS_ACCESS_DENIED, check(
+		`\denied`, open, windows.MAXIMUM_ALLOWED, false))
+
+	// Overwriting and superseding the file requires writing.
+	for _, disposition := range []uint32{
+		windows.FILE_OVERWRITE, windows.FILE_OVERWRITE_IF,
+		windows.FILE_SUPERSEDE,
+	} {
+		assert.Equal(windows.STATUS_ACCESS_DENIED, check(`\readonly`,
+			disposition<<24, windows.FILE_READ_DATA, false))
+		assert.NoError(check(`\writable`, disposition<<24,
+			windows.FILE_READ_DATA, false))
+	}
+
+	// Creating files checks the parent directory.
+	create := uint32(windows.FILE_CREATE) << 24
+	assert.NoError(check(`\file`, create, windows.FILE_GENERIC_READ, true))
+	assert.Equal(windows.STATUS_ACCESS_DENIED, check(`\readonly\file`,
+		create, windows.FILE_GENERIC_READ, true))
+	assert.Equal(windows.STATUS_ACCESS_DENIED, check(`\readonly\dir`,
+		create|windows.FILE_DIRECTORY_FILE, windows.FILE_GENERIC_READ, true))
+}
+
+func TestMapGenericAccess(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint32(windows.FILE_GENERIC_READ),
+		mapGenericAccess(windows.GENERIC_READ))
+	assert.Equal(uint32(fileAllAccess),
+		mapGenericAccess(windows.GENERIC_ALL|windows.GENERIC_READ))
+	assert.Equal(uint32(windows.MAXIMUM_ALLOWED|windows.FILE_READ_DATA),
+		mapGenericAccess(windows.MAXIMUM_ALLOWED|windows.FILE_READ_DATA))
+}
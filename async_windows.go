@@ -0,0 +1,185 @@
+package winfsp
+
+import (
+	"io"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var sendResponse *syscall.Proc
+
+// AsyncRequest identifies the request which is completed
+// asynchronously by the FileSystemRef.CompleteAsync.
+type AsyncRequest struct {
+	kind uint32
+	hint uint64
+	hold *asyncHold
+}
+
+// asyncHold keeps the operation serving the asynchronous
+// request open until it is completed, which might happen
+// before the operation returns windows.STATUS_PENDING.
+type asyncHold struct {
+	mtx       sync.Mutex
+	finish    func(windows.NTStatus)
+	completed bool
+	abandoned bool
+	status    windows.NTStatus
+}
+
+func (h *asyncHold) attach(finish func(windows.NTStatus)) {
+	h.mtx.Lock()
+	completed, status := h.completed, h.status
+	if !completed {
+		h.finish = finish
+	}
+	h.mtx.Unlock()
+	if completed {
+		finish(status)
+	}
+}
+
+// abandon marks the request as not pending, since the
+// operation beginning it has returned synchronously and the
+// dispatcher has responded to it already.
+func (h *asyncHold) abandon() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.abandoned = true
+}
+
+// complete completes the request with its status, which
+// reports false if the request has been completed before,
+// or has been abandoned.
+func (h *asyncHold) complete(status windows.NTStatus) bool {
+	h.mtx.Lock()
+	if h.completed || h.abandoned {
+		h.mtx.Unlock()
+		return false
+	}
+	finish := h.finish
+	h.completed = true
+	h.status = status
+	h.mtx.Unlock()
+	if finish != nil {
+		finish(status)
+	}
+	return true
+}
+
+// pendingOperation retrieves the hold of the asynchronous
+// request that the operation returns windows.STATUS_PENDING
+// for, or nil if the operation is not pending.
+func (ref *FileSystemRef) pendingOperation(
+	status *windows.NTStatus,
+) *asyncHold {
+	request := operationRequest()
+	if request == nil {
+		return nil
+	}
+	return ref.takeAsyncHold(request.Hint, status)
+}
+
+// takeAsyncHold removes the hold of the request whatever the
+// operation returns, so that the request which has begun but
+// is not pending won't be kept forever. The hold which is not
+// pending is abandoned, so that completing it won't respond
+// to the request twice.
+func (ref *FileSystemRef) takeAsyncHold(
+	hint uint64, status *windows.NTStatus,
+) *asyncHold {
+	value, ok := ref.asyncHolds.LoadAndDelete(hint)
+	if !ok {
+		return nil
+	}
+	hold := value.(*asyncHold)
+	if status == nil || *status != windows.STATUS_PENDING {
+		hold.abandon()
+		return nil
+	}
+	return hold
+}
+
+// BeginAsync retrieves the request being served, so that
+// the behaviour is able to return windows.STATUS_PENDING and
+// complete it later from another goroutine, without blocking
+// the dispatcher thread on the slow backends.
+//
+// Only the Read, Write and ReadDirectoryRaw behaviours can
+// be completed asynchronously. The buffer passed to them
+// remains valid until the request is completed, while the
+// per file serialization and the content inspection no
+// longer apply to the asynchronous completion.
+//
+// This must only be called inside the behaviours, and on
+// the goroutine which the behaviour is invoked, since the
+// request is tracked by the dispatcher thread.
+func (ref *FileSystemRef) BeginAsync() (AsyncRequest, error) {
+	request := operationRequest()
+	if request == nil {
+		return AsyncRequest{}, errors.New("no request being served")
+	}
+	switch request.Kind {
+	case FspFsctlTransactReadKind,
+		FspFsctlTransactWriteKind,
+		FspFsctlTransactQueryDirectoryKind:
+	default:
+		return AsyncRequest{}, errors.Errorf(
+			"request kind %d cannot complete asynchronously",
+			request.Kind)
+	}
+	hold := &asyncHold{}
+	ref.asyncHolds.Store(request.Hint, hold)
+	return AsyncRequest{
+		kind: request.Kind,
+		hint: request.Hint,
+		hold: hold,
+	}, nil
+}
+
+// CompleteAsync completes the request which the behaviour
+// has returned windows.STATUS_PENDING for, with the number of
+// bytes transferred and the error of the operation. The info
+// is the file info after writing, and ignored otherwise.
+//
+// Each request can only be completed once, and completing it
+// again returns an error without responding. So does the
+// request whose behaviour has begun it but returned without
+// windows.STATUS_PENDING, which has been responded already.
+func (ref *FileSystemRef) CompleteAsync(
+	request AsyncRequest, n int,
+	info *FSP_FSCTL_FILE_INFO, err error,
+) error {
+	if request.kind == FspFsctlTransactReservedKind {
+		return errors.New("invalid async request")
+	}
+	// XXX: see the counterpart in the read delegate.
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	status := ref.convertNTStatus(err)
+	if status == windows.STATUS_PENDING {
+		return errors.New("complete request with pending status")
+	}
+	if request.hold != nil && !request.hold.complete(status) {
+		return errors.New("request has been completed or is not pending")
+	}
+	var response FSP_FSCTL_TRANSACT_RSP
+	response.Size = uint16(unsafe.Sizeof(response))
+	response.Kind = request.kind
+	response.Hint = request.hint
+	response.IoStatus.Status = uint32(status)
+	response.IoStatus.Information = uint32(n)
+	if request.kind == FspFsctlTransactWriteKind && info != nil {
+		*(*FSP_FSCTL_FILE_INFO)(unsafe.Pointer(&response.Rsp)) = *info
+	}
+	_, _, _ = sendResponse.Call(
+		uintptr(unsafe.Pointer(ref.fileSystem)),
+		uintptr(unsafe.Pointer(&response)),
+	)
+	return nil
+}
@@ -0,0 +1,82 @@
+package winfsp
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestCompleteAsync(t *testing.T) {
+	assert := assert.New(t)
+	// The size must be the sizeof(FSP_FSCTL_TRANSACT_RSP),
+	// otherwise the driver rejects the response.
+	assert.Equal(uintptr(128), unsafe.Sizeof(FSP_FSCTL_TRANSACT_RSP{}))
+
+	ref := &FileSystemRef{}
+	assert.Error(ref.CompleteAsync(AsyncRequest{}, 0, nil, nil))
+	assert.Error(ref.CompleteAsync(AsyncRequest{
+		kind: FspFsctlTransactReadKind,
+	}, 0, nil, windows.STATUS_PENDING))
+
+	// The request completed before is not responded again.
+	request := AsyncRequest{
+		kind: FspFsctlTransactReadKind,
+		hint: 1,
+		hold: &asyncHold{},
+	}
+	assert.True(request.hold.complete(windows.STATUS_SUCCESS))
+	assert.False(request.hold.complete(windows.STATUS_SUCCESS))
+	assert.Error(ref.CompleteAsync(request, 0, nil, nil))
+}
+
+func TestTakeAsyncHold(t *testing.T) {
+	assert := assert.New(t)
+	ref := &FileSystemRef{}
+	count := func() int {
+		n := 0
+		ref.asyncHolds.Range(func(_, _ interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	// The hold is removed even if the operation which has
+	// begun the request is not pending.
+	ref.asyncHolds.Store(uint64(1), &asyncHold{})
+	failure := windows.STATUS_ACCESS_DENIED
+	assert.Nil(ref.takeAsyncHold(1, &failure))
+	assert.Equal(0, count())
+	ref.asyncHolds.Store(uint64(2), &asyncHold{})
+	assert.Nil(ref.takeAsyncHold(2, nil))
+	assert.Equal(0, count())
+
+	// The pending operation takes the hold over.
+	hold := &asyncHold{}
+	ref.asyncHolds.Store(uint64(3), hold)
+	pending := windows.STATUS_PENDING
+	assert.Same(hold, ref.takeAsyncHold(3, &pending))
+	assert.Equal(0, count())
+	assert.Nil(ref.takeAsyncHold(4, &pending))
+}
+
+func TestCompleteAsyncNotPending(t *testing.T) {
+	assert := assert.New(t)
+	ref := &FileSystemRef{}
+
+	// The behaviour begins the request but returns it
+	// synchronously, which has been responded by the
+	// dispatcher, and must not be responded again.
+	request := AsyncRequest{
+		kind: FspFsctlTransactReadKind,
+		hint: 1,
+		hold: &asyncHold{},
+	}
+	ref.asyncHolds.Store(request.hint, request.hold)
+	success := windows.STATUS_SUCCESS
+	assert.Nil(ref.takeAsyncHold(request.hint, &success))
+	assert.Error(ref.CompleteAsync(request, 0, nil, nil))
+	assert.False(request.hold.complete(windows.STATUS_SUCCESS))
+}
@@ -0,0 +1,212 @@
+package blockcache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBlockSize = 64 * 1024
+	defaultCapacity  = 256
+)
+
+type option struct {
+	blockSize int
+	capacity  int
+}
+
+// Option is the option of the cache.
+type Option func(*option)
+
+// BlockSize sets the size of each block read from the source,
+// which is 64KiB by default.
+func BlockSize(size int) Option {
+	return func(o *option) {
+		o.blockSize = size
+	}
+}
+
+// Capacity sets the maximum number of blocks kept in memory,
+// which is 256 by default.
+func Capacity(blocks int) Option {
+	return func(o *option) {
+		o.capacity = blocks
+	}
+}
+
+// Stats is the counters of the cache.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Blocks    int
+}
+
+// block is a cached block, which is being loaded until the
+// loaded channel is closed.
+type block struct {
+	index   int64
+	data    []byte
+	err     error
+	loaded  chan struct{}
+	element *list.Element
+}
+
+// Cache is the io.ReaderAt caching the blocks of the source.
+type Cache struct {
+	source    io.ReaderAt
+	size      int64
+	blockSize int
+	capacity  int
+
+	mtx    sync.Mutex
+	blocks map[int64]*block
+	lru    *list.List
+	stats  Stats
+}
+
+// New creates the cache of the source with the given size.
+func New(source io.ReaderAt, size int64, opts ...Option) (*Cache, error) {
+	option := &option{
+		blockSize: defaultBlockSize,
+		capacity:  defaultCapacity,
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+	if option.blockSize <= 0 {
+		return nil, errors.Errorf("invalid block size %d", option.blockSize)
+	}
+	if option.capacity <= 0 {
+		return nil, errors.Errorf("invalid capacity %d", option.capacity)
+	}
+	return &Cache{
+		source:    source,
+		size:      size,
+		blockSize: option.blockSize,
+		capacity:  option.capacity,
+		blocks:    make(map[int64]*block),
+		lru:       list.New(),
+	}, nil
+}
+
+// Size returns the size of the source.
+func (c *Cache) Size() int64 {
+	return c.size
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() Stats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := c.stats
+	stats.Blocks = c.lru.Len()
+	return stats
+}
+
+// Invalidate drops all cached blocks, which is required after
+// the source has been modified.
+func (c *Cache) Invalidate() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for index, b := range c.blocks {
+		if b.element != nil {
+			c.lru.Remove(b.element)
+		}
+		delete(c.blocks, index)
+	}
+}
+
+// acquire looks up the block, or starts loading it when it is
+// missing, in which case the caller must call load.
+func (c *Cache) acquire(index int64) (*block, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if b, ok := c.blocks[index]; ok {
+		c.stats.Hits++
+		if b.element != nil {
+			c.lru.MoveToFront(b.element)
+		}
+		return b, false
+	}
+	c.stats.Misses++
+	b := &block{index: index, loaded: make(chan struct{})}
+	c.blocks[index] = b
+	return b, true
+}
+
+// load reads the block from the source and inserts it into
+// the cache, evicting the least recently used blocks.
+func (c *Cache) load(b *block) {
+	defer close(b.loaded)
+	offset := b.index * int64(c.blockSize)
+	length := int64(c.blockSize)
+	if remaining := c.size - offset; remaining < length {
+		length = remaining
+	}
+	data := make([]byte, length)
+	n, err := c.source.ReadAt(data, offset)
+	if err == io.EOF && int64(n) == length {
+		err = nil
+	}
+	b.data, b.err = data[:n], err
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.blocks[b.index] != b {
+		// Invalidated while loading, the block is only
+		// returned to the readers waiting for it.
+		return
+	}
+	if err != nil {
+		// Failures are not cached, so that they could be
+		// retried by the next read.
+		delete(c.blocks, b.index)
+		return
+	}
+	b.element = c.lru.PushFront(b)
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.blocks, oldest.Value.(*block).index)
+		c.stats.Evictions++
+	}
+}
+
+// ReadAt reads from the cached blocks, loading the missing
+// blocks from the source.
+func (c *Cache) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.Errorf("negative offset %d", offset)
+	}
+	total := 0
+	for len(p) > 0 {
+		if offset >= c.size {
+			return total, io.EOF
+		}
+		index := offset / int64(c.blockSize)
+		b, missing := c.acquire(index)
+		if missing {
+			c.load(b)
+		} else {
+			<-b.loaded
+		}
+		if b.err != nil {
+			return total, b.err
+		}
+		start := int(offset - index*int64(c.blockSize))
+		if start >= len(b.data) {
+			return total, io.ErrUnexpectedEOF
+		}
+		n := copy(p, b.data[start:])
+		total += n
+		offset += int64(n)
+		p = p[n:]
+	}
+	return total, nil
+}
+
+var _ io.ReaderAt = (*Cache)(nil)
@@ -0,0 +1,129 @@
+package blockcache_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aegistudio/go-winfsp/blockcache"
+)
+
+// countingSource counts the reads hitting the source.
+type countingSource struct {
+	data  []byte
+	reads int64
+	delay time.Duration
+	err   error
+}
+
+func (s *countingSource) ReadAt(p []byte, offset int64) (int, error) {
+	atomic.AddInt64(&s.reads, 1)
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return 0, s.err
+	}
+	n := copy(p, s.data[offset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestReadAt(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	source := &countingSource{data: data}
+	cache, err := blockcache.New(source, int64(len(data)),
+		blockcache.BlockSize(4), blockcache.Capacity(3))
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The read across blocks loads each of them once.
+	buf := make([]byte, 6)
+	n, err := cache.ReadAt(buf, 2)
+	assert.NoError(err)
+	assert.Equal(6, n)
+	assert.Equal("cdefgh", string(buf))
+	assert.Equal(int64(2), source.reads)
+	n, err = cache.ReadAt(buf, 2)
+	assert.NoError(err)
+	assert.Equal(6, n)
+	assert.Equal(int64(2), source.reads)
+
+	// The tail of the source is a partial block.
+	n, err = cache.ReadAt(buf, 24)
+	assert.Equal(io.EOF, err)
+	assert.Equal(2, n)
+	assert.Equal("yz", string(buf[:n]))
+	assert.Equal(blockcache.Stats{
+		Hits: 2, Misses: 3, Blocks: 3,
+	}, cache.Stats())
+
+	// The least recently used block is evicted.
+	_, err = cache.ReadAt(buf[:1], 12)
+	assert.NoError(err)
+	stats := cache.Stats()
+	assert.Equal(int64(1), stats.Evictions)
+	assert.Equal(3, stats.Blocks)
+	_, err = cache.ReadAt(buf[:1], 0)
+	assert.NoError(err)
+	assert.Equal(int64(5), source.reads)
+
+	cache.Invalidate()
+	assert.Equal(0, cache.Stats().Blocks)
+	_, err = cache.ReadAt(buf[:1], 0)
+	assert.NoError(err)
+	assert.Equal(int64(6), source.reads)
+}
+
+func TestConcurrentMiss(t *testing.T) {
+	assert := assert.New(t)
+	data := bytes.Repeat([]byte{'x'}, 16)
+	source := &countingSource{data: data, delay: 10 * time.Millisecond}
+	cache, err := blockcache.New(source, int64(len(data)),
+		blockcache.BlockSize(16))
+	if !assert.NoError(err) {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 16)
+			n, err := cache.ReadAt(buf, 0)
+			assert.NoError(err)
+			assert.Equal(16, n)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int64(1), source.reads)
+}
+
+func TestSourceError(t *testing.T) {
+	assert := assert.New(t)
+	errBroken := errors.New("broken")
+	source := &countingSource{data: make([]byte, 8), err: errBroken}
+	cache, err := blockcache.New(source, 8, blockcache.BlockSize(4))
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = cache.ReadAt(make([]byte, 4), 0)
+	assert.Equal(errBroken, err)
+
+	// The failure is not cached and is retried.
+	source.err = nil
+	_, err = cache.ReadAt(make([]byte, 4), 0)
+	assert.NoError(err)
+	assert.Equal(int64(2), source.reads)
+
+	_, err = blockcache.New(source, 8, blockcache.BlockSize(0))
+	assert.Error(err)
+}
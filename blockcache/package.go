@@ -0,0 +1,8 @@
+// Package blockcache provides an in-memory cache of fixed
+// size blocks in front of a slow io.ReaderAt source, such as
+// a disk image on a network share or an object over HTTP.
+//
+// The blocks are evicted in least recently used order once
+// the capacity is reached, and concurrent reads of the same
+// missing block wait for a single read from the source.
+package blockcache
@@ -0,0 +1,127 @@
+package winfsp
+
+import (
+	"syscall"
+)
+
+// The callbacks taking 64-bit integers on 386, whose cdecl
+// ABI passes each of them in two consecutive stack slots,
+// low word first. The syscall.NewCallbackCDecl refuses the
+// arguments wider than uintptr, so they are received as
+// two uint32s and joined before entering the delegates.
+
+// joinUint64 joins the words of a 64-bit integer argument.
+func joinUint64(lo, hi uint32) uint64 {
+	return uint64(hi)<<32 | uint64(lo)
+}
+
+var go_delegateCreate = syscall.NewCallbackCDecl(func(
+	fileSystem, fileName uintptr,
+	createOptions, grantedAccess, fileAttributes uint32,
+	securityDescriptor uintptr, allocationSizeLo, allocationSizeHi uint32,
+	file *uintptr, fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateCreate(
+		fileSystem, fileName,
+		createOptions, grantedAccess, fileAttributes,
+		securityDescriptor, joinUint64(allocationSizeLo, allocationSizeHi),
+		file, fileInfoAddr,
+	))
+})
+
+var go_delegateOverwrite = syscall.NewCallbackCDecl(func(
+	fileSystem, file uintptr,
+	attributes uint32, replaceAttributes uint8,
+	allocationSizeLo, allocationSizeHi uint32, fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateOverwrite(
+		fileSystem, file,
+		attributes, replaceAttributes,
+		joinUint64(allocationSizeLo, allocationSizeHi), fileInfoAddr,
+	))
+})
+
+var go_delegateOverwriteEx = syscall.NewCallbackCDecl(func(
+	fileSystem, file uintptr,
+	attributes uint32, replaceAttributes uint8,
+	allocationSizeLo, allocationSizeHi uint32,
+	ea uintptr, eaLength uint32, fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateOverwriteEx(
+		fileSystem, file,
+		attributes, replaceAttributes,
+		joinUint64(allocationSizeLo, allocationSizeHi), ea, eaLength,
+		fileInfoAddr,
+	))
+})
+
+var go_delegateRead = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, buffer uintptr,
+	offsetLo, offsetHi uint32, length uint32, bytesRead *uint32,
+) uintptr {
+	return uintptr(delegateRead(
+		fileSystem, fileContext, buffer,
+		joinUint64(offsetLo, offsetHi), length, bytesRead,
+	))
+})
+
+var go_delegateWrite = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, buffer uintptr,
+	offsetLo, offsetHi uint32, length uint32,
+	writeToEndOfFile, constrainedIo uint8,
+	bytesWritten *uint32, fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateWrite(
+		fileSystem, fileContext, buffer,
+		joinUint64(offsetLo, offsetHi), length,
+		writeToEndOfFile, constrainedIo,
+		bytesWritten, fileInfoAddr,
+	))
+})
+
+var go_delegateSetBasicInfo = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext uintptr,
+	attributes uint32,
+	creationTimeLo, creationTimeHi uint32,
+	lastAccessTimeLo, lastAccessTimeHi uint32,
+	lastWriteTimeLo, lastWriteTimeHi uint32,
+	changeTimeLo, changeTimeHi uint32,
+	fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateSetBasicInfo(
+		fileSystem, fileContext, attributes,
+		joinUint64(creationTimeLo, creationTimeHi),
+		joinUint64(lastAccessTimeLo, lastAccessTimeHi),
+		joinUint64(lastWriteTimeLo, lastWriteTimeHi),
+		joinUint64(changeTimeLo, changeTimeHi),
+		fileInfoAddr,
+	))
+})
+
+var go_delegateSetFileSize = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext uintptr,
+	newSizeLo, newSizeHi uint32, setAllocationSize uint8,
+	fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateSetFileSize(
+		fileSystem, fileContext,
+		joinUint64(newSizeLo, newSizeHi), setAllocationSize,
+		fileInfoAddr,
+	))
+})
+
+var go_delegateCreateEx = syscall.NewCallbackCDecl(func(
+	fileSystem, fileName uintptr,
+	createOptions, grantedAccess, fileAttributes uint32,
+	securityDescriptor uintptr, allocationSizeLo, allocationSizeHi uint32,
+	extraBuffer uintptr, extraLength uint32, isReparse uint8,
+	file *uintptr, fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateCreateEx(
+		fileSystem, fileName,
+		createOptions, grantedAccess, fileAttributes,
+		securityDescriptor, joinUint64(allocationSizeLo, allocationSizeHi),
+		extraBuffer, extraLength, isReparse,
+		file, fileInfoAddr,
+	))
+})
@@ -0,0 +1,30 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinUint64(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint64(0x0123456789abcdef),
+		joinUint64(0x89abcdef, 0x01234567))
+	assert.Equal(uint64(0xffffffff), joinUint64(0xffffffff, 0))
+	assert.Equal(uint64(1)<<32, joinUint64(0, 1))
+}
+
+func TestCallbacks386(t *testing.T) {
+	assert := assert.New(t)
+
+	// The callbacks are created at the initialization, which
+	// would have panicked if any argument were too wide.
+	for _, callback := range []uintptr{
+		go_delegateCreate, go_delegateOverwrite,
+		go_delegateOverwriteEx, go_delegateRead,
+		go_delegateWrite, go_delegateSetBasicInfo,
+		go_delegateSetFileSize, go_delegateCreateEx,
+	} {
+		assert.NotZero(callback)
+	}
+}
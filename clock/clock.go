@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Func is the adapter to allow the use of ordinary functions
+// as Clock, e.g. clock.Func(time.Now).
+type Func func() time.Time
+
+func (f Func) Now() time.Time {
+	return f()
+}
+
+// System is the clock of the system, which is used wherever
+// the clock is nil.
+var System Clock = Func(time.Now)
+
+// Now returns the current time of the clock, or the time of
+// the system when the clock is nil.
+func Now(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// Fake is the clock whose time only changes when it is set or
+// advanced explicitly, which is intended for tests.
+type Fake struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+// NewFake creates the fake clock starting at the time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.now
+}
+
+// Set sets the current time of the clock.
+func (f *Fake) Set(now time.Time) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.now = now
+}
+
+// Advance moves the current time of the clock forward.
+func (f *Fake) Advance(d time.Duration) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.now = f.now.Add(d)
+}
+
+var (
+	_ Clock = Func(nil)
+	_ Clock = (*Fake)(nil)
+)
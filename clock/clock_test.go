@@ -0,0 +1,27 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	assert.Equal(start, fake.Now())
+	assert.Equal(start, Now(fake))
+	fake.Advance(time.Minute)
+	assert.Equal(start.Add(time.Minute), fake.Now())
+	fake.Set(start)
+	assert.Equal(start, fake.Now())
+}
+
+func TestSystem(t *testing.T) {
+	assert := assert.New(t)
+	before := time.Now()
+	assert.False(Now(nil).Before(before))
+	assert.False(System.Now().Before(before))
+}
@@ -0,0 +1,5 @@
+// Package clock abstracts the source of the current time, so
+// that the timestamp dependent behaviours, e.g. the default
+// creation time of volumes and the expiry of cache entries,
+// could be driven deterministically in tests.
+package clock
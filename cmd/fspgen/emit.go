@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// typeMapping maps a C type name into its Go type name.
+type typeMapping struct {
+	c, golang string
+}
+
+// parseTypeMappings parses the comma separated list of type
+// names, where each one is either `C` or `C=Go`.
+func parseTypeMappings(list string) []typeMapping {
+	var result []typeMapping
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		mapping := typeMapping{c: item, golang: item}
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			mapping = typeMapping{c: item[:i], golang: item[i+1:]}
+		}
+		result = append(result, mapping)
+	}
+	return result
+}
+
+// parseFieldMappings parses the comma separated list of the
+// field names of the form `T.C=Go`, keyed by `T.C`. An empty
+// Go name marks the field absent from the Go type.
+func parseFieldMappings(list string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			result[item[:i]] = item[i+1:]
+		}
+	}
+	return result
+}
+
+// emitter renders the parsed header into Go source.
+type emitter struct {
+	h     *header
+	buf   bytes.Buffer
+	names map[string]string
+}
+
+func newEmitter(h *header, mappings []typeMapping) *emitter {
+	names := make(map[string]string)
+	for _, mapping := range mappings {
+		names[mapping.c] = mapping.golang
+	}
+	return &emitter{h: h, names: names}
+}
+
+func (e *emitter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&e.buf, format, args...)
+}
+
+// buildConstraint returns the architectures whose pointer size
+// matches the one the layouts are computed with.
+func (e *emitter) buildConstraint() string {
+	if e.h.ptrSize == 4 {
+		return "windows && 386"
+	}
+	return "windows && (amd64 || arm64)"
+}
+
+func (e *emitter) header(pkg, constraint string, imports ...string) {
+	e.printf("// Code generated by fspgen; DO NOT EDIT.\n\n")
+	if constraint != "" {
+		e.printf("//go:build %s\n\n", constraint)
+	}
+	e.printf("package %s\n\n", pkg)
+	for _, path := range imports {
+		e.printf("import %q\n\n", path)
+	}
+}
+
+// goType renders the Go type of the field without its array
+// dimensions, with bitfields rendered as their storage unit.
+func (e *emitter) goType(f *field) (string, error) {
+	if f.inline != nil {
+		if f.inline.union {
+			return fmt.Sprintf("[%d]%s", f.inline.size/f.inline.align,
+				unsignedType(f.inline.align)), nil
+		}
+		var buf strings.Builder
+		buf.WriteString("struct {\n")
+		if err := e.fields(&buf, f.inline); err != nil {
+			return "", err
+		}
+		buf.WriteString("}")
+		return buf.String(), nil
+	}
+	if f.typ == "*" {
+		return "uintptr", nil
+	}
+	if n, ok := e.h.primitive(f.typ); ok {
+		if n == e.h.ptrSize && strings.HasPrefix(f.typ, "P") ||
+			f.typ == "HANDLE" || strings.HasSuffix(f.typ, "_PTR") ||
+			f.typ == "SIZE_T" {
+			return "uintptr", nil
+		}
+		return unsignedType(n), nil
+	}
+	if name, ok := e.names[f.typ]; ok {
+		return name, nil
+	}
+	return "", errors.Errorf(
+		"type %q of field %s is not emitted", f.typ, f.name)
+}
+
+func unsignedType(size int) string {
+	switch size {
+	case 1:
+		return "uint8"
+	case 2:
+		return "uint16"
+	case 4:
+		return "uint32"
+	}
+	return "uint64"
+}
+
+func (e *emitter) fields(buf *strings.Builder, st *structType) error {
+	bitfields := 0
+	for _, f := range st.fields {
+		typ, err := e.goType(f)
+		if err != nil {
+			return err
+		}
+		name := f.name
+		if f.bits != nil {
+			name = fmt.Sprintf("Bitfield%d", bitfields)
+			bitfields++
+		}
+		var dims strings.Builder
+		if f.flex {
+			dims.WriteString("[0]")
+		}
+		for _, n := range f.array {
+			fmt.Fprintf(&dims, "[%d]", n)
+		}
+		fmt.Fprintf(buf, "\t%s %s%s", name, dims.String(), typ)
+		if f.bits != nil {
+			fmt.Fprintf(buf, " // %s", strings.Join(f.bits, ", "))
+		}
+		buf.WriteString("\n")
+	}
+	return nil
+}
+
+// emitConsts renders the macros and enumerators matching
+// the pattern as Go constants.
+func (e *emitter) emitConsts(pattern *regexp.Regexp) {
+	e.printf("const (\n")
+	for _, name := range e.h.order {
+		if !pattern.MatchString(name) {
+			continue
+		}
+		tokens := e.h.macros[name]
+		if len(tokens) == 0 {
+			continue
+		}
+		value, err := e.h.eval(tokens)
+		if err != nil {
+			// Macros like strings or function calls are
+			// not constants to be emitted.
+			continue
+		}
+		if strings.HasPrefix(tokens[0].value, "0x") {
+			e.printf("\t%s = %#x\n", name, value)
+		} else {
+			e.printf("\t%s = %d\n", name, value)
+		}
+	}
+	e.printf(")\n\n")
+	e.printf("const (\n")
+	for _, enum := range e.h.enums {
+		if pattern.MatchString(enum.name) {
+			e.printf("\t%s = %d\n", enum.name, enum.value)
+		}
+	}
+	e.printf(")\n\n")
+}
+
+func (e *emitter) lookup(mapping typeMapping) (*structType, error) {
+	st, ok := e.h.types[mapping.c]
+	if !ok {
+		return nil, errors.Errorf("type %q not found", mapping.c)
+	}
+	if st.err != nil {
+		return nil, errors.Wrapf(st.err, "type %q", mapping.c)
+	}
+	return st, nil
+}
+
+// emitTypes renders the struct definitions.
+func (e *emitter) emitTypes(mappings []typeMapping) error {
+	for _, mapping := range mappings {
+		st, err := e.lookup(mapping)
+		if err != nil {
+			return err
+		}
+		var buf strings.Builder
+		if st.union {
+			fmt.Fprintf(&buf, "[%d]%s", st.size/st.align,
+				unsignedType(st.align))
+			e.printf("type %s %s\n\n", mapping.golang, buf.String())
+			continue
+		}
+		if err := e.fields(&buf, st); err != nil {
+			return errors.Wrapf(err, "type %q", mapping.c)
+		}
+		e.printf("type %s struct {\n%s}\n\n", mapping.golang, buf.String())
+	}
+	return nil
+}
+
+// emitAsserts renders the compile time assertions on the
+// sizes and field offsets of the Go types, so that divergence
+// from the C layout breaks the build. The fields are renamed
+// by the field mappings, since the hand written types do not
+// always follow the names in the headers.
+func (e *emitter) emitAsserts(
+	mappings []typeMapping, fields map[string]string,
+) error {
+	e.printf("var (\n")
+	for _, mapping := range mappings {
+		st, err := e.lookup(mapping)
+		if err != nil {
+			return err
+		}
+		e.printf("\t_ [0]struct{} = [unsafe.Sizeof(%s{}) - %d]struct{}{}\n",
+			mapping.golang, st.size)
+		if st.union {
+			continue
+		}
+		for _, f := range st.fields {
+			if f.bits != nil || f.name == "" {
+				continue
+			}
+			name := f.name
+			if renamed, ok := fields[mapping.c+"."+f.name]; ok {
+				name = renamed
+			}
+			if name == "" {
+				continue
+			}
+			e.printf("\t_ [0]struct{} = "+
+				"[unsafe.Offsetof(%s{}.%s) - %d]struct{}{}\n",
+				mapping.golang, name, f.offset)
+		}
+	}
+	e.printf(")\n")
+	return nil
+}
+
+func (e *emitter) source() ([]byte, error) {
+	result, err := format.Source(e.buf.Bytes())
+	return result, errors.Wrap(err, "format source")
+}
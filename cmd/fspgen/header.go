@@ -0,0 +1,678 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// token is a lexical token of the C header.
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+type tokenKind int
+
+const (
+	tokenIdent = tokenKind(iota)
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+// header is the collection of definitions parsed from the
+// C headers, in the order they are defined.
+type header struct {
+	ptrSize int
+	macros  map[string][]token
+	order   []string
+	types   map[string]*structType
+	enums   []*enumConst
+	asserts []*staticAssert
+}
+
+// field is a member of a struct or union.
+type field struct {
+	name   string
+	typ    string
+	inline *structType
+	array  []int
+	flex   bool
+	bits   []string
+	size   int
+	align  int
+	offset int
+}
+
+type structType struct {
+	name   string
+	union  bool
+	fields []*field
+	size   int
+	align  int
+
+	// err is the reason why the layout cannot be computed,
+	// which is only fatal when the type is requested.
+	err error
+}
+
+type enumConst struct {
+	name  string
+	value int64
+}
+
+type staticAssert struct {
+	typ  string
+	size int
+}
+
+func newHeader(ptrSize int) *header {
+	return &header{
+		ptrSize: ptrSize,
+		macros:  make(map[string][]token),
+		types:   make(map[string]*structType),
+	}
+}
+
+var (
+	continuationRegexp = regexp.MustCompile(`\\\r?\n`)
+	blockCommentRegexp = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	lineCommentRegexp  = regexp.MustCompile(`//[^\n]*`)
+	defineRegexp       = regexp.MustCompile(
+		`^#\s*define\s+([A-Za-z_]\w*)(\()?(.*)$`)
+)
+
+// preprocess strips the comments and collects the object-like
+// macros, returning the remaining code without directives.
+func (h *header) preprocess(source string) (string, error) {
+	source = continuationRegexp.ReplaceAllString(source, " ")
+	source = blockCommentRegexp.ReplaceAllString(source, " ")
+	source = lineCommentRegexp.ReplaceAllString(source, "")
+	var code strings.Builder
+	for _, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "#") {
+			code.WriteString(line)
+			code.WriteString("\n")
+			continue
+		}
+		match := defineRegexp.FindStringSubmatch(trimmed)
+		if match == nil || match[2] != "" {
+			// Other directives and function-like macros are
+			// irrelevant to the layouts, so we skip them.
+			continue
+		}
+		if _, ok := h.macros[match[1]]; ok {
+			continue
+		}
+		tokens, err := tokenize(match[3])
+		if err != nil {
+			return "", errors.Wrapf(err, "macro %s", match[1])
+		}
+		h.macros[match[1]] = tokens
+		h.order = append(h.order, match[1])
+	}
+	return code.String(), nil
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(!first && c >= '0' && c <= '9')
+}
+
+func tokenize(source string) ([]token, error) {
+	var result []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == 'L' && i+1 < len(source) && source[i+1] == '"',
+			c == '"':
+			start := i + 1
+			if c == 'L' {
+				start++
+			}
+			j := strings.IndexByte(source[start:], '"')
+			if j < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			end := start + j + 1
+			result = append(result, token{tokenString, source[i:end]})
+			i = end
+		case isIdentByte(c, true):
+			j := i + 1
+			for j < len(source) && isIdentByte(source[j], false) {
+				j++
+			}
+			result = append(result, token{tokenIdent, source[i:j]})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(source) && isIdentByte(source[j], false) {
+				j++
+			}
+			result = append(result, token{tokenNumber, source[i:j]})
+			i = j
+		default:
+			punct := string(c)
+			if i+1 < len(source) {
+				switch two := source[i : i+2]; two {
+				case "<<", ">>", "==", "!=", "<=", ">=", "&&", "||":
+					punct = two
+				}
+			}
+			result = append(result, token{tokenPunct, punct})
+			i += len(punct)
+		}
+	}
+	return result, nil
+}
+
+// expand substitutes the object-like macros in the tokens.
+func (h *header) expand(tokens []token, depth int) []token {
+	if depth > 16 {
+		return tokens
+	}
+	var result []token
+	for _, tok := range tokens {
+		body, ok := h.macros[tok.value]
+		if tok.kind == tokenIdent && ok {
+			result = append(result, h.expand(body, depth+1)...)
+			continue
+		}
+		result = append(result, tok)
+	}
+	return result
+}
+
+// parser walks through the tokens of the header.
+type parser struct {
+	h      *header
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return token{tokenPunct, ""}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.peek(0)
+	p.pos++
+	return tok
+}
+
+func (p *parser) expect(value string) error {
+	if tok := p.next(); tok.value != value {
+		return errors.Errorf("expect %q but got %q", value, tok.value)
+	}
+	return nil
+}
+
+// parse collects the structs, enums and static assertions
+// from the preprocessed code.
+func (h *header) parse(code string) error {
+	tokens, err := tokenize(code)
+	if err != nil {
+		return err
+	}
+	p := &parser{h: h, tokens: h.expand(tokens, 0)}
+	for p.pos < len(p.tokens) {
+		switch tok := p.peek(0); {
+		case tok.value == "typedef" &&
+			(p.peek(1).value == "struct" || p.peek(1).value == "union") &&
+			(p.peek(2).value == "{" || p.peek(3).value == "{"):
+			// The forward declarations are skipped as others.
+			p.next()
+			if err := p.parseTypedef(); err != nil {
+				return err
+			}
+		case tok.value == "enum" && p.peek(1).value == "{":
+			p.pos += 2
+			if err := p.parseEnum(); err != nil {
+				return err
+			}
+		case tok.value == "FSP_FSCTL_STATIC_ASSERT":
+			p.next()
+			p.parseStaticAssert()
+		default:
+			p.next()
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseTypedef() error {
+	st, err := p.parseStruct()
+	if err != nil {
+		return err
+	}
+	name := p.next()
+	if name.kind != tokenIdent {
+		return errors.Errorf("unexpected typedef name %q", name.value)
+	}
+	// Skip the pointer typedefs following the name.
+	for p.pos < len(p.tokens) && p.peek(0).value != ";" {
+		p.next()
+	}
+	p.next()
+	if _, ok := p.h.types[name.value]; ok {
+		return nil
+	}
+	st.name = name.value
+	p.h.types[name.value] = st
+	return nil
+}
+
+// parseStruct parses the struct or union starting from the
+// keyword, and computes its layout.
+func (p *parser) parseStruct() (*structType, error) {
+	st := &structType{union: p.next().value == "union"}
+	if p.peek(0).kind == tokenIdent {
+		p.next() // tag name
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.peek(0).value != "}" {
+		if p.pos >= len(p.tokens) {
+			return nil, errors.New("unterminated struct")
+		}
+		fields, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+		st.fields = append(st.fields, fields...)
+	}
+	p.next()
+	st.err = p.h.layout(st)
+	return st, nil
+}
+
+var ignoredQualifiers = map[string]bool{
+	"const": true, "volatile": true, "struct": true,
+}
+
+func (p *parser) parseMember() ([]*field, error) {
+	var inline *structType
+	var typ string
+	if v := p.peek(0).value; (v == "struct" || v == "union") &&
+		(p.peek(1).value == "{" || p.peek(2).value == "{") {
+		var err error
+		if inline, err = p.parseStruct(); err != nil {
+			return nil, err
+		}
+	} else {
+		for ignoredQualifiers[p.peek(0).value] {
+			p.next()
+		}
+		typ = p.next().value
+	}
+	if p.peek(0).value == "(" && p.peek(1).value == "*" {
+		// Function pointer members, whose parameters are skipped.
+		p.pos += 2
+		f := &field{typ: "*", name: p.next().value}
+		if err := p.parseArray(f); err != nil {
+			return nil, err
+		}
+		for depth := 1; depth > 0 || p.peek(0).value != ";"; {
+			switch p.next().value {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			case "":
+				return nil, errors.New("unterminated function pointer")
+			}
+		}
+		p.next()
+		return []*field{f}, nil
+	}
+	var result []*field
+	for {
+		f := &field{typ: typ, inline: inline}
+		for p.peek(0).value == "*" {
+			p.next()
+			f.typ = "*"
+		}
+		if p.peek(0).kind == tokenIdent {
+			f.name = p.next().value
+		}
+		if err := p.parseArray(f); err != nil {
+			return nil, err
+		}
+		if p.peek(0).value == ":" {
+			p.next()
+			width := p.next()
+			f.bits = []string{f.name + ":" + width.value}
+		}
+		result = append(result, f)
+		if p.peek(0).value != "," {
+			break
+		}
+		p.next()
+	}
+	return result, p.expect(";")
+}
+
+// parseArray parses the array dimensions of the field.
+func (p *parser) parseArray(f *field) error {
+	for p.peek(0).value == "[" {
+		p.next()
+		if p.peek(0).value == "]" {
+			p.next()
+			f.flex = true
+			continue
+		}
+		start := p.pos
+		for p.peek(0).value != "]" {
+			if p.pos >= len(p.tokens) {
+				return errors.Errorf("unterminated array of %s", f.name)
+			}
+			p.next()
+		}
+		n, err := p.h.eval(p.tokens[start:p.pos])
+		if err != nil {
+			return errors.Wrapf(err, "array size of %s", f.name)
+		}
+		f.array = append(f.array, int(n))
+		p.next()
+	}
+	return nil
+}
+
+func (p *parser) parseEnum() error {
+	var value int64
+	for p.peek(0).value != "}" {
+		name := p.next()
+		if name.kind != tokenIdent {
+			return errors.Errorf("unexpected enum name %q", name.value)
+		}
+		if p.peek(0).value == "=" {
+			p.next()
+			start := p.pos
+			for p.peek(0).value != "," && p.peek(0).value != "}" {
+				p.next()
+			}
+			var err error
+			if value, err = p.h.eval(p.tokens[start:p.pos]); err != nil {
+				return errors.Wrapf(err, "enum %s", name.value)
+			}
+		}
+		p.h.enums = append(p.h.enums, &enumConst{name.value, value})
+		value++
+		if p.peek(0).value == "," {
+			p.next()
+		}
+	}
+	p.next()
+	return nil
+}
+
+// parseStaticAssert recognizes the assertions of the form
+// `N == sizeof(T)` or `sizeof(T) == N`, ignoring others.
+func (p *parser) parseStaticAssert() {
+	if p.peek(0).value != "(" {
+		return
+	}
+	p.next()
+	start := p.pos
+	for p.peek(0).value != "," && p.pos < len(p.tokens) {
+		p.next()
+	}
+	expr := p.tokens[start:p.pos]
+	var typ string
+	var size int64
+	var err error
+	switch {
+	case len(expr) >= 6 && expr[1].value == "==" &&
+		expr[2].value == "sizeof":
+		typ = expr[4].value
+		size, err = p.h.eval(expr[:1])
+	case len(expr) >= 6 && expr[0].value == "sizeof" &&
+		expr[4].value == "==":
+		typ = expr[2].value
+		size, err = p.h.eval(expr[5:])
+	default:
+		return
+	}
+	if err == nil {
+		p.h.asserts = append(p.h.asserts, &staticAssert{typ, int(size)})
+	}
+}
+
+// check verifies the computed layouts against the static
+// assertions inside the headers.
+func (h *header) check() error {
+	for _, assert := range h.asserts {
+		if st, ok := h.types[assert.typ]; ok && st.err == nil &&
+			st.size != assert.size {
+			return errors.Errorf("layout of %q is %d bytes, but %d "+
+				"is asserted by header", assert.typ, st.size, assert.size)
+		}
+	}
+	return nil
+}
+
+// primitive returns the size of the primitive C types.
+func (h *header) primitive(typ string) (int, bool) {
+	switch typ {
+	case "UINT8", "INT8", "BOOLEAN", "UCHAR", "CHAR", "BYTE":
+		return 1, true
+	case "UINT16", "INT16", "USHORT", "SHORT", "WCHAR":
+		return 2, true
+	case "UINT32", "INT32", "ULONG", "LONG", "DWORD", "NTSTATUS", "BOOL":
+		return 4, true
+	case "UINT64", "INT64", "ULONGLONG", "LONGLONG":
+		return 8, true
+	case "*", "PVOID", "HANDLE", "SIZE_T", "ULONG_PTR", "UINT_PTR",
+		"PWSTR", "PSECURITY_DESCRIPTOR":
+		return h.ptrSize, true
+	}
+	return 0, false
+}
+
+// layout computes the offsets of the fields, and the size
+// and alignment of the struct, imitating the MSVC rules.
+func (h *header) layout(st *structType) error {
+	st.align = 1
+	offset, bitsUsed := 0, 0
+	var bitfield *field
+	var fields []*field
+	for _, f := range st.fields {
+		size, align := 0, 0
+		if f.inline != nil {
+			if f.inline.err != nil {
+				return f.inline.err
+			}
+			size, align = f.inline.size, f.inline.align
+		} else if n, ok := h.primitive(f.typ); ok {
+			size, align = n, n
+		} else if ref, ok := h.types[f.typ]; ok && ref.err == nil {
+			size, align = ref.size, ref.align
+		} else {
+			return errors.Errorf("unknown type %q of field %s",
+				f.typ, f.name)
+		}
+		f.align = align
+		if f.bits != nil {
+			width, _ := strconv.Atoi(strings.SplitN(f.bits[0], ":", 2)[1])
+			if bitfield != nil && bitfield.size == size &&
+				bitsUsed+width <= 8*size {
+				bitfield.bits = append(bitfield.bits, f.bits...)
+				bitsUsed += width
+				continue
+			}
+			bitfield, bitsUsed = f, width
+		} else {
+			bitfield = nil
+		}
+		for _, n := range f.array {
+			size *= n
+		}
+		if f.flex {
+			size = 0
+		}
+		f.size = size
+		if align > st.align {
+			st.align = align
+		}
+		if st.union {
+			f.offset = 0
+			if size > st.size {
+				st.size = size
+			}
+		} else {
+			offset = (offset + align - 1) / align * align
+			f.offset = offset
+			offset += size
+			st.size = offset
+		}
+		fields = append(fields, f)
+	}
+	st.fields = fields
+	st.size = (st.size + st.align - 1) / st.align * st.align
+	return nil
+}
+
+// eval evaluates the integer constant expression.
+func (h *header) eval(tokens []token) (int64, error) {
+	e := &evaluator{h: h, tokens: h.expand(tokens, 0)}
+	value, err := e.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	if e.pos != len(e.tokens) {
+		return 0, errors.Errorf("trailing token %q", e.tokens[e.pos].value)
+	}
+	return value, nil
+}
+
+type evaluator struct {
+	h      *header
+	tokens []token
+	pos    int
+}
+
+var binaryPrecedence = map[string]int{
+	"|": 1, "^": 2, "&": 3, "<<": 4, ">>": 4,
+	"+": 5, "-": 5, "*": 6, "/": 6, "%": 6,
+}
+
+func (e *evaluator) peek() string {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos].value
+	}
+	return ""
+}
+
+func (e *evaluator) binary(minPrecedence int) (int64, error) {
+	lhs, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := e.peek()
+		precedence, ok := binaryPrecedence[op]
+		if !ok || precedence <= minPrecedence {
+			return lhs, nil
+		}
+		e.pos++
+		rhs, err := e.binary(precedence)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "|":
+			lhs |= rhs
+		case "^":
+			lhs ^= rhs
+		case "&":
+			lhs &= rhs
+		case "<<":
+			lhs <<= uint(rhs)
+		case ">>":
+			lhs >>= uint(rhs)
+		case "+":
+			lhs += rhs
+		case "-":
+			lhs -= rhs
+		case "*":
+			lhs *= rhs
+		case "/", "%":
+			if rhs == 0 {
+				return 0, errors.New("division by zero")
+			}
+			if op == "/" {
+				lhs /= rhs
+			} else {
+				lhs %= rhs
+			}
+		}
+	}
+}
+
+func (e *evaluator) unary() (int64, error) {
+	if e.pos >= len(e.tokens) {
+		return 0, errors.New("unexpected end of expression")
+	}
+	tok := e.tokens[e.pos]
+	e.pos++
+	switch {
+	case tok.value == "-":
+		value, err := e.unary()
+		return -value, err
+	case tok.value == "~":
+		value, err := e.unary()
+		return ^value, err
+	case tok.value == "sizeof":
+		if e.peek() != "(" || e.pos+2 >= len(e.tokens) {
+			return 0, errors.New("malformed sizeof")
+		}
+		typ := e.tokens[e.pos+1].value
+		e.pos += 3
+		if n, ok := e.h.primitive(typ); ok {
+			return int64(n), nil
+		}
+		if st, ok := e.h.types[typ]; ok {
+			return int64(st.size), nil
+		}
+		return 0, errors.Errorf("sizeof unknown type %q", typ)
+	case tok.value == "(":
+		// Casts to primitive types are simply dropped.
+		if _, ok := e.h.primitive(e.peek()); ok &&
+			e.pos+1 < len(e.tokens) && e.tokens[e.pos+1].value == ")" {
+			e.pos += 2
+			return e.unary()
+		}
+		value, err := e.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		if e.peek() != ")" {
+			return 0, errors.New("unbalanced parenthesis")
+		}
+		e.pos++
+		return value, nil
+	case tok.kind == tokenNumber:
+		return parseNumber(tok.value)
+	}
+	return 0, errors.Errorf("unexpected token %q", tok.value)
+}
+
+func parseNumber(value string) (int64, error) {
+	value = strings.TrimRight(value, "uUlL")
+	result, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return int64(result), nil
+}
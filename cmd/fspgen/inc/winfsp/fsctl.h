@@ -0,0 +1,184 @@
+/**
+ * @file winfsp/fsctl.h
+ *
+ * Excerpt of the WinFSP 2.0 header, limited to the declarations
+ * transcribed by the winfsp package. Replace it with the header
+ * of a new release and run go generate to track the release.
+ */
+
+#ifndef WINFSP_FSCTL_H_INCLUDED
+#define WINFSP_FSCTL_H_INCLUDED
+
+#define FSP_FSCTL_STATIC_ASSERT(e,m)    static_assert(e,m)
+
+#define FSP_FSCTL_DEFAULT_ALIGNMENT     8
+
+#define FSP_FSCTL_VOLUME_NAME_SIZE      (64 * sizeof(WCHAR))
+#define FSP_FSCTL_VOLUME_PREFIX_SIZE    (192 * sizeof(WCHAR))
+#define FSP_FSCTL_VOLUME_FSNAME_SIZE    (16 * sizeof(WCHAR))
+#define FSP_FSCTL_VOLUME_NAME_SIZEMAX   (FSP_FSCTL_VOLUME_NAME_SIZE + FSP_FSCTL_VOLUME_PREFIX_SIZE)
+
+enum
+{
+    FspFsctlTransactReservedKind = 0,
+    FspFsctlTransactCreateKind,
+    FspFsctlTransactOverwriteKind,
+    FspFsctlTransactCleanupKind,
+    FspFsctlTransactCloseKind,
+    FspFsctlTransactReadKind,
+    FspFsctlTransactWriteKind,
+    FspFsctlTransactQueryInformationKind,
+    FspFsctlTransactSetInformationKind,
+    FspFsctlTransactQueryEaKind,
+    FspFsctlTransactSetEaKind,
+    FspFsctlTransactFlushBuffersKind,
+    FspFsctlTransactQueryVolumeInformationKind,
+    FspFsctlTransactSetVolumeInformationKind,
+    FspFsctlTransactQueryDirectoryKind,
+    FspFsctlTransactFileSystemControlKind,
+    FspFsctlTransactDeviceControlKind,
+    FspFsctlTransactShutdownKind,
+    FspFsctlTransactLockControlKind,
+    FspFsctlTransactQuerySecurityKind,
+    FspFsctlTransactSetSecurityKind,
+    FspFsctlTransactQueryStreamInformationKind,
+    FspFsctlTransactKindCount,
+};
+
+#define FSP_FSCTL_VOLUME_PARAMS_V0_FIELD_DEFN\
+    UINT16 Version;                     /* set to 0 or sizeof(FSP_FSCTL_VOLUME_PARAMS) */\
+    /* volume information */\
+    UINT16 SectorSize;\
+    UINT16 SectorsPerAllocationUnit;\
+    UINT16 MaxComponentLength;          /* maximum file name component length (bytes) */\
+    UINT64 VolumeCreationTime;\
+    UINT32 VolumeSerialNumber;\
+    /* I/O timeouts, capacity, etc. */\
+    UINT32 TransactTimeout;             /* DEPRECATED: (millis; 1 sec - 10 sec) */\
+    UINT32 IrpTimeout;                  /* DEPRECATED: (millis; 1 min - 10 min) */\
+    UINT32 IrpCapacity;                 /* DEPRECATED: maximum number of pending IRP's (100 - 1000)*/\
+    UINT32 FileInfoTimeout;             /* FileInfo/Security/VolumeInfo timeout (millis) */\
+    /* FILE_FS_ATTRIBUTE_INFORMATION::FileSystemAttributes */\
+    UINT32 CaseSensitiveSearch:1;       /* file system supports case-sensitive file names */\
+    UINT32 CasePreservedNames:1;        /* file system preserves the case of file names */\
+    UINT32 UnicodeOnDisk:1;             /* file system supports Unicode in file names */\
+    UINT32 PersistentAcls:1;            /* file system preserves and enforces access control lists */\
+    UINT32 ReparsePoints:1;             /* file system supports reparse points */\
+    UINT32 ReparsePointsAccessCheck:1;  /* file system performs reparse point access checks */\
+    UINT32 NamedStreams:1;              /* file system supports named streams */\
+    UINT32 HardLinks:1;                 /* unimplemented; set to 0 */\
+    UINT32 ExtendedAttributes:1;        /* file system supports extended attributes */\
+    UINT32 ReadOnlyVolume:1;\
+    /* kernel-mode flags */\
+    UINT32 PostCleanupWhenModifiedOnly:1;   /* post Cleanup when a file was modified/deleted */\
+    UINT32 PassQueryDirectoryPattern:1;     /* pass Pattern during QueryDirectory operations */\
+    UINT32 AlwaysUseDoubleBuffering:1;\
+    UINT32 PassQueryDirectoryFileName:1;    /* pass FileName during QueryDirectory (GetDirInfoByName) */\
+    UINT32 FlushAndPurgeOnCleanup:1;        /* keeps file off "standby" list */\
+    UINT32 DeviceControl:1;                 /* support user-mode ioctl handling */\
+    /* user-mode flags */\
+    UINT32 UmFileContextIsUserContext2:1;   /* user mode: FileContext parameter is UserContext2 */\
+    UINT32 UmFileContextIsFullContext:1;    /* user mode: FileContext parameter is FullContext */\
+    UINT32 UmNoReparsePointsDirCheck:1;     /* user mode: no reparse points on directories */\
+    UINT32 UmReservedFlags:5;\
+    /* additional kernel-mode flags */\
+    UINT32 AllowOpenInKernelMode:1;         /* allow kernel mode to open files when possible */\
+    UINT32 CasePreservedExtendedAttributes:1;   /* preserve case of EA (default is UPPERCASE) */\
+    UINT32 WslFeatures:1;                   /* support features required for WSLinux */\
+    UINT32 DirectoryMarkerAsNextOffset:1;   /* directory marker is next offset instead of last name */\
+    UINT32 RejectIrpPriorToTransact0:1;     /* reject IRP's prior to FspFsctlTransact with 0 buffers */\
+    UINT32 SupportsPosixUnlinkRename:1;     /* file system supports POSIX-style unlink and rename */\
+    UINT32 PostDispositionWhenNecessaryOnly:1;  /* post Disposition for dirs or READONLY attr check */\
+    UINT32 KmReservedFlags:1;\
+    WCHAR Prefix[FSP_FSCTL_VOLUME_PREFIX_SIZE / sizeof(WCHAR)]; /* UNC prefix (\Server\Share) */\
+    WCHAR FileSystemName[FSP_FSCTL_VOLUME_FSNAME_SIZE / sizeof(WCHAR)];
+#define FSP_FSCTL_VOLUME_PARAMS_V1_FIELD_DEFN\
+    /* additional fields; specify .Version == sizeof(FSP_FSCTL_VOLUME_PARAMS) */\
+    UINT32 VolumeInfoTimeoutValid:1;    /* VolumeInfoTimeout field is valid */\
+    UINT32 DirInfoTimeoutValid:1;       /* DirInfoTimeout field is valid */\
+    UINT32 SecurityTimeoutValid:1;      /* SecurityTimeout field is valid*/\
+    UINT32 StreamInfoTimeoutValid:1;    /* StreamInfoTimeout field is valid */\
+    UINT32 EaTimeoutValid:1;            /* EaTimeout field is valid */\
+    UINT32 KmAdditionalReservedFlags:27;\
+    UINT32 VolumeInfoTimeout;           /* volume info timeout (millis); overrides FileInfoTimeout */\
+    UINT32 DirInfoTimeout;              /* dir info timeout (millis); overrides FileInfoTimeout */\
+    UINT32 SecurityTimeout;             /* security info timeout (millis); overrides FileInfoTimeout */\
+    UINT32 StreamInfoTimeout;           /* stream info timeout (millis); overrides FileInfoTimeout */\
+    UINT32 EaTimeout;                   /* EA timeout (millis); overrides FileInfoTimeout */\
+    UINT32 FsextControlCode;\
+    UINT32 Reserved32[1];\
+    UINT64 Reserved64[2];
+typedef struct
+{
+    FSP_FSCTL_VOLUME_PARAMS_V0_FIELD_DEFN
+} FSP_FSCTL_VOLUME_PARAMS_V0;
+FSP_FSCTL_STATIC_ASSERT(456 == sizeof(FSP_FSCTL_VOLUME_PARAMS_V0),
+    "sizeof(FSP_FSCTL_VOLUME_PARAMS_V0) must be exactly 456.");
+typedef struct
+{
+    FSP_FSCTL_VOLUME_PARAMS_V0_FIELD_DEFN
+    FSP_FSCTL_VOLUME_PARAMS_V1_FIELD_DEFN
+} FSP_FSCTL_VOLUME_PARAMS;
+FSP_FSCTL_STATIC_ASSERT(504 == sizeof(FSP_FSCTL_VOLUME_PARAMS),
+    "sizeof(FSP_FSCTL_VOLUME_PARAMS) is currently 504. "
+    "Update this assertion check if it changes.");
+typedef struct
+{
+    UINT64 TotalSize;
+    UINT64 FreeSize;
+    UINT16 VolumeLabelLength;
+    WCHAR VolumeLabel[32];
+} FSP_FSCTL_VOLUME_INFO;
+typedef struct
+{
+    UINT32 FileAttributes;
+    UINT32 ReparseTag;
+    UINT64 AllocationSize;
+    UINT64 FileSize;
+    UINT64 CreationTime;
+    UINT64 LastAccessTime;
+    UINT64 LastWriteTime;
+    UINT64 ChangeTime;
+    UINT64 IndexNumber;
+    UINT32 HardLinks;                   /* unimplemented: set to 0 */
+    UINT32 EaSize;
+} FSP_FSCTL_FILE_INFO;
+typedef struct
+{
+    FSP_FSCTL_FILE_INFO FileInfo;
+    PWSTR NormalizedName;
+    UINT16 NormalizedNameSize;
+} FSP_FSCTL_OPEN_FILE_INFO;
+typedef struct
+{
+    UINT16 Size;
+    FSP_FSCTL_FILE_INFO FileInfo;
+    union
+    {
+        UINT64 NextOffset;
+        UINT8 Padding[24];
+            /* make struct as big as FILE_ID_BOTH_DIR_INFORMATION; allows for in-place copying */
+    } DUMMYUNIONNAME;
+    WCHAR FileNameBuf[];
+} FSP_FSCTL_DIR_INFO;
+typedef struct
+{
+    UINT16 Size;
+    UINT64 StreamSize;
+    UINT64 StreamAllocationSize;
+    WCHAR StreamNameBuf[];
+} FSP_FSCTL_STREAM_INFO;
+typedef struct
+{
+    UINT16 Size;
+    UINT32 Filter;
+    UINT32 Action;
+    WCHAR FileNameBuf[];
+} FSP_FSCTL_NOTIFY_INFO;
+typedef struct
+{
+    UINT16 Offset;
+    UINT16 Size;
+} FSP_FSCTL_TRANSACT_BUF;
+
+#endif
@@ -0,0 +1,131 @@
+// Command fspgen parses the headers of WinFSP and emits the Go
+// constants and struct layouts of the winfsp package, so that
+// tracking a new release of WinFSP becomes mechanical.
+//
+// The layouts are computed with the rules of MSVC, and checked
+// against the static assertions inside the headers. Besides the
+// definitions, the compile time assertions on the sizes and
+// field offsets of the Go types can be emitted with -assert,
+// which is also useful for checking the hand written types:
+//
+//	go run ./cmd/fspgen -I "C:\Program Files (x86)\WinFsp\inc" \
+//		-o zconst_windows.go
+//	go run ./cmd/fspgen -I "C:\Program Files (x86)\WinFsp\inc" \
+//		-assert -o zlayout_windows.go
+//
+// The assertions of the winfsp package are generated from the
+// snapshot of the headers in the inc directory, by running go
+// generate in the root of the module, and the snapshot should
+// be replaced by the headers of the new release to track it.
+//
+// Bitfields are collapsed into their storage units, and unions
+// are emitted as arrays of their alignment units, since Go has
+// no counterparts of them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTypes are the types transcribed by the winfsp package.
+const defaultTypes = "FSP_FSCTL_VOLUME_INFO," +
+	"FSP_FSCTL_VOLUME_PARAMS_V0," +
+	"FSP_FSCTL_VOLUME_PARAMS=FSP_FSCTL_VOLUME_PARAMS_V1," +
+	"FSP_FSCTL_FILE_INFO,FSP_FSCTL_OPEN_FILE_INFO," +
+	"FSP_FSCTL_DIR_INFO,FSP_FSCTL_STREAM_INFO," +
+	"FSP_FSCTL_NOTIFY_INFO,FSP_FSCTL_TRANSACT_BUF," +
+	"FSP_FILE_SYSTEM_INTERFACE,FSP_FILE_SYSTEM_OPERATION_CONTEXT"
+
+// defaultFields are the fields of the transcribed types whose
+// names differ from the headers, or which are left out.
+const defaultFields = "FSP_FSCTL_VOLUME_PARAMS_V0.Version=Zero," +
+	"FSP_FSCTL_VOLUME_PARAMS.Version=SizeOfVolumeParamsV1," +
+	"FSP_FSCTL_DIR_INFO.DUMMYUNIONNAME=NextOffset," +
+	"FSP_FSCTL_DIR_INFO.FileNameBuf=," +
+	"FSP_FSCTL_STREAM_INFO.StreamNameBuf=," +
+	"FSP_FSCTL_NOTIFY_INFO.FileNameBuf="
+
+var (
+	includeDir = flag.String("I",
+		`C:\Program Files (x86)\WinFsp\inc`, "WinFSP include directory")
+	headers = flag.String("headers",
+		"winfsp/fsctl.h,winfsp/winfsp.h", "headers to parse, in order")
+	pkg    = flag.String("package", "winfsp", "package name")
+	output = flag.String("o", "", "output file, or stdout if empty")
+	types  = flag.String("types", defaultTypes, "types to emit")
+	consts = flag.String("consts", `^FSP_FSCTL_\w+_SIZE(MAX)?$|`+
+		`^FspFsctlTransact\w+Kind$`, "pattern of constants to emit")
+	fields = flag.String("fields", defaultFields,
+		"Go names of the fields in the assertions")
+	assertOnly = flag.Bool("assert", false, "emit layout assertions only")
+	ptrSize    = flag.Int("ptrsize", 8, "pointer size of the target")
+)
+
+func run() error {
+	pattern, err := regexp.Compile(*consts)
+	if err != nil {
+		return errors.Wrap(err, "compile constant pattern")
+	}
+	if *ptrSize != 4 && *ptrSize != 8 {
+		return errors.Errorf("invalid pointer size %d", *ptrSize)
+	}
+	h := newHeader(*ptrSize)
+	var code []string
+	for _, name := range strings.Split(*headers, ",") {
+		name = strings.TrimSpace(name)
+		data, err := os.ReadFile(filepath.Join(*includeDir, name))
+		if err != nil {
+			return errors.Wrapf(err, "read header %q", name)
+		}
+		preprocessed, err := h.preprocess(string(data))
+		if err != nil {
+			return errors.Wrapf(err, "preprocess header %q", name)
+		}
+		code = append(code, preprocessed)
+	}
+	for i, preprocessed := range code {
+		if err := h.parse(preprocessed); err != nil {
+			return errors.Wrapf(err, "parse header #%d", i)
+		}
+	}
+	if err := h.check(); err != nil {
+		return err
+	}
+	mappings := parseTypeMappings(*types)
+	e := newEmitter(h, mappings)
+	if *assertOnly {
+		e.header(*pkg, e.buildConstraint(), "unsafe")
+		err = e.emitAsserts(mappings, parseFieldMappings(*fields))
+	} else {
+		e.header(*pkg, "")
+		e.emitConsts(pattern)
+		err = e.emitTypes(mappings)
+	}
+	if err != nil {
+		return err
+	}
+	source, err := e.source()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return os.WriteFile(*output, source, 0644)
+}
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "fspgen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testHeader is an excerpt imitating the style of fsctl.h.
+const testHeader = `
+#ifndef WINFSP_FSCTL_H_INCLUDED
+#define WINFSP_FSCTL_H_INCLUDED
+#define FSP_FSCTL_STATIC_ASSERT(e,m)    static_assert(e,m)
+
+#define FSP_FSCTL_VOLUME_PREFIX_SIZE    (192 * sizeof(WCHAR))
+#define FSP_FSCTL_VOLUME_FSNAME_SIZE    (16 * sizeof(WCHAR))
+#define FSP_FSCTL_TRANSACT_REQ_SIZEMAX  (4096 - 64) /* 64: size for internal use */
+
+enum
+{
+    FspFsctlTransactReservedKind = 0,
+    FspFsctlTransactCreateKind,
+    FspFsctlTransactOverwriteKind,
+};
+
+#define FSP_FSCTL_VOLUME_PARAMS_V0_FIELD_DEFN\
+    UINT16 Version;\
+    UINT16 SectorSize;\
+    UINT64 VolumeCreationTime;\
+    UINT32 CaseSensitiveSearch:1;       /* file system supports case-sensitive file names */\
+    UINT32 CasePreservedNames:1;\
+    UINT32 KmReservedFlags:30;\
+    WCHAR Prefix[FSP_FSCTL_VOLUME_PREFIX_SIZE / sizeof(WCHAR)];\
+    WCHAR FileSystemName[FSP_FSCTL_VOLUME_FSNAME_SIZE / sizeof(WCHAR)];
+typedef struct
+{
+    FSP_FSCTL_VOLUME_PARAMS_V0_FIELD_DEFN
+} FSP_FSCTL_VOLUME_PARAMS_V0;
+FSP_FSCTL_STATIC_ASSERT(440 == sizeof(FSP_FSCTL_VOLUME_PARAMS_V0),
+    "sizeof(FSP_FSCTL_VOLUME_PARAMS_V0) is a fixed size.");
+
+typedef struct
+{
+    UINT16 Size;
+    UINT32 Filter;
+    WCHAR FileNameBuf[];
+} FSP_FSCTL_NOTIFY_INFO;
+
+typedef struct
+{
+    UINT16 Version;
+    UINT32 Kind;
+    union
+    {
+        struct
+        {
+            UINT64 UserContext;
+            UINT32 FileAttributes;
+        } Create;
+        UINT8 Raw[20];
+    } Req;
+    PVOID Opaque;
+} FSP_FSCTL_TRANSACT_REQ;
+#endif
+`
+
+// testInterface imitates the function pointers in winfsp.h.
+const testInterface = `
+typedef struct _FSP_FILE_SYSTEM FSP_FILE_SYSTEM;
+typedef struct _FSP_FILE_SYSTEM_INTERFACE
+{
+    NTSTATUS (*GetVolumeInfo)(FSP_FILE_SYSTEM *FileSystem,
+        FSP_FSCTL_VOLUME_INFO *VolumeInfo);
+    VOID (*Close)(FSP_FILE_SYSTEM *FileSystem, PVOID FileContext);
+    NTSTATUS (*Reserved[2])();
+} FSP_FILE_SYSTEM_INTERFACE;
+`
+
+func parseTestHeader(t *testing.T, ptrSize int, sources ...string) *header {
+	t.Helper()
+	h := newHeader(ptrSize)
+	var code []string
+	for _, source := range sources {
+		preprocessed, err := h.preprocess(source)
+		if err != nil {
+			t.Fatalf("preprocess: %v", err)
+		}
+		code = append(code, preprocessed)
+	}
+	for _, preprocessed := range code {
+		if err := h.parse(preprocessed); err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+	}
+	return h
+}
+
+func TestLayout(t *testing.T) {
+	assert := assert.New(t)
+	h := parseTestHeader(t, 8, testHeader)
+	assert.NoError(h.check())
+
+	params := h.types["FSP_FSCTL_VOLUME_PARAMS_V0"]
+	if assert.NotNil(params) {
+		assert.NoError(params.err)
+		assert.Equal(440, params.size)
+		assert.Equal(8, params.align)
+		var offsets []int
+		for _, f := range params.fields {
+			offsets = append(offsets, f.offset)
+		}
+		assert.Equal([]int{0, 2, 8, 16, 20, 404}, offsets)
+		assert.Equal([]string{"CaseSensitiveSearch:1",
+			"CasePreservedNames:1", "KmReservedFlags:30"},
+			params.fields[3].bits)
+	}
+
+	notify := h.types["FSP_FSCTL_NOTIFY_INFO"]
+	if assert.NotNil(notify) {
+		assert.Equal(8, notify.size)
+		assert.True(notify.fields[2].flex)
+	}
+
+	req := h.types["FSP_FSCTL_TRANSACT_REQ"]
+	if assert.NotNil(req) {
+		assert.Equal(40, req.size)
+		assert.Equal(8, req.fields[2].offset)
+		assert.Equal(24, req.fields[2].size)
+		assert.Equal(32, req.fields[3].offset)
+	}
+	assert.Equal(32, parseTestHeader(t, 8, testHeader, testInterface).
+		types["FSP_FILE_SYSTEM_INTERFACE"].size)
+	assert.Equal(16, parseTestHeader(t, 4, testHeader, testInterface).
+		types["FSP_FILE_SYSTEM_INTERFACE"].size)
+}
+
+func TestStaticAssertMismatch(t *testing.T) {
+	h := parseTestHeader(t, 8, testHeader+`
+FSP_FSCTL_STATIC_ASSERT(sizeof(FSP_FSCTL_NOTIFY_INFO) == 12, "");`)
+	assert.Error(t, h.check())
+}
+
+func TestEmitDefinitions(t *testing.T) {
+	assert := assert.New(t)
+	h := parseTestHeader(t, 8, testHeader, testInterface)
+	mappings := parseTypeMappings("FSP_FSCTL_VOLUME_PARAMS_V0," +
+		"FSP_FSCTL_TRANSACT_REQ=TransactReq,FSP_FILE_SYSTEM_INTERFACE")
+	e := newEmitter(h, mappings)
+	e.header("winfsp", "")
+	e.emitConsts(regexp.MustCompile(
+		`^FSP_FSCTL_\w+_SIZE(MAX)?$|^FspFsctlTransact\w+Kind$`))
+	assert.NoError(e.emitTypes(mappings))
+	source, err := e.source()
+	assert.NoError(err)
+	for _, expected := range []string{
+		"FSP_FSCTL_VOLUME_PREFIX_SIZE   = 384",
+		"FSP_FSCTL_TRANSACT_REQ_SIZEMAX = 4032",
+		"FspFsctlTransactOverwriteKind = 2",
+		"Bitfield0          uint32 // CaseSensitiveSearch:1, " +
+			"CasePreservedNames:1, KmReservedFlags:30",
+		"Prefix             [192]uint16",
+		"type TransactReq struct",
+		"Req     [3]uint64",
+		"GetVolumeInfo uintptr",
+		"Reserved      [2]uintptr",
+	} {
+		assert.Contains(string(source), expected)
+	}
+	assert.NotContains(string(source), "WINFSP_FSCTL_H_INCLUDED")
+}
+
+func TestEmitAsserts(t *testing.T) {
+	assert := assert.New(t)
+	h := parseTestHeader(t, 8, testHeader)
+	mappings := parseTypeMappings("FSP_FSCTL_NOTIFY_INFO=NotifyInfo")
+	fields := parseFieldMappings("FSP_FSCTL_NOTIFY_INFO.Size=Length," +
+		"FSP_FSCTL_NOTIFY_INFO.FileNameBuf=")
+	e := newEmitter(h, mappings)
+	e.header("winfsp", e.buildConstraint(), "unsafe")
+	assert.NoError(e.emitAsserts(mappings, fields))
+	source, err := e.source()
+	assert.NoError(err)
+	assert.Contains(string(source), "//go:build windows && (amd64 || arm64)")
+	assert.Contains(string(source),
+		"[unsafe.Sizeof(NotifyInfo{}) - 8]struct{}{}")
+	assert.Contains(string(source),
+		"[unsafe.Offsetof(NotifyInfo{}.Length) - 0]struct{}{}")
+	assert.Contains(string(source),
+		"[unsafe.Offsetof(NotifyInfo{}.Filter) - 4]struct{}{}")
+	assert.NotContains(string(source), "FileNameBuf")
+	assert.Error(e.emitAsserts(parseTypeMappings("FSP_MISSING"), nil))
+}
+
+func TestGenerated(t *testing.T) {
+	assert := assert.New(t)
+	expected, err := os.ReadFile("../../zlayout_windows.go")
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The checked in assertions must be the ones generated
+	// from the header snapshot, run go generate otherwise.
+	path := filepath.Join(t.TempDir(), "zlayout_windows.go")
+	defer func(dir, out string, assertion bool) {
+		*includeDir, *output, *assertOnly = dir, out, assertion
+	}(*includeDir, *output, *assertOnly)
+	*includeDir, *output, *assertOnly = "inc", path, true
+	assert.NoError(run())
+	generated, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(string(expected), string(generated))
+}
@@ -0,0 +1,125 @@
+//go:build webdav
+// +build webdav
+
+package davfs
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+type fileSystem struct {
+	fs gofs.FileSystem
+}
+
+// New wraps the file system as webdav.FileSystem.
+func New(fs gofs.FileSystem) webdav.FileSystem {
+	return &fileSystem{fs: fs}
+}
+
+// backendName converts the slash separated name of WebDAV
+// into the name passed to the file system.
+func backendName(name string) (string, error) {
+	if strings.ContainsAny(name, `\:`) {
+		return "", os.ErrNotExist
+	}
+	return filepath.FromSlash(path.Clean("/" + name)), nil
+}
+
+func (d *fileSystem) Mkdir(
+	ctx context.Context, name string, perm os.FileMode,
+) error {
+	backend, err := backendName(name)
+	if err != nil {
+		return err
+	}
+	return d.fs.Mkdir(backend, perm)
+}
+
+func (d *fileSystem) OpenFile(
+	ctx context.Context, name string, flag int, perm os.FileMode,
+) (webdav.File, error) {
+	backend, err := backendName(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.fs.OpenFile(backend, flag, perm)
+}
+
+// removeAll removes the file and its descendants, stopping
+// once the context is done.
+func (d *fileSystem) removeAll(ctx context.Context, backend string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := d.fs.Stat(backend)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		f, err := d.fs.OpenFile(backend, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		children, err := f.Readdir(-1)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := d.removeAll(ctx, filepath.Join(
+				backend, child.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return d.fs.Remove(backend)
+}
+
+func (d *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	backend, err := backendName(name)
+	if err != nil {
+		return err
+	}
+	if backend == `\` {
+		// The root directory must never be removed.
+		return os.ErrInvalid
+	}
+	if err := d.removeAll(ctx, backend); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *fileSystem) Rename(
+	ctx context.Context, oldName, newName string,
+) error {
+	source, err := backendName(oldName)
+	if err != nil {
+		return err
+	}
+	target, err := backendName(newName)
+	if err != nil {
+		return err
+	}
+	return d.fs.Rename(source, target)
+}
+
+func (d *fileSystem) Stat(
+	ctx context.Context, name string,
+) (os.FileInfo, error) {
+	backend, err := backendName(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.fs.Stat(backend)
+}
+
+var _ webdav.FileSystem = (*fileSystem)(nil)
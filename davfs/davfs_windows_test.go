@@ -0,0 +1,105 @@
+//go:build webdav
+// +build webdav
+
+package davfs_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/webdav"
+
+	"github.com/aegistudio/go-winfsp/davfs"
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// osFS is the passthrough gofs.FileSystem over a directory.
+type osFS string
+
+func (fs osFS) path(name string) string {
+	return filepath.Join(string(fs), name)
+}
+
+func (fs osFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := os.OpenFile(fs.path(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs osFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(fs.path(name), perm)
+}
+
+func (fs osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(fs.path(name))
+}
+
+func (fs osFS) Rename(source, target string) error {
+	return os.Rename(fs.path(source), fs.path(target))
+}
+
+func (fs osFS) Remove(name string) error {
+	return os.Remove(fs.path(name))
+}
+
+func TestFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	var dav webdav.FileSystem = davfs.New(osFS(dir))
+
+	// The files written through WebDAV land in the backend.
+	assert.NoError(dav.Mkdir(ctx, "/dir", 0755))
+	f, err := dav.OpenFile(ctx, "/dir/file",
+		os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if assert.NoError(err) {
+		_, err = io.WriteString(f, "content")
+		assert.NoError(err)
+		assert.NoError(f.Close())
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "dir", "file"))
+	assert.NoError(err)
+	assert.Equal("content", string(content))
+	info, err := dav.Stat(ctx, "/dir/../dir/file")
+	if assert.NoError(err) {
+		assert.Equal(int64(len("content")), info.Size())
+	}
+
+	// The names escaping the slash separated namespace are
+	// rejected rather than interpreted by the backend.
+	_, err = dav.Stat(ctx, `/dir\file`)
+	assert.True(os.IsNotExist(err))
+	_, err = dav.Stat(ctx, "/C:/file")
+	assert.True(os.IsNotExist(err))
+
+	assert.NoError(dav.Rename(ctx, "/dir/file", "/renamed"))
+	_, err = os.Stat(filepath.Join(dir, "renamed"))
+	assert.NoError(err)
+	_, err = dav.Stat(ctx, "/dir/file")
+	assert.True(os.IsNotExist(err))
+
+	// The directories are removed recursively, but the root
+	// directory is never removed.
+	assert.NoError(os.WriteFile(
+		filepath.Join(dir, "dir", "inner"), nil, 0644))
+	assert.NoError(dav.RemoveAll(ctx, "/dir"))
+	_, err = os.Stat(filepath.Join(dir, "dir"))
+	assert.True(os.IsNotExist(err))
+	assert.NoError(dav.RemoveAll(ctx, "/missing"))
+	assert.Error(dav.RemoveAll(ctx, "/"))
+	_, err = os.Stat(filepath.Join(dir, "renamed"))
+	assert.NoError(err)
+
+	// The removal stops once the context is done.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(dav.RemoveAll(cancelled, "/renamed"), context.Canceled)
+}
@@ -0,0 +1,9 @@
+// Package davfs adapts gofs.FileSystem into the FileSystem of
+// golang.org/x/net/webdav, so that the same backend could be
+// mounted locally through WinFSP and shared to other machines
+// over WebDAV from the same process simultaneously.
+//
+// The adapter is only built with the "webdav" build tag, so
+// that the programs not serving WebDAV won't link the WebDAV
+// server of golang.org/x/net.
+package davfs
@@ -0,0 +1,59 @@
+package winfsp
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Debug specifies whether the debug log of all operations
+// should be emitted by WinFSP once the file system has
+// been mounted.
+func Debug(value bool) Option {
+	return func(o *option) {
+		o.debugLog = 0
+		if value {
+			o.debugLog = math.MaxUint32
+		}
+	}
+}
+
+// DebugMask sets the debug log mask of the file system
+// once it has been mounted, so that only the operations
+// of interest are logged, e.g.
+//
+//	DebugMask(DebugKinds(
+//	    FspFsctlTransactReadKind, FspFsctlTransactWriteKind))
+//
+// See SetDebugLog for the meaning of the mask.
+func DebugMask(mask uint32) Option {
+	return func(o *option) {
+		o.debugLog = mask
+	}
+}
+
+// DebugKinds builds the debug log mask enabling the debug
+// log of the specified transact kinds.
+func DebugKinds(kinds ...uint32) uint32 {
+	mask := uint32(0)
+	for _, kind := range kinds {
+		if kind < 32 {
+			mask |= 1 << kind
+		}
+	}
+	return mask
+}
+
+// SetDebugLog sets the debug log mask of the file system,
+// which can be adjusted at any time after mounting.
+//
+// Each bit of the mask enables the debug log of the
+// transact kind (e.g. FspFsctlTransactCreateKind) at the
+// corresponding position, and 0 disables the debug log.
+func (f *FileSystem) SetDebugLog(mask uint32) {
+	atomic.StoreUint32(&f.fileSystem.DebugLog, mask)
+}
+
+// DebugLog returns current debug log mask of the file system.
+func (f *FileSystem) DebugLog() uint32 {
+	return atomic.LoadUint32(&f.fileSystem.DebugLog)
+}
@@ -0,0 +1,43 @@
+package winfsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDebugLog(t *testing.T) {
+	assert := assert.New(t)
+	o := newOption()
+	assert.Equal(uint32(0), o.debugLog)
+	Debug(true)(o)
+	assert.Equal(uint32(math.MaxUint32), o.debugLog)
+	Debug(false)(o)
+	assert.Equal(uint32(0), o.debugLog)
+
+	// The mask could be raised and lowered after mounting.
+	f := &FileSystem{}
+	f.fileSystem = &FSP_FILE_SYSTEM{}
+	f.SetDebugLog(math.MaxUint32)
+	assert.Equal(uint32(math.MaxUint32), f.DebugLog())
+	assert.Equal(uint32(math.MaxUint32), f.fileSystem.DebugLog)
+	f.SetDebugLog(0)
+	assert.Equal(uint32(0), f.DebugLog())
+}
+
+func TestDebugMask(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint32(0), DebugKinds())
+	mask := DebugKinds(FspFsctlTransactReadKind, FspFsctlTransactWriteKind)
+	assert.Equal(uint32(1<<FspFsctlTransactReadKind|
+		1<<FspFsctlTransactWriteKind), mask)
+
+	// The kinds beyond the mask are ignored.
+	assert.Equal(mask, DebugKinds(
+		FspFsctlTransactReadKind, FspFsctlTransactWriteKind, 32))
+
+	o := newOption()
+	DebugMask(mask)(o)
+	assert.Equal(mask, o.debugLog)
+}
@@ -0,0 +1,98 @@
+package winfsp
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var debugLogSetHandle *syscall.Proc
+
+// DebugLogSetHandle redirects the debug log of WinFSP to
+// the handle, which is the standard error by default.
+//
+// The debug log is shared by all file systems hosted in
+// the process, and enabled by Debug or DebugMask.
+func DebugLogSetHandle(handle windows.Handle) error {
+	if err := tryLoadWinFSP(); err != nil {
+		return err
+	}
+	_, _, _ = debugLogSetHandle.Call(uintptr(handle))
+	return nil
+}
+
+// debugLogPump copies the debug log written into the pipe
+// to the writer, until the pipe is closed.
+type debugLogPump struct {
+	reader, writer *os.File
+	done           chan struct{}
+	closeOnce      sync.Once
+}
+
+var (
+	debugLogMutex   sync.Mutex
+	debugLogCurrent *debugLogPump
+)
+
+// DebugLogSetWriter redirects the debug log of WinFSP to
+// the writer, by creating an anonymous pipe whose content
+// is copied to the writer in a goroutine.
+//
+// Closing the returned closer restores the debug log to the
+// standard error, and waits for the pending debug log to be
+// copied. Setting another writer takes over the debug log,
+// and the former closer then only releases its pipe.
+func DebugLogSetWriter(w io.Writer) (io.Closer, error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return nil, err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "create debug log pipe")
+	}
+	pump := &debugLogPump{
+		reader: reader,
+		writer: writer,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(pump.done)
+		_, _ = io.Copy(w, reader)
+	}()
+	debugLogMutex.Lock()
+	defer debugLogMutex.Unlock()
+	_, _, _ = debugLogSetHandle.Call(writer.Fd())
+	debugLogCurrent = pump
+	return pump, nil
+}
+
+// Close restores the debug log and releases the pipe.
+func (p *debugLogPump) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		debugLogMutex.Lock()
+		if debugLogCurrent == p {
+			stderr, _ := windows.GetStdHandle(windows.STD_ERROR_HANDLE)
+			_, _, _ = debugLogSetHandle.Call(uintptr(stderr))
+			debugLogCurrent = nil
+		}
+		debugLogMutex.Unlock()
+		err = p.writer.Close()
+		<-p.done
+		_ = p.reader.Close()
+	})
+	return err
+}
+
+// DebugLogWriter redirects the debug log of WinFSP to the
+// writer with DebugLogSetWriter while the file system is
+// mounted, and restores it after unmounting.
+func DebugLogWriter(w io.Writer) Option {
+	return func(o *option) {
+		o.debugLogWriter = w
+	}
+}
@@ -0,0 +1,389 @@
+package diagfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/gofs"
+	"github.com/aegistudio/go-winfsp/vfs"
+)
+
+// DirName is the name of the injected diagnostic directory.
+const DirName = ".winfsp"
+
+// Stats is the content of stats.json.
+type Stats struct {
+	Uptime      string `json:"uptime"`
+	OpenHandles int    `json:"openHandles"`
+
+	// Statistics is the snapshot of the statistics collector
+	// of the mounted file system, which is nil unless it is
+	// mounted with the winfsp.Statistics option.
+	Statistics *winfsp.StatsSnapshot `json:"statistics,omitempty"`
+}
+
+// FileSystem is the layer injecting the diagnostic directory.
+type FileSystem struct {
+	inner   gofs.FileSystem
+	tree    *vfs.FileSystem
+	started time.Time
+
+	mtx sync.Mutex
+	ref *winfsp.FileSystemRef
+}
+
+// New creates the layer over the inner file system.
+//
+// The statistics and the open files are reported from the
+// file system ref attached by Attach after mounting, and the
+// names of the open files are only available when it is
+// mounted with the winfsp.Statistics option.
+//
+// The optional interfaces of the inner file system are
+// forwarded through gofs.FileSystemWrapper, while the files
+// in the diagnostic directory are read only.
+func New(inner gofs.FileSystem) *FileSystem {
+	fs := &FileSystem{
+		inner:   inner,
+		started: time.Now(),
+	}
+	fs.tree = vfs.New(vfs.Dir{
+		"stats.json":  vfs.BytesFunc(fs.statsJSON),
+		"handles.txt": vfs.BytesFunc(fs.handlesText),
+		"version":     vfs.BytesFunc(versionText),
+	})
+	return fs
+}
+
+// Attach attaches the ref of the mounted file system, whose
+// statistics and open files are reported.
+func (fs *FileSystem) Attach(ref *winfsp.FileSystemRef) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.ref = ref
+}
+
+func (fs *FileSystem) attached() *winfsp.FileSystemRef {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	return fs.ref
+}
+
+// Stats collects the statistics of the attached file system.
+func (fs *FileSystem) Stats() Stats {
+	result := Stats{
+		Uptime: time.Since(fs.started).Round(time.Second).String(),
+	}
+	if ref := fs.attached(); ref != nil {
+		result.OpenHandles = len(ref.OpenFiles())
+		if collector := ref.Statistics(); collector != nil {
+			snapshot := collector.Snapshot()
+			result.Statistics = &snapshot
+		}
+	}
+	return result
+}
+
+func (fs *FileSystem) statsJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(fs.Stats(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (fs *FileSystem) handlesText() ([]byte, error) {
+	ref := fs.attached()
+	if ref == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	for _, file := range ref.OpenFiles() {
+		fmt.Fprintf(&buf, "%s\tcontext=%#x\n", file.Name, file.Context)
+	}
+	return buf.Bytes(), nil
+}
+
+func versionText() ([]byte, error) {
+	version := "(unknown)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range append([]*debug.Module{
+			&info.Main}, info.Deps...) {
+			if dep.Path == "github.com/aegistudio/go-winfsp" {
+				version = dep.Version
+			}
+		}
+	}
+	return []byte(fmt.Sprintf("go-winfsp %s\n%s %s/%s\n", version,
+		runtime.Version(), runtime.GOOS, runtime.GOARCH)), nil
+}
+
+// route checks whether the name is inside the diagnostic
+// directory, returning the name inside the directory.
+func route(name string) (string, bool) {
+	trimmed := strings.TrimLeft(name, `\/`)
+	first := trimmed
+	rest := ""
+	if i := strings.IndexAny(trimmed, `\/`); i >= 0 {
+		first, rest = trimmed[:i], trimmed[i:]
+	}
+	if !strings.EqualFold(first, DirName) {
+		return "", false
+	}
+	return `\` + strings.TrimLeft(rest, `\/`), true
+}
+
+func isRoot(name string) bool {
+	return strings.Trim(name, `\/`) == ""
+}
+
+// dirInfo is the info of the diagnostic directory itself,
+// which is hidden from the listing of explorer.
+type dirInfo struct {
+	os.FileInfo
+}
+
+func (i *dirInfo) Name() string {
+	return DirName
+}
+
+func (i *dirInfo) FileAttributes() uint32 {
+	return windows.FILE_ATTRIBUTE_DIRECTORY | windows.FILE_ATTRIBUTE_HIDDEN
+}
+
+func (fs *FileSystem) dirInfo() (os.FileInfo, error) {
+	info, err := fs.tree.Stat(`\`)
+	if err != nil {
+		return nil, err
+	}
+	return &dirInfo{FileInfo: info}, nil
+}
+
+func (fs *FileSystem) Unwrap() gofs.FileSystem {
+	return fs.inner
+}
+
+func (fs *FileSystem) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	if inner, ok := route(name); ok {
+		f, err := fs.tree.OpenFile(inner, flag, perm)
+		if err != nil || !isRoot(inner) {
+			return f, err
+		}
+		return &diagDir{File: f, fs: fs}, nil
+	}
+	f, err := fs.inner.OpenFile(name, flag, perm)
+	if err != nil || !isRoot(name) {
+		return f, err
+	}
+	return &rootDir{File: f, fs: fs}, nil
+}
+
+func (fs *FileSystem) Mkdir(name string, perm os.FileMode) error {
+	if inner, ok := route(name); ok {
+		if isRoot(inner) {
+			return os.ErrExist
+		}
+		return os.ErrPermission
+	}
+	return fs.inner.Mkdir(name, perm)
+}
+
+func (fs *FileSystem) Stat(name string) (os.FileInfo, error) {
+	if inner, ok := route(name); ok {
+		if isRoot(inner) {
+			return fs.dirInfo()
+		}
+		return fs.tree.Stat(inner)
+	}
+	return fs.inner.Stat(name)
+}
+
+func (fs *FileSystem) Rename(source, target string) error {
+	_, sourceDiag := route(source)
+	_, targetDiag := route(target)
+	if sourceDiag || targetDiag {
+		return os.ErrPermission
+	}
+	return fs.inner.Rename(source, target)
+}
+
+func (fs *FileSystem) Remove(name string) error {
+	if _, ok := route(name); ok {
+		return os.ErrPermission
+	}
+	return fs.inner.Remove(name)
+}
+
+func (fs *FileSystem) SetAttributes(name string, attributes uint32) error {
+	if _, ok := route(name); ok {
+		return os.ErrPermission
+	}
+	inner, ok := fs.inner.(gofs.FileSystemAttributes)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.SetAttributes(name, attributes)
+}
+
+func (fs *FileSystem) Chmod(name string, mode os.FileMode) error {
+	if _, ok := route(name); ok {
+		return os.ErrPermission
+	}
+	inner, ok := fs.inner.(gofs.FileSystemChmod)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Chmod(name, mode)
+}
+
+func (fs *FileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	if _, ok := route(name); ok {
+		return os.ErrPermission
+	}
+	inner, ok := fs.inner.(gofs.FileSystemChtimes)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Chtimes(name, atime, mtime)
+}
+
+func (fs *FileSystem) Sync() error {
+	inner, ok := fs.inner.(gofs.FileSystemSync)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Sync()
+}
+
+// GetSecurity returns nil descriptor for the diagnostic
+// names, so that their descriptors are derived from status.
+func (fs *FileSystem) GetSecurity(
+	name string,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	if _, ok := route(name); ok {
+		return nil, nil
+	}
+	inner, ok := fs.inner.(gofs.FileSystemSecurity)
+	if !ok {
+		return nil, windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.GetSecurity(name)
+}
+
+func (fs *FileSystem) SetSecurity(
+	name string, sd *windows.SECURITY_DESCRIPTOR,
+) error {
+	if _, ok := route(name); ok {
+		return os.ErrPermission
+	}
+	inner, ok := fs.inner.(gofs.FileSystemSetSecurity)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.SetSecurity(name, sd)
+}
+
+func (fs *FileSystem) Symlink(oldname, newname string) error {
+	if _, ok := route(newname); ok {
+		return os.ErrPermission
+	}
+	inner, ok := fs.inner.(gofs.FileSystemSymlink)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Symlink(oldname, newname)
+}
+
+func (fs *FileSystem) Readlink(name string) (string, error) {
+	if _, ok := route(name); ok {
+		return "", os.ErrInvalid
+	}
+	inner, ok := fs.inner.(gofs.FileSystemSymlink)
+	if !ok {
+		return "", windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Readlink(name)
+}
+
+// Lstat is Stat for the diagnostic names, which are never
+// symbolic links.
+func (fs *FileSystem) Lstat(name string) (os.FileInfo, error) {
+	if _, ok := route(name); ok {
+		return fs.Stat(name)
+	}
+	inner, ok := fs.inner.(gofs.FileSystemSymlink)
+	if !ok {
+		return nil, windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Lstat(name)
+}
+
+// rootDir is the root directory of the inner file system,
+// whose listing is appended with the diagnostic directory.
+type rootDir struct {
+	gofs.File
+	fs     *FileSystem
+	listed bool
+}
+
+func (f *rootDir) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	if f.listed {
+		return infos, err
+	}
+	if err != nil && err != io.EOF {
+		return infos, err
+	}
+	if count > 0 && len(infos) == count {
+		return infos, err
+	}
+	info, dirErr := f.fs.dirInfo()
+	if dirErr != nil {
+		return infos, err
+	}
+	f.listed = true
+	return append(infos, info), nil
+}
+
+func (f *rootDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		f.listed = false
+	}
+	return f.File.Seek(offset, whence)
+}
+
+// diagDir is the opened diagnostic directory itself.
+type diagDir struct {
+	gofs.File
+	fs *FileSystem
+}
+
+func (d *diagDir) Stat() (os.FileInfo, error) {
+	return d.fs.dirInfo()
+}
+
+var (
+	_ gofs.FileSystemWrapper     = (*FileSystem)(nil)
+	_ gofs.FileSystemAttributes  = (*FileSystem)(nil)
+	_ gofs.FileSystemChmod       = (*FileSystem)(nil)
+	_ gofs.FileSystemChtimes     = (*FileSystem)(nil)
+	_ gofs.FileSystemSync        = (*FileSystem)(nil)
+	_ gofs.FileSystemSetSecurity = (*FileSystem)(nil)
+	_ gofs.FileSystemSymlink     = (*FileSystem)(nil)
+	_ gofs.AttributesFileInfo    = (*dirInfo)(nil)
+	_ gofs.File                  = (*rootDir)(nil)
+	_ gofs.File                  = (*diagDir)(nil)
+)
@@ -0,0 +1,208 @@
+package diagfs_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/diagfs"
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// dirFS is the backend storing the files under a local directory.
+type dirFS string
+
+func (d dirFS) path(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+func (d dirFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := os.OpenFile(d.path(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d dirFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(d.path(name), perm)
+}
+
+func (d dirFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(d.path(name))
+}
+
+func (d dirFS) Rename(source, target string) error {
+	return os.Rename(d.path(source), d.path(target))
+}
+
+func (d dirFS) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+func readAll(fs gofs.FileSystem, name string) (string, error) {
+	f, err := fs.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(f)
+	return string(data), err
+}
+
+func TestDiagnosticDir(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(root, "file"), nil, 0644))
+	fs := diagfs.New(dirFS(root))
+
+	// The directory is listed after the entries of the root.
+	dir, err := fs.OpenFile(`\`, os.O_RDONLY, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	infos, err := dir.Readdir(-1)
+	assert.NoError(err)
+	assert.NoError(dir.Close())
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	assert.Equal([]string{"file", diagfs.DirName}, names)
+	info, err := fs.Stat(`\.WinFsp`)
+	if assert.NoError(err) {
+		assert.True(info.IsDir())
+		attributes := info.(gofs.AttributesFileInfo).FileAttributes()
+		assert.NotZero(attributes & windows.FILE_ATTRIBUTE_HIDDEN)
+	}
+
+	// The directory cannot be modified.
+	assert.True(os.IsExist(fs.Mkdir(`\.winfsp`, 0755)))
+	assert.True(os.IsPermission(fs.Remove(`\.winfsp\version`)))
+	assert.True(os.IsPermission(fs.Rename(`\file`, `\.winfsp\file`)))
+	_, err = os.Stat(filepath.Join(root, diagfs.DirName))
+	assert.True(os.IsNotExist(err))
+
+	version, err := readAll(fs, `\.winfsp\version`)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(version, "go-winfsp "))
+}
+
+// linkFS is the dirFS supporting symbolic links.
+type linkFS struct{ dirFS }
+
+func (l linkFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, l.path(newname))
+}
+
+func (l linkFS) Readlink(name string) (string, error) {
+	return os.Readlink(l.path(name))
+}
+
+func (l linkFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(l.path(name))
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+	fs := diagfs.New(linkFS{dirFS(root)})
+	var wrapper gofs.FileSystemWrapper = fs
+	assert.Equal(linkFS{dirFS(root)}, wrapper.Unwrap())
+
+	// The optional interfaces are forwarded to the inner one,
+	// and reported unsupported when the inner one lacks them.
+	assert.NoError(os.WriteFile(filepath.Join(root, "file"), nil, 0644))
+	assert.NoError(fs.Chmod(`\file`, 0444))
+	info, err := os.Stat(filepath.Join(root, "file"))
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0444), info.Mode().Perm())
+	}
+	assert.Equal(windows.STATUS_INVALID_DEVICE_REQUEST, fs.Sync())
+
+	// The diagnostic names are never forwarded.
+	assert.True(os.IsPermission(fs.Chmod(`\.winfsp\version`, 0644)))
+	assert.True(os.IsPermission(fs.Symlink(`\file`, `\.winfsp\link`)))
+	sd, err := fs.GetSecurity(`\.winfsp\version`)
+	assert.NoError(err)
+	assert.Nil(sd)
+	info, err = fs.Lstat(`\.winfsp`)
+	if assert.NoError(err) {
+		assert.True(info.IsDir())
+	}
+}
+
+func TestStatsAndHandles(t *testing.T) {
+	assert := assert.New(t)
+	fs := diagfs.New(dirFS(t.TempDir()))
+
+	// Nothing but the uptime is reported before attaching.
+	content, err := readAll(fs, `\.winfsp\stats.json`)
+	assert.NoError(err)
+	var stats diagfs.Stats
+	assert.NoError(json.Unmarshal([]byte(content), &stats))
+	assert.Nil(stats.Statistics)
+
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(fs), mountpoint,
+		winfsp.Statistics(true))
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	fs.Attach(&mounted.FileSystemRef)
+	root := mountpoint + `\`
+
+	f, err := os.OpenFile(filepath.Join(root, "file"),
+		os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte("hello"))
+	assert.NoError(err)
+	assert.NoError(f.Sync())
+
+	data, err := os.ReadFile(filepath.Join(root, diagfs.DirName, "handles.txt"))
+	assert.NoError(err)
+	assert.Contains(string(data), `\file`+"\t")
+
+	data, err = os.ReadFile(filepath.Join(root, diagfs.DirName, "stats.json"))
+	assert.NoError(err)
+	stats = diagfs.Stats{}
+	assert.NoError(json.Unmarshal(data, &stats))
+	assert.NotZero(stats.OpenHandles)
+	if assert.NotNil(stats.Statistics) {
+		assert.Equal(uint64(5), stats.Statistics.BytesWritten)
+		assert.NotZero(stats.Statistics.Operations["Create"].Count)
+	}
+
+	// Closed handles are no longer listed.
+	assert.NoError(f.Close())
+	data, err = os.ReadFile(filepath.Join(root, diagfs.DirName, "handles.txt"))
+	assert.NoError(err)
+	assert.NotContains(string(data), `\file`+"\t")
+}
+
+func freeDriveLetter(t *testing.T) string {
+	t.Helper()
+	drives, err := windows.GetLogicalDrives()
+	if err != nil {
+		t.Fatalf("get logical drives: %v", err)
+	}
+	for letter := 'Z'; letter >= 'D'; letter-- {
+		if drives&(1<<uint(letter-'A')) == 0 {
+			return string(letter) + ":"
+		}
+	}
+	t.Skip("no free drive letter")
+	return ""
+}
@@ -0,0 +1,11 @@
+// Package diagfs provides an opt-in gofs.FileSystem layer which
+// injects a hidden diagnostic directory named ".winfsp" into the
+// root of the mounted namespace.
+//
+// The directory contains virtual files generated on reading,
+// which are stats.json for the statistics collected by the file
+// system (see winfsp.Statistics), handles.txt for the files
+// currently opened, and version for the version of this module
+// and the Go runtime. This gives the users an in-band way to
+// inspect a live mount with nothing but a file browser.
+package diagfs
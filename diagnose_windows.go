@@ -0,0 +1,149 @@
+package winfsp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// PanicHandler is called with the panicking operation, the
+// value passed to panic and the stack of the goroutine, when
+// a behaviour panics and the panic has been recovered.
+//
+// The operation will be nil if the file system has not been
+// instrumented by any other option.
+type PanicHandler func(op *Operation, value interface{}, stack []byte)
+
+// RecoverPanic recovers the panics raised by behaviours,
+// failing the operations with STATUS_INTERNAL_ERROR instead
+// of crashing the whole process, and reports them to the
+// handler if it is not nil.
+func RecoverPanic(handler PanicHandler) Option {
+	return func(o *option) {
+		o.recoverPanic = true
+		o.panicHandler = handler
+	}
+}
+
+// DiagnosticBundle keeps a ring buffer of the latest operations,
+// and writes a diagnostic bundle file into the directory when a
+// behaviour panics, which is helpful for reporting bugs.
+//
+// The bundle contains the panic, the stacks of all goroutines,
+// the recent operations, and the parameters of mounting. This
+// option implies RecoverPanic.
+func DiagnosticBundle(dir string, size int) Option {
+	return func(o *option) {
+		o.recoverPanic = true
+		o.bundleDir = dir
+		o.bundleSize = size
+	}
+}
+
+// operationRing is the ring buffer of recent operations.
+type operationRing struct {
+	mtx   sync.Mutex
+	ops   []Operation
+	next  int
+	count int
+}
+
+func newOperationRing(size int) *operationRing {
+	if size <= 0 {
+		size = 256
+	}
+	return &operationRing{ops: make([]Operation, size)}
+}
+
+func (r *operationRing) add(op *Operation) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.ops[r.next] = *op
+	r.next = (r.next + 1) % len(r.ops)
+	if r.count < len(r.ops) {
+		r.count++
+	}
+}
+
+// snapshot returns the operations from the oldest one.
+func (r *operationRing) snapshot() []Operation {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	result := make([]Operation, 0, r.count)
+	start := (r.next - r.count + len(r.ops)) % len(r.ops)
+	for i := 0; i < r.count; i++ {
+		result = append(result, r.ops[(start+i)%len(r.ops)])
+	}
+	return result
+}
+
+// allGoroutineStacks dumps the stacks of all goroutines.
+func allGoroutineStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func formatOperation(op *Operation) string {
+	return fmt.Sprintf("%s %s file=%#x name=%q pid=%d took=%s status=%s",
+		op.Start.Format(time.RFC3339Nano), op.Kind, op.File,
+		op.Name, op.ProcessId, op.Duration, op.Status)
+}
+
+// writeDiagnosticBundle writes the bundle file of a panic
+// into the bundle directory, returning its path.
+func (ref *FileSystemRef) writeDiagnosticBundle(
+	op *Operation, value interface{}, stack []byte,
+) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "panic: %v\n", value)
+	if op != nil {
+		fmt.Fprintf(&buf, "operation: %s\n", formatOperation(op))
+	}
+	fmt.Fprintf(&buf, "\n%s\n", stack)
+	fmt.Fprintf(&buf, "== mount ==\n%s\n", ref.mountSummary)
+	if winFSPDLL != nil {
+		fmt.Fprintf(&buf, "dll: %s\n", winFSPDLL.Name)
+	}
+	if major, minor, err := Version(); err != nil {
+		fmt.Fprintf(&buf, "winfsp version: unknown (%v)\n", err)
+	} else {
+		fmt.Fprintf(&buf, "winfsp version: %d.%d\n", major, minor)
+	}
+	fmt.Fprintf(&buf, "\n== recent operations ==\n")
+	for _, recent := range ref.recentOps.snapshot() {
+		fmt.Fprintf(&buf, "%s\n", formatOperation(&recent))
+	}
+	if ref.trace != nil {
+		fmt.Fprintf(&buf, "\n== trace ==\n")
+		_ = ref.DumpTrace(&buf)
+	}
+	fmt.Fprintf(&buf, "\n== goroutines ==\n%s", allGoroutineStacks())
+	path := filepath.Join(ref.bundleDir, fmt.Sprintf(
+		"winfsp-panic-%s-%d.txt",
+		time.Now().Format("20060102-150405.000"), os.Getpid()))
+	return path, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// handlePanic handles the recovered panic of a behaviour.
+func (ref *FileSystemRef) handlePanic(op *Operation, value interface{}) {
+	stack := make([]byte, 1<<16)
+	stack = stack[:runtime.Stack(stack, false)]
+	if ref.recentOps != nil {
+		// Nothing we could do if the bundle cannot be written,
+		// but the panic might still be reported to the handler.
+		_, _ = ref.writeDiagnosticBundle(op, value, stack)
+	}
+	if ref.panicHandler != nil {
+		ref.panicHandler(op, value, stack)
+	}
+}
@@ -0,0 +1,79 @@
+package winfsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestOperationRing(t *testing.T) {
+	assert := assert.New(t)
+	ring := newOperationRing(2)
+	assert.Empty(ring.snapshot())
+	for _, kind := range []string{"Open", "Read", "Close"} {
+		ring.add(&Operation{Kind: kind})
+	}
+
+	// Only the latest operations are kept, from the oldest.
+	ops := ring.snapshot()
+	if assert.Len(ops, 2) {
+		assert.Equal("Read", ops[0].Kind)
+		assert.Equal("Close", ops[1].Kind)
+	}
+	assert.Len(newOperationRing(0).ops, 256)
+}
+
+type panicFlush struct{ swapBase }
+
+func (panicFlush) Flush(
+	fs *FileSystemRef, file uintptr, info *FSP_FSCTL_FILE_INFO,
+) error {
+	if file == 2 {
+		panic("boom")
+	}
+	return nil
+}
+
+func TestDiagnosticBundle(t *testing.T) {
+	assert := assert.New(t)
+	ref, fileSystem := instrumentedTestRef(t, panicFlush{})
+	ref.recoverPanic = true
+	ref.recentOps = newOperationRing(4)
+	ref.bundleDir = t.TempDir()
+	ref.mountSummary = "mount summary"
+	var panics []interface{}
+	ref.panicHandler = func(op *Operation, value interface{}, stack []byte) {
+		assert.Equal(uintptr(2), op.File)
+		assert.NotEmpty(stack)
+		panics = append(panics, value)
+	}
+
+	// The panic fails the operation instead of the process.
+	assert.Equal(windows.STATUS_SUCCESS, delegateFlush(fileSystem, 1, 0))
+	assert.Equal(windows.STATUS_INTERNAL_ERROR, delegateFlush(fileSystem, 2, 0))
+	assert.Equal([]interface{}{"boom"}, panics)
+
+	bundles, err := filepath.Glob(filepath.Join(ref.bundleDir, "winfsp-panic-*.txt"))
+	assert.NoError(err)
+	if !assert.Len(bundles, 1) {
+		return
+	}
+	data, err := os.ReadFile(bundles[0])
+	assert.NoError(err)
+	major, minor, err := Version()
+	assert.NoError(err)
+	for _, expected := range []string{
+		"panic: boom",
+		fmt.Sprintf("winfsp version: %d.%d\n", major, minor),
+		"mount summary",
+		"== recent operations ==",
+		"Flush file=0x1",
+		"== goroutines ==",
+	} {
+		assert.Contains(string(data), expected)
+	}
+}
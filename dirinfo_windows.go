@@ -0,0 +1,46 @@
+package winfsp
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var addDirInfo *syscall.Proc
+
+// FileSystemAddDirInfo appends the directory entry into the
+// buffer of ReadDirectoryRaw, advancing the bytesTransferred.
+// It is the counterpart of DirBufferFiller for the file
+// systems which maintain their own directory buffers.
+//
+// The list of entries must be terminated by adding a nil
+// entry. When false is returned, the buffer is full and the
+// behaviour should return with the entries added so far.
+func FileSystemAddDirInfo(
+	name string, info *FSP_FSCTL_FILE_INFO,
+	buf []byte, bytesTransferred *int,
+) (bool, error) {
+	var dirInfo uintptr
+	if info != nil {
+		encoder := dirInfoEncoders.Get().(*dirInfoEncoder)
+		defer dirInfoEncoders.Put(encoder)
+		alignedBuffer, err := encoder.encode(name, info)
+		if err != nil {
+			return false, err
+		}
+		defer runtime.KeepAlive(alignedBuffer)
+		dirInfo = uintptr(unsafe.Pointer(&alignedBuffer[0]))
+	}
+	var bufAddr uintptr
+	if len(buf) > 0 {
+		bufAddr = uintptr(unsafe.Pointer(&buf[0]))
+	}
+	transferred := uint32(*bytesTransferred)
+	addOk, _, _ := addDirInfo.Call(
+		dirInfo, bufAddr, uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&transferred)),
+	)
+	*bytesTransferred = int(transferred)
+	// BUG: same bug as the directory buffer acquisition.
+	return uint8(addOk) != 0, nil
+}
@@ -0,0 +1,75 @@
+package winfsp
+
+import (
+	"testing"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestDirInfoEncoderReuse(t *testing.T) {
+	assert := assert.New(t)
+	var encoder dirInfoEncoder
+	long := &FSP_FSCTL_FILE_INFO{FileSize: 1, IndexNumber: 2}
+	_, err := encoder.encode("a-rather-long-file-name.txt", long)
+	assert.NoError(err)
+
+	// The stale content of the previous entry must not be
+	// carried over into the shorter entry.
+	buf, err := encoder.encode("b", nil)
+	assert.NoError(err)
+	expected, err := encodeDirInfo("b", nil)
+	assert.NoError(err)
+	size := (*FSP_FSCTL_DIR_INFO)(unsafe.Pointer(&buf[0])).Size
+	assert.Equal(int(unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}))+2, int(size))
+	assert.Equal(expected[:len(expected)-1], buf[:len(expected)-1])
+	assert.Equal(FSP_FSCTL_FILE_INFO{},
+		(*FSP_FSCTL_DIR_INFO)(unsafe.Pointer(&buf[0])).FileInfo)
+
+	_, err = encoder.encode("nul\x00name", nil)
+	assert.Error(err)
+}
+
+func BenchmarkDirInfoEncoder(b *testing.B) {
+	info := &FSP_FSCTL_FILE_INFO{FileSize: 4096}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encoder := dirInfoEncoders.Get().(*dirInfoEncoder)
+		_, _ = encoder.encode("directory-entry.txt", info)
+		dirInfoEncoders.Put(encoder)
+	}
+}
+
+func TestDirInfoAlignment(t *testing.T) {
+	assert := assert.New(t)
+	header := int(unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}))
+	for n := 0; n < 9; n++ {
+		name := "abcdefgh"[:n]
+		buf, err := encodeDirInfo(name, nil)
+		assert.NoError(err)
+		assert.Zero(uintptr(unsafe.Pointer(&buf[0])) % 8)
+		assert.Len(buf, (header+2*n+7)/8)
+		dirInfo := (*FSP_FSCTL_DIR_INFO)(unsafe.Pointer(&buf[0]))
+		assert.Equal(header+2*n, int(dirInfo.Size))
+		units := unsafe.Slice((*uint16)(unsafe.Add(
+			unsafe.Pointer(dirInfo), header)), n)
+		assert.Equal(name, string(utf16.Decode(units)))
+	}
+
+	// The NUL would terminate the name prematurely.
+	_, err := encodeDirInfo("a\x00", nil)
+	assert.Equal(windows.STATUS_OBJECT_NAME_INVALID, err)
+}
+
+func TestEnforceBytePtr(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(enforceBytePtr(0, 0))
+	data := []byte("data")
+	view := enforceBytePtr(uintptr(unsafe.Pointer(&data[0])), 3)
+	assert.Equal([]byte("dat"), view)
+	assert.Equal(3, cap(view))
+	view[0] = 'D'
+	assert.Equal([]byte("Data"), data)
+}
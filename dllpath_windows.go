@@ -0,0 +1,139 @@
+package winfsp
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DLLPathEnv is the environment variable specifying the
+// path of the WinFSP DLL, or the directory containing it,
+// which is overridden by SetDLLPath.
+const DLLPathEnv = "WINFSP_DLL"
+
+// dllPolicy is how the WinFSP DLL will be located, which
+// must be settled before the DLL is loaded.
+var dllPolicy struct {
+	sync.Mutex
+	path    string
+	appDir  bool
+	settled bool
+}
+
+// settleDLLPolicy marks the policy as settled, returning
+// the path and whether the application directory should
+// be searched.
+func settleDLLPolicy() (string, bool) {
+	dllPolicy.Lock()
+	defer dllPolicy.Unlock()
+	dllPolicy.settled = true
+	path := dllPolicy.path
+	if path == "" {
+		path = os.Getenv(DLLPathEnv)
+	}
+	return path, dllPolicy.appDir
+}
+
+var errDLLSettled = errors.New("winfsp dll already loaded")
+
+// SetDLLPath specifies the path of the WinFSP DLL, or the
+// directory containing it, e.g. for the applications that
+// bundle WinFSP. Then the DLL will only be loaded from the
+// path instead of being searched for.
+//
+// It must be called before the DLL is loaded by any API
+// of this package.
+func SetDLLPath(path string) error {
+	dllPolicy.Lock()
+	defer dllPolicy.Unlock()
+	if dllPolicy.settled {
+		return errDLLSettled
+	}
+	dllPolicy.path = path
+	return nil
+}
+
+// SetDLLApplicationDir specifies whether the WinFSP DLL
+// should be searched in the directory of the executable
+// first, before the system search path and the directory
+// where WinFSP is installed.
+//
+// It must be called before the DLL is loaded by any API
+// of this package.
+func SetDLLApplicationDir(value bool) error {
+	dllPolicy.Lock()
+	defer dllPolicy.Unlock()
+	if dllPolicy.settled {
+		return errDLLSettled
+	}
+	dllPolicy.appDir = value
+	return nil
+}
+
+// DLLPath calls SetDLLPath when mounting. Mounting fails if
+// the DLL has been loaded from another path.
+func DLLPath(path string) Option {
+	return func(o *option) {
+		o.dllPath = path
+	}
+}
+
+// DLLApplicationDir calls SetDLLApplicationDir when
+// mounting, which is ignored if the DLL has been loaded.
+func DLLApplicationDir(value bool) Option {
+	return func(o *option) {
+		o.dllAppDir = value
+	}
+}
+
+// applyDLLOptions applies the DLL options before the DLL
+// is loaded for mounting.
+func applyDLLOptions(o *option) error {
+	if o.dllAppDir {
+		_ = SetDLLApplicationDir(true)
+	}
+	if o.dllPath == "" {
+		return nil
+	}
+	if err := SetDLLPath(o.dllPath); err != errDLLSettled {
+		return err
+	}
+	dllPolicy.Lock()
+	defer dllPolicy.Unlock()
+	if dllPolicy.path != o.dllPath {
+		return errors.Wrapf(errDLLSettled,
+			"cannot load from %q", o.dllPath)
+	}
+	return nil
+}
+
+// loadDLLFromPath loads the DLL from the path, which is
+// either the DLL itself or the directory containing it.
+func loadDLLFromPath(path, dllName string) (*syscall.DLL, error) {
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		path = filepath.Join(path, dllName)
+	}
+	dll, err := syscall.LoadDLL(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "winfsp load dll %q", path)
+	}
+	return dll, nil
+}
+
+// loadDLLFromAppDir attempts to load the DLL from the
+// directory of the executable.
+func loadDLLFromAppDir(dllName string) *syscall.DLL {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	path := filepath.Join(filepath.Dir(executable), dllName)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	dll, _ := syscall.LoadDLL(path)
+	return dll
+}
@@ -0,0 +1,79 @@
+package winfsp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+// resetDLLPolicy clears the DLL policy for the test, which
+// is restored after the test.
+func resetDLLPolicy(t *testing.T) {
+	t.Helper()
+	dllPolicy.Lock()
+	path, appDir, settled := dllPolicy.path, dllPolicy.appDir, dllPolicy.settled
+	dllPolicy.path, dllPolicy.appDir, dllPolicy.settled = "", false, false
+	dllPolicy.Unlock()
+	t.Cleanup(func() {
+		dllPolicy.Lock()
+		defer dllPolicy.Unlock()
+		dllPolicy.path, dllPolicy.appDir, dllPolicy.settled = path, appDir, settled
+	})
+}
+
+func TestDLLPolicy(t *testing.T) {
+	assert := assert.New(t)
+	resetDLLPolicy(t)
+	t.Setenv(DLLPathEnv, `C:\env\winfsp`)
+
+	// The path set explicitly overrides the environment.
+	path, appDir := settleDLLPolicy()
+	assert.Equal(`C:\env\winfsp`, path)
+	assert.False(appDir)
+	resetDLLPolicy(t)
+	assert.NoError(SetDLLPath(`C:\app\winfsp`))
+	assert.NoError(SetDLLApplicationDir(true))
+	path, appDir = settleDLLPolicy()
+	assert.Equal(`C:\app\winfsp`, path)
+	assert.True(appDir)
+
+	// The policy cannot be changed once the DLL is loaded,
+	// and mounting fails when it is loaded from elsewhere.
+	assert.Equal(errDLLSettled, SetDLLPath(`C:\other`))
+	assert.Equal(errDLLSettled, SetDLLApplicationDir(false))
+	o := newOption()
+	DLLPath(`C:\app\winfsp`)(o)
+	DLLApplicationDir(true)(o)
+	assert.NoError(applyDLLOptions(o))
+	o = newOption()
+	DLLPath(`C:\other`)(o)
+	assert.Equal(errDLLSettled, errors.Cause(applyDLLOptions(o)))
+}
+
+func TestLoadDLLFromPath(t *testing.T) {
+	assert := assert.New(t)
+	system, err := windows.GetSystemDirectory()
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The path is either the DLL or the directory of it.
+	for _, path := range []string{
+		system, filepath.Join(system, "kernel32.dll"),
+	} {
+		dll, err := loadDLLFromPath(path, "kernel32.dll")
+		if assert.NoError(err, path) {
+			_, err = dll.FindProc("GetCurrentProcessId")
+			assert.NoError(err)
+		}
+	}
+	dir := t.TempDir()
+	_, err = loadDLLFromPath(dir, "winfsp-test.dll")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "winfsp-test.dll")
+	}
+	assert.Nil(loadDLLFromAppDir("winfsp-test.dll"))
+}
@@ -0,0 +1,207 @@
+package ea
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FlagNeedEa is the flag of FILE_NEED_EA, marking that the
+// file cannot be interpreted without the attribute.
+const FlagNeedEa = 0x80
+
+const (
+	headerSize = 8
+	alignment  = 4
+
+	// MaxNameLength is the maximum length of the names.
+	MaxNameLength = 255
+
+	// MaxValueLength is the maximum length of the values.
+	MaxValueLength = 65535
+)
+
+// Attribute is an extended attribute of the file.
+//
+// An attribute with empty value removes the attribute of
+// the same name when it is set onto the file.
+type Attribute struct {
+	Name  string
+	Value []byte
+	Flags uint8
+}
+
+// size is the number of bytes the attribute occupies,
+// excluding the padding to the next entry.
+func (a Attribute) size() int {
+	return headerSize + len(a.Name) + 1 + len(a.Value)
+}
+
+func (a Attribute) validate() error {
+	if len(a.Name) == 0 || len(a.Name) > MaxNameLength {
+		return errors.Errorf("invalid ea name length %d", len(a.Name))
+	}
+	if strings.IndexByte(a.Name, 0) >= 0 {
+		return errors.Errorf("ea name %q contains nul", a.Name)
+	}
+	if len(a.Value) > MaxValueLength {
+		return errors.Errorf(
+			"ea %q value length %d too large", a.Name, len(a.Value))
+	}
+	return nil
+}
+
+var errTruncated = errors.New("truncated ea information")
+
+// Iterator walks through the entries of the list.
+type Iterator struct {
+	data    []byte
+	offset  int
+	done    bool
+	current Attribute
+	err     error
+}
+
+// NewIterator creates the iterator over the list.
+func NewIterator(data []byte) *Iterator {
+	return &Iterator{data: data, done: len(data) == 0}
+}
+
+// Next advances to the next entry, returning false when
+// the list is exhausted or malformed.
+func (it *Iterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	rest := it.data[it.offset:]
+	if len(rest) < headerSize {
+		it.err = errTruncated
+		return false
+	}
+	next := int(binary.LittleEndian.Uint32(rest[0:4]))
+	nameLength := int(rest[5])
+	valueLength := int(binary.LittleEndian.Uint16(rest[6:8]))
+	size := headerSize + nameLength + 1 + valueLength
+	if len(rest) < size {
+		it.err = errTruncated
+		return false
+	}
+	if next != 0 && (next < size || next > len(rest)) {
+		it.err = errors.Errorf(
+			"invalid ea next entry offset %d", next)
+		return false
+	}
+	name := rest[headerSize : headerSize+nameLength]
+	value := rest[headerSize+nameLength+1 : size]
+	it.current = Attribute{
+		Name:  string(name),
+		Value: value,
+		Flags: rest[4],
+	}
+	if next == 0 {
+		it.done = true
+	} else {
+		it.offset += next
+	}
+	return true
+}
+
+// Attribute returns the current entry. The value refers to
+// the buffer of the list and must be copied to be retained.
+func (it *Iterator) Attribute() Attribute {
+	return it.current
+}
+
+// Err returns the error encountered while iterating.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Decode decodes all entries of the list, with the values
+// copied out of the buffer.
+func Decode(data []byte) ([]Attribute, error) {
+	var result []Attribute
+	it := NewIterator(data)
+	for it.Next() {
+		attr := it.Attribute()
+		attr.Value = append([]byte(nil), attr.Value...)
+		result = append(result, attr)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Builder fills the entries into a fixed size buffer, which
+// is usually the buffer provided to the GetEa.
+type Builder struct {
+	buf  []byte
+	n    int
+	last int
+}
+
+// NewBuilder creates the builder filling the buffer.
+func NewBuilder(buf []byte) *Builder {
+	return &Builder{buf: buf, last: -1}
+}
+
+// Add appends the attribute to the list, returning false
+// without modifying the list when the buffer is full.
+func (b *Builder) Add(attr Attribute) (bool, error) {
+	if err := attr.validate(); err != nil {
+		return false, err
+	}
+	offset := b.n
+	if b.last >= 0 {
+		offset = (b.n + alignment - 1) &^ (alignment - 1)
+	}
+	if offset+attr.size() > len(b.buf) {
+		return false, nil
+	}
+	entry := b.buf[offset : offset+attr.size()]
+	binary.LittleEndian.PutUint32(entry[0:4], 0)
+	entry[4] = attr.Flags
+	entry[5] = uint8(len(attr.Name))
+	binary.LittleEndian.PutUint16(entry[6:8], uint16(len(attr.Value)))
+	copy(entry[headerSize:], attr.Name)
+	entry[headerSize+len(attr.Name)] = 0
+	copy(entry[headerSize+len(attr.Name)+1:], attr.Value)
+	if b.last >= 0 {
+		// Zero the padding and link the previous entry.
+		for i := b.n; i < offset; i++ {
+			b.buf[i] = 0
+		}
+		binary.LittleEndian.PutUint32(
+			b.buf[b.last:b.last+4], uint32(offset-b.last))
+	}
+	b.last = offset
+	b.n = offset + attr.size()
+	return true, nil
+}
+
+// Len returns the number of bytes filled.
+func (b *Builder) Len() int {
+	return b.n
+}
+
+// Bytes returns the filled portion of the buffer.
+func (b *Builder) Bytes() []byte {
+	return b.buf[:b.n]
+}
+
+// Encode encodes the attributes into a new list.
+func Encode(attrs []Attribute) ([]byte, error) {
+	size := 0
+	for _, attr := range attrs {
+		size = (size+alignment-1)&^(alignment-1) + attr.size()
+	}
+	b := NewBuilder(make([]byte, size))
+	for _, attr := range attrs {
+		if _, err := b.Add(attr); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+package ea
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	attrs := []Attribute{
+		{Name: "$LXUID", Value: []byte{0xe8, 0x03, 0, 0}},
+		{Name: "A", Value: []byte("x"), Flags: FlagNeedEa},
+		{Name: "EMPTY"},
+	}
+	data, err := Encode(attrs)
+	assert.NoError(err)
+	// The second entry starts at the aligned end of the first.
+	assert.Equal([]byte{20, 0, 0, 0}, data[0:4])
+	decoded, err := Decode(data)
+	assert.NoError(err)
+	assert.Equal(attrs, decoded)
+
+	decoded, err = Decode(nil)
+	assert.NoError(err)
+	assert.Empty(decoded)
+}
+
+func TestBuilderFull(t *testing.T) {
+	assert := assert.New(t)
+	buf := make([]byte, 24)
+	b := NewBuilder(buf)
+	ok, err := b.Add(Attribute{Name: "A", Value: []byte("x")})
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(11, b.Len())
+	ok, err = b.Add(Attribute{Name: "B", Value: []byte("yyyy")})
+	assert.NoError(err)
+	assert.False(ok)
+	assert.Equal(11, b.Len())
+	decoded, err := Decode(b.Bytes())
+	assert.NoError(err)
+	assert.Len(decoded, 1)
+
+	_, err = b.Add(Attribute{Name: ""})
+	assert.Error(err)
+	_, err = b.Add(Attribute{Name: "a\x00b"})
+	assert.Error(err)
+}
+
+func TestMalformed(t *testing.T) {
+	assert := assert.New(t)
+	data, err := Encode([]Attribute{
+		{Name: "A", Value: []byte("x")},
+		{Name: "B", Value: []byte("y")},
+	})
+	assert.NoError(err)
+
+	_, err = Decode(data[:len(data)-1])
+	assert.Error(err)
+
+	looping := append([]byte(nil), data...)
+	looping[0] = 4
+	_, err = Decode(looping)
+	assert.Error(err)
+
+	beyond := append([]byte(nil), data...)
+	beyond[0] = 200
+	_, err = Decode(beyond)
+	assert.Error(err)
+
+	_, err = Decode([]byte{0, 0, 0})
+	assert.Error(err)
+}
+
+func TestWSLMetadata(t *testing.T) {
+	assert := assert.New(t)
+	meta := WSLMetadata{
+		Present: WSLUID | WSLMode | WSLDev,
+		UID:     1000, Mode: 0o100644, DevMajor: 8, DevMinor: 1,
+	}
+	attrs := meta.Attributes()
+	assert.Len(attrs, 3)
+	assert.Equal(NameLxUID, attrs[0].Name)
+	assert.Equal([]byte{0xe8, 0x03, 0, 0}, attrs[0].Value)
+	parsed, err := ParseWSL(append(attrs, Attribute{Name: "OTHER"}))
+	assert.NoError(err)
+	assert.Equal(meta, parsed)
+
+	// The names are case insensitive, and empty values
+	// remove the fields.
+	parsed, err = ParseWSL([]Attribute{
+		{Name: "$lxgid", Value: []byte{1, 0, 0, 0}},
+		{Name: NameLxUID, Value: []byte{1, 0, 0, 0}},
+		{Name: NameLxUID},
+	})
+	assert.NoError(err)
+	assert.Equal(WSLMetadata{Present: WSLGID, GID: 1}, parsed)
+
+	_, err = ParseWSL([]Attribute{{Name: NameLxDev, Value: []byte{1, 0, 0, 0}}})
+	assert.Error(err)
+}
@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package ea
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzParseEA(f *testing.F) {
+	data, err := Encode([]Attribute{
+		{Name: "$LXUID", Value: []byte{0xe8, 0x03, 0, 0}},
+		{Name: "A", Value: []byte("x"), Flags: FlagNeedEa},
+		{Name: "EMPTY"},
+	})
+	assert.NoError(f, err)
+	f.Add(data)
+	f.Add(data[:len(data)-1])
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0, 1, 0, 0, 'A', 0})
+	f.Add([]byte{4, 0, 0, 0, 0, 0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The list comes from the kernel, and walking its next
+		// entry offsets must never panic.
+		attrs, err := Decode(data)
+		if err != nil {
+			return
+		}
+		for _, attr := range attrs {
+			if attr.validate() != nil {
+				// The names with NUL are decodable but are not
+				// accepted when building a list.
+				return
+			}
+		}
+
+		// The decoded attributes must survive encoding, and
+		// encoding them again must produce the same list.
+		encoded, err := Encode(attrs)
+		if !assert.NoError(t, err) {
+			return
+		}
+		decoded, err := Decode(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, attrs, decoded)
+		reencoded, err := Encode(decoded)
+		assert.NoError(t, err)
+		assert.Equal(t, encoded, reencoded)
+	})
+}
@@ -0,0 +1,13 @@
+// Package ea decodes and encodes the lists of extended
+// attributes of windows, i.e. the FILE_FULL_EA_INFORMATION
+// structures chained by their NextEntryOffset.
+//
+// The lists are received by the SetEa and CreateEx of the
+// file systems and filled into the buffer by the GetEa,
+// where the offsets and lengths come from the callers and
+// must never be trusted, so the Iterator checks every entry
+// against the bounds of the buffer before decoding it.
+//
+// The WSLMetadata converts the POSIX metadata stored by WSL
+// from and into the extended attributes.
+package ea
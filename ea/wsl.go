@@ -0,0 +1,104 @@
+package ea
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The names of the extended attributes where WSL stores the
+// POSIX metadata of the files, when the file system is
+// mounted with the WSL features enabled.
+const (
+	NameLxUID  = "$LXUID"
+	NameLxGID  = "$LXGID"
+	NameLxMode = "$LXMOD"
+	NameLxDev  = "$LXDEV"
+)
+
+// WSLField marks the fields present in the WSLMetadata.
+type WSLField uint8
+
+const (
+	WSLUID WSLField = 1 << iota
+	WSLGID
+	WSLMode
+	WSLDev
+)
+
+// WSLMetadata is the POSIX metadata of a file created from
+// WSL, which is carried in the extended attributes.
+//
+// Only the fields marked in Present are valid, since WSL
+// might set them separately, e.g. only the $LXMOD upon a
+// chmod of the file.
+type WSLMetadata struct {
+	Present  WSLField
+	UID      uint32
+	GID      uint32
+	Mode     uint32
+	DevMajor uint32
+	DevMinor uint32
+}
+
+// ParseWSL extracts the WSL metadata from the attributes,
+// ignoring the attributes of other names.
+func ParseWSL(attrs []Attribute) (WSLMetadata, error) {
+	var result WSLMetadata
+	for _, attr := range attrs {
+		var field WSLField
+		var values []*uint32
+		switch {
+		case strings.EqualFold(attr.Name, NameLxUID):
+			field, values = WSLUID, []*uint32{&result.UID}
+		case strings.EqualFold(attr.Name, NameLxGID):
+			field, values = WSLGID, []*uint32{&result.GID}
+		case strings.EqualFold(attr.Name, NameLxMode):
+			field, values = WSLMode, []*uint32{&result.Mode}
+		case strings.EqualFold(attr.Name, NameLxDev):
+			field, values = WSLDev, []*uint32{
+				&result.DevMajor, &result.DevMinor}
+		default:
+			continue
+		}
+		if len(attr.Value) == 0 {
+			// Empty value removes the attribute.
+			for _, value := range values {
+				*value = 0
+			}
+			result.Present &^= field
+			continue
+		}
+		if len(attr.Value) != 4*len(values) {
+			return WSLMetadata{}, errors.Errorf(
+				"invalid ea %q value length %d", attr.Name, len(attr.Value))
+		}
+		for i, value := range values {
+			*value = binary.LittleEndian.Uint32(attr.Value[4*i:])
+		}
+		result.Present |= field
+	}
+	return result, nil
+}
+
+// Attributes encodes the present fields of the metadata
+// into the extended attributes.
+func (m WSLMetadata) Attributes() []Attribute {
+	var result []Attribute
+	add := func(field WSLField, name string, values ...uint32) {
+		if m.Present&field == 0 {
+			return
+		}
+		value := make([]byte, 4*len(values))
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(value[4*i:], v)
+		}
+		result = append(result, Attribute{Name: name, Value: value})
+	}
+	add(WSLUID, NameLxUID, m.UID)
+	add(WSLGID, NameLxGID, m.GID)
+	add(WSLMode, NameLxMode, m.Mode)
+	add(WSLDev, NameLxDev, m.DevMajor, m.DevMinor)
+	return result
+}
@@ -0,0 +1,105 @@
+package winfsp
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// WslFeatures specifies whether the features required by
+// WSL are supported, which requires the file system to
+// support extended attributes.
+//
+// WSL stores the POSIX metadata of the files in extended
+// attributes, which are passed to CreateEx and SetEa, and
+// retrieved by GetEa. They can be converted with the
+// ea.WSLMetadata.
+func WslFeatures(value bool) Option {
+	return func(o *option) {
+		o.wslFeatures = value
+	}
+}
+
+// BehaviourGetEa retrieves the extended attributes of the
+// file, filling the FILE_FULL_EA_INFORMATION list into the
+// buffer and returning the number of bytes filled.
+//
+// The list can be built safely with the ea.Builder.
+type BehaviourGetEa interface {
+	GetEa(fs *FileSystemRef, file uintptr, buf []byte) (int, error)
+}
+
+func delegateGetEa(
+	fileSystem, fileContext, ea uintptr,
+	eaLength uint32, bytesTransferred *uint32,
+) (status windows.NTStatus) {
+	*bytesTransferred = 0
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"GetEa", fileContext, 0, 0, eaLength, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	n, err := b.getEa.GetEa(
+		ref, fileContext, enforceBytePtr(ea, int(eaLength)))
+	if err != nil {
+		return ref.convertNTStatus(err)
+	}
+	*bytesTransferred = uint32(n)
+	return windows.STATUS_SUCCESS
+}
+
+var go_delegateGetEa = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, ea uintptr,
+	eaLength uint32, bytesTransferred *uint32,
+) uintptr {
+	return uintptr(delegateGetEa(
+		fileSystem, fileContext, ea,
+		eaLength, bytesTransferred,
+	))
+})
+
+// BehaviourSetEa sets the extended attributes of the file,
+// where the attributes with empty value are to be removed.
+//
+// The FILE_FULL_EA_INFORMATION list comes from the caller
+// and can be walked safely with the ea.Iterator.
+type BehaviourSetEa interface {
+	SetEa(
+		fs *FileSystemRef, file uintptr, ea []byte,
+		info *FSP_FSCTL_FILE_INFO,
+	) error
+}
+
+func delegateSetEa(
+	fileSystem, fileContext, ea uintptr,
+	eaLength uint32, fileInfoAddr uintptr,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"SetEa", fileContext, 0, 0, eaLength, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.setEa.SetEa(
+		ref, fileContext, enforceBytePtr(ea, int(eaLength)),
+		(*FSP_FSCTL_FILE_INFO)(unsafe.Pointer(fileInfoAddr)),
+	))
+}
+
+var go_delegateSetEa = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, ea uintptr,
+	eaLength uint32, fileInfoAddr uintptr,
+) uintptr {
+	return uintptr(delegateSetEa(
+		fileSystem, fileContext, ea,
+		eaLength, fileInfoAddr,
+	))
+})
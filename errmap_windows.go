@@ -0,0 +1,68 @@
+package winfsp
+
+import (
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+// ErrorMapperFunc maps the errors returned by the behaviours
+// into NTSTATUS, returning false if the error is unknown to
+// it, so that the error is passed to the next mapper.
+type ErrorMapperFunc func(err error) (windows.NTStatus, bool)
+
+// ErrorMapper adds the error mapper of the file system, so
+// that the backends are able to map their domain errors,
+// e.g. quota exceeded, to the specific NTSTATUS codes.
+//
+// The mappers of the file system are consulted in the order
+// they are added, before the mappers registered by the
+// RegisterErrorMapper and the builtin conversions.
+func ErrorMapper(mapper ErrorMapperFunc) Option {
+	return func(o *option) {
+		o.errorMappers = append(o.errorMappers, mapper)
+	}
+}
+
+var errorMappers struct {
+	mtx     sync.RWMutex
+	mappers []ErrorMapperFunc
+}
+
+// RegisterErrorMapper registers the error mapper shared by
+// all file systems, which is consulted in the order they
+// are registered, before the builtin conversions.
+//
+// This is usually called at the initialization of the
+// packages providing the backends.
+func RegisterErrorMapper(mapper ErrorMapperFunc) {
+	errorMappers.mtx.Lock()
+	defer errorMappers.mtx.Unlock()
+	errorMappers.mappers = append(errorMappers.mappers, mapper)
+}
+
+// mapRegisteredError consults the registered mappers.
+func mapRegisteredError(err error) (windows.NTStatus, bool) {
+	errorMappers.mtx.RLock()
+	defer errorMappers.mtx.RUnlock()
+	for _, mapper := range errorMappers.mappers {
+		if status, ok := mapper(err); ok {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// convertNTStatus converts the error returned by the
+// behaviours of the file system into NTSTATUS.
+func (ref *FileSystemRef) convertNTStatus(err error) windows.NTStatus {
+	if err == nil {
+		return windows.STATUS_SUCCESS
+	}
+	for _, mapper := range ref.errorMappers {
+		if status, ok := mapper(err); ok {
+			return status
+		}
+	}
+	return convertNTStatus(err)
+}
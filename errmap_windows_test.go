@@ -0,0 +1,43 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+type quotaError struct{}
+
+func (quotaError) Error() string { return "quota exceeded" }
+
+func TestErrorMapper(t *testing.T) {
+	assert := assert.New(t)
+	errBusy := errors.New("backend busy")
+	ref := &FileSystemRef{errorMappers: []ErrorMapperFunc{
+		func(err error) (windows.NTStatus, bool) {
+			if errors.Is(err, errBusy) {
+				return windows.STATUS_DEVICE_BUSY, true
+			}
+			return 0, false
+		},
+	}}
+	RegisterErrorMapper(func(err error) (windows.NTStatus, bool) {
+		var quota quotaError
+		if errors.As(err, &quota) {
+			return windows.STATUS_DISK_FULL, true
+		}
+		return 0, false
+	})
+
+	assert.Equal(windows.STATUS_SUCCESS, ref.convertNTStatus(nil))
+	assert.Equal(windows.STATUS_DEVICE_BUSY,
+		ref.convertNTStatus(errors.Wrap(errBusy, "read")))
+	assert.Equal(windows.STATUS_DISK_FULL,
+		ref.convertNTStatus(errors.Wrap(quotaError{}, "write")))
+	assert.Equal(windows.STATUS_DISK_FULL,
+		convertNTStatus(quotaError{}))
+	assert.Equal(windows.STATUS_INTERNAL_ERROR,
+		convertNTStatus(errBusy))
+}
@@ -0,0 +1,69 @@
+package winfsp
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/filetime"
+)
+
+// allocationUnit is the size of the allocation unit of the
+// volume, i.e. SectorSize * SectorsPerAllocationUnit.
+const allocationUnit = 4096
+
+// SetTimes sets the timestamps of the file information,
+// where the change time is set to the write time, and
+// the zero time is converted into 0.
+func (info *FSP_FSCTL_FILE_INFO) SetTimes(
+	creation, access, write time.Time,
+) {
+	info.CreationTime = filetime.Timestamp(creation)
+	info.LastAccessTime = filetime.Timestamp(access)
+	info.LastWriteTime = filetime.Timestamp(write)
+	info.ChangeTime = info.LastWriteTime
+}
+
+// Times returns the timestamps of the file information.
+func (info *FSP_FSCTL_FILE_INFO) Times() (
+	creation, access, write, change time.Time,
+) {
+	return filetime.Time(info.CreationTime),
+		filetime.Time(info.LastAccessTime),
+		filetime.Time(info.LastWriteTime),
+		filetime.Time(info.ChangeTime)
+}
+
+// FromOsFileInfo fills the file information with the one
+// returned by os.Stat, whose attributes and timestamps are
+// taken from the Win32FileAttributeData when available.
+//
+// The index number, reparse tag and other fields beyond
+// the reach of os.FileInfo are left untouched.
+func (info *FSP_FSCTL_FILE_INFO) FromOsFileInfo(source os.FileInfo) {
+	info.FileSize = uint64(source.Size())
+	info.AllocationSize = (info.FileSize + allocationUnit - 1) /
+		allocationUnit * allocationUnit
+	if data, ok := source.Sys().(*syscall.Win32FileAttributeData); ok {
+		info.FileAttributes = data.FileAttributes
+		info.CreationTime = filetime.Filetime(data.CreationTime)
+		info.LastAccessTime = filetime.Filetime(data.LastAccessTime)
+		info.LastWriteTime = filetime.Filetime(data.LastWriteTime)
+		info.ChangeTime = info.LastWriteTime
+		return
+	}
+	info.FileAttributes = 0
+	if source.IsDir() {
+		info.FileAttributes |= windows.FILE_ATTRIBUTE_DIRECTORY
+	}
+	if source.Mode().Perm()&0o222 == 0 {
+		info.FileAttributes |= windows.FILE_ATTRIBUTE_READONLY
+	}
+	if info.FileAttributes == 0 {
+		info.FileAttributes = windows.FILE_ATTRIBUTE_NORMAL
+	}
+	modTime := source.ModTime()
+	info.SetTimes(modTime, modTime, modTime)
+}
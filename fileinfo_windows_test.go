@@ -0,0 +1,55 @@
+package winfsp
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+type testFileInfo struct {
+	os.FileInfo
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (f testFileInfo) Size() int64        { return f.size }
+func (f testFileInfo) Mode() os.FileMode  { return f.mode }
+func (f testFileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f testFileInfo) ModTime() time.Time { return f.modTime }
+func (f testFileInfo) Sys() interface{}   { return nil }
+
+func TestFileInfoTimes(t *testing.T) {
+	assert := assert.New(t)
+	creation := time.Unix(1600000000, 100)
+	write := time.Unix(1700000000, 0)
+	var info FSP_FSCTL_FILE_INFO
+	info.SetTimes(creation, time.Time{}, write)
+	assert.Equal(uint64(0), info.LastAccessTime)
+	gotCreation, gotAccess, gotWrite, gotChange := info.Times()
+	assert.True(creation.Equal(gotCreation))
+	assert.True(gotAccess.IsZero())
+	assert.True(write.Equal(gotWrite))
+	assert.True(write.Equal(gotChange))
+}
+
+func TestFileInfoFromOsFileInfo(t *testing.T) {
+	assert := assert.New(t)
+	modTime := time.Unix(1700000000, 0)
+	var info FSP_FSCTL_FILE_INFO
+	info.FromOsFileInfo(testFileInfo{
+		size: 5000, mode: 0o444, modTime: modTime,
+	})
+	assert.Equal(uint64(5000), info.FileSize)
+	assert.Equal(uint64(8192), info.AllocationSize)
+	assert.Equal(uint32(windows.FILE_ATTRIBUTE_READONLY), info.FileAttributes)
+	_, _, write, _ := info.Times()
+	assert.True(modTime.Equal(write))
+
+	info.FromOsFileInfo(testFileInfo{mode: os.ModeDir | 0o755})
+	assert.Equal(uint32(windows.FILE_ATTRIBUTE_DIRECTORY), info.FileAttributes)
+	assert.Equal(uint64(0), info.CreationTime)
+}
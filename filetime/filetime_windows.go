@@ -18,7 +18,12 @@ func uint64FromFiletime(filetime *syscall.Filetime) uint64 {
 	return result
 }
 
+// Timestamp converts the time into filetime, and the
+// zero time is converted into 0.
 func Timestamp(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
 	filetime := pool.Get().(*syscall.Filetime)
 	defer pool.Put(filetime)
 	*filetime = syscall.NsecToFiletime(t.UnixNano())
@@ -28,3 +33,13 @@ func Timestamp(t time.Time) uint64 {
 func Filetime(t syscall.Filetime) uint64 {
 	return uint64FromFiletime(&t)
 }
+
+// Time converts the filetime into time, and 0 is converted
+// into the zero time.
+func Time(filetime uint64) time.Time {
+	if filetime == 0 {
+		return time.Time{}
+	}
+	ft := (*syscall.Filetime)(unsafe.Pointer(&filetime))
+	return time.Unix(0, ft.Nanoseconds())
+}
@@ -1,5 +1,5 @@
 // Package filetime provides support for converting a
-// golang's timestamp into a file timestamp.
+// golang's timestamp into a file timestamp, and back.
 //
 // The filetime must fit in with a uint64 number, so
 // that we can store uint64 instead of concrete values.
@@ -0,0 +1,225 @@
+package winfsp
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// flagName is the name of a bit flag for formatting.
+type flagName struct {
+	flag uint32
+	name string
+}
+
+// formatFlags formats the flags as their names joined by
+// "|", with the unknown bits formatted in hexadecimal.
+func formatFlags(value uint32, names []flagName) string {
+	var parts []string
+	for _, item := range names {
+		if value&item.flag == item.flag {
+			parts = append(parts, item.name)
+			value &^= item.flag
+		}
+	}
+	if value != 0 {
+		parts = append(parts, fmt.Sprintf("0x%x", value))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, "|")
+}
+
+// CreateOptions is the createOptions passed to the Open
+// and Create behaviours, which carries the disposition in
+// its highest byte and the FILE_* options in the rest.
+type CreateOptions uint32
+
+var dispositionNames = []string{
+	windows.FILE_SUPERSEDE:    "FILE_SUPERSEDE",
+	windows.FILE_OPEN:         "FILE_OPEN",
+	windows.FILE_CREATE:       "FILE_CREATE",
+	windows.FILE_OPEN_IF:      "FILE_OPEN_IF",
+	windows.FILE_OVERWRITE:    "FILE_OVERWRITE",
+	windows.FILE_OVERWRITE_IF: "FILE_OVERWRITE_IF",
+}
+
+var createOptionNames = []flagName{
+	{windows.FILE_DIRECTORY_FILE, "FILE_DIRECTORY_FILE"},
+	{windows.FILE_WRITE_THROUGH, "FILE_WRITE_THROUGH"},
+	{windows.FILE_SEQUENTIAL_ONLY, "FILE_SEQUENTIAL_ONLY"},
+	{windows.FILE_NO_INTERMEDIATE_BUFFERING, "FILE_NO_INTERMEDIATE_BUFFERING"},
+	{windows.FILE_SYNCHRONOUS_IO_ALERT, "FILE_SYNCHRONOUS_IO_ALERT"},
+	{windows.FILE_SYNCHRONOUS_IO_NONALERT, "FILE_SYNCHRONOUS_IO_NONALERT"},
+	{windows.FILE_NON_DIRECTORY_FILE, "FILE_NON_DIRECTORY_FILE"},
+	{windows.FILE_CREATE_TREE_CONNECTION, "FILE_CREATE_TREE_CONNECTION"},
+	{windows.FILE_COMPLETE_IF_OPLOCKED, "FILE_COMPLETE_IF_OPLOCKED"},
+	{windows.FILE_NO_EA_KNOWLEDGE, "FILE_NO_EA_KNOWLEDGE"},
+	{windows.FILE_OPEN_REMOTE_INSTANCE, "FILE_OPEN_REMOTE_INSTANCE"},
+	{windows.FILE_RANDOM_ACCESS, "FILE_RANDOM_ACCESS"},
+	{windows.FILE_DELETE_ON_CLOSE, "FILE_DELETE_ON_CLOSE"},
+	{windows.FILE_OPEN_BY_FILE_ID, "FILE_OPEN_BY_FILE_ID"},
+	{windows.FILE_OPEN_FOR_BACKUP_INTENT, "FILE_OPEN_FOR_BACKUP_INTENT"},
+	{windows.FILE_NO_COMPRESSION, "FILE_NO_COMPRESSION"},
+	{windows.FILE_OPEN_REQUIRING_OPLOCK, "FILE_OPEN_REQUIRING_OPLOCK"},
+	{windows.FILE_DISALLOW_EXCLUSIVE, "FILE_DISALLOW_EXCLUSIVE"},
+	{windows.FILE_RESERVE_OPFILTER, "FILE_RESERVE_OPFILTER"},
+	{windows.FILE_OPEN_REPARSE_POINT, "FILE_OPEN_REPARSE_POINT"},
+	{windows.FILE_OPEN_NO_RECALL, "FILE_OPEN_NO_RECALL"},
+	{windows.FILE_OPEN_FOR_FREE_SPACE_QUERY, "FILE_OPEN_FOR_FREE_SPACE_QUERY"},
+}
+
+// Disposition returns the disposition, e.g. FILE_OPEN_IF.
+func (o CreateOptions) Disposition() uint32 {
+	return uint32(o>>24) & 0xff
+}
+
+// Options returns the FILE_* options without disposition.
+func (o CreateOptions) Options() uint32 {
+	return uint32(o) & 0x00ffffff
+}
+
+// Has tells whether all the options are specified.
+func (o CreateOptions) Has(options uint32) bool {
+	return o.Options()&options == options
+}
+
+// IsDirectoryFile tells whether the file must be a directory.
+func (o CreateOptions) IsDirectoryFile() bool {
+	return o.Has(windows.FILE_DIRECTORY_FILE)
+}
+
+// IsNonDirectoryFile tells whether the file must not be a
+// directory.
+func (o CreateOptions) IsNonDirectoryFile() bool {
+	return o.Has(windows.FILE_NON_DIRECTORY_FILE)
+}
+
+// DeleteOnClose tells whether the file should be deleted
+// when its last handle is closed.
+func (o CreateOptions) DeleteOnClose() bool {
+	return o.Has(windows.FILE_DELETE_ON_CLOSE)
+}
+
+// OpenReparsePoint tells whether the reparse point itself
+// should be opened instead of its target.
+func (o CreateOptions) OpenReparsePoint() bool {
+	return o.Has(windows.FILE_OPEN_REPARSE_POINT)
+}
+
+func (o CreateOptions) String() string {
+	disposition := fmt.Sprintf("0x%x", o.Disposition())
+	if d := o.Disposition(); int(d) < len(dispositionNames) {
+		disposition = dispositionNames[d]
+	}
+	if o.Options() == 0 {
+		return disposition
+	}
+	return disposition + "|" + formatFlags(o.Options(), createOptionNames)
+}
+
+// fileDeleteChild is the FILE_DELETE_CHILD access right,
+// which is missing from the windows package.
+const fileDeleteChild = 0x00000040
+
+// GrantedAccess is the grantedAccess passed to the Open
+// and Create behaviours, which is the access mask granted
+// to the handle being opened.
+type GrantedAccess uint32
+
+var grantedAccessNames = []flagName{
+	{windows.FILE_READ_DATA, "FILE_READ_DATA"},
+	{windows.FILE_WRITE_DATA, "FILE_WRITE_DATA"},
+	{windows.FILE_APPEND_DATA, "FILE_APPEND_DATA"},
+	{windows.FILE_READ_EA, "FILE_READ_EA"},
+	{windows.FILE_WRITE_EA, "FILE_WRITE_EA"},
+	{windows.FILE_EXECUTE, "FILE_EXECUTE"},
+	{fileDeleteChild, "FILE_DELETE_CHILD"},
+	{windows.FILE_READ_ATTRIBUTES, "FILE_READ_ATTRIBUTES"},
+	{windows.FILE_WRITE_ATTRIBUTES, "FILE_WRITE_ATTRIBUTES"},
+	{windows.DELETE, "DELETE"},
+	{windows.READ_CONTROL, "READ_CONTROL"},
+	{windows.WRITE_DAC, "WRITE_DAC"},
+	{windows.WRITE_OWNER, "WRITE_OWNER"},
+	{windows.SYNCHRONIZE, "SYNCHRONIZE"},
+	{windows.ACCESS_SYSTEM_SECURITY, "ACCESS_SYSTEM_SECURITY"},
+}
+
+// Has tells whether all the access rights are granted.
+func (a GrantedAccess) Has(access uint32) bool {
+	return uint32(a)&access == access
+}
+
+// CanRead tells whether the data can be read.
+func (a GrantedAccess) CanRead() bool {
+	return a.Has(windows.FILE_READ_DATA)
+}
+
+// CanWrite tells whether the data can be written or
+// appended.
+func (a GrantedAccess) CanWrite() bool {
+	return uint32(a)&(windows.FILE_WRITE_DATA|windows.FILE_APPEND_DATA) != 0
+}
+
+// WantsDelete tells whether the file can be deleted.
+func (a GrantedAccess) WantsDelete() bool {
+	return a.Has(windows.DELETE)
+}
+
+func (a GrantedAccess) String() string {
+	return formatFlags(uint32(a), grantedAccessNames)
+}
+
+// CleanupFlags is the cleanupFlags passed to the Cleanup
+// behaviour, telling the work to do on the last handle.
+type CleanupFlags uint32
+
+var cleanupFlagNames = []flagName{
+	{FspCleanupDelete, "Delete"},
+	{FspCleanupSetAllocationSize, "SetAllocationSize"},
+	{FspCleanupSetArchiveBit, "SetArchiveBit"},
+	{FspCleanupSetLastAccessTime, "SetLastAccessTime"},
+	{FspCleanupSetLastWriteTime, "SetLastWriteTime"},
+	{FspCleanupSetChangeTime, "SetChangeTime"},
+}
+
+// WantsDelete tells whether the file should be deleted.
+func (f CleanupFlags) WantsDelete() bool {
+	return f&FspCleanupDelete != 0
+}
+
+// SetAllocationSize tells whether the allocation size
+// should be truncated to the file size.
+func (f CleanupFlags) SetAllocationSize() bool {
+	return f&FspCleanupSetAllocationSize != 0
+}
+
+// SetArchiveBit tells whether the archive attribute
+// should be set since the file is modified.
+func (f CleanupFlags) SetArchiveBit() bool {
+	return f&FspCleanupSetArchiveBit != 0
+}
+
+// SetLastAccessTime tells whether the last access time
+// should be updated.
+func (f CleanupFlags) SetLastAccessTime() bool {
+	return f&FspCleanupSetLastAccessTime != 0
+}
+
+// SetLastWriteTime tells whether the last write time
+// should be updated.
+func (f CleanupFlags) SetLastWriteTime() bool {
+	return f&FspCleanupSetLastWriteTime != 0
+}
+
+// SetChangeTime tells whether the change time should be
+// updated.
+func (f CleanupFlags) SetChangeTime() bool {
+	return f&FspCleanupSetChangeTime != 0
+}
+
+func (f CleanupFlags) String() string {
+	return formatFlags(uint32(f), cleanupFlagNames)
+}
@@ -0,0 +1,42 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestCreateOptions(t *testing.T) {
+	assert := assert.New(t)
+	options := CreateOptions(windows.FILE_OPEN_IF<<24 |
+		windows.FILE_DIRECTORY_FILE | windows.FILE_DELETE_ON_CLOSE)
+	assert.Equal(uint32(windows.FILE_OPEN_IF), options.Disposition())
+	assert.True(options.IsDirectoryFile())
+	assert.False(options.IsNonDirectoryFile())
+	assert.True(options.DeleteOnClose())
+	assert.Equal("FILE_OPEN_IF|FILE_DIRECTORY_FILE|FILE_DELETE_ON_CLOSE",
+		options.String())
+	assert.Equal("FILE_SUPERSEDE", CreateOptions(0).String())
+	assert.Equal("0x9|FILE_WRITE_THROUGH",
+		CreateOptions(0x9<<24|windows.FILE_WRITE_THROUGH).String())
+}
+
+func TestGrantedAccess(t *testing.T) {
+	assert := assert.New(t)
+	access := GrantedAccess(windows.FILE_APPEND_DATA | windows.DELETE)
+	assert.False(access.CanRead())
+	assert.True(access.CanWrite())
+	assert.True(access.WantsDelete())
+	assert.Equal("FILE_APPEND_DATA|DELETE", access.String())
+	assert.Equal("0", GrantedAccess(0).String())
+}
+
+func TestCleanupFlags(t *testing.T) {
+	assert := assert.New(t)
+	flags := CleanupFlags(FspCleanupDelete | FspCleanupSetChangeTime | 0x100)
+	assert.True(flags.WantsDelete())
+	assert.True(flags.SetChangeTime())
+	assert.False(flags.SetLastWriteTime())
+	assert.Equal("Delete|SetChangeTime|0x100", flags.String())
+}
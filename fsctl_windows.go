@@ -1,9 +1,22 @@
 package winfsp
 
+import (
+	"golang.org/x/sys/windows"
+)
+
+// The layouts of the types transcribed from the headers are
+// asserted by the generated zlayout_windows.go, from the header
+// snapshot inside the cmd/fspgen/inc.
+//go:generate go run ./cmd/fspgen -I cmd/fspgen/inc -assert -o zlayout_windows.go
+
 const (
 	SIZEOF_WCHAR = 2
 )
 
+const (
+	FSP_FSCTL_DEFAULT_ALIGNMENT = 8
+)
+
 const (
 	FspFsctlTransactReservedKind = iota
 	FspFsctlTransactCreateKind
@@ -100,7 +113,7 @@ type FSP_FSCTL_VOLUME_PARAMS_V0 struct {
 	FileSystemAttribute      uint32
 	Prefix                   [FSP_FSCTL_VOLUME_PREFIX_SIZE / SIZEOF_WCHAR]uint16
 	FileSystemName           [FSP_FSCTL_VOLUME_FSNAME_SIZE / SIZEOF_WCHAR]uint16
-	// 416 bytes
+	// 456 bytes
 }
 
 const (
@@ -169,14 +182,12 @@ type FSP_FSCTL_STREAM_INFO struct {
 	Size                 uint16
 	StreamSize           uint64
 	StreamAllocationSize uint64
-	StreamNameBuf        *uint16
 }
 
 type FSP_FSCTL_NOTIFY_INFO struct {
-	Size        uint16
-	Filter      uint32
-	Action      uint32
-	FileNameBuf *uint16
+	Size   uint16
+	Filter uint32
+	Action uint32
 }
 
 type FSP_FSCTL_TRANSACT_FULL_CONTEXT struct {
@@ -193,3 +204,58 @@ type FSP_IO_STATUS struct {
 	Information uint32
 	Status      uint32
 }
+
+// FSP_FSCTL_TRANSACT_RSP is the transact response, where
+// the Rsp is the union of the responses of all kinds.
+type FSP_FSCTL_TRANSACT_RSP struct {
+	Version  uint16
+	Size     uint16
+	Kind     uint32
+	Hint     uint64
+	IoStatus FSP_IO_STATUS
+	Rsp      [13]uint64
+}
+
+type FSP_FSCTL_TRANSACT_REQ_HEADER struct {
+	Version uint16
+	Size    uint16
+	Kind    uint32
+	Hint    uint64
+}
+
+type FSP_FSCTL_TRANSACT_REQ_CREATE struct {
+	CreateOptions      uint32
+	FileAttributes     uint32
+	SecurityDescriptor FSP_FSCTL_TRANSACT_BUF
+	AllocationSize     uint64
+	AccessToken        uint64
+	DesiredAccess      uint32
+	GrantedAccess      uint32
+	ShareAccess        uint32
+	Ea                 FSP_FSCTL_TRANSACT_BUF
+	Flags              uint32
+	NamedStream        uint32
+}
+
+type FSP_FSCTL_TRANSACT_REQ_SET_INFORMATION_RENAME struct {
+	UserContext          uint64
+	UserContext2         uint64
+	FileInformationClass uint32
+	_                    uint32
+	NewFileName          FSP_FSCTL_TRANSACT_BUF
+	AccessToken          uint64
+	Flags                uint32
+}
+
+const (
+	FileRenameInformation   = 10
+	FileRenameInformationEx = 65
+)
+
+func FSP_FSCTL_TRANSACT_REQ_TOKEN_HANDLE(token uint64) windows.Token {
+	return windows.Token(uint32(token))
+}
+
+func FSP_FSCTL_TRANSACT_REQ_TOKEN_PID(token uint64) uint32 {
+	return uint32(token >> 32)
+}
@@ -0,0 +1,36 @@
+package winfsp
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// FsextControl sends the input to the kernel mode fsext
+// provider serving the file system, and receives its reply
+// into the output, returning the number of bytes received.
+//
+// This is the transact channel between the user mode half
+// and the provider, e.g. how the WinFsp-FUSE fsext exchanges
+// the FUSE protocol messages. The control code must have
+// been set by FsextControlCode on mounting.
+func (f *FileSystem) FsextControl(input, output []byte) (int, error) {
+	if f.fsextControlCode == 0 {
+		return 0, errors.New("fsext control code unspecified")
+	}
+	var inputPtr, outputPtr *byte
+	if len(input) > 0 {
+		inputPtr = &input[0]
+	}
+	if len(output) > 0 {
+		outputPtr = &output[0]
+	}
+	var bytesReturned uint32
+	if err := windows.DeviceIoControl(
+		f.fileSystem.VolumeHandle, f.fsextControlCode,
+		inputPtr, uint32(len(input)),
+		outputPtr, uint32(len(output)),
+		&bytesReturned, nil); err != nil {
+		return 0, errors.Wrap(err, "fsext control")
+	}
+	return int(bytesReturned), nil
+}
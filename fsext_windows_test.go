@@ -0,0 +1,40 @@
+package winfsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestFsextControl(t *testing.T) {
+	assert := assert.New(t)
+	f := &FileSystem{}
+	_, err := f.FsextControl(nil, make([]byte, 4))
+	assert.Error(err)
+
+	// The control is transacted through the volume handle,
+	// which is imitated by a host file here, replying to the
+	// FSCTL_GET_COMPRESSION with its compression format.
+	name := filepath.Join(t.TempDir(), "volume")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+	file, err := os.Open(name)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = file.Close() }()
+	f.fileSystem = &FSP_FILE_SYSTEM{
+		VolumeHandle: windows.Handle(file.Fd()),
+	}
+	f.fsextControlCode = windows.FSCTL_GET_COMPRESSION
+	output := []byte{0xff, 0xff, 0xff, 0xff}
+	n, err := f.FsextControl(nil, output)
+	if assert.NoError(err) {
+		assert.Equal(2, n)
+		assert.Equal([]byte{0, 0}, output[:n])
+	}
+	_, err = f.FsextControl(nil, nil)
+	assert.Error(err)
+}
@@ -0,0 +1,145 @@
+package winfsp
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// FullContext specifies whether the file contexts are
+// made of both UserContext and UserContext2, which is the
+// FspFSAttributeUmFileContextIsFullContext mode of WinFSP.
+//
+// Under this mode, the file context returned by Open and
+// Create and passed to the other behaviours is still the
+// UserContext2, so that the behaviours need no change,
+// while the UserContext can be set and retrieved by the
+// SetUserContext and UserContext of the file system. This
+// is how the file systems ported from the C samples keep
+// their node and descriptor pairs.
+func FullContext(value bool) Option {
+	return func(o *option) {
+		o.fullContext = value
+	}
+}
+
+// openingFile is the file being opened or created, whose
+// full context and open file information are filled by the
+// Open and Create behaviours.
+type openingFile struct {
+	context *FSP_FSCTL_TRANSACT_FULL_CONTEXT
+	info    *FSP_FSCTL_OPEN_FILE_INFO
+}
+
+// openingContexts records the files being opened by the
+// Open and Create behaviours, keyed by the ID of the
+// dispatcher threads serving them.
+type openingContexts struct {
+	contexts sync.Map
+}
+
+func (o *openingContexts) begin(file *openingFile) func() {
+	thread := windows.GetCurrentThreadId()
+	o.contexts.Store(thread, file)
+	return func() {
+		o.contexts.Delete(thread)
+	}
+}
+
+func (o *openingContexts) current() *openingFile {
+	value, ok := o.contexts.Load(windows.GetCurrentThreadId())
+	if !ok {
+		return nil
+	}
+	return value.(*openingFile)
+}
+
+// fileContext resolves the file context passed by WinFSP
+// into the one returned by the behaviours.
+func (ref *FileSystemRef) fileContext(file uintptr) uintptr {
+	if !ref.fullContext || file == 0 {
+		return file
+	}
+	context := (*FSP_FSCTL_TRANSACT_FULL_CONTEXT)(
+		unsafe.Pointer(file))
+	return uintptr(context.UserContext2)
+}
+
+// beginOpen records the file context and information being
+// filled by the current Open or Create behaviour.
+func (ref *FileSystemRef) beginOpen(
+	file *uintptr, fileInfoAddr uintptr,
+) func() {
+	opening := &openingFile{
+		info: (*FSP_FSCTL_OPEN_FILE_INFO)(
+			unsafe.Pointer(fileInfoAddr)),
+	}
+	if ref.fullContext {
+		opening.context = (*FSP_FSCTL_TRANSACT_FULL_CONTEXT)(
+			unsafe.Pointer(file))
+	}
+	return ref.opening.begin(opening)
+}
+
+// setFileContext stores the file context returned by the
+// Open or Create behaviour.
+func (ref *FileSystemRef) setFileContext(file *uintptr, result uintptr) {
+	if !ref.fullContext {
+		*file = result
+		return
+	}
+	context := (*FSP_FSCTL_TRANSACT_FULL_CONTEXT)(
+		unsafe.Pointer(file))
+	context.UserContext2 = uint64(result)
+}
+
+// UserContext returns the UserContext of the file that
+// the current operation is performed on, when the file
+// system is mounted with FullContext.
+//
+// This must only be called inside the behaviours, and 0
+// is returned for the operations not performed on a file.
+func (ref *FileSystemRef) UserContext() uint64 {
+	if !ref.fullContext {
+		return 0
+	}
+	if opening := ref.opening.current(); opening != nil {
+		return opening.context.UserContext
+	}
+	request := operationRequest()
+	if request == nil {
+		return 0
+	}
+	switch request.Kind {
+	case FspFsctlTransactCreateKind,
+		FspFsctlTransactQueryVolumeInformationKind,
+		FspFsctlTransactSetVolumeInformationKind:
+		return 0
+	}
+	body := uintptr(unsafe.Pointer(request)) +
+		unsafe.Sizeof(FSP_FSCTL_TRANSACT_REQ_HEADER{})
+	return (*FSP_FSCTL_TRANSACT_FULL_CONTEXT)(
+		unsafe.Pointer(body)).UserContext
+}
+
+// SetUserContext sets the UserContext of the file being
+// opened or created, when the file system is mounted with
+// FullContext.
+//
+// This must only be called inside the Open, Create and
+// CreateEx behaviours, and on the goroutine which the
+// behaviour is invoked, since the file being opened is
+// tracked by the dispatcher thread.
+func (ref *FileSystemRef) SetUserContext(value uint64) error {
+	if !ref.fullContext {
+		return errors.New("file system not mounted with full context")
+	}
+	opening := ref.opening.current()
+	if opening == nil {
+		return errors.New("no file being opened or created")
+	}
+	opening.context.UserContext = value
+	return nil
+}
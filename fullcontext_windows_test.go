@@ -0,0 +1,41 @@
+package winfsp
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullContext(t *testing.T) {
+	assert := assert.New(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ref := &FileSystemRef{fullContext: true}
+	var context FSP_FSCTL_TRANSACT_FULL_CONTEXT
+	file := (*uintptr)(unsafe.Pointer(&context))
+	assert.Error(ref.SetUserContext(1))
+
+	var info FSP_FSCTL_OPEN_FILE_INFO
+	end := ref.beginOpen(file, uintptr(unsafe.Pointer(&info)))
+	assert.NoError(ref.SetUserContext(0x1234))
+	assert.Equal(uint64(0x1234), ref.UserContext())
+	ref.setFileContext(file, 0x5678)
+	end()
+	assert.Error(ref.SetUserContext(1))
+	assert.Equal(uint64(0x1234), context.UserContext)
+	assert.Equal(uint64(0x5678), context.UserContext2)
+	assert.Equal(uintptr(0x5678), ref.fileContext(uintptr(
+		unsafe.Pointer(&context))))
+	assert.Equal(uintptr(0), ref.fileContext(0))
+
+	plain := &FileSystemRef{}
+	var result uintptr
+	defer plain.beginOpen(&result, uintptr(unsafe.Pointer(&info)))()
+	plain.setFileContext(&result, 0x5678)
+	assert.Equal(uintptr(0x5678), result)
+	assert.Equal(uintptr(0x5678), plain.fileContext(result))
+	assert.Error(plain.SetUserContext(1))
+}
@@ -0,0 +1,141 @@
+//go:build go1.18
+// +build go1.18
+
+package winfsp
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/wtf8"
+)
+
+func FuzzUTF16PtrToString(f *testing.F) {
+	f.Add([]byte("a\x00b\x00"))
+	f.Add([]byte{0x3d, 0xd8, 0x00, 0xde})
+	f.Add([]byte{0x00, 0xd8, 0x41, 0x00})
+	f.Add([]byte{0x41, 0x00, 0x00, 0xdc, 0x00, 0x00, 0x42, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		units := make([]uint16, len(data)/2, len(data)/2+1)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+		units = append(units, 0)
+		n := 0
+		for units[n] != 0 {
+			n++
+		}
+		// The conversion must stop at the first NUL and agree
+		// with the conversion of the slice, and the unpaired
+		// surrogates must survive encoding it back.
+		result := utf16PtrToString(uintptr(unsafe.Pointer(&units[0])))
+		assert.Equal(t, wtf8.Decode(units[:n]), result)
+		assert.Equal(t, units[:n], wtf8.AppendEncode(
+			make([]uint16, 0, n), result))
+	})
+}
+
+func FuzzUTF16RoundTrip(f *testing.F) {
+	f.Add("file.txt")
+	f.Add(`\dir\文件.txt`)
+	f.Add("\U0001F600")
+	f.Add("\xed\xa0\x80A")
+	f.Add("\xff")
+
+	// The unpaired surrogate encoded in WTF-8 round trips.
+	units := append(wtf8.Encode("\xed\xa0\x80A"), 0)
+	assert.Equal(f, []uint16{0xd800, 'A', 0}, units)
+	assert.Equal(f, "\xed\xa0\x80A",
+		utf16PtrToString(uintptr(unsafe.Pointer(&units[0]))))
+	f.Fuzz(func(t *testing.T, name string) {
+		units, err := utf16FromName(name)
+		if err != nil {
+			// Strings containing NUL are rejected.
+			return
+		}
+		units = append(units, 0)
+		result := utf16PtrToString(uintptr(unsafe.Pointer(&units[0])))
+		assert.Equal(t, wtf8.Decode(units[:len(units)-1]), result)
+		if utf8.ValidString(name) {
+			assert.Equal(t, name, result)
+		}
+		// The result is either the name itself, or the name
+		// with the invalid sequences replaced, which is stable.
+		assert.Equal(t, result, wtf8.Decode(wtf8.Encode(result)))
+	})
+}
+
+func FuzzEncodeDirInfo(f *testing.F) {
+	f.Add("file.txt", uint32(windows.FILE_ATTRIBUTE_NORMAL), uint64(4096))
+	f.Add("", uint32(0), uint64(0))
+	f.Add("\U0001F600\U0001F600", uint32(0), uint64(1))
+	f.Fuzz(func(t *testing.T, name string, attributes uint32, size uint64) {
+		info := &FSP_FSCTL_FILE_INFO{
+			FileAttributes: attributes,
+			FileSize:       size,
+		}
+		buf, err := encodeDirInfo(name, info)
+		if err != nil {
+			return
+		}
+		bufLen := len(buf) * 8
+		dirInfo := (*FSP_FSCTL_DIR_INFO)(unsafe.Pointer(&buf[0]))
+		headerSize := int(unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}))
+		entrySize := int(dirInfo.Size)
+		assert.GreaterOrEqual(t, entrySize, headerSize)
+		assert.LessOrEqual(t, entrySize, bufLen)
+		assert.Equal(t, 0, (entrySize-headerSize)%SIZEOF_WCHAR)
+		assert.Equal(t, *info, dirInfo.FileInfo)
+		units := make([]uint16, (entrySize-headerSize)/SIZEOF_WCHAR)
+		for i := range units {
+			units[i] = *(*uint16)(unsafe.Pointer(uintptr(
+				unsafe.Pointer(&buf[0])) + uintptr(headerSize+2*i)))
+		}
+		assert.Equal(t, wtf8.Encode(name), units)
+	})
+}
+
+func FuzzAppendNotifyInfo(f *testing.F) {
+	f.Add(`\a`, `\dir\b.txt`, uint32(1), uint32(3))
+	f.Add("", "\U0001F600", uint32(0), uint32(0))
+	f.Fuzz(func(t *testing.T, first, second string, filter, action uint32) {
+		var buf []byte
+		var names []string
+		for _, name := range []string{first, second} {
+			next, err := appendNotifyInfo(buf, filter, action, name)
+			if err != nil {
+				continue
+			}
+			buf = next
+			names = append(names, name)
+		}
+
+		// Walk through the buffer and decode the entries.
+		headerSize := int(unsafe.Sizeof(FSP_FSCTL_NOTIFY_INFO{}))
+		offset := 0
+		for _, name := range names {
+			if !assert.LessOrEqual(t, offset+headerSize, len(buf)) {
+				return
+			}
+			entry := buf[offset:]
+			size := int(binary.LittleEndian.Uint16(entry))
+			assert.LessOrEqual(t, offset+size, len(buf))
+			assert.Equal(t, filter, binary.LittleEndian.Uint32(entry[4:]))
+			assert.Equal(t, action, binary.LittleEndian.Uint32(entry[8:]))
+			units := make([]uint16, (size-headerSize)/SIZEOF_WCHAR)
+			for i := range units {
+				units[i] = binary.LittleEndian.Uint16(
+					entry[headerSize+2*i:])
+			}
+			assert.Equal(t, wtf8.Encode(name), units)
+			offset += alignUp(size)
+		}
+		assert.Equal(t, len(buf), offset)
+		assert.Equal(t, 0, len(buf)%FSP_FSCTL_DEFAULT_ALIGNMENT)
+	})
+}
@@ -4,15 +4,19 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"io"
+	"math"
 	"os"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sys/windows"
 
 	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/clock"
 	"github.com/aegistudio/go-winfsp/filetime"
 	"github.com/aegistudio/go-winfsp/pathlock"
 	"github.com/aegistudio/go-winfsp/procsd"
@@ -30,6 +34,48 @@ type File interface {
 	Truncate(size int64) error
 }
 
+// BirthtimeFileInfo is the optional interface of the file
+// info returned by the backends tracking the creation time of
+// files, which would otherwise be reported as ModTime.
+type BirthtimeFileInfo interface {
+	os.FileInfo
+	Birthtime() time.Time
+}
+
+// OwnerFileInfo is the optional interface of the file info
+// returned by the backends tracking the POSIX ownership, e.g.
+// files from remote POSIX systems. The security descriptor of
+// such files is mapped from their uid, gid and permissions,
+// instead of being owned by the mounting process.
+type OwnerFileInfo interface {
+	os.FileInfo
+	Uid() uint32
+	Gid() uint32
+}
+
+// AttributesFileInfo is the optional interface of the file
+// info returned by the backends persisting windows attributes
+// of files, e.g. FILE_ATTRIBUTE_HIDDEN, which would otherwise
+// be derived from the file mode.
+type AttributesFileInfo interface {
+	os.FileInfo
+	FileAttributes() uint32
+}
+
+// ReparseFileInfo is the optional interface of the file info
+// returned by the backends aware of reparse points, reporting
+// the reparse tag of the file, or 0 if it is not a reparse
+// point. Otherwise, the files reported with os.ModeSymlink
+// are tagged as IO_REPARSE_TAG_SYMLINK.
+//
+// The tags are reported in the directory listings, so that
+// tools like robocopy and git won't follow the links while
+// enumerating the directories.
+type ReparseFileInfo interface {
+	os.FileInfo
+	ReparseTag() uint32
+}
+
 type FileSystem interface {
 	OpenFile(name string, flag int, perm os.FileMode) (File, error)
 	Mkdir(name string, perm os.FileMode) error
@@ -38,6 +84,91 @@ type FileSystem interface {
 	Remove(name string) error
 }
 
+// FileSystemAttributes is the optional interface of the file
+// system persisting windows attributes of files, which should
+// be reported back by AttributesFileInfo afterwards.
+//
+// The attributes requested at creation or overwriting are set
+// through this interface, and only the settable attributes,
+// e.g. FILE_ATTRIBUTE_HIDDEN and FILE_ATTRIBUTE_SYSTEM, will
+// be passed.
+type FileSystemAttributes interface {
+	FileSystem
+	SetAttributes(name string, attributes uint32) error
+}
+
+// FileSystemChmod is the optional interface of the file system
+// which could change the permissions of files, e.g. through
+// os.Chmod, which is used for setting the read-only attribute
+// when the file system does not implement FileSystemAttributes.
+//
+// The read-only attribute is mapped to the write permission of
+// the owner, i.e. the write permissions are removed when it is
+// set, and the owner's write permission is granted when it is
+// cleared. Changing the other attributes is rejected with
+// STATUS_ACCESS_DENIED.
+type FileSystemChmod interface {
+	FileSystem
+	Chmod(name string, mode os.FileMode) error
+}
+
+// setAttributes persists the attributes of the file through
+// FileSystemAttributes, or maps the read-only attribute onto
+// the permissions through FileSystemChmod otherwise.
+func (fs *fileSystem) setAttributes(
+	name string, attributes uint32, fileInfo os.FileInfo,
+) error {
+	if fs.attributes != nil {
+		return fs.attributes.SetAttributes(
+			name, attributes&settableAttributes)
+	}
+	if fs.chmod == nil {
+		return nil
+	}
+	current := fileInfo.Mode() & (os.ModePerm |
+		os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	mode := current
+	if attributes&windows.FILE_ATTRIBUTE_READONLY != 0 {
+		mode &^= 0222
+	} else {
+		mode |= 0200
+	}
+	if mode == current {
+		return nil
+	}
+	return fs.chmod.Chmod(name, mode)
+}
+
+// settableAttributes are the attributes passed to the
+// FileSystemAttributes, while the others are derived from
+// the file itself.
+const settableAttributes = windows.FILE_ATTRIBUTE_READONLY |
+	windows.FILE_ATTRIBUTE_HIDDEN |
+	windows.FILE_ATTRIBUTE_SYSTEM |
+	windows.FILE_ATTRIBUTE_ARCHIVE |
+	windows.FILE_ATTRIBUTE_TEMPORARY |
+	windows.FILE_ATTRIBUTE_OFFLINE |
+	windows.FILE_ATTRIBUTE_NOT_CONTENT_INDEXED
+
+// appliedAttributes returns the attributes which could be
+// changed through the interfaces of the file system.
+func (fs *fileSystem) appliedAttributes() uint32 {
+	if fs.attributes != nil {
+		return settableAttributes
+	}
+	if fs.chmod != nil {
+		return windows.FILE_ATTRIBUTE_READONLY
+	}
+	return 0
+}
+
+// hostAttributes are the attributes of the host files which
+// are reported, while the others, e.g. compressed, encrypted
+// and sparse, are not implemented by the volume.
+const hostAttributes = settableAttributes |
+	windows.FILE_ATTRIBUTE_DIRECTORY |
+	windows.FILE_ATTRIBUTE_NORMAL
+
 type fileHandle struct {
 	lock  *pathlock.Lock
 	dir   winfsp.DirBuffer
@@ -46,18 +177,50 @@ type fileHandle struct {
 	mtx   sync.RWMutex
 
 	evaluatedIndex uint64
+
+	// allocationSize is the size allocated for the file through
+	// this handle, which might be greater than the file size.
+	allocationSize uint64
+
+	// listing is the snapshot of the directory, which is kept
+	// until the listing restarts from the beginning.
+	listing []os.FileInfo
+
+	mmap     *mmapFile
+	mmapPath string
+
+	// deleteOnClose marks the file opened with the option
+	// FILE_DELETE_ON_CLOSE, which is removed at cleanup.
+	deleteOnClose bool
+
+	// isLink marks the handle opened on the symbolic link
+	// itself, whose file is a linkFile.
+	isLink bool
 }
 
 type fileSystem struct {
-	inner   FileSystem
-	handles sync.Map
-	locker  pathlock.PathLocker
+	inner       FileSystem
+	attributes  FileSystemAttributes
+	chmod       FileSystemChmod
+	chtimes     FileSystemChtimes
+	sync        FileSystemSync
+	getSecurity FileSystemSecurity
+	setSecurity FileSystemSetSecurity
+	links       FileSystemSymlink
+	handles     sync.Map
+	locker      pathlock.PathLocker
 
 	labelLen int
 	label    [32]uint16
+
+	mmapChunk int64
+	mmaps     mmapRegistry
 }
 
 func (handle *fileHandle) reopenFile(fs *fileSystem) (File, error) {
+	if handle.isLink {
+		return &linkFile{fs: fs.links, name: handle.lock.FilePath()}, nil
+	}
 	return fs.inner.OpenFile(
 		handle.lock.FilePath(), handle.flags, os.FileMode(0))
 }
@@ -76,27 +239,113 @@ func attributesFromFileMode(mode os.FileMode) uint32 {
 	return attributes
 }
 
+// attributesWithDirectory keeps the directory attribute of
+// the reported attributes consistent with the file.
+func attributesWithDirectory(attributes uint32, isDir bool) uint32 {
+	attributes &^= windows.FILE_ATTRIBUTE_DIRECTORY |
+		windows.FILE_ATTRIBUTE_NORMAL
+	if isDir {
+		attributes |= windows.FILE_ATTRIBUTE_DIRECTORY
+	}
+	if attributes == 0 {
+		attributes = windows.FILE_ATTRIBUTE_NORMAL
+	}
+	return attributes
+}
+
+// attributesFromStat retrieves the attributes persisted by
+// the backend, or derives them from the file mode otherwise.
+func attributesFromStat(info os.FileInfo) uint32 {
+	if attrs, ok := info.(AttributesFileInfo); ok {
+		return attributesWithDirectory(attrs.FileAttributes(), info.IsDir())
+	}
+	if findData, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		// The symbolic links to directories are not reported
+		// as directories by golang, but they are on windows.
+		isDir := info.IsDir() || (info.Mode()&os.ModeSymlink != 0 &&
+			findData.FileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0)
+		return attributesWithDirectory(
+			findData.FileAttributes&hostAttributes, isDir)
+	}
+	return attributesFromFileMode(info.Mode())
+}
+
+// reparseTagFromStat retrieves the reparse tag reported by the
+// backend, or derives it from the file mode otherwise.
+func reparseTagFromStat(info os.FileInfo) uint32 {
+	if reparse, ok := info.(ReparseFileInfo); ok {
+		return reparse.ReparseTag()
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return windows.IO_REPARSE_TAG_SYMLINK
+	}
+	return 0
+}
+
 func (fs *fileSystem) GetSecurityByName(
 	ref *winfsp.FileSystemRef, name string,
 	flags winfsp.GetSecurityByNameFlags,
 ) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
-	info, err := fs.inner.Stat(name)
+	info, err := fs.stat(name)
+	if err != nil && fs.links != nil {
+		// The file might be inside the symbolic links, which
+		// are to be resolved by WinFSP then.
+		if index, ok := ref.FindReparsePoint(name); ok {
+			return index, nil, windows.STATUS_REPARSE
+		}
+	}
 	if err != nil || flags == winfsp.GetExistenceOnly {
 		return 0, nil, err
 	}
-	attributes := attributesFromFileMode(info.Mode())
+	attributes := attributesFromStat(info)
+	if fs.links != nil && reparseTagFromStat(info) != 0 {
+		attributes &^= windows.FILE_ATTRIBUTE_NORMAL
+		attributes |= windows.FILE_ATTRIBUTE_REPARSE_POINT
+	}
 	var sd *windows.SECURITY_DESCRIPTOR
-	if (flags & winfsp.GetSecurityByName) != 0 {
-		// XXX: this is a mock up, the file is considered to
-		// be owned by current process, so it is okay to
-		// return the security descriptor of the process.
-		sd, err = procsd.Load()
+	if flags.WantsSecurity() {
+		sd, err = fs.security(name, info)
 	}
 	return attributes, sd, err
 }
 
 var _ winfsp.BehaviourGetSecurityByName = (*fileSystem)(nil)
 
+// stat retrieves the status of the file, without following
+// the symbolic link if the file system supports them.
+func (fs *fileSystem) stat(name string) (os.FileInfo, error) {
+	if fs.links != nil {
+		return fs.links.Lstat(name)
+	}
+	return fs.inner.Stat(name)
+}
+
+// posixMode converts the file mode into POSIX permissions.
+func posixMode(mode os.FileMode) uint32 {
+	result := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		result |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		result |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		result |= 01000
+	}
+	return result
+}
+
+func securityFromStat(info os.FileInfo) (*windows.SECURITY_DESCRIPTOR, error) {
+	if owner, ok := info.(OwnerFileInfo); ok {
+		return winfsp.PosixMapPermissionsToSecurityDescriptor(
+			owner.Uid(), owner.Gid(), posixMode(info.Mode()))
+	}
+	// XXX: this is a mock up, the file is considered to
+	// be owned by current process, so it is okay to
+	// return the security descriptor of the process.
+	return procsd.Load()
+}
+
 func evaluateIndexNumber(p string) uint64 {
 	// XXX: we evaluate the index number for a file by hashing,
 	// so each file is identified by its path. Since we will not
@@ -114,14 +363,53 @@ func evaluateIndexNumber(p string) uint64 {
 	return a ^ b ^ c ^ d
 }
 
-func fileInfoFromStat(
+// allocationUnit is the size of allocation unit reported.
+const allocationUnit = 4096
+
+func roundAllocationSize(size uint64) uint64 {
+	return (size + allocationUnit - 1) / allocationUnit * allocationUnit
+}
+
+// fileInfo fills the file info of the file opened by handle,
+// whose allocation size is the greater one of the size it has
+// allocated and the size of the file.
+func (fs *fileSystem) fileInfo(
+	handle *fileHandle,
+	target *winfsp.FSP_FSCTL_FILE_INFO, source os.FileInfo,
+) {
+	fs.fileInfoFromStat(target, source, handle.evaluatedIndex)
+	allocationSize := atomic.LoadUint64(&handle.allocationSize)
+	if allocationSize > target.AllocationSize {
+		target.AllocationSize = allocationSize
+	}
+}
+
+// fileInfoFromStat converts the status of the file, where the
+// reparse tags are only reported when the symbolic links are
+// supported, or the volume would list the links that are
+// followed once opened.
+func (fs *fileSystem) fileInfoFromStat(
 	target *winfsp.FSP_FSCTL_FILE_INFO, source os.FileInfo,
 	evaluatedIndexNumber uint64,
 ) {
-	target.FileAttributes = attributesFromFileMode(source.Mode())
+	target.FileAttributes = attributesFromStat(source)
 	target.ReparseTag = 0
+	if fs.links != nil {
+		target.ReparseTag = reparseTagFromStat(source)
+	}
+	if target.ReparseTag != 0 {
+		target.FileAttributes &^= windows.FILE_ATTRIBUTE_NORMAL
+		target.FileAttributes |= windows.FILE_ATTRIBUTE_REPARSE_POINT
+	} else {
+		// The attribute must agree with the tag, or the
+		// readers would look for a tag that is not there.
+		target.FileAttributes &^= windows.FILE_ATTRIBUTE_REPARSE_POINT
+		if target.FileAttributes == 0 {
+			target.FileAttributes = windows.FILE_ATTRIBUTE_NORMAL
+		}
+	}
 	target.FileSize = uint64(source.Size())
-	target.AllocationSize = ((target.FileSize + 4095) / 4096) * 4096
+	target.AllocationSize = roundAllocationSize(target.FileSize)
 	target.CreationTime = filetime.Timestamp(source.ModTime())
 	target.LastAccessTime = target.CreationTime
 	target.LastWriteTime = target.CreationTime
@@ -129,6 +417,11 @@ func fileInfoFromStat(
 	target.IndexNumber = evaluatedIndexNumber
 	target.HardLinks = 0
 	target.EaSize = 0
+	if birth, ok := source.(BirthtimeFileInfo); ok {
+		if birthtime := birth.Birthtime(); !birthtime.IsZero() {
+			target.CreationTime = filetime.Timestamp(birthtime)
+		}
+	}
 
 	// We can extract more data from it if it is find data from
 	// windows, which is the one from golang's standard library.
@@ -293,7 +586,19 @@ func (fs *fileSystem) openFile(
 
 	// Attempt to open the file in the underlying file system.
 	dirCheckErr := windows.STATUS_NOT_A_DIRECTORY
-	file, err := fs.inner.OpenFile(name, accessFlags|flags, mode)
+	file, err := fs.openLink(name, createOptions, flags)
+	if err != nil {
+		return 0, err
+	}
+	if file != nil {
+		handle.isLink = true
+	} else {
+		err = fs.exclusive(name, func() error {
+			var err error
+			file, err = fs.inner.OpenFile(name, accessFlags|flags, mode)
+			return err
+		})
+	}
 	if err != nil {
 		// We will only try again if it complains about opening a
 		// directory file failed, but we should be able to open the
@@ -337,7 +642,9 @@ func (fs *fileSystem) openFile(
 	}
 	switch createOptions & bothDirectoryFlags {
 	case windows.FILE_DIRECTORY_FILE:
-		if !fileInfo.IsDir() {
+		// The symbolic links to directories are removed
+		// as directories on windows.
+		if !fileInfo.IsDir() && !handle.isLink {
 			return 0, dirCheckErr
 		}
 	case windows.FILE_NON_DIRECTORY_FILE:
@@ -347,6 +654,17 @@ func (fs *fileSystem) openFile(
 	default:
 	}
 
+	// The file opened with FILE_DELETE_ON_CLOSE is removed at
+	// cleanup, regardless of whether the driver has marked it
+	// as delete pending, so it must be rejected now if it will
+	// never be removed, just like what NTFS does.
+	if createOptions&windows.FILE_DELETE_ON_CLOSE != 0 {
+		if attributesFromStat(fileInfo)&windows.FILE_ATTRIBUTE_READONLY != 0 {
+			return 0, windows.STATUS_CANNOT_DELETE
+		}
+		handle.deleteOnClose = true
+	}
+
 	// Downgrade the lock to reader lock if it is the file
 	// to supersede, and other processes can access it with
 	// such flag from now on.
@@ -358,7 +676,7 @@ func (fs *fileSystem) openFile(
 	handle.evaluatedIndex = evaluateIndexNumber(lock.Path())
 
 	// Copy the status out to the file information block.
-	fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
+	fs.fileInfo(handle, info, fileInfo)
 
 	// Finish opening the file and return to the caller.
 	created = true
@@ -378,10 +696,76 @@ func (fs *fileSystem) Create(
 	if fileAttributes&windows.FILE_ATTRIBUTE_DIRECTORY != 0 {
 		fileMode |= os.FileMode(0111)
 	}
-	return fs.openFile(
+	result, err := fs.openFile(
 		ref, name, createOptions, grantedAccess,
 		fileMode, info,
 	)
+	if err != nil {
+		return 0, err
+	}
+	if err := fs.initialize(result, fileAttributes,
+		securityDescriptor, allocationSize, info); err != nil {
+		// The file has just been created, which must not be
+		// left behind without what is requested.
+		var path string
+		if handle, loadErr := fs.load(result); loadErr == nil {
+			path = handle.lock.FilePath()
+		}
+		fs.Close(ref, result)
+		if path != "" {
+			_ = fs.inner.Remove(path)
+		}
+		return 0, err
+	}
+	return result, nil
+}
+
+// initialize persists the attributes and security descriptor
+// of the created file if the inner file system supports it, and
+// allocates the space requested for the file, updating the file
+// info.
+func (fs *fileSystem) initialize(
+	file uintptr, attributes uint32,
+	sd *windows.SECURITY_DESCRIPTOR, allocationSize uint64,
+	info *winfsp.FSP_FSCTL_FILE_INFO,
+) error {
+	securityOk := fs.setSecurity != nil && sd != nil
+	if fs.attributes == nil && !securityOk && allocationSize == 0 {
+		return nil
+	}
+	handle, err := fs.load(file)
+	if err != nil {
+		return err
+	}
+	if err := handle.lockChecked(); err != nil {
+		return err
+	}
+	defer handle.unlockChecked()
+	if fs.attributes != nil {
+		if err := fs.attributes.SetAttributes(handle.lock.FilePath(),
+			attributes&settableAttributes); err != nil {
+			return err
+		}
+	}
+	if securityOk {
+		if err := fs.setSecurity.SetSecurity(
+			handle.lock.FilePath(), sd); err != nil {
+			return err
+		}
+	}
+	if allocationSize > 0 {
+		if err := fs.exclusive(handle.lock.FilePath(), func() error {
+			return handle.allocate(int64(allocationSize))
+		}); err != nil {
+			return err
+		}
+	}
+	fileInfo, err := handle.file.Stat()
+	if err != nil {
+		return err
+	}
+	fs.fileInfo(handle, info, fileInfo)
+	return nil
 }
 
 var _ winfsp.BehaviourCreate = (*fileSystem)(nil)
@@ -417,6 +801,7 @@ func (fs *fileSystem) Close(
 	defer fileHandle.mtx.Unlock()
 	defer fileHandle.lock.Unlock()
 	defer fileHandle.dir.Delete()
+	fs.unmapHandle(fileHandle)
 	if fileHandle.file != nil {
 		_ = fileHandle.file.Close()
 		fileHandle.file = nil
@@ -458,18 +843,34 @@ func (fs *fileSystem) Overwrite(
 		return err
 	}
 	defer handle.unlockChecked()
-	if err := handle.file.Truncate(0); err != nil {
+	atomic.StoreUint64(&handle.allocationSize, 0)
+	if err := fs.exclusive(handle.lock.FilePath(), func() error {
+		if err := handle.file.Truncate(0); err != nil {
+			return err
+		}
+		if allocationSize > 0 {
+			return handle.allocate(int64(allocationSize))
+		}
+		return nil
+	}); err != nil {
 		return err
 	}
-	// TODO: support chmod operation in the future.
-	//
-	// It might seems like we are just ignoring the attribute
-	// update but we might support them in the future.
 	fileInfo, err := handle.file.Stat()
 	if err != nil {
 		return err
 	}
-	fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
+	fs.fileInfo(handle, info, fileInfo)
+	if !replaceAttributes {
+		attributes |= info.FileAttributes
+	}
+	if err := fs.setAttributes(
+		handle.lock.FilePath(), attributes, fileInfo); err != nil {
+		return err
+	}
+	if fileInfo, err = handle.file.Stat(); err != nil {
+		return err
+	}
+	fs.fileInfo(handle, info, fileInfo)
 	return nil
 }
 
@@ -497,18 +898,23 @@ func (fs *fileSystem) ReadDirectory(
 		return err
 	}
 	defer handle.unlockChecked()
-	f, err := handle.reopenFile(fs)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = f.Close() }()
-	fileInfos, err := f.Readdir(-1)
-	if err != nil {
-		return err
+	// The listing is only updated while the directory buffer
+	// is acquired exclusively, so the read lock suffices.
+	if handle.listing == nil {
+		f, err := handle.reopenFile(fs)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		fileInfos, err := f.Readdir(-1)
+		if err != nil {
+			return err
+		}
+		handle.listing = fileInfos
 	}
-	for _, fileInfo := range fileInfos {
+	for _, fileInfo := range handle.listing {
 		var info winfsp.FSP_FSCTL_FILE_INFO
-		fileInfoFromStat(&info, fileInfo, 0)
+		fs.fileInfoFromStat(&info, fileInfo, 0)
 		ok, err := fill(fileInfo.Name(), &info)
 		if err != nil || !ok {
 			return err
@@ -519,6 +925,21 @@ func (fs *fileSystem) ReadDirectory(
 
 var _ winfsp.BehaviourReadDirectory = (*fileSystem)(nil)
 
+func (fs *fileSystem) RewindDirectory(
+	ref *winfsp.FileSystemRef, file uintptr,
+) error {
+	handle, err := fs.load(file)
+	if err != nil {
+		return err
+	}
+	handle.mtx.Lock()
+	defer handle.mtx.Unlock()
+	handle.listing = nil
+	return nil
+}
+
+var _ winfsp.BehaviourRewindDirectory = (*fileSystem)(nil)
+
 func (fs *fileSystem) GetFileInfo(
 	ref *winfsp.FileSystemRef, file uintptr,
 	info *winfsp.FSP_FSCTL_FILE_INFO,
@@ -535,7 +956,7 @@ func (fs *fileSystem) GetFileInfo(
 	if err != nil {
 		return err
 	}
-	fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
+	fs.fileInfo(handle, info, fileInfo)
 	return nil
 }
 
@@ -544,11 +965,19 @@ var _ winfsp.BehaviourGetFileInfo = (*fileSystem)(nil)
 func (fs *fileSystem) GetSecurity(
 	ref *winfsp.FileSystemRef, file uintptr,
 ) (*windows.SECURITY_DESCRIPTOR, error) {
-	_, err := fs.load(file)
+	handle, err := fs.load(file)
 	if err != nil {
 		return nil, err
 	}
-	return procsd.Load()
+	if err := handle.lockChecked(); err != nil {
+		return nil, err
+	}
+	defer handle.unlockChecked()
+	fileInfo, err := handle.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fs.security(handle.lock.FilePath(), fileInfo)
 }
 
 var _ winfsp.BehaviourGetSecurity = (*fileSystem)(nil)
@@ -599,12 +1028,85 @@ func (fs *fileSystem) SetBasicInfo(
 	if err != nil {
 		return err
 	}
-	fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
-	return windows.STATUS_ACCESS_DENIED
+	fs.fileInfo(handle, info, fileInfo)
+	// The attributes of 0 leaves the attributes unchanged,
+	// just like the INVALID_FILE_ATTRIBUTES.
+	setAttributes := flags&winfsp.SetBasicInfoAttributes != 0 &&
+		attribute != 0
+	attributesDenied := setAttributes &&
+		(attribute^info.FileAttributes)&settableAttributes&^
+			fs.appliedAttributes() != 0
+	atime, mtime, timesChanged := basicInfoTimes(
+		flags, lastAccessTime, lastWriteTime, info)
+
+	// The changes which can't be applied by the file system
+	// are rejected, instead of pretending to be applied.
+	if attributesDenied {
+		return windows.STATUS_ACCESS_DENIED
+	}
+	if timesChanged && fs.chtimes == nil {
+		return windows.STATUS_ACCESS_DENIED
+	}
+	if setAttributes {
+		if err := fs.setAttributes(
+			handle.lock.FilePath(), attribute, fileInfo); err != nil {
+			return err
+		}
+	}
+	if timesChanged {
+		if err := fs.chtimes.Chtimes(handle.lock.FilePath(),
+			filetime.Time(atime), filetime.Time(mtime)); err != nil {
+			return err
+		}
+	}
+	if fileInfo, err = handle.file.Stat(); err != nil {
+		return err
+	}
+	fs.fileInfo(handle, info, fileInfo)
+	return nil
 }
 
 var _ winfsp.BehaviourSetBasicInfo = (*fileSystem)(nil)
 
+// FileSystemChtimes is the optional interface of the file
+// system which could change the access and modification
+// times of files, e.g. through os.Chtimes, so that the times
+// are preserved when the files are copied onto the volume.
+//
+// Without this interface, SetBasicInfo changing the times is
+// rejected with STATUS_ACCESS_DENIED. The creation and change
+// times are ignored anyway, since they can't be set through
+// the interface.
+type FileSystemChtimes interface {
+	FileSystem
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// basicInfoTimes returns the access and modification times
+// set by SetBasicInfo, keeping the one which is not requested
+// from the current info of the file, and whether they differ
+// from the current ones.
+func basicInfoTimes(
+	flags winfsp.SetBasicInfoFlags,
+	lastAccessTime, lastWriteTime uint64,
+	info *winfsp.FSP_FSCTL_FILE_INFO,
+) (atime, mtime uint64, changed bool) {
+	// The value -1 asks for suspending the updating of the
+	// time by the file system, which is not supported.
+	atime, mtime = info.LastAccessTime, info.LastWriteTime
+	if flags&winfsp.SetBasicInfoLastAccessTime != 0 &&
+		lastAccessTime != math.MaxUint64 {
+		atime = lastAccessTime
+	}
+	if flags&winfsp.SetBasicInfoLastWriteTime != 0 &&
+		lastWriteTime != math.MaxUint64 {
+		mtime = lastWriteTime
+	}
+	changed = atime != info.LastAccessTime ||
+		mtime != info.LastWriteTime
+	return atime, mtime, changed
+}
+
 // FileTruncateEx is the truncate interface related to Windows
 // style opertations. Without this interface, we will be
 // imitating the set allocation size behaviour of file, making
@@ -632,6 +1134,62 @@ func (f *fileMimicTruncate) Shrink(newSize int64) error {
 	return nil
 }
 
+// FileAllocateEx is the optional interface of the file which
+// could preallocate the space of the file without changing its
+// size, e.g. through fallocate. Without this interface, the
+// allocation size is only tracked and reported by the handle,
+// unless the file is a real *os.File.
+type FileAllocateEx interface {
+	File
+
+	// Allocate ensures there's space allocated for the file
+	// to grow up to the size.
+	Allocate(size int64) error
+}
+
+// allocateOSFile preallocates the space of the local file.
+func allocateOSFile(f *os.File, size int64) error {
+	allocation := size
+	return windows.SetFileInformationByHandle(
+		windows.Handle(f.Fd()), windows.FileAllocationInfo,
+		(*byte)(unsafe.Pointer(&allocation)),
+		uint32(unsafe.Sizeof(allocation)))
+}
+
+// allocate sets the allocation size of the file, shrinking the
+// file if it is greater, and preallocating the space otherwise.
+func (handle *fileHandle) allocate(size int64) error {
+	var shrinker FileTruncateEx
+	if obj, ok := handle.file.(FileTruncateEx); ok {
+		shrinker = obj
+	} else {
+		shrinker = &fileMimicTruncate{
+			File: handle.file,
+		}
+	}
+	if err := shrinker.Shrink(size); err != nil {
+		return err
+	}
+	fileInfo, err := handle.file.Stat()
+	if err != nil {
+		return err
+	}
+	if size > fileInfo.Size() {
+		switch f := handle.file.(type) {
+		case FileAllocateEx:
+			err = f.Allocate(size)
+		case *os.File:
+			err = allocateOSFile(f, size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&handle.allocationSize,
+		roundAllocationSize(uint64(size)))
+	return nil
+}
+
 func (fs *fileSystem) SetFileSize(
 	ref *winfsp.FileSystemRef, file uintptr,
 	newSize uint64, setAllocationSize bool,
@@ -646,28 +1204,19 @@ func (fs *fileSystem) SetFileSize(
 	}
 	defer handle.unlockChecked()
 	size := int64(newSize)
-	if setAllocationSize {
-		var shrinker FileTruncateEx
-		if obj, ok := handle.file.(FileTruncateEx); ok {
-			shrinker = obj
-		} else {
-			shrinker = &fileMimicTruncate{
-				File: handle.file,
-			}
-		}
-		if err := shrinker.Shrink(size); err != nil {
-			return err
-		}
-	} else {
-		if err := handle.file.Truncate(size); err != nil {
-			return err
+	if err := fs.exclusive(handle.lock.FilePath(), func() error {
+		if setAllocationSize {
+			return handle.allocate(size)
 		}
+		return handle.file.Truncate(size)
+	}); err != nil {
+		return err
 	}
 	fileInfo, err := handle.file.Stat()
 	if err != nil {
 		return err
 	}
-	fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
+	fs.fileInfo(handle, info, fileInfo)
 	return nil
 }
 
@@ -687,7 +1236,17 @@ func (fs *fileSystem) Read(
 	defer handle.unlockChecked()
 	// No matter random access or append only file handle
 	// on windows should support random read.
-	return handle.file.ReadAt(buf, int64(offset))
+	n := 0
+	if fs.mmapChunk > 0 {
+		if n, err = fs.readMapped(handle, buf, int64(offset)); err != nil {
+			return n, err
+		}
+		if n == len(buf) {
+			return n, nil
+		}
+	}
+	m, err := handle.file.ReadAt(buf[n:], int64(offset)+int64(n))
+	return n + m, err
 }
 
 var _ winfsp.BehaviourRead = (*fileSystem)(nil)
@@ -797,7 +1356,7 @@ func (fs *fileSystem) Write(
 		// XXX: since the driver code just take the information
 		// field for notification and display purpose, so only
 		// the lastly updated information is required.
-		fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
+		fs.fileInfo(handle, info, fileInfo)
 	}
 	return n, err
 }
@@ -808,10 +1367,6 @@ func (fs *fileSystem) Flush(
 	ref *winfsp.FileSystemRef, file uintptr,
 	info *winfsp.FSP_FSCTL_FILE_INFO,
 ) error {
-	if file == 0 {
-		// Flush the whole filesystem, not a single file.
-		return nil
-	}
 	handle, err := fs.load(file)
 	if err != nil {
 		return err
@@ -827,12 +1382,29 @@ func (fs *fileSystem) Flush(
 	if err != nil {
 		return err
 	}
-	fileInfoFromStat(info, fileInfo, handle.evaluatedIndex)
+	fs.fileInfo(handle, info, fileInfo)
 	return nil
 }
 
 var _ winfsp.BehaviourFlush = (*fileSystem)(nil)
 
+// FileSystemSync is the optional interface of the file system
+// which could flush its state as a whole, which is called when
+// the volume is flushed.
+type FileSystemSync interface {
+	FileSystem
+	Sync() error
+}
+
+func (fs *fileSystem) FlushVolume(ref *winfsp.FileSystemRef) error {
+	if fs.sync != nil {
+		return fs.sync.Sync()
+	}
+	return nil
+}
+
+var _ winfsp.BehaviourFlushVolume = (*fileSystem)(nil)
+
 func (fs *fileSystem) CanDelete(
 	ref *winfsp.FileSystemRef, file uintptr,
 	name string,
@@ -880,7 +1452,7 @@ func (fs *fileSystem) Cleanup(
 	if err != nil {
 		return
 	}
-	if cleanupFlags&winfsp.FspCleanupDelete == 0 {
+	if cleanupFlags&winfsp.FspCleanupDelete == 0 && !handle.deleteOnClose {
 		return
 	}
 	if !handle.lock.IsWrite() {
@@ -891,6 +1463,7 @@ func (fs *fileSystem) Cleanup(
 	if handle.file == nil {
 		return
 	}
+	fs.unmapHandle(handle)
 	_ = handle.file.Close()
 	handle.file = nil
 	_ = fs.inner.Remove(handle.lock.FilePath())
@@ -917,7 +1490,24 @@ func (fs *fileSystem) Rename(
 
 	// Try to grab the target path's lock. And upon exit
 	// either the source or the target lock will be released.
+	//
+	// The handles opened on the target are invalidated under
+	// the POSIX rename semantics, and they are restored after
+	// the target lock is released if the renaming fails. The
+	// intent marked by the failed locking is withdrawn then,
+	// otherwise the FairPathLock rejects the restoring.
+	var invalidated []*fileHandle
+	defer func() {
+		if invalidated != nil {
+			fs.locker.CancelIntent(target)
+			fs.restoreHandles(invalidated)
+		}
+	}()
 	newLock := fs.locker.Lock(target)
+	if newLock == nil && replaceIfExist && ref.Operation().PosixRename {
+		invalidated = fs.invalidateHandles(target)
+		newLock = fs.locker.Lock(target)
+	}
 	if newLock == nil {
 		return windows.STATUS_SHARING_VIOLATION
 	}
@@ -953,6 +1543,7 @@ func (fs *fileSystem) Rename(
 		pos = new(int64)
 		*pos = value
 	}
+	fs.unmapHandle(handle)
 	_ = handle.file.Close()
 	handle.file = nil
 	defer func() {
@@ -979,13 +1570,103 @@ func (fs *fileSystem) Rename(
 		return err
 	}
 	handle.lock, newLock = newLock, handle.lock
+	invalidated = nil
 	return nil
 }
 
 var _ winfsp.BehaviourRename = (*fileSystem)(nil)
 
-func New(fs FileSystem) winfsp.BehaviourBase {
-	return &fileSystem{
+// invalidateHandles invalidates the handles opened on the file
+// to be replaced by renaming, which is allowed by the POSIX
+// rename semantics, e.g. when saving through a temporary file
+// while the target is still opened by a previewer.
+//
+// The files of the handles are closed and their locks are
+// released, so that the following operations on the handles
+// fail with STATUS_INVALID_HANDLE, as there's no way to keep
+// the replaced file available to them.
+func (fs *fileSystem) invalidateHandles(name string) []*fileHandle {
+	path := pathlock.CleanPath(name)
+	var result []*fileHandle
+	fs.handles.Range(func(_, value interface{}) bool {
+		handle := value.(*fileHandle)
+		if handle.lock.Path() != path || handle.lock.IsWrite() {
+			return true
+		}
+		handle.mtx.Lock()
+		defer handle.mtx.Unlock()
+		if handle.file != nil {
+			fs.unmapHandle(handle)
+			_ = handle.file.Close()
+			handle.file = nil
+		}
+		handle.lock.Unlock()
+		result = append(result, handle)
+		return true
+	})
+	return result
+}
+
+// restoreHandles locks and reopens the file of the handles
+// invalidated for the renaming which has failed, so that
+// they remain available as if the renaming was never tried.
+//
+// The handles closed in between are skipped, and the ones
+// whose file could not be locked or reopened remain invalid.
+func (fs *fileSystem) restoreHandles(handles []*fileHandle) {
+	for _, handle := range handles {
+		fs.restoreHandle(handle)
+	}
+}
+
+func (fs *fileSystem) restoreHandle(handle *fileHandle) {
+	handle.mtx.Lock()
+	defer handle.mtx.Unlock()
+	if _, ok := fs.handles.Load(
+		uintptr(unsafe.Pointer(handle))); !ok {
+		return
+	}
+	lock := fs.locker.RLockPath(handle.lock.Path())
+	if lock == nil {
+		return
+	}
+	handle.lock = lock
+	f, err := handle.reopenFile(fs)
+	if err != nil {
+		return
+	}
+	handle.file = f
+}
+
+// FairPathLock prevents the removal and renaming of files from
+// being starved by the continuous opening of them, by rejecting
+// the new openings within the window after the removal or the
+// renaming fails due to the open files. See pathlock.PathLocker
+// for the details.
+func FairPathLock(window time.Duration) Option {
+	return func(fs *fileSystem) {
+		fs.locker.FairWindow = window
+	}
+}
+
+// Clock sets the clock measuring the window of FairPathLock,
+// which is the system clock by default.
+func Clock(value clock.Clock) Option {
+	return func(fs *fileSystem) {
+		fs.locker.Clock = value
+	}
+}
+
+func New(fs FileSystem, opts ...Option) winfsp.BehaviourBase {
+	result := &fileSystem{
 		inner: fs,
 	}
+	for _, opt := range opts {
+		opt(result)
+	}
+	result.resolveOptional()
+	if result.links != nil {
+		return &symlinkFileSystem{fileSystem: result}
+	}
+	return result
 }
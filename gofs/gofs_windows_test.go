@@ -0,0 +1,1298 @@
+package gofs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/gofs"
+	"github.com/aegistudio/go-winfsp/wtf8"
+)
+
+// freeDriveLetter finds an unused drive letter to mount.
+func freeDriveLetter(t *testing.T) string {
+	t.Helper()
+	drives, err := windows.GetLogicalDrives()
+	if err != nil {
+		t.Fatalf("get logical drives: %v", err)
+	}
+	for letter := 'Z'; letter >= 'D'; letter-- {
+		if drives&(1<<uint(letter-'A')) == 0 {
+			return string(letter) + ":"
+		}
+	}
+	t.Skip("no free drive letter")
+	return ""
+}
+
+var mountMtx sync.Mutex
+
+// mountMemFS mounts a fresh memfs, returning the root path of
+// the mounted drive, which will be unmounted after the test.
+func mountMemFS(t *testing.T, opts ...winfsp.Option) string {
+	t.Helper()
+	return mountFS(t, newMemFS(), opts...)
+}
+
+func mountFS(
+	t *testing.T, fs gofs.FileSystem, opts ...winfsp.Option,
+) string {
+	t.Helper()
+	return mountBehaviour(t, gofs.New(fs), opts...)
+}
+
+func mountBehaviour(
+	t *testing.T, fs winfsp.BehaviourBase, opts ...winfsp.Option,
+) string {
+	t.Helper()
+	mountMtx.Lock()
+	defer mountMtx.Unlock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(fs, mountpoint, opts...)
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	t.Cleanup(mounted.Unmount)
+	return mountpoint + `\`
+}
+
+const (
+	concurrency = 16
+	iterations  = 32
+)
+
+func TestConcurrentReadWrite(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	shared := filepath.Join(root, "shared")
+	sharedData := bytes.Repeat([]byte("shared"), 4096)
+	assert.NoError(os.WriteFile(shared, sharedData, 0644))
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := filepath.Join(root, fmt.Sprintf("file-%d", i))
+			for j := 0; j < iterations; j++ {
+				data := bytes.Repeat([]byte{byte(i), byte(j)}, 1024*(j+1))
+				if !assert.NoError(os.WriteFile(name, data, 0644)) {
+					return
+				}
+				content, err := os.ReadFile(name)
+				if !assert.NoError(err) {
+					return
+				}
+				assert.Equal(data, content)
+				content, err = os.ReadFile(shared)
+				if !assert.NoError(err) {
+					return
+				}
+				assert.Equal(sharedData, content)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentRenameRemove(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	stop := make(chan struct{})
+
+	// Keep listing the root directory while the files are
+	// being created, renamed and removed under it.
+	var listWg sync.WaitGroup
+	listWg.Add(1)
+	go func() {
+		defer listWg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, err := os.ReadDir(root)
+			assert.NoError(err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dir := filepath.Join(root, fmt.Sprintf("dir-%d", i))
+			if !assert.NoError(os.Mkdir(dir, 0755)) {
+				return
+			}
+			for j := 0; j < iterations; j++ {
+				source := filepath.Join(dir, fmt.Sprintf("source-%d", j))
+				target := filepath.Join(root, fmt.Sprintf("target-%d-%d", i, j))
+				if !assert.NoError(os.WriteFile(
+					source, []byte(source), 0644)) {
+					return
+				}
+				if !assert.NoError(os.Rename(source, target)) {
+					return
+				}
+				content, err := os.ReadFile(target)
+				assert.NoError(err)
+				assert.Equal([]byte(source), content)
+				assert.NoError(os.Remove(target))
+			}
+			assert.NoError(os.Remove(dir))
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	listWg.Wait()
+
+	entries, err := os.ReadDir(root)
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestConcurrentExternalProcesses(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := filepath.Join(root, fmt.Sprintf("process-%d.txt", i))
+			for j := 0; j < iterations/4; j++ {
+				line := fmt.Sprintf("process %d iteration %d", i, j)
+				assert.NoError(exec.Command("cmd", "/c",
+					"echo "+line+">"+name).Run())
+				output, err := exec.Command("cmd", "/c",
+					"type "+name).Output()
+				if !assert.NoError(err) {
+					return
+				}
+				assert.Equal(line, string(bytes.TrimSpace(output)))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentMounts(t *testing.T) {
+	assert := assert.New(t)
+	roots := []string{mountMemFS(t), mountMemFS(t)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		for _, root := range roots {
+			wg.Add(1)
+			go func(i int, root string) {
+				defer wg.Done()
+				name := filepath.Join(root, fmt.Sprintf("file-%d", i))
+				for j := 0; j < iterations; j++ {
+					data := []byte(fmt.Sprintf("%s %d", name, j))
+					if !assert.NoError(os.WriteFile(name, data, 0644)) {
+						return
+					}
+					content, err := os.ReadFile(name)
+					assert.NoError(err)
+					assert.Equal(data, content)
+				}
+			}(i, root)
+		}
+	}
+	wg.Wait()
+}
+
+func TestBirthtime(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	name := filepath.Join(root, "birthtime")
+	assert.NoError(os.WriteFile(name, []byte("created"), 0644))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(os.WriteFile(name, []byte("modified"), 0644))
+
+	info, err := os.Stat(name)
+	if !assert.NoError(err) {
+		return
+	}
+	data := info.Sys().(*syscall.Win32FileAttributeData)
+	created := time.Unix(0, data.CreationTime.Nanoseconds())
+	modified := time.Unix(0, data.LastWriteTime.Nanoseconds())
+	assert.True(created.Before(modified))
+}
+
+// ownerFS is the memFS reporting the POSIX ownership of files.
+type ownerFS struct {
+	*memFS
+	uid, gid uint32
+}
+
+type ownerFile struct {
+	gofs.File
+	uid, gid uint32
+}
+
+type ownerFileInfo struct {
+	os.FileInfo
+	uid, gid uint32
+}
+
+func (info ownerFileInfo) Uid() uint32 { return info.uid }
+
+func (info ownerFileInfo) Gid() uint32 { return info.gid }
+
+func (fs ownerFS) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.memFS.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return ownerFileInfo{FileInfo: info, uid: fs.uid, gid: fs.gid}, nil
+}
+
+func (fs ownerFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := fs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return ownerFile{File: f, uid: fs.uid, gid: fs.gid}, nil
+}
+
+func (f ownerFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ownerFileInfo{FileInfo: info, uid: f.uid, gid: f.gid}, nil
+}
+
+var _ gofs.OwnerFileInfo = ownerFileInfo{}
+
+func TestPosixOwnership(t *testing.T) {
+	assert := assert.New(t)
+	root := mountFS(t, ownerFS{memFS: newMemFS(), uid: 1000, gid: 1001})
+	name := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+
+	// The owner and group are mapped from the uid and gid
+	// reported by the backend, instead of the process.
+	sd, err := windows.GetNamedSecurityInfo(name,
+		windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION|
+			windows.GROUP_SECURITY_INFORMATION)
+	if !assert.NoError(err) {
+		return
+	}
+	owner, _, err := sd.Owner()
+	assert.NoError(err)
+	uidSid, err := winfsp.PosixMapUidToSid(1000)
+	assert.NoError(err)
+	assert.True(owner.Equals(uidSid))
+	group, _, err := sd.Group()
+	assert.NoError(err)
+	gidSid, err := winfsp.PosixMapUidToSid(1001)
+	assert.NoError(err)
+	assert.True(group.Equals(gidSid))
+}
+
+func TestDirectorySnapshot(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	dir := filepath.Join(root, "dir")
+	assert.NoError(os.Mkdir(dir, 0755))
+	const count = 256
+	for i := 0; i < count; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("original-file-%03d", i))
+		assert.NoError(os.WriteFile(name, nil, 0644))
+	}
+
+	f, err := os.Open(dir)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	listed, err := f.Readdirnames(16)
+	assert.NoError(err)
+
+	// Modifying the directory in the middle of listing must
+	// not cause duplicated or missing entries.
+	for i := 0; i < count; i += 2 {
+		name := filepath.Join(dir, fmt.Sprintf("original-file-%03d", i))
+		assert.NoError(os.Remove(name))
+		name = filepath.Join(dir, fmt.Sprintf("created-file-%03d", i))
+		assert.NoError(os.WriteFile(name, nil, 0644))
+	}
+	remaining, err := f.Readdirnames(-1)
+	assert.NoError(err)
+	listed = append(listed, remaining...)
+	expected := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		expected = append(expected, fmt.Sprintf("original-file-%03d", i))
+	}
+	assert.ElementsMatch(expected, listed)
+}
+
+func TestLongPath(t *testing.T) {
+	for _, backend := range []struct {
+		name string
+		fs   func() gofs.FileSystem
+	}{
+		{"memfs", func() gofs.FileSystem { return newMemFS() }},
+		{"osfs", func() gofs.FileSystem { return osFS(t.TempDir()) }},
+	} {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			assert := assert.New(t)
+			mountMtx.Lock()
+			mountpoint := freeDriveLetter(t)
+			mounted, err := winfsp.Mount(gofs.New(backend.fs()), mountpoint)
+			mountMtx.Unlock()
+			if err != nil {
+				t.Skipf("winfsp mount unavailable: %v", err)
+			}
+			defer mounted.Unmount()
+
+			// Nest the directories well beyond MAX_PATH, which
+			// the os package accesses with the \\?\ prefix.
+			dir := mountpoint + `\`
+			component := strings.Repeat("d", 60)
+			for i := 0; i < 10; i++ {
+				dir = filepath.Join(dir, fmt.Sprintf("%s%02d", component, i))
+				if !assert.NoError(os.Mkdir(dir, 0755)) {
+					return
+				}
+			}
+			name := filepath.Join(dir, strings.Repeat("f", 200))
+			assert.Greater(len(name), 2*windows.MAX_PATH)
+			assert.NoError(os.WriteFile(name, []byte("deep"), 0644))
+			content, err := os.ReadFile(name)
+			assert.NoError(err)
+			assert.Equal("deep", string(content))
+
+			entries, err := os.ReadDir(dir)
+			assert.NoError(err)
+			if assert.Len(entries, 1) {
+				assert.Equal(filepath.Base(name), entries[0].Name())
+			}
+			renamed := filepath.Join(dir, strings.Repeat("r", 200))
+			assert.NoError(os.Rename(name, renamed))
+			assert.NoError(os.Remove(renamed))
+			assert.NoError(os.RemoveAll(filepath.Join(
+				mountpoint+`\`, component+"00")))
+		})
+	}
+}
+
+func TestUnpairedSurrogate(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	name := append(windows.StringToUTF16(root)[:len(root)],
+		'a', 0xd800, 'b', 0)
+	handle, err := windows.CreateFile(&name[0],
+		windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.CREATE_NEW, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(windows.CloseHandle(handle))
+
+	// The name must be listed and reopened as it is, instead
+	// of having its surrogate replaced by U+FFFD.
+	var data windows.Win32finddata
+	pattern := append(windows.StringToUTF16(root)[:len(root)], 'a', '*', 0)
+	find, err := windows.FindFirstFile(&pattern[0], &data)
+	if assert.NoError(err) {
+		assert.Equal(name[len(root):len(name)-1],
+			data.FileName[:len(name)-len(root)-1])
+		assert.Equal(uint16(0), data.FileName[len(name)-len(root)-1])
+		assert.NoError(windows.FindClose(find))
+	}
+	entries, err := os.ReadDir(root)
+	if assert.NoError(err) && assert.Len(entries, 1) {
+		assert.Equal(wtf8.Decode(name[len(root):len(name)-1]),
+			entries[0].Name())
+	}
+	assert.NoError(windows.DeleteFile(&name[0]))
+	entries, err = os.ReadDir(root)
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestCreationAttributes(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	name, err := windows.UTF16PtrFromString(filepath.Join(root, "hidden"))
+	if !assert.NoError(err) {
+		return
+	}
+	handle, err := windows.CreateFile(name,
+		windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.CREATE_NEW, windows.FILE_ATTRIBUTE_HIDDEN|
+			windows.FILE_ATTRIBUTE_SYSTEM, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(windows.CloseHandle(handle))
+	attributes, err := windows.GetFileAttributes(name)
+	assert.NoError(err)
+	assert.NotZero(attributes & windows.FILE_ATTRIBUTE_HIDDEN)
+	assert.NotZero(attributes & windows.FILE_ATTRIBUTE_SYSTEM)
+	assert.Zero(attributes & windows.FILE_ATTRIBUTE_READONLY)
+
+	// Overwriting the file replaces the attributes.
+	handle, err = windows.CreateFile(name,
+		windows.GENERIC_WRITE, 0, nil, windows.CREATE_ALWAYS,
+		windows.FILE_ATTRIBUTE_HIDDEN|windows.FILE_ATTRIBUTE_SYSTEM|
+			windows.FILE_ATTRIBUTE_ARCHIVE, 0)
+	if assert.NoError(err) {
+		assert.NoError(windows.CloseHandle(handle))
+	}
+	attributes, err = windows.GetFileAttributes(name)
+	assert.NoError(err)
+	assert.NotZero(attributes & windows.FILE_ATTRIBUTE_ARCHIVE)
+}
+
+func TestDeleteOnClose(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	open := func(name string, access, disposition, flags uint32) (
+		windows.Handle, error,
+	) {
+		utf16Name, err := windows.UTF16PtrFromString(filepath.Join(root, name))
+		if err != nil {
+			return windows.InvalidHandle, err
+		}
+		return windows.CreateFile(utf16Name, access,
+			windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|
+				windows.FILE_SHARE_DELETE, nil, disposition,
+			flags|windows.FILE_FLAG_DELETE_ON_CLOSE, 0)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(root, name))
+		return err == nil
+	}
+
+	// The temporary file used by the compilers is readable and
+	// writable through its handle, and is gone after closing.
+	handle, err := open("temp",
+		windows.GENERIC_READ|windows.GENERIC_WRITE|windows.DELETE,
+		windows.CREATE_NEW, windows.FILE_ATTRIBUTE_TEMPORARY)
+	if !assert.NoError(err) {
+		return
+	}
+	var n uint32
+	assert.NoError(windows.WriteFile(handle, []byte("scratch"), &n, nil))
+	_, err = windows.Seek(handle, 0, 0)
+	assert.NoError(err)
+	buf := make([]byte, 16)
+	assert.NoError(windows.ReadFile(handle, buf, &n, nil))
+	assert.Equal("scratch", string(buf[:n]))
+	assert.True(exists("temp"))
+	assert.NoError(windows.CloseHandle(handle))
+	assert.False(exists("temp"))
+
+	// The existing file opened by the installers is removed.
+	assert.NoError(os.WriteFile(filepath.Join(root, "stale"), nil, 0644))
+	handle, err = open("stale", windows.DELETE, windows.OPEN_EXISTING, 0)
+	if assert.NoError(err) {
+		assert.NoError(windows.CloseHandle(handle))
+	}
+	assert.False(exists("stale"))
+
+	// The empty directory could be removed in the same way.
+	assert.NoError(os.Mkdir(filepath.Join(root, "dir"), 0755))
+	handle, err = open("dir", windows.DELETE, windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS)
+	if assert.NoError(err) {
+		assert.NoError(windows.CloseHandle(handle))
+	}
+	assert.False(exists("dir"))
+
+	// The read-only file could not be opened for deletion.
+	readOnly, err := windows.UTF16PtrFromString(filepath.Join(root, "readonly"))
+	if !assert.NoError(err) {
+		return
+	}
+	handle, err = windows.CreateFile(readOnly, windows.GENERIC_WRITE, 0,
+		nil, windows.CREATE_NEW, windows.FILE_ATTRIBUTE_READONLY, 0)
+	if assert.NoError(err) {
+		assert.NoError(windows.CloseHandle(handle))
+	}
+	_, err = open("readonly", windows.DELETE, windows.OPEN_EXISTING, 0)
+	assert.Error(err)
+	assert.True(exists("readonly"))
+}
+
+// listDir lists the directory through FindFirstFile, which
+// reports the reparse tags in the Reserved0.
+func listDir(t *testing.T, dir string) map[string]windows.Win32finddata {
+	t.Helper()
+	pattern, err := windows.UTF16PtrFromString(dir + `\*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findData windows.Win32finddata
+	find, err := windows.FindFirstFile(pattern, &findData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = windows.FindClose(find) }()
+	found := make(map[string]windows.Win32finddata)
+	for err == nil {
+		found[windows.UTF16ToString(findData.FileName[:])] = findData
+		err = windows.FindNextFile(find, &findData)
+	}
+	assert.Equal(t, windows.ERROR_NO_MORE_FILES, err)
+	return found
+}
+
+func TestReparseTagListing(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+	assert.NoError(os.Mkdir(filepath.Join(dir, "dir"), 0755))
+	for _, name := range []string{"file", "dir"} {
+		if err := os.Symlink(name, filepath.Join(dir, name+"-link")); err != nil {
+			t.Skipf("symlink unavailable: %v", err)
+		}
+	}
+
+	// The links are reported as reparse points when the file
+	// system supports symbolic links.
+	found := listDir(t, strings.TrimSuffix(mountFS(t, linkFS{osFS(dir)}), `\`))
+	for name, isDir := range map[string]bool{
+		"file-link": false, "dir-link": true,
+	} {
+		data, ok := found[name]
+		if !assert.True(ok, name) {
+			continue
+		}
+		assert.NotZero(data.FileAttributes&
+			windows.FILE_ATTRIBUTE_REPARSE_POINT, name)
+		assert.Equal(uint32(windows.IO_REPARSE_TAG_SYMLINK),
+			data.Reserved0, name)
+		assert.Equal(isDir, data.FileAttributes&
+			windows.FILE_ATTRIBUTE_DIRECTORY != 0, name)
+	}
+	assert.Zero(found["file"].FileAttributes &
+		windows.FILE_ATTRIBUTE_REPARSE_POINT)
+
+	// Otherwise they are followed once opened, and must not
+	// be listed as reparse points.
+	found = listDir(t, strings.TrimSuffix(mountFS(t, osFS(dir)), `\`))
+	for _, name := range []string{"file-link", "dir-link"} {
+		data, ok := found[name]
+		if !assert.True(ok, name) {
+			continue
+		}
+		assert.Zero(data.FileAttributes&
+			windows.FILE_ATTRIBUTE_REPARSE_POINT, name)
+		assert.Zero(data.Reserved0, name)
+	}
+}
+
+// fileRenameInfo is the FILE_RENAME_INFO structure, followed
+// by the buffer of the name.
+type fileRenameInfo struct {
+	Flags          uint32
+	RootDirectory  windows.Handle
+	FileNameLength uint32
+	FileName       [windows.MAX_PATH]uint16
+}
+
+const (
+	fileRenameFlagReplaceIfExists = 0x00000001
+	fileRenameFlagPosixSemantics  = 0x00000002
+)
+
+func TestRenameOverOpenTarget(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t, winfsp.PosixUnlinkRename(true))
+	target := filepath.Join(root, "document")
+	assert.NoError(os.WriteFile(target, []byte("old"), 0644))
+
+	// The previewer keeps the document open while sharing the
+	// deletion, so that the editor is able to replace it.
+	utf16Target, err := windows.UTF16PtrFromString(target)
+	if !assert.NoError(err) {
+		return
+	}
+	previewer, err := windows.CreateFile(utf16Target,
+		windows.GENERIC_READ, windows.FILE_SHARE_READ|
+			windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = windows.CloseHandle(previewer) }()
+
+	temp := filepath.Join(root, "document.tmp")
+	assert.NoError(os.WriteFile(temp, []byte("new"), 0644))
+	utf16Temp, err := windows.UTF16PtrFromString(temp)
+	if !assert.NoError(err) {
+		return
+	}
+	editor, err := windows.CreateFile(utf16Temp,
+		windows.DELETE|windows.SYNCHRONIZE, 0, nil,
+		windows.OPEN_EXISTING, 0, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	info := fileRenameInfo{
+		Flags: fileRenameFlagReplaceIfExists |
+			fileRenameFlagPosixSemantics,
+	}
+	name := windows.StringToUTF16("document")
+	info.FileNameLength = uint32(2 * (len(name) - 1))
+	copy(info.FileName[:], name)
+	assert.NoError(windows.SetFileInformationByHandle(
+		editor, windows.FileRenameInfoEx,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))))
+	assert.NoError(windows.CloseHandle(editor))
+
+	content, err := os.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal("new", string(content))
+	_, err = os.Stat(temp)
+	assert.True(os.IsNotExist(err))
+}
+
+// failRenameFS is the memFS failing to rename files.
+type failRenameFS struct {
+	*memFS
+}
+
+func (fs failRenameFS) Rename(source, target string) error {
+	return windows.STATUS_DISK_FULL
+}
+
+func TestRenameOverOpenTargetFailure(t *testing.T) {
+	testRenameOverOpenTargetFailure(t)
+}
+
+func TestRenameOverOpenTargetFailureFair(t *testing.T) {
+	// The failed renaming marks its intent to write the
+	// target, which must not keep the previewer from being
+	// restored, nor the target from being opened.
+	testRenameOverOpenTargetFailure(t, gofs.FairPathLock(time.Hour))
+}
+
+func testRenameOverOpenTargetFailure(t *testing.T, opts ...gofs.Option) {
+	assert := assert.New(t)
+	fs := failRenameFS{newMemFS()}
+	root := mountBehaviour(t, gofs.New(fs, opts...),
+		winfsp.PosixUnlinkRename(true))
+	target := filepath.Join(root, "document")
+	assert.NoError(os.WriteFile(target, []byte("old"), 0644))
+	previewer, err := os.Open(target)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = previewer.Close() }()
+
+	temp := filepath.Join(root, "document.tmp")
+	assert.NoError(os.WriteFile(temp, []byte("new"), 0644))
+	utf16Temp, err := windows.UTF16PtrFromString(temp)
+	if !assert.NoError(err) {
+		return
+	}
+	editor, err := windows.CreateFile(utf16Temp,
+		windows.DELETE|windows.SYNCHRONIZE, 0, nil,
+		windows.OPEN_EXISTING, 0, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	info := fileRenameInfo{
+		Flags: fileRenameFlagReplaceIfExists |
+			fileRenameFlagPosixSemantics,
+	}
+	name := windows.StringToUTF16("document")
+	info.FileNameLength = uint32(2 * (len(name) - 1))
+	copy(info.FileName[:], name)
+	assert.Error(windows.SetFileInformationByHandle(
+		editor, windows.FileRenameInfoEx,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))))
+	assert.NoError(windows.CloseHandle(editor))
+
+	// The previewer is still able to read the document, since
+	// the target is not replaced after all.
+	buf := make([]byte, 3)
+	n, err := previewer.ReadAt(buf, 0)
+	assert.NoError(err)
+	assert.Equal("old", string(buf[:n]))
+	content, err := os.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal("old", string(content))
+}
+
+// fileStandardInfo is the FILE_STANDARD_INFO structure.
+type fileStandardInfo struct {
+	AllocationSize int64
+	EndOfFile      int64
+	NumberOfLinks  uint32
+	DeletePending  bool
+	Directory      bool
+}
+
+func TestAllocationSize(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	f, err := os.Create(filepath.Join(root, "preallocated"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	handle := windows.Handle(f.Fd())
+	standardInfo := func() fileStandardInfo {
+		var info fileStandardInfo
+		assert.NoError(windows.GetFileInformationByHandleEx(
+			handle, windows.FileStandardInfo,
+			(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))))
+		return info
+	}
+
+	// Growing the allocation must not change the file size.
+	allocation := int64(1024 * 1024)
+	assert.NoError(windows.SetFileInformationByHandle(
+		handle, windows.FileAllocationInfo,
+		(*byte)(unsafe.Pointer(&allocation)),
+		uint32(unsafe.Sizeof(allocation))))
+	info := standardInfo()
+	assert.Equal(allocation, info.AllocationSize)
+	assert.Equal(int64(0), info.EndOfFile)
+
+	// Writing within the allocation keeps it unchanged.
+	_, err = f.Write([]byte("preallocated"))
+	assert.NoError(err)
+	info = standardInfo()
+	assert.Equal(allocation, info.AllocationSize)
+	assert.Equal(int64(12), info.EndOfFile)
+}
+
+// blockingFS is the memfs whose reads block until released,
+// imitating a hung backend.
+type blockingFS struct {
+	*memFS
+	release chan struct{}
+}
+
+type blockingFile struct {
+	gofs.File
+	release chan struct{}
+}
+
+func (fs blockingFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := fs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return blockingFile{File: f, release: fs.release}, nil
+}
+
+func (f blockingFile) ReadAt(b []byte, offset int64) (int, error) {
+	<-f.release
+	return f.File.ReadAt(b, offset)
+}
+
+func TestUnmountContext(t *testing.T) {
+	assert := assert.New(t)
+	fs := blockingFS{memFS: newPopulatedMemFS(t), release: make(chan struct{})}
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(fs), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	f, err := os.Open(filepath.Join(mountpoint+`\`, "file"))
+	if !assert.NoError(err) {
+		close(fs.release)
+		mounted.Unmount()
+		return
+	}
+	read := make(chan error, 1)
+	go func() {
+		_, err := f.Read(make([]byte, 4))
+		read <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The unmounting gives up waiting for the in-flight read
+	// when the context is done, while the file system is
+	// still destroyed after the read completes.
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(mounted.UnmountContext(ctx), context.DeadlineExceeded)
+	close(fs.release)
+	<-read
+	_ = f.Close()
+	select {
+	case <-mounted.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("file system not destroyed")
+	}
+
+	// The file system without operations in flight is
+	// unmounted without error.
+	mountMtx.Lock()
+	mounted, err = winfsp.Mount(gofs.New(newMemFS()), mountpoint)
+	mountMtx.Unlock()
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(mounted.UnmountContext(context.Background()))
+	<-mounted.Done()
+}
+
+func TestMaxComponentLength(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t, winfsp.MaxComponentLength(64))
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The limit is advertised to the callers of the volume
+	// information.
+	var maxComponentLength uint32
+	assert.NoError(windows.GetVolumeInformation(
+		rootPtr, nil, 0, nil, &maxComponentLength, nil, nil, 0))
+	assert.Equal(uint32(64), maxComponentLength)
+}
+
+func TestDebugLogWriter(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(newMemFS()), mountpoint,
+		winfsp.Debug(true), winfsp.DebugLogWriter(&buf))
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	name := filepath.Join(mountpoint+`\`, "debug-log-file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+
+	// The pending debug log has been copied to the writer
+	// once the file system is unmounted.
+	mounted.Unmount()
+	assert.Contains(buf.String(), "debug-log-file")
+}
+
+func TestMountPointSecurity(t *testing.T) {
+	assert := assert.New(t)
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;WD)")
+	if !assert.NoError(err) {
+		return
+	}
+	root := mountMemFS(t, winfsp.MountPointSecurity(sd))
+
+	// The mount point granting everyone is usable as usual.
+	name := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+	content, err := os.ReadFile(name)
+	assert.NoError(err)
+	assert.Equal([]byte("content"), content)
+}
+
+func TestRemoveMountPoint(t *testing.T) {
+	assert := assert.New(t)
+	mountMtx.Lock()
+	defer mountMtx.Unlock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(newMemFS()), mountpoint)
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	name := filepath.Join(mountpoint+`\`, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+
+	// The detached file system is no longer accessible from
+	// the mount point, while the dispatcher keeps running.
+	if !assert.NoError(mounted.RemoveMountPoint()) {
+		return
+	}
+	assert.Empty(mounted.MountPoint())
+	_, err = os.Stat(name)
+	assert.Error(err)
+
+	// The files are retained after being attached again.
+	if !assert.NoError(mounted.SetMountPoint(mountpoint)) {
+		return
+	}
+	assert.Equal(mountpoint, mounted.MountPoint())
+	content, err := os.ReadFile(name)
+	assert.NoError(err)
+	assert.Equal([]byte("content"), content)
+}
+
+func TestChtimes(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	name := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+
+	// The modification time must survive the copying, which
+	// sets the times through SetBasicInfo.
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.NoError(os.Chtimes(name, mtime, mtime))
+	info, err := os.Stat(name)
+	if assert.NoError(err) {
+		assert.True(mtime.Equal(info.ModTime()), info.ModTime())
+	}
+}
+
+func TestSetAttributes(t *testing.T) {
+	assert := assert.New(t)
+	root := mountMemFS(t)
+	name := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+	namePtr, err := windows.UTF16PtrFromString(name)
+	assert.NoError(err)
+
+	// The attributes set by attrib must be reported back.
+	assert.NoError(windows.SetFileAttributes(namePtr,
+		windows.FILE_ATTRIBUTE_READONLY|windows.FILE_ATTRIBUTE_HIDDEN))
+	attributes, err := windows.GetFileAttributes(namePtr)
+	assert.NoError(err)
+	assert.NotZero(attributes & windows.FILE_ATTRIBUTE_READONLY)
+	assert.NotZero(attributes & windows.FILE_ATTRIBUTE_HIDDEN)
+	assert.NoError(windows.SetFileAttributes(namePtr,
+		windows.FILE_ATTRIBUTE_NORMAL))
+	attributes, err = windows.GetFileAttributes(namePtr)
+	assert.NoError(err)
+	assert.Zero(attributes & windows.FILE_ATTRIBUTE_READONLY)
+	assert.Zero(attributes & windows.FILE_ATTRIBUTE_HIDDEN)
+}
+
+func TestSetBasicInfoUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	root := mountFS(t, osFS(t.TempDir()))
+	name := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+	namePtr, err := windows.UTF16PtrFromString(name)
+	assert.NoError(err)
+
+	// The osFS can neither change the times nor the
+	// attributes, which must not be reported as applied.
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.ErrorIs(os.Chtimes(name, mtime, mtime),
+		windows.ERROR_ACCESS_DENIED)
+	assert.ErrorIs(windows.SetFileAttributes(namePtr,
+		windows.FILE_ATTRIBUTE_HIDDEN), windows.ERROR_ACCESS_DENIED)
+	attributes, err := windows.GetFileAttributes(namePtr)
+	assert.NoError(err)
+	assert.Zero(attributes & windows.FILE_ATTRIBUTE_HIDDEN)
+
+	// Nothing is requested to change, which must succeed.
+	assert.NoError(windows.SetFileAttributes(namePtr,
+		windows.FILE_ATTRIBUTE_NORMAL))
+}
+
+// chmodFS is the osFS supporting changing permissions.
+type chmodFS struct {
+	osFS
+}
+
+func (fs chmodFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(fs.path(name), mode)
+}
+
+var _ gofs.FileSystemChmod = chmodFS{}
+
+func TestChmod(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644))
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(chmodFS{osFS(dir)}), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	name := filepath.Join(mountpoint+`\`, "file")
+
+	// The read-only attribute is mapped onto the permissions
+	// of the backend file.
+	assert.NoError(os.Chmod(name, 0444))
+	info, err := os.Stat(filepath.Join(dir, "file"))
+	assert.NoError(err)
+	assert.Zero(info.Mode() & 0200)
+	assert.Error(os.WriteFile(name, []byte("denied"), 0644))
+	assert.NoError(os.Chmod(name, 0644))
+	info, err = os.Stat(filepath.Join(dir, "file"))
+	assert.NoError(err)
+	assert.NotZero(info.Mode() & 0200)
+	assert.NoError(os.WriteFile(name, []byte("allowed"), 0644))
+
+	// The other attributes can't be mapped onto permissions.
+	namePtr, err := windows.UTF16PtrFromString(name)
+	assert.NoError(err)
+	assert.ErrorIs(windows.SetFileAttributes(namePtr,
+		windows.FILE_ATTRIBUTE_HIDDEN), windows.ERROR_ACCESS_DENIED)
+}
+
+// securityFS is the memFS storing security descriptors.
+type securityFS struct {
+	*memFS
+	mtx sync.Mutex
+	sds map[string][]byte
+}
+
+func (fs *securityFS) GetSecurity(
+	name string,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	data, ok := fs.sds[name]
+	if !ok {
+		return nil, nil
+	}
+	data = append([]byte(nil), data...)
+	return (*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(&data[0])), nil
+}
+
+func (fs *securityFS) SetSecurity(
+	name string, sd *windows.SECURITY_DESCRIPTOR,
+) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.sds[name] = append([]byte(nil), unsafe.Slice(
+		(*byte)(unsafe.Pointer(sd)), sd.Length())...)
+	return nil
+}
+
+var _ gofs.FileSystemSetSecurity = (*securityFS)(nil)
+
+func TestSecurity(t *testing.T) {
+	assert := assert.New(t)
+	inner := &securityFS{memFS: newMemFS(), sds: make(map[string][]byte)}
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(inner), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	name := filepath.Join(mountpoint+`\`, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+
+	// The DACL set through the mount is persisted by the file
+	// system and reported back.
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;FA;;;WD)")
+	assert.NoError(err)
+	dacl, _, err := sd.DACL()
+	assert.NoError(err)
+	assert.NoError(windows.SetNamedSecurityInfo(name,
+		windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION|
+			windows.PROTECTED_DACL_SECURITY_INFORMATION,
+		nil, nil, dacl, nil))
+	inner.mtx.Lock()
+	assert.NotEmpty(inner.sds)
+	inner.mtx.Unlock()
+	sd, err = windows.GetNamedSecurityInfo(name,
+		windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	assert.NoError(err)
+	assert.Equal("D:P(A;;FA;;;WD)", sd.String())
+}
+
+func TestOperationDeadline(t *testing.T) {
+	assert := assert.New(t)
+	fs := blockingFS{memFS: newPopulatedMemFS(t), release: make(chan struct{})}
+	defer close(fs.release)
+	root := mountFS(t, fs,
+		winfsp.KindOperationDeadline("Read", 100*time.Millisecond))
+
+	// The read on the hung backend is replied with timeout
+	// once the deadline fires, instead of hanging the caller.
+	f, err := os.Open(filepath.Join(root, "file"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	start := time.Now()
+	_, err = f.Read(make([]byte, 4))
+	assert.ErrorIs(err, windows.ERROR_SEM_TIMEOUT)
+	assert.Less(time.Since(start), 5*time.Second)
+
+	// The dispatcher is still serving the other requests.
+	_, err = os.Stat(filepath.Join(root, "dir"))
+	assert.NoError(err)
+}
+
+type readCounter struct {
+	mtx           sync.Mutex
+	running, peak int
+}
+
+type countingFS struct {
+	blockingFS
+	reads *readCounter
+}
+
+type countingFile struct {
+	gofs.File
+	reads *readCounter
+}
+
+func (fs countingFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := fs.blockingFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return countingFile{File: f, reads: fs.reads}, nil
+}
+
+func (f countingFile) ReadAt(b []byte, offset int64) (int, error) {
+	f.reads.mtx.Lock()
+	f.reads.running++
+	if f.reads.running > f.reads.peak {
+		f.reads.peak = f.reads.running
+	}
+	f.reads.mtx.Unlock()
+	defer func() {
+		f.reads.mtx.Lock()
+		f.reads.running--
+		f.reads.mtx.Unlock()
+	}()
+	return f.File.ReadAt(b, offset)
+}
+
+func TestOperationDeadlineLimited(t *testing.T) {
+	assert := assert.New(t)
+	fs := countingFS{
+		blockingFS: blockingFS{
+			memFS:   newPopulatedMemFS(t),
+			release: make(chan struct{}),
+		},
+		reads: &readCounter{},
+	}
+	root := mountFS(t, fs, winfsp.ConcurrencyLimit(1),
+		winfsp.KindOperationDeadline("Read", 10*time.Second))
+	var files []*os.File
+	for _, name := range []string{"file", `dir\nested`} {
+		f, err := os.Open(filepath.Join(root, name))
+		if !assert.NoError(err) {
+			close(fs.release)
+			return
+		}
+		defer func() { _ = f.Close() }()
+		files = append(files, f)
+	}
+
+	// The read completed asynchronously keeps its slot until
+	// it is completed, so the other read waits for it.
+	read := make(chan error, len(files))
+	for _, f := range files {
+		go func(f *os.File) {
+			_, err := f.Read(make([]byte, 4))
+			read <- err
+		}(f)
+		time.Sleep(50 * time.Millisecond)
+	}
+	select {
+	case <-read:
+		assert.Fail("read completed while the backend hangs")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(fs.release)
+	for range files {
+		select {
+		case err := <-read:
+			assert.NoError(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("read not completed")
+		}
+	}
+	fs.reads.mtx.Lock()
+	defer fs.reads.mtx.Unlock()
+	assert.Equal(1, fs.reads.peak)
+}
+
+func TestHostAttributes(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	hostName := filepath.Join(dir, "sparse")
+	assert.NoError(os.WriteFile(hostName, []byte("content"), 0644))
+	hostPtr, err := windows.UTF16PtrFromString(hostName)
+	if !assert.NoError(err) {
+		return
+	}
+	host, err := windows.CreateFile(hostPtr,
+		windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.OPEN_EXISTING, 0, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	var returned uint32
+	err = windows.DeviceIoControl(host, windows.FSCTL_SET_SPARSE,
+		nil, 0, nil, 0, &returned, nil)
+	assert.NoError(windows.CloseHandle(host))
+	if err != nil {
+		t.Skipf("sparse files unavailable: %v", err)
+	}
+	root := mountFS(t, osFS(dir))
+
+	// The attributes of the host file which the volume does
+	// not implement are not reported.
+	name, err := windows.UTF16PtrFromString(filepath.Join(root, "sparse"))
+	if !assert.NoError(err) {
+		return
+	}
+	attributes, err := windows.GetFileAttributes(name)
+	assert.NoError(err)
+	assert.Zero(attributes & windows.FILE_ATTRIBUTE_SPARSE_FILE)
+}
+
+// failAttributesFS is the memFS failing to set attributes.
+type failAttributesFS struct {
+	*memFS
+}
+
+func (fs failAttributesFS) SetAttributes(name string, attributes uint32) error {
+	return windows.STATUS_DISK_FULL
+}
+
+func TestCreationAttributesFailure(t *testing.T) {
+	assert := assert.New(t)
+	fs := failAttributesFS{newMemFS()}
+	root := mountFS(t, fs)
+
+	// The created file is removed when the attributes fail
+	// to be persisted.
+	name, err := windows.UTF16PtrFromString(filepath.Join(root, "file"))
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = windows.CreateFile(name,
+		windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.CREATE_NEW, windows.FILE_ATTRIBUTE_HIDDEN, 0)
+	assert.Error(err)
+	_, err = fs.memFS.Stat(`\file`)
+	assert.True(os.IsNotExist(err))
+}
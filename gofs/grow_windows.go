@@ -0,0 +1,204 @@
+package gofs
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// defaultGrowChunkSize is the default size of zeros written
+// at a time while extending a file.
+const defaultGrowChunkSize = 1024 * 1024
+
+type growFileSystem struct {
+	FileSystem
+	ctx       context.Context
+	chunkSize int
+}
+
+// GrowByWriting wraps the file system whose files might not be
+// extended by Truncate, e.g. the ones backed by object storages
+// or append only logs, so that the files are extended by writing
+// zeros up to the requested size instead.
+//
+// The zeros are written in chunks of chunkSize bytes, or a
+// default size if it is not positive, and extending is given up
+// once the context is done, e.g. the file system is unmounting.
+//
+// Only the methods of File are available to the wrapped files,
+// so their FileTruncateEx, FileWriteEx and FileAllocateEx will
+// be imitated by this package instead. The optional interfaces
+// of the file system are forwarded through FileSystemWrapper.
+func GrowByWriting(
+	ctx context.Context, fs FileSystem, chunkSize int,
+) FileSystem {
+	if chunkSize <= 0 {
+		chunkSize = defaultGrowChunkSize
+	}
+	return &growFileSystem{
+		FileSystem: fs,
+		ctx:        ctx,
+		chunkSize:  chunkSize,
+	}
+}
+
+func (fs *growFileSystem) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (File, error) {
+	file, err := fs.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &growFile{File: file, fs: fs}, nil
+}
+
+func (fs *growFileSystem) Unwrap() FileSystem {
+	return fs.FileSystem
+}
+
+func (fs *growFileSystem) SetAttributes(name string, attributes uint32) error {
+	inner, ok := fs.FileSystem.(FileSystemAttributes)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.SetAttributes(name, attributes)
+}
+
+func (fs *growFileSystem) Chmod(name string, mode os.FileMode) error {
+	inner, ok := fs.FileSystem.(FileSystemChmod)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Chmod(name, mode)
+}
+
+func (fs *growFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	inner, ok := fs.FileSystem.(FileSystemChtimes)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Chtimes(name, atime, mtime)
+}
+
+func (fs *growFileSystem) Sync() error {
+	inner, ok := fs.FileSystem.(FileSystemSync)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Sync()
+}
+
+func (fs *growFileSystem) GetSecurity(
+	name string,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	inner, ok := fs.FileSystem.(FileSystemSecurity)
+	if !ok {
+		return nil, windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.GetSecurity(name)
+}
+
+func (fs *growFileSystem) SetSecurity(
+	name string, sd *windows.SECURITY_DESCRIPTOR,
+) error {
+	inner, ok := fs.FileSystem.(FileSystemSetSecurity)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.SetSecurity(name, sd)
+}
+
+func (fs *growFileSystem) Symlink(oldname, newname string) error {
+	inner, ok := fs.FileSystem.(FileSystemSymlink)
+	if !ok {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Symlink(oldname, newname)
+}
+
+func (fs *growFileSystem) Readlink(name string) (string, error) {
+	inner, ok := fs.FileSystem.(FileSystemSymlink)
+	if !ok {
+		return "", windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Readlink(name)
+}
+
+func (fs *growFileSystem) Lstat(name string) (os.FileInfo, error) {
+	inner, ok := fs.FileSystem.(FileSystemSymlink)
+	if !ok {
+		return nil, windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	return inner.Lstat(name)
+}
+
+type growFile struct {
+	File
+	fs *growFileSystem
+}
+
+// Truncate attempts to extend the file with the inner file,
+// and falls back to writing zeros if it fails or the file has
+// not been extended to the size.
+func (f *growFile) Truncate(size int64) error {
+	fileInfo, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if size <= fileInfo.Size() {
+		return f.File.Truncate(size)
+	}
+	if err := f.File.Truncate(size); err == nil {
+		if fileInfo, err = f.File.Stat(); err != nil {
+			return err
+		}
+		if fileInfo.Size() >= size {
+			return nil
+		}
+	}
+	if fileInfo, err = f.File.Stat(); err != nil {
+		return err
+	}
+	return f.fill(fileInfo.Size(), size)
+}
+
+// fill writes zeros from the offset to the end.
+func (f *growFile) fill(offset, end int64) error {
+	zeros := make([]byte, f.fs.chunkSize)
+	for offset < end {
+		select {
+		case <-f.fs.ctx.Done():
+			return f.fs.ctx.Err()
+		default:
+		}
+		chunk := zeros
+		if remaining := end - offset; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := f.File.WriteAt(chunk, offset)
+		offset += int64(n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Nothing written without an error, which would
+			// otherwise be retried forever.
+			return io.ErrShortWrite
+		}
+	}
+	return nil
+}
+
+var (
+	_ FileSystemWrapper     = (*growFileSystem)(nil)
+	_ FileSystemAttributes  = (*growFileSystem)(nil)
+	_ FileSystemChmod       = (*growFileSystem)(nil)
+	_ FileSystemChtimes     = (*growFileSystem)(nil)
+	_ FileSystemSync        = (*growFileSystem)(nil)
+	_ FileSystemSetSecurity = (*growFileSystem)(nil)
+	_ FileSystemSymlink     = (*growFileSystem)(nil)
+	_ File                  = (*growFile)(nil)
+)
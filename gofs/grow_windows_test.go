@@ -0,0 +1,170 @@
+package gofs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+var errNoExtend = errors.New("truncate cannot extend")
+
+// noExtendFS is the memfs whose files cannot be extended by
+// Truncate, imitating the object storages.
+type noExtendFS struct {
+	*memFS
+}
+
+type noExtendFile struct {
+	gofs.File
+}
+
+func (fs noExtendFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := fs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return noExtendFile{File: f}, nil
+}
+
+func (f noExtendFile) Truncate(size int64) error {
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size > fileInfo.Size() {
+		return errNoExtend
+	}
+	return f.File.Truncate(size)
+}
+
+func TestGrowByWriting(t *testing.T) {
+	assert := assert.New(t)
+	fs := gofs.GrowByWriting(context.Background(),
+		noExtendFS{memFS: newMemFS()}, 3)
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	_, err = f.Write([]byte("data"))
+	assert.NoError(err)
+	assert.NoError(f.Truncate(12))
+	content, err := io.ReadAll(io.NewSectionReader(f, 0, 64))
+	assert.NoError(err)
+	assert.Equal(append([]byte("data"), bytes.Repeat([]byte{0}, 8)...), content)
+
+	// Shrinking is still done by the inner file.
+	assert.NoError(f.Truncate(2))
+	fileInfo, err := f.Stat()
+	assert.NoError(err)
+	assert.Equal(int64(2), fileInfo.Size())
+}
+
+func TestGrowByWritingCancel(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fs := gofs.GrowByWriting(ctx, noExtendFS{memFS: newMemFS()}, 0)
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	assert.ErrorIs(f.Truncate(1024), context.Canceled)
+}
+
+// stuckFile is the noExtendFile which writes nothing without
+// reporting any error.
+type stuckFile struct {
+	noExtendFile
+}
+
+func (f stuckFile) WriteAt(b []byte, offset int64) (int, error) {
+	return 0, nil
+}
+
+// stuckFS is the noExtendFS whose files are stuckFile.
+type stuckFS struct {
+	noExtendFS
+}
+
+func (fs stuckFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := fs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return stuckFile{noExtendFile{File: f}}, nil
+}
+
+func TestGrowByWritingStuck(t *testing.T) {
+	assert := assert.New(t)
+	fs := gofs.GrowByWriting(context.Background(),
+		stuckFS{noExtendFS{memFS: newMemFS()}}, 0)
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	assert.ErrorIs(f.Truncate(1024), io.ErrShortWrite)
+}
+
+// volumeFlags retrieves the file system flags of the volume.
+func volumeFlags(t *testing.T, root string) uint32 {
+	t.Helper()
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags uint32
+	if err := windows.GetVolumeInformation(
+		rootPtr, nil, 0, nil, nil, &flags, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+func TestGrowByWritingOptional(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// The attributes are forwarded to the file system which
+	// persists them.
+	root := mountFS(t, gofs.GrowByWriting(ctx, newMemFS(), 0))
+	name := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(name, []byte("content"), 0644))
+	namePtr, err := windows.UTF16PtrFromString(name)
+	assert.NoError(err)
+	assert.NoError(windows.SetFileAttributes(namePtr,
+		windows.FILE_ATTRIBUTE_HIDDEN))
+	attributes, err := windows.GetFileAttributes(namePtr)
+	assert.NoError(err)
+	assert.NotZero(attributes & windows.FILE_ATTRIBUTE_HIDDEN)
+	assert.Zero(volumeFlags(t, root) & windows.FILE_SUPPORTS_REPARSE_POINTS)
+
+	// The file system lacking the attributes falls back to the
+	// permissions, which must not be hidden by the wrapper.
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+	root = mountFS(t, gofs.GrowByWriting(ctx, chmodFS{osFS(dir)}, 0))
+	assert.NoError(os.Chmod(filepath.Join(root, "file"), 0444))
+	info, err := os.Stat(filepath.Join(dir, "file"))
+	assert.NoError(err)
+	assert.Zero(info.Mode() & 0200)
+
+	// The symbolic links are only claimed when supported.
+	root = mountFS(t, gofs.GrowByWriting(ctx, linkFS{osFS(dir)}, 0))
+	assert.NotZero(volumeFlags(t, root) & windows.FILE_SUPPORTS_REPARSE_POINTS)
+}
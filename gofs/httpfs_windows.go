@@ -0,0 +1,121 @@
+package gofs
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// backendName converts the slash separated name into the name
+// passed to the file system, which is the same as the name of
+// files opened through the mounted volume.
+func backendName(name string) (string, bool) {
+	if strings.ContainsAny(name, `\:`) {
+		return "", false
+	}
+	return filepath.FromSlash(path.Clean("/" + name)), true
+}
+
+type httpFileSystem struct {
+	fs FileSystem
+}
+
+// HTTPFileSystem wraps the file system as http.FileSystem, so
+// that the same file system could also be served over HTTP
+// through http.FileServer, besides mounted through WinFSP.
+func HTTPFileSystem(fs FileSystem) http.FileSystem {
+	return &httpFileSystem{fs: fs}
+}
+
+func (h *httpFileSystem) Open(name string) (http.File, error) {
+	backend, ok := backendName(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return h.fs.OpenFile(backend, os.O_RDONLY, 0)
+}
+
+type ioFS struct {
+	fs FileSystem
+}
+
+// IOFS wraps the file system as the read only fs.FS, which
+// also implements fs.StatFS.
+func IOFS(fs FileSystem) fs.FS {
+	return &ioFS{fs: fs}
+}
+
+func (f *ioFS) backendName(op, name string) (string, error) {
+	backend, ok := "", fs.ValidPath(name)
+	if ok {
+		backend, ok = backendName(name)
+	}
+	if !ok {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return backend, nil
+}
+
+func (f *ioFS) Open(name string) (fs.File, error) {
+	backend, err := f.backendName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.fs.OpenFile(backend, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &ioFile{File: file}, nil
+}
+
+func (f *ioFS) Stat(name string) (fs.FileInfo, error) {
+	backend, err := f.backendName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.fs.Stat(backend)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ioFile is the file opened through fs.FS, whose directory
+// entries are listed at once and then returned in pages.
+type ioFile struct {
+	File
+	listed  bool
+	entries []os.FileInfo
+}
+
+func (f *ioFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.listed {
+		entries, err := f.File.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		f.listed, f.entries = true, entries
+	}
+	count := len(f.entries)
+	if n > 0 && n < count {
+		count = n
+	}
+	if n > 0 && count == 0 {
+		return nil, io.EOF
+	}
+	result := make([]fs.DirEntry, count)
+	for i := range result {
+		result[i] = fs.FileInfoToDirEntry(f.entries[i])
+	}
+	f.entries = f.entries[count:]
+	return result, nil
+}
+
+var (
+	_ fs.StatFS      = (*ioFS)(nil)
+	_ fs.ReadDirFile = (*ioFile)(nil)
+)
@@ -0,0 +1,64 @@
+package gofs_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+func newPopulatedMemFS(t *testing.T) *memFS {
+	fs := newMemFS()
+	assert.NoError(t, fs.Mkdir(`\dir`, 0755))
+	for name, content := range map[string]string{
+		`\file`:          "file",
+		`\dir\nested`:    "nested",
+		`\dir\another`:   "another",
+		`\dir\.dotfile`:  "dotfile",
+		`\dir\space ful`: "space",
+	} {
+		f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+		if assert.NoError(t, err) {
+			_, err = f.Write([]byte(content))
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+		}
+	}
+	return fs
+}
+
+func TestIOFS(t *testing.T) {
+	fsys := gofs.IOFS(newPopulatedMemFS(t))
+	if err := fstest.TestFS(fsys, "file", "dir/nested",
+		"dir/another", "dir/.dotfile", "dir/space ful"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.FileServer(
+		gofs.HTTPFileSystem(newPopulatedMemFS(t))))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/dir/nested")
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	content, err := io.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("nested", string(content))
+
+	resp, err = http.Get(server.URL + "/missing")
+	if assert.NoError(err) {
+		_ = resp.Body.Close()
+		assert.Equal(http.StatusNotFound, resp.StatusCode)
+	}
+}
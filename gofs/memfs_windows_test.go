@@ -0,0 +1,405 @@
+package gofs_test
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// memNode is a file or directory in the memfs.
+type memNode struct {
+	mtx      sync.RWMutex
+	name     string
+	mode     os.FileMode
+	modTime  time.Time
+	created  time.Time
+	attrs    uint32
+	data     []byte
+	children map[string]*memNode
+}
+
+func (n *memNode) stat() os.FileInfo {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	return &memFileInfo{
+		name:    n.name,
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+		created: n.created,
+		attrs:   n.attrs,
+	}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	created time.Time
+	attrs   uint32
+}
+
+func (i *memFileInfo) Name() string         { return i.name }
+func (i *memFileInfo) Size() int64          { return i.size }
+func (i *memFileInfo) Mode() os.FileMode    { return i.mode }
+func (i *memFileInfo) ModTime() time.Time   { return i.modTime }
+func (i *memFileInfo) IsDir() bool          { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}     { return nil }
+func (i *memFileInfo) Birthtime() time.Time { return i.created }
+
+func (i *memFileInfo) FileAttributes() uint32 {
+	attrs := i.attrs
+	if i.mode.Perm()&0200 == 0 {
+		attrs |= windows.FILE_ATTRIBUTE_READONLY
+	}
+	return attrs
+}
+
+// memFS is the in-memory gofs.FileSystem for testing.
+type memFS struct {
+	mtx  sync.Mutex
+	root *memNode
+}
+
+func newMemFS() *memFS {
+	now := time.Now()
+	return &memFS{root: &memNode{
+		mode:     os.ModeDir | 0777,
+		modTime:  now,
+		created:  now,
+		children: make(map[string]*memNode),
+	}}
+}
+
+func splitPath(name string) []string {
+	var result []string
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '\\' || r == '/'
+	}) {
+		if part != "." {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// lookup finds the parent directory and base name of the
+// path, with the memfs lock held by the caller.
+func (fs *memFS) lookup(name string) (*memNode, string, error) {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return nil, "", nil
+	}
+	dir := fs.root
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := dir.children[part]
+		if !ok {
+			return nil, "", os.ErrNotExist
+		}
+		if !child.mode.IsDir() {
+			return nil, "", syscall.ENOTDIR
+		}
+		dir = child
+	}
+	return dir, parts[len(parts)-1], nil
+}
+
+func (fs *memFS) node(name string) (*memNode, error) {
+	dir, base, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil {
+		return fs.root, nil
+	}
+	node, ok := dir.children[base]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return node, nil
+}
+
+func (fs *memFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	node, err := fs.node(name)
+	if err != nil && !(os.IsNotExist(err) && flag&os.O_CREATE != 0) {
+		return nil, err
+	}
+	if node != nil && flag&(os.O_CREATE|os.O_EXCL) ==
+		(os.O_CREATE|os.O_EXCL) {
+		return nil, os.ErrExist
+	}
+	if node == nil {
+		dir, base, err := fs.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		node = &memNode{
+			name:    base,
+			mode:    perm & os.ModePerm,
+			modTime: now,
+			created: now,
+		}
+		dir.mtx.Lock()
+		dir.children[base] = node
+		dir.mtx.Unlock()
+	}
+	if node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, syscall.EISDIR
+	}
+	if flag&os.O_TRUNC != 0 {
+		node.mtx.Lock()
+		node.data = nil
+		node.modTime = time.Now()
+		node.mtx.Unlock()
+	}
+	return &memFile{node: node, flag: flag}, nil
+}
+
+func (fs *memFS) Mkdir(name string, perm os.FileMode) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	dir, base, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	if dir == nil {
+		return os.ErrExist
+	}
+	if _, ok := dir.children[base]; ok {
+		return os.ErrExist
+	}
+	dir.mtx.Lock()
+	defer dir.mtx.Unlock()
+	now := time.Now()
+	dir.children[base] = &memNode{
+		name:     base,
+		mode:     os.ModeDir | (perm & os.ModePerm),
+		modTime:  now,
+		created:  now,
+		children: make(map[string]*memNode),
+	}
+	return nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	node, err := fs.node(name)
+	if err != nil {
+		return nil, err
+	}
+	return node.stat(), nil
+}
+
+func (fs *memFS) SetAttributes(name string, attributes uint32) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	node, err := fs.node(name)
+	if err != nil {
+		return err
+	}
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	node.attrs = attributes &^ windows.FILE_ATTRIBUTE_READONLY
+	return nil
+}
+
+func (fs *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	node, err := fs.node(name)
+	if err != nil {
+		return err
+	}
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	node.modTime = mtime
+	return nil
+}
+
+func (fs *memFS) Rename(source, target string) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	sourceDir, sourceBase, err := fs.lookup(source)
+	if err != nil {
+		return err
+	}
+	targetDir, targetBase, err := fs.lookup(target)
+	if err != nil {
+		return err
+	}
+	if sourceDir == nil || targetDir == nil {
+		return os.ErrPermission
+	}
+	node, ok := sourceDir.children[sourceBase]
+	if !ok {
+		return os.ErrNotExist
+	}
+	sourceDir.mtx.Lock()
+	delete(sourceDir.children, sourceBase)
+	sourceDir.mtx.Unlock()
+	node.mtx.Lock()
+	node.name = targetBase
+	node.mtx.Unlock()
+	targetDir.mtx.Lock()
+	targetDir.children[targetBase] = node
+	targetDir.mtx.Unlock()
+	return nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	dir, base, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	if dir == nil {
+		return os.ErrPermission
+	}
+	node, ok := dir.children[base]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if len(node.children) > 0 {
+		return syscall.ERROR_DIR_NOT_EMPTY
+	}
+	dir.mtx.Lock()
+	delete(dir.children, base)
+	dir.mtx.Unlock()
+	return nil
+}
+
+var (
+	_ gofs.FileSystem           = (*memFS)(nil)
+	_ gofs.FileSystemAttributes = (*memFS)(nil)
+	_ gofs.BirthtimeFileInfo    = (*memFileInfo)(nil)
+	_ gofs.AttributesFileInfo   = (*memFileInfo)(nil)
+)
+
+// memFile is the open file of memfs.
+type memFile struct {
+	node   *memNode
+	flag   int
+	mtx    sync.Mutex
+	offset int64
+}
+
+func (f *memFile) ReadAt(b []byte, offset int64) (int, error) {
+	f.node.mtx.RLock()
+	defer f.node.mtx.RUnlock()
+	if offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(b []byte, offset int64) (int, error) {
+	f.node.mtx.Lock()
+	defer f.node.mtx.Unlock()
+	if end := offset + int64(len(b)); end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	f.node.modTime = time.Now()
+	return copy(f.node.data[offset:], b), nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = f.node.stat().Size()
+	}
+	n, err := f.WriteAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.node.stat().Size()
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	f.node.mtx.RLock()
+	children := make([]*memNode, 0, len(f.node.children))
+	for _, child := range f.node.children {
+		children = append(children, child)
+	}
+	f.node.mtx.RUnlock()
+	result := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		result = append(result, child.stat())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.node.stat(), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.node.mtx.Lock()
+	defer f.node.mtx.Unlock()
+	data := make([]byte, size)
+	copy(data, f.node.data)
+	f.node.data = data
+	f.node.modTime = time.Now()
+	return nil
+}
+
+var _ gofs.File = (*memFile)(nil)
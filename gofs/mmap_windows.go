@@ -0,0 +1,261 @@
+package gofs
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// Option is the option for creating the file system.
+type Option func(*fileSystem)
+
+const (
+	// defaultMmapChunkSize is the default size of each mapped
+	// view of the file, large enough to amortize the mapping.
+	defaultMmapChunkSize = 64 * 1024 * 1024
+
+	// mmapGranularity is the allocation granularity that the
+	// offset of each mapped view must be aligned to.
+	mmapGranularity = 64 * 1024
+
+	// mmapMaxViews is the maximum number of views kept mapped
+	// for each file, so that huge files will not exhaust the
+	// address space, especially on 32-bit platforms.
+	mmapMaxViews = 4
+)
+
+// MmapRead enables reading through memory mapped views for
+// the files opened read only, whose File is a real *os.File,
+// which cuts the syscall overhead of local passthrough file
+// systems. The file is mapped in chunks of chunkSize bytes,
+// or a default size if it is not positive.
+//
+// The views are unmapped before the file is truncated through
+// this file system. Only local files should be served this way,
+// since an I/O error of a mapped view crashes the process.
+func MmapRead(chunkSize int64) Option {
+	return func(fs *fileSystem) {
+		if chunkSize <= 0 {
+			chunkSize = defaultMmapChunkSize
+		}
+		fs.mmapChunk = (chunkSize + mmapGranularity - 1) /
+			mmapGranularity * mmapGranularity
+	}
+}
+
+type mmapView struct {
+	offset int64
+	data   []byte
+}
+
+// mmapFile is the mapping of a read only *os.File, which is
+// created lazily and might be unmapped before truncation.
+type mmapFile struct {
+	mtx     sync.Mutex
+	file    *os.File
+	mapping windows.Handle
+	size    int64
+	views   []mmapView
+}
+
+// view returns the view starting from the offset, mapping
+// it if not mapped yet, with the lock held by the caller.
+func (m *mmapFile) view(offset, length int64) ([]byte, error) {
+	for i, view := range m.views {
+		if view.offset == offset {
+			copy(m.views[1:i+1], m.views[:i])
+			m.views[0] = view
+			return view.data, nil
+		}
+	}
+	addr, err := windows.MapViewOfFile(m.mapping, windows.FILE_MAP_READ,
+		uint32(offset>>32), uint32(offset), uintptr(length))
+	if err != nil {
+		return nil, errors.Wrap(err, "map view of file")
+	}
+	data := unsafe.Slice((*byte)(unsafe.Pointer(addr)), int(length))
+	if len(m.views) >= mmapMaxViews {
+		last := m.views[len(m.views)-1]
+		_ = windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&last.data[0])))
+		m.views = m.views[:len(m.views)-1]
+	}
+	m.views = append([]mmapView{{offset: offset, data: data}}, m.views...)
+	return data, nil
+}
+
+// readAt copies the data within the mapped range, returning
+// the number of bytes copied, and the remaining data must be
+// read from the file instead.
+func (m *mmapFile) readAt(b []byte, offset, chunk int64) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.mapping == 0 {
+		fileInfo, err := m.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fileInfo.Size() == 0 {
+			return 0, nil
+		}
+		mapping, err := windows.CreateFileMapping(
+			windows.Handle(m.file.Fd()), nil,
+			windows.PAGE_READONLY, 0, 0, nil)
+		if err != nil {
+			return 0, errors.Wrap(err, "create file mapping")
+		}
+		m.mapping = mapping
+		m.size = fileInfo.Size()
+	}
+	n := 0
+	for n < len(b) && offset < m.size {
+		start := offset / chunk * chunk
+		length := chunk
+		if start+length > m.size {
+			length = m.size - start
+		}
+		data, err := m.view(start, length)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(b[n:], data[offset-start:])
+		n += copied
+		offset += int64(copied)
+	}
+	return n, nil
+}
+
+// unmap unmaps all views and closes the mapping, which will
+// be mapped again on the next read.
+func (m *mmapFile) unmap() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, view := range m.views {
+		_ = windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&view.data[0])))
+	}
+	m.views = nil
+	if m.mapping != 0 {
+		_ = windows.CloseHandle(m.mapping)
+		m.mapping = 0
+	}
+}
+
+// mmapPath is the mapped files under the same path, whose
+// guard is held exclusively while the file is truncated.
+type mmapPath struct {
+	guard sync.RWMutex
+	refs  int
+	files map[*mmapFile]struct{}
+}
+
+// mmapRegistry tracks the mapped files by their paths, since
+// a file cannot be truncated while any view is mapped.
+type mmapRegistry struct {
+	mtx   sync.Mutex
+	paths map[string]*mmapPath
+}
+
+func (r *mmapRegistry) acquire(path string) *mmapPath {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.paths == nil {
+		r.paths = make(map[string]*mmapPath)
+	}
+	entry, ok := r.paths[path]
+	if !ok {
+		entry = &mmapPath{files: make(map[*mmapFile]struct{})}
+		r.paths[path] = entry
+	}
+	entry.refs++
+	return entry
+}
+
+// remove removes the mapped file from the path, with the
+// lock held by the caller.
+func (r *mmapRegistry) remove(path string, file *mmapFile) {
+	if entry, ok := r.paths[path]; ok {
+		delete(entry.files, file)
+		if entry.refs == 0 && len(entry.files) == 0 {
+			delete(r.paths, path)
+		}
+	}
+}
+
+func (r *mmapRegistry) release(path string, entry *mmapPath) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	entry.refs--
+	if entry.refs == 0 && len(entry.files) == 0 {
+		delete(r.paths, path)
+	}
+}
+
+// exclusive executes the function, which might truncate the
+// file, with all views of the file unmapped.
+func (fs *fileSystem) exclusive(path string, f func() error) error {
+	if fs.mmapChunk <= 0 {
+		return f()
+	}
+	entry := fs.mmaps.acquire(path)
+	defer fs.mmaps.release(path, entry)
+	entry.guard.Lock()
+	defer entry.guard.Unlock()
+	fs.mmaps.mtx.Lock()
+	files := make([]*mmapFile, 0, len(entry.files))
+	for file := range entry.files {
+		files = append(files, file)
+	}
+	fs.mmaps.mtx.Unlock()
+	for _, file := range files {
+		file.unmap()
+	}
+	return f()
+}
+
+// readMapped attempts to read the file through the mapped
+// views, returning the number of bytes read from them.
+func (fs *fileSystem) readMapped(
+	handle *fileHandle, b []byte, offset int64,
+) (int, error) {
+	file, ok := handle.file.(*os.File)
+	if !ok || handle.flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return 0, nil
+	}
+	path := handle.lock.FilePath()
+	entry := fs.mmaps.acquire(path)
+	defer fs.mmaps.release(path, entry)
+	fs.mmaps.mtx.Lock()
+	if handle.mmap == nil || handle.mmap.file != file {
+		handle.mmap = &mmapFile{file: file}
+		handle.mmapPath = path
+		entry.files[handle.mmap] = struct{}{}
+	} else if handle.mmapPath != path {
+		// The handle has been renamed since it is mapped, and
+		// its views must be unmapped by the exclusive access to
+		// the new path instead of the old one.
+		fs.mmaps.remove(handle.mmapPath, handle.mmap)
+		handle.mmapPath = path
+		entry.files[handle.mmap] = struct{}{}
+	}
+	mapped := handle.mmap
+	fs.mmaps.mtx.Unlock()
+	entry.guard.RLock()
+	defer entry.guard.RUnlock()
+	return mapped.readAt(b, offset, fs.mmapChunk)
+}
+
+// unmapHandle unmaps the file of the handle, which must be
+// called before the file of handle is closed, with the handle
+// locked exclusively.
+func (fs *fileSystem) unmapHandle(handle *fileHandle) {
+	if handle.mmap == nil {
+		return
+	}
+	handle.mmap.unmap()
+	fs.mmaps.mtx.Lock()
+	fs.mmaps.remove(handle.mmapPath, handle.mmap)
+	fs.mmaps.mtx.Unlock()
+	handle.mmap = nil
+}
@@ -0,0 +1,148 @@
+package gofs_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// osFS is the passthrough gofs.FileSystem over a directory,
+// whose files are real *os.File.
+type osFS string
+
+func (fs osFS) path(name string) string {
+	return filepath.Join(string(fs), name)
+}
+
+func (fs osFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := os.OpenFile(fs.path(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs osFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(fs.path(name), perm)
+}
+
+func (fs osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(fs.path(name))
+}
+
+func (fs osFS) Rename(source, target string) error {
+	return os.Rename(fs.path(source), fs.path(target))
+}
+
+func (fs osFS) Remove(name string) error {
+	return os.Remove(fs.path(name))
+}
+
+func TestMmapRead(t *testing.T) {
+	assert := assert.New(t)
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(osFS(t.TempDir()),
+		gofs.MmapRead(64*1024)), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+
+	// Spread the content across several chunks so that views
+	// are mapped, reused and evicted while reading.
+	name := filepath.Join(mountpoint+`\`, "mapped")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	assert.NoError(os.WriteFile(name, data, 0644))
+	content, err := os.ReadFile(name)
+	assert.NoError(err)
+	assert.Equal(data, content)
+
+	// Truncation must succeed while the file is still mapped
+	// by another open handle.
+	f, err := os.Open(name)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	buf := make([]byte, 4096)
+	_, err = f.ReadAt(buf, 200*1024)
+	assert.NoError(err)
+	assert.Equal(data[200*1024:204*1024], buf)
+	assert.NoError(os.Truncate(name, 1024))
+	n, err := f.ReadAt(buf, 0)
+	assert.Equal(io.EOF, err)
+	assert.Equal(data[:1024], buf[:n])
+
+	// The data appended beyond the mapping is still visible.
+	extra := append(data[:1024:1024], []byte("appended")...)
+	assert.NoError(os.WriteFile(name, extra, 0644))
+	content, err = io.ReadAll(io.NewSectionReader(f, 0, 1<<20))
+	assert.NoError(err)
+	assert.Equal(extra, content)
+}
+
+func TestMmapRename(t *testing.T) {
+	assert := assert.New(t)
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(osFS(t.TempDir()),
+		gofs.MmapRead(64*1024)), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	name := filepath.Join(mountpoint+`\`, "mapped")
+	renamed := filepath.Join(mountpoint+`\`, "renamed")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	assert.NoError(os.WriteFile(name, data, 0644))
+
+	// The file is mapped and renamed through the same handle.
+	utf16Name, err := windows.UTF16PtrFromString(name)
+	if !assert.NoError(err) {
+		return
+	}
+	handle, err := windows.CreateFile(utf16Name,
+		windows.GENERIC_READ|windows.DELETE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|
+			windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	f := os.NewFile(uintptr(handle), name)
+	defer func() { _ = f.Close() }()
+	buf := make([]byte, 4096)
+	_, err = f.ReadAt(buf, 200*1024)
+	assert.NoError(err)
+	var info fileRenameInfo
+	target := windows.StringToUTF16("renamed")
+	info.FileNameLength = uint32(2 * (len(target) - 1))
+	copy(info.FileName[:], target)
+	assert.NoError(windows.SetFileInformationByHandle(
+		handle, windows.FileRenameInfo,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))))
+	_, err = f.ReadAt(buf, 200*1024)
+	assert.NoError(err)
+	assert.Equal(data[200*1024:204*1024], buf)
+
+	// The views are found under the new path and unmapped
+	// before the renamed file is truncated.
+	assert.NoError(os.Truncate(renamed, 1024))
+	n, err := f.ReadAt(buf, 0)
+	assert.Equal(io.EOF, err)
+	assert.Equal(data[:1024], buf[:n])
+}
@@ -16,4 +16,22 @@
 // This makes it works even if the underlying file system
 // is backed by a Window's native directory through the
 // language interfaces by Golang.
+//
+// The file info returned by Stat and Readdir might implement
+// BirthtimeFileInfo to report the creation time of files, and
+// OwnerFileInfo to report the POSIX ownership of files. The
+// windows attributes of files, e.g. hidden, are persisted if
+// the file system implements FileSystemAttributes, and are
+// reported back by AttributesFileInfo. Otherwise, the read-only
+// attribute is mapped onto the permissions if it implements
+// FileSystemChmod. The reparse tags of the files, e.g. symbolic
+// links, are reported by the file info implementing
+// ReparseFileInfo. The symbolic links are surfaced to windows
+// as reparse points if it implements FileSystemSymlink. The
+// access and modification times set by windows, e.g. while
+// copying files, are applied if it implements
+// FileSystemChtimes. The security descriptors of files are
+// loaded from the file system if it implements
+// FileSystemSecurity, and persisted if it implements
+// FileSystemSetSecurity.
 package gofs
@@ -0,0 +1,84 @@
+package gofs
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+)
+
+// FileSystemSecurity is the optional interface of the file
+// system which stores the security descriptors of files, e.g.
+// serialized into extended attributes or a sidecar database.
+//
+// The GetSecurity returns nil descriptor when there's none
+// stored for the file, and the descriptor derived from the
+// status of the file is used then.
+type FileSystemSecurity interface {
+	FileSystem
+	GetSecurity(name string) (*windows.SECURITY_DESCRIPTOR, error)
+}
+
+// FileSystemSetSecurity is the optional interface of the file
+// system which persists the security descriptors of files, so
+// that the ACL modified by windows applications are retained.
+//
+// The descriptors passed to SetSecurity are self-relative, which
+// must be copied or serialized since they are not guaranteed to
+// be valid after the call returns. The file system is also in
+// charge of moving and removing the stored descriptors when the
+// files are renamed or removed.
+type FileSystemSetSecurity interface {
+	FileSystemSecurity
+	SetSecurity(name string, sd *windows.SECURITY_DESCRIPTOR) error
+}
+
+// security retrieves the security descriptor of the file,
+// which is either stored by the file system or derived from
+// the status of the file.
+func (fs *fileSystem) security(
+	name string, info os.FileInfo,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	if fs.getSecurity != nil {
+		sd, err := fs.getSecurity.GetSecurity(name)
+		if err != nil || sd != nil {
+			return sd, err
+		}
+	}
+	return securityFromStat(info)
+}
+
+func (fs *fileSystem) SetSecurity(
+	ref *winfsp.FileSystemRef, file uintptr,
+	info windows.SECURITY_INFORMATION,
+	desc *windows.SECURITY_DESCRIPTOR,
+) error {
+	if fs.setSecurity == nil {
+		return windows.STATUS_INVALID_DEVICE_REQUEST
+	}
+	handle, err := fs.load(file)
+	if err != nil {
+		return err
+	}
+	if err := handle.lockChecked(); err != nil {
+		return err
+	}
+	defer handle.unlockChecked()
+	fileInfo, err := handle.file.Stat()
+	if err != nil {
+		return err
+	}
+	name := handle.lock.FilePath()
+	sd, err := fs.security(name, fileInfo)
+	if err != nil {
+		return err
+	}
+	if sd, err = winfsp.ModifySecurityDescriptor(
+		sd, info, desc); err != nil {
+		return err
+	}
+	return fs.setSecurity.SetSecurity(name, sd)
+}
+
+var _ winfsp.BehaviourSetSecurity = (*fileSystem)(nil)
@@ -0,0 +1,280 @@
+package gofs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/reparse"
+)
+
+// FileSystemSymlink is the optional interface of the file
+// system supporting symbolic links, which are surfaced to
+// windows as the reparse points of IO_REPARSE_TAG_SYMLINK.
+//
+// The Lstat must not follow the link in the last component,
+// so that the links are reported as reparse points instead
+// of the files they point to.
+type FileSystemSymlink interface {
+	FileSystem
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Lstat(name string) (os.FileInfo, error)
+}
+
+// symlinkTempSuffix is appended to the name of the file to
+// create the symbolic link replacing it.
+const symlinkTempSuffix = ".winfsp-symlink~"
+
+// linkFile is the file opened on the symbolic link itself,
+// i.e. with FILE_OPEN_REPARSE_POINT, e.g. for removing the
+// link, which serves nothing but the status of the link.
+type linkFile struct {
+	fs   FileSystemSymlink
+	name string
+}
+
+func (f *linkFile) Read([]byte) (int, error) {
+	return 0, windows.STATUS_INVALID_DEVICE_REQUEST
+}
+
+func (f *linkFile) Write([]byte) (int, error) {
+	return 0, windows.STATUS_INVALID_DEVICE_REQUEST
+}
+
+func (f *linkFile) ReadAt([]byte, int64) (int, error) {
+	return 0, windows.STATUS_INVALID_DEVICE_REQUEST
+}
+
+func (f *linkFile) WriteAt([]byte, int64) (int, error) {
+	return 0, windows.STATUS_INVALID_DEVICE_REQUEST
+}
+
+func (f *linkFile) Seek(int64, int) (int64, error) {
+	return 0, nil
+}
+
+func (f *linkFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, windows.STATUS_NOT_A_DIRECTORY
+}
+
+func (f *linkFile) Truncate(int64) error {
+	return windows.STATUS_INVALID_DEVICE_REQUEST
+}
+
+func (f *linkFile) Stat() (os.FileInfo, error) { return f.fs.Lstat(f.name) }
+func (f *linkFile) Sync() error                { return nil }
+func (f *linkFile) Close() error               { return nil }
+
+// openLink opens the symbolic link itself when the caller
+// asks for the reparse point, returning nil if the file is
+// not a symbolic link, which is opened as usual then.
+func (fs *fileSystem) openLink(
+	name string, createOptions uint32, flags int,
+) (File, error) {
+	if fs.links == nil ||
+		createOptions&windows.FILE_OPEN_REPARSE_POINT == 0 {
+		return nil, nil
+	}
+	info, err := fs.links.Lstat(name)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil, nil
+	}
+	if flags&os.O_EXCL != 0 {
+		return nil, windows.STATUS_OBJECT_NAME_COLLISION
+	}
+	if flags&os.O_TRUNC != 0 {
+		return nil, windows.STATUS_ACCESS_DENIED
+	}
+	return &linkFile{fs: fs.links, name: name}, nil
+}
+
+// symlinkTarget converts the windows symbolic link into the
+// target of the link in the file system.
+func symlinkTarget(link *reparse.Symlink) string {
+	if link.Relative {
+		return strings.ReplaceAll(link.Target, `\`, "/")
+	}
+	if link.PrintName != "" {
+		return link.PrintName
+	}
+	target := strings.TrimPrefix(link.Target, `\??\`)
+	if strings.HasPrefix(target, `UNC\`) {
+		target = `\` + target[3:]
+	}
+	return target
+}
+
+// symlinkPoint converts the target of the link in the file
+// system into the windows symbolic link.
+func symlinkPoint(target string) *reparse.Symlink {
+	printName := strings.ReplaceAll(target, "/", `\`)
+	switch {
+	case strings.HasPrefix(printName, `\\`):
+		return &reparse.Symlink{
+			Target:    `\??\UNC\` + printName[2:],
+			PrintName: printName,
+		}
+	case filepath.IsAbs(printName):
+		return &reparse.Symlink{
+			Target:    `\??\` + printName,
+			PrintName: printName,
+		}
+	}
+	return &reparse.Symlink{
+		Target:    printName,
+		PrintName: printName,
+		Relative:  true,
+	}
+}
+
+// symlinkFileSystem is the file system whose backend supports
+// symbolic links, which implements the reparse behaviours.
+type symlinkFileSystem struct {
+	*fileSystem
+}
+
+func (fs *symlinkFileSystem) GetReparsePointByName(
+	ref *winfsp.FileSystemRef, name string, isDirectory bool,
+) ([]byte, error) {
+	info, err := fs.links.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return nil, windows.STATUS_NOT_A_REPARSE_POINT
+	}
+	target, err := fs.links.Readlink(name)
+	if err != nil {
+		return nil, err
+	}
+	return reparse.Encode(symlinkPoint(target))
+}
+
+var _ winfsp.BehaviourGetReparsePointByName = (*symlinkFileSystem)(nil)
+
+func (fs *symlinkFileSystem) GetReparsePoint(
+	ref *winfsp.FileSystemRef, file uintptr, name string,
+) ([]byte, error) {
+	handle, err := fs.load(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := handle.lockChecked(); err != nil {
+		return nil, err
+	}
+	defer handle.unlockChecked()
+	if !handle.isLink {
+		return nil, windows.STATUS_NOT_A_REPARSE_POINT
+	}
+	return fs.GetReparsePointByName(ref, handle.lock.FilePath(), false)
+}
+
+var _ winfsp.BehaviourGetReparsePoint = (*symlinkFileSystem)(nil)
+
+// SetReparsePoint replaces the file by the symbolic link,
+// which is how the symbolic links are created by windows,
+// i.e. creating an empty file or directory first and then
+// setting the reparse point on it.
+func (fs *symlinkFileSystem) SetReparsePoint(
+	ref *winfsp.FileSystemRef, file uintptr, name string,
+	data []byte,
+) error {
+	point, err := reparse.Decode(data)
+	if err != nil {
+		return windows.STATUS_IO_REPARSE_DATA_INVALID
+	}
+	link, ok := point.(*reparse.Symlink)
+	if !ok {
+		return windows.STATUS_IO_REPARSE_TAG_NOT_HANDLED
+	}
+	handle, err := fs.load(file)
+	if err != nil {
+		return err
+	}
+	handle.mtx.Lock()
+	defer handle.mtx.Unlock()
+	if handle.file == nil {
+		return windows.STATUS_INVALID_HANDLE
+	}
+
+	// Only the empty files might be replaced, just like what
+	// the NTFS requires for the directories.
+	path := handle.lock.FilePath()
+	var restore func() error
+	if handle.isLink {
+		target, err := fs.links.Readlink(path)
+		if err != nil {
+			return err
+		}
+		restore = func() error {
+			return fs.links.Symlink(target, path)
+		}
+	} else {
+		fileInfo, err := handle.file.Stat()
+		if err != nil {
+			return err
+		}
+		perm := fileInfo.Mode().Perm()
+		if fileInfo.IsDir() {
+			f, err := handle.reopenFile(fs.fileSystem)
+			if err != nil {
+				return err
+			}
+			fileInfos, err := f.Readdir(-1)
+			_ = f.Close()
+			if err != nil {
+				return err
+			}
+			if len(fileInfos) > 0 {
+				return windows.STATUS_DIRECTORY_NOT_EMPTY
+			}
+			restore = func() error {
+				return fs.inner.Mkdir(path, perm)
+			}
+		} else if fileInfo.Size() > 0 {
+			return windows.STATUS_IO_REPARSE_DATA_INVALID
+		} else {
+			restore = func() error {
+				f, err := fs.inner.OpenFile(path,
+					os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+				if err != nil {
+					return err
+				}
+				return f.Close()
+			}
+		}
+	}
+
+	// The link is created aside and renamed over the file, so
+	// that the file is kept when the link can't be created,
+	// and restored when the link can't be renamed.
+	temp := path + symlinkTempSuffix
+	if err := fs.links.Symlink(symlinkTarget(link), temp); err != nil {
+		return err
+	}
+	fs.unmapHandle(handle)
+	_ = handle.file.Close()
+	handle.file = nil
+	defer func() {
+		if f, err := handle.reopenFile(fs.fileSystem); err == nil {
+			handle.file = f
+		}
+	}()
+	if err := fs.inner.Remove(path); err != nil {
+		_ = fs.inner.Remove(temp)
+		return err
+	}
+	if err := fs.inner.Rename(temp, path); err != nil {
+		_ = fs.inner.Remove(temp)
+		_ = restore()
+		return err
+	}
+	handle.isLink = true
+	return nil
+}
+
+var _ winfsp.BehaviourSetReparsePoint = (*symlinkFileSystem)(nil)
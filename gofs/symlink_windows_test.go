@@ -0,0 +1,142 @@
+package gofs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/gofs"
+	"github.com/aegistudio/go-winfsp/reparse"
+)
+
+// linkFS is the osFS supporting symbolic links.
+type linkFS struct {
+	osFS
+}
+
+func (fs linkFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, fs.path(newname))
+}
+
+func (fs linkFS) Readlink(name string) (string, error) {
+	return os.Readlink(fs.path(name))
+}
+
+func (fs linkFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(fs.path(name))
+}
+
+var _ gofs.FileSystemSymlink = linkFS{}
+
+func TestSymlink(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	if err := os.Symlink("probe", filepath.Join(dir, "probe")); err != nil {
+		t.Skipf("symlink unavailable: %v", err)
+	}
+	assert.NoError(os.Remove(filepath.Join(dir, "probe")))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644))
+	assert.NoError(os.Mkdir(filepath.Join(dir, "dir"), 0755))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "dir", "inner"), []byte("inner"), 0644))
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(linkFS{osFS(dir)}), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	root := mountpoint + `\`
+
+	// The links created through the mount are links of the
+	// backend, which are resolved by windows.
+	assert.NoError(os.Symlink("file", filepath.Join(root, "file-link")))
+	target, err := os.Readlink(filepath.Join(dir, "file-link"))
+	assert.NoError(err)
+	assert.Equal("file", target)
+	content, err := os.ReadFile(filepath.Join(root, "file-link"))
+	assert.NoError(err)
+	assert.Equal("content", string(content))
+
+	assert.NoError(os.Symlink("dir", filepath.Join(root, "dir-link")))
+	target, err = os.Readlink(filepath.Join(root, "dir-link"))
+	assert.NoError(err)
+	assert.Equal("dir", target)
+	content, err = os.ReadFile(filepath.Join(root, "dir-link", "inner"))
+	assert.NoError(err)
+	assert.Equal("inner", string(content))
+
+	// Removing the links must not remove their targets.
+	info, err := os.Lstat(filepath.Join(root, "file-link"))
+	if assert.NoError(err) {
+		assert.NotZero(info.Mode() & os.ModeSymlink)
+	}
+	assert.NoError(os.Remove(filepath.Join(root, "file-link")))
+	assert.NoError(os.Remove(filepath.Join(root, "dir-link")))
+	_, err = os.Lstat(filepath.Join(dir, "file-link"))
+	assert.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "file"))
+	assert.NoError(err)
+	_, err = os.Stat(filepath.Join(dir, "dir", "inner"))
+	assert.NoError(err)
+}
+
+// failingLinkFS is the linkFS which fails creating links,
+// e.g. lacking the privilege of creating symbolic links.
+type failingLinkFS struct {
+	linkFS
+}
+
+func (fs failingLinkFS) Symlink(oldname, newname string) error {
+	return os.ErrPermission
+}
+
+func TestSymlinkFailure(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "empty"), nil, 0644))
+	mountMtx.Lock()
+	mountpoint := freeDriveLetter(t)
+	mounted, err := winfsp.Mount(gofs.New(
+		failingLinkFS{linkFS{osFS(dir)}}), mountpoint)
+	mountMtx.Unlock()
+	if err != nil {
+		t.Skipf("winfsp mount unavailable: %v", err)
+	}
+	defer mounted.Unmount()
+	name, err := windows.UTF16PtrFromString(
+		filepath.Join(mountpoint+`\`, "empty"))
+	assert.NoError(err)
+	handle, err := windows.CreateFile(name,
+		windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_OPEN_REPARSE_POINT|
+			windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = windows.CloseHandle(handle) }()
+	data, err := reparse.Encode(&reparse.Symlink{
+		Target: "target", PrintName: "target", Relative: true,
+	})
+	assert.NoError(err)
+
+	// The file is kept when the link can't be created, and
+	// the handle remains usable.
+	var returned uint32
+	assert.Error(windows.DeviceIoControl(handle,
+		windows.FSCTL_SET_REPARSE_POINT, &data[0], uint32(len(data)),
+		nil, 0, &returned, nil))
+	info, err := os.Lstat(filepath.Join(dir, "empty"))
+	if assert.NoError(err) {
+		assert.Zero(info.Mode() & os.ModeSymlink)
+	}
+	var fileInfo windows.ByHandleFileInformation
+	assert.NoError(windows.GetFileInformationByHandle(handle, &fileInfo))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(entries, 1)
+}
@@ -0,0 +1,76 @@
+package gofs
+
+// FileSystemWrapper is the optional interface of the file
+// systems wrapping another one, e.g. GrowByWriting, which
+// forward the optional interfaces to the wrapped one.
+//
+// Since the wrapper must implement the optional interfaces
+// to forward them, an optional interface of the wrapper is
+// only used when the wrapped file system also implements it.
+type FileSystemWrapper interface {
+	FileSystem
+	Unwrap() FileSystem
+}
+
+// supports reports whether the file system and the ones it
+// wraps all match, i.e. implement the optional interface.
+func supports(fs FileSystem, match func(FileSystem) bool) bool {
+	for {
+		if !match(fs) {
+			return false
+		}
+		wrapper, ok := fs.(FileSystemWrapper)
+		if !ok {
+			return true
+		}
+		fs = wrapper.Unwrap()
+	}
+}
+
+// resolveOptional resolves the optional interfaces supported
+// by the inner file system.
+func (fs *fileSystem) resolveOptional() {
+	inner := fs.inner
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemAttributes)
+		return ok
+	}) {
+		fs.attributes = inner.(FileSystemAttributes)
+	}
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemChmod)
+		return ok
+	}) {
+		fs.chmod = inner.(FileSystemChmod)
+	}
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemChtimes)
+		return ok
+	}) {
+		fs.chtimes = inner.(FileSystemChtimes)
+	}
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemSync)
+		return ok
+	}) {
+		fs.sync = inner.(FileSystemSync)
+	}
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemSecurity)
+		return ok
+	}) {
+		fs.getSecurity = inner.(FileSystemSecurity)
+	}
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemSetSecurity)
+		return ok
+	}) {
+		fs.setSecurity = inner.(FileSystemSetSecurity)
+	}
+	if supports(inner, func(f FileSystem) bool {
+		_, ok := f.(FileSystemSymlink)
+		return ok
+	}) {
+		fs.links = inner.(FileSystemSymlink)
+	}
+}
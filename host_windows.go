@@ -1,40 +1,48 @@
 package winfsp
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
-	"reflect"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/clock"
+	"github.com/aegistudio/go-winfsp/wtf8"
 )
 
-// FileSystemRef is the reference for the file system,
-// with which the callers can operate and manipulate the
-// file system, except for destroying it.
-type FileSystemRef struct {
-	fileSystemOps     *FSP_FILE_SYSTEM_INTERFACE
-	fileSystem        *FSP_FILE_SYSTEM
+// behaviours is the behaviours that the file system is
+// served with, which are interpreted from the BehaviourBase.
+type behaviours struct {
 	base              BehaviourBase
 	getVolumeInfo     BehaviourGetVolumeInfo
 	setVolumeLabel    BehaviourSetVolumeLabel
 	getSecurityByName BehaviourGetSecurityByName
 	create            BehaviourCreate
 	overwrite         BehaviourOverwrite
+	overwriteEx       BehaviourOverwriteEx
 	cleanup           BehaviourCleanup
 	read              BehaviourRead
 	write             BehaviourWrite
 	flush             BehaviourFlush
+	flushVolume       BehaviourFlushVolume
 	getFileInfo       BehaviourGetFileInfo
 	setBasicInfo      BehaviourSetBasicInfo
 	setFileSize       BehaviourSetFileSize
 	canDelete         BehaviourCanDelete
+	setDelete         BehaviourSetDelete
 	rename            BehaviourRename
 	getSecurity       BehaviourGetSecurity
 	setSecurity       BehaviourSetSecurity
@@ -42,21 +50,166 @@ type FileSystemRef struct {
 	getDirInfoByName  BehaviourGetDirInfoByName
 	deviceIoControl   BehaviourDeviceIoControl
 	createEx          BehaviourCreateEx
+	getStreamInfo     BehaviourGetStreamInfo
+	getEa             BehaviourGetEa
+	setEa             BehaviourSetEa
+	dispatcherStopped BehaviourDispatcherStopped
+
+	openRaw              BehaviourOpenRaw
+	getSecurityByNameRaw BehaviourGetSecurityByNameRaw
+
+	getReparsePointByName BehaviourGetReparsePointByName
+	getReparsePoint       BehaviourGetReparsePoint
+	setReparsePoint       BehaviourSetReparsePoint
+	deleteReparsePoint    BehaviourDeleteReparsePoint
+}
+
+// FileSystemRef is the reference for the file system,
+// with which the callers can operate and manipulate the
+// file system, except for destroying it.
+type FileSystemRef struct {
+	fileSystemOps *FSP_FILE_SYSTEM_INTERFACE
+	fileSystem    *FSP_FILE_SYSTEM
+	current       atomic.Value // *behaviourSet
+	swapMutex     sync.Mutex
+	asyncHolds    sync.Map
+
+	minimalSecurity *minimalSecurity
+
+	serializePerFile bool
+	fileLocks        sync.Map
+	processAccess    ProcessAccessPolicy
+	securitySource   SecuritySource
+	errorMappers     []ErrorMapperFunc
+	inspector        ContentInspector
+	trackNames       bool
+	fileNames        sync.Map
+	openFiles        sync.Map
+	instrumented     bool
+	slowThreshold    time.Duration
+	slowHandler      OperationHandler
+	operationLogger  OperationHandler
+	stats            *StatsCollector
+	recoverPanic     bool
+	panicHandler     PanicHandler
+	recentOps        *operationRing
+	bundleDir        string
+	mountSummary     string
+	limiter          *concurrencyLimiter
+	deadlines        *deadlineEnforcer
+	trace            *operationRing
+	clock            clock.Clock
+	fullContext      bool
+	posixRename      bool
+	opening          openingContexts
+	ctx              context.Context
+	cancel           context.CancelFunc
+	mountPointMutex  sync.Mutex
+	mountPoint       string
+	handle           uintptr
+	volumeMutex      sync.RWMutex
+	volumeName       string
+	volumeHandle     windows.Handle
+	dispatcherResult windows.NTStatus
+	destroyed        bool
+}
+
+// now returns the current time of the file system's clock.
+func (ref *FileSystemRef) now() time.Time {
+	if ref == nil {
+		return time.Now()
+	}
+	return clock.Now(ref.clock)
 }
 
 // ntStatusNoRef is returned when user context to inner
 // map is not present.
 const ntStatusNoRef = windows.STATUS_DEVICE_OFF_LINE
 
-var refMap sync.Map
-
 func loadFileSystemRef(fileSystem uintptr) *FileSystemRef {
 	fsp := (*FSP_FILE_SYSTEM)(unsafe.Pointer(fileSystem))
-	value, ok := refMap.Load(fsp.UserContext)
+	return refMap.load(fsp.UserContext)
+}
+
+// lockFile serializes the operations targeting the same
+// file context, when the file system is mounted with the
+// SerializePerFile option. The returned function must be
+// called to release the file context.
+func (ref *FileSystemRef) lockFile(file uintptr) func() {
+	if !ref.serializePerFile || file == 0 {
+		return func() {}
+	}
+	value, ok := ref.fileLocks.Load(file)
 	if !ok {
-		return nil
+		value, _ = ref.fileLocks.LoadOrStore(file, &sync.Mutex{})
+	}
+	mtx := value.(*sync.Mutex)
+	mtx.Lock()
+	return mtx.Unlock
+}
+
+// releaseFile removes the serialization lock of a file
+// context, which must be called after it has been closed.
+func (ref *FileSystemRef) releaseFile(file uintptr) {
+	if ref.serializePerFile {
+		ref.fileLocks.Delete(file)
+	}
+}
+
+// trackFileName records the name of the open file context,
+// when there's any feature requiring it.
+func (ref *FileSystemRef) trackFileName(file uintptr, name string) {
+	if ref.trackNames {
+		ref.fileNames.Store(file, name)
+	}
+}
+
+// untrackFileName removes the name of the closed file.
+func (ref *FileSystemRef) untrackFileName(file uintptr) {
+	if ref.trackNames {
+		ref.fileNames.Delete(file)
 	}
-	return value.(*FileSystemRef)
+}
+
+// fileName retrieves the name of the open file context,
+// which is the name it is opened or lastly renamed to.
+func (ref *FileSystemRef) fileName(file uintptr) string {
+	if value, ok := ref.fileNames.Load(file); ok {
+		return value.(string)
+	}
+	return ""
+}
+
+// OpenFile is the file context currently opened.
+type OpenFile struct {
+	// Context is the file context returned by the behaviour.
+	Context uintptr
+
+	// Name is the name the file is opened or lastly renamed
+	// to, which is only tracked when there's any option
+	// requiring it, e.g. Statistics, and empty otherwise.
+	Name string
+}
+
+// OpenFiles returns the file contexts currently opened,
+// ordered by their names.
+func (ref *FileSystemRef) OpenFiles() []OpenFile {
+	var result []OpenFile
+	ref.openFiles.Range(func(key, _ interface{}) bool {
+		file := key.(uintptr)
+		result = append(result, OpenFile{
+			Context: file,
+			Name:    ref.fileName(file),
+		})
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Context < result[j].Context
+	})
+	return result
 }
 
 var syscallNTStatusMap = map[syscall.Errno]windows.NTStatus{
@@ -69,6 +222,39 @@ var syscallNTStatusMap = map[syscall.Errno]windows.NTStatus{
 	syscall.ENOTDIR: windows.STATUS_NOT_A_DIRECTORY,
 	syscall.EISDIR:  windows.STATUS_FILE_IS_A_DIRECTORY,
 	syscall.EINVAL:  windows.STATUS_INVALID_PARAMETER,
+	syscall.EACCES:  windows.STATUS_ACCESS_DENIED,
+
+	syscall.ENOSPC:       windows.STATUS_DISK_FULL,
+	syscall.EDQUOT:       windows.STATUS_QUOTA_EXCEEDED,
+	syscall.EFBIG:        windows.STATUS_FILE_TOO_LARGE,
+	syscall.EROFS:        windows.STATUS_MEDIA_WRITE_PROTECTED,
+	syscall.ENAMETOOLONG: windows.STATUS_NAME_TOO_LONG,
+	syscall.ENOTEMPTY:    windows.STATUS_DIRECTORY_NOT_EMPTY,
+	syscall.EXDEV:        windows.STATUS_NOT_SAME_DEVICE,
+	syscall.EMLINK:       windows.STATUS_TOO_MANY_LINKS,
+	syscall.ELOOP:        windows.STATUS_REPARSE_POINT_NOT_RESOLVED,
+	syscall.EBUSY:        windows.STATUS_DEVICE_BUSY,
+	syscall.ETXTBSY:      windows.STATUS_SHARING_VIOLATION,
+	syscall.EMFILE:       windows.STATUS_TOO_MANY_OPENED_FILES,
+	syscall.ENFILE:       windows.STATUS_TOO_MANY_OPENED_FILES,
+	syscall.EBADF:        windows.STATUS_INVALID_HANDLE,
+	syscall.ESTALE:       windows.STATUS_FILE_INVALID,
+	syscall.EIO:          windows.STATUS_IO_DEVICE_ERROR,
+	syscall.ENXIO:        windows.STATUS_NO_SUCH_DEVICE,
+	syscall.ENODEV:       windows.STATUS_NO_SUCH_DEVICE,
+	syscall.ENOMEM:       windows.STATUS_NO_MEMORY,
+	syscall.ENOSYS:       windows.STATUS_NOT_IMPLEMENTED,
+	syscall.ENOTSUP:      windows.STATUS_NOT_SUPPORTED,
+	syscall.EOPNOTSUPP:   windows.STATUS_NOT_SUPPORTED,
+	syscall.ETIMEDOUT:    windows.STATUS_IO_TIMEOUT,
+	syscall.EINTR:        windows.STATUS_CANCELLED,
+	syscall.ECANCELED:    windows.STATUS_CANCELLED,
+	syscall.EAGAIN:       windows.STATUS_RETRY,
+	syscall.ENOTCONN:     windows.STATUS_CONNECTION_DISCONNECTED,
+	syscall.ECONNRESET:   windows.STATUS_CONNECTION_RESET,
+	syscall.ECONNREFUSED: windows.STATUS_CONNECTION_REFUSED,
+	syscall.EHOSTUNREACH: windows.STATUS_HOST_UNREACHABLE,
+	syscall.ENETUNREACH:  windows.STATUS_NETWORK_UNREACHABLE,
 
 	// System errors conversion map.
 	syscall.ERROR_ACCESS_DENIED: windows.STATUS_ACCESS_DENIED,
@@ -79,6 +265,13 @@ var syscallNTStatusMap = map[syscall.Errno]windows.NTStatus{
 	syscall.ERROR_ALREADY_EXISTS:  windows.STATUS_OBJECT_NAME_COLLISION,
 	syscall.ERROR_BUFFER_OVERFLOW: windows.STATUS_BUFFER_OVERFLOW,
 	syscall.ERROR_DIR_NOT_EMPTY:   windows.STATUS_DIRECTORY_NOT_EMPTY,
+
+	windows.ERROR_DISK_FULL:            windows.STATUS_DISK_FULL,
+	windows.ERROR_HANDLE_DISK_FULL:     windows.STATUS_DISK_FULL,
+	windows.ERROR_WRITE_PROTECT:        windows.STATUS_MEDIA_WRITE_PROTECTED,
+	windows.ERROR_SHARING_VIOLATION:    windows.STATUS_SHARING_VIOLATION,
+	windows.ERROR_FILENAME_EXCED_RANGE: windows.STATUS_NAME_TOO_LONG,
+	windows.ERROR_NOT_SAME_DEVICE:      windows.STATUS_NOT_SAME_DEVICE,
 }
 
 func convertNTStatus(err error) windows.NTStatus {
@@ -89,11 +282,17 @@ func convertNTStatus(err error) windows.NTStatus {
 	if errors.As(err, &status) {
 		return status
 	}
+	if status, ok := mapRegisteredError(err); ok {
+		return status
+	}
 	var errno syscall.Errno
 	if errors.As(err, &errno) {
 		if status, ok := syscallNTStatusMap[errno]; ok {
 			return status
 		}
+		if status, ok := convertWin32(errno); ok {
+			return status
+		}
 	}
 	if errors.Is(err, io.EOF) {
 		return windows.STATUS_END_OF_FILE
@@ -110,18 +309,47 @@ func convertNTStatus(err error) windows.NTStatus {
 	return windows.STATUS_INTERNAL_ERROR
 }
 
+// utf16PtrToString converts the NUL terminated name into
+// string, in which the unpaired surrogates are preserved.
 func utf16PtrToString(ptr uintptr) string {
-	utf16Ptr := (*uint16)(unsafe.Pointer(ptr))
-	return windows.UTF16PtrToString(utf16Ptr)
+	if ptr == 0 {
+		return ""
+	}
+	n := 0
+	for *(*uint16)(unsafe.Pointer(ptr + uintptr(n)*SIZEOF_WCHAR)) != 0 {
+		n++
+	}
+	return wtf8.Decode(unsafe.Slice((*uint16)(unsafe.Pointer(ptr)), n))
+}
+
+// cloneUTF16Ptr copies the NUL terminated UTF-16 string, so
+// that it outlives the request it is passed with.
+func cloneUTF16Ptr(ptr *uint16) *uint16 {
+	if ptr == nil {
+		return nil
+	}
+	n := 0
+	for *(*uint16)(unsafe.Add(unsafe.Pointer(ptr), n*SIZEOF_WCHAR)) != 0 {
+		n++
+	}
+	result := append([]uint16(nil), unsafe.Slice(ptr, n+1)...)
+	return &result[0]
+}
+
+// utf16FromName converts the name back into UTF-16 without
+// the terminating NUL, restoring the unpaired surrogates.
+func utf16FromName(name string) ([]uint16, error) {
+	if strings.IndexByte(name, 0) >= 0 {
+		return nil, windows.STATUS_OBJECT_NAME_INVALID
+	}
+	return wtf8.Encode(name), nil
 }
 
 func enforceBytePtr(ptr uintptr, size int) []byte {
-	slice := &reflect.SliceHeader{
-		Data: ptr,
-		Len:  size,
-		Cap:  size,
+	if ptr == 0 {
+		return nil
 	}
-	return *(*[]byte)(unsafe.Pointer(slice))
+	return unsafe.Slice((*byte)(unsafe.Pointer(ptr)), size)
 }
 
 // FileSystem is the created object of WinFSP's filesystem.
@@ -132,6 +360,13 @@ func enforceBytePtr(ptr uintptr, size int) []byte {
 // when there's no reference to it.
 type FileSystem struct {
 	FileSystemRef
+	shellDrive       string
+	fsextControlCode uint32
+	debugLogCloser   io.Closer
+
+	mountPointSecurity *windows.SECURITY_DESCRIPTOR
+	mountDir           *mountDirectory
+	removal            removalWatch
 }
 
 // BehaviourBase defines the mandatory methods.
@@ -140,6 +375,9 @@ type FileSystem struct {
 // upon mounting the filesystem.
 type BehaviourBase interface {
 	// Open the file specified by name.
+	//
+	// The case insensitive file systems should report the
+	// name in its stored case by SetNormalizedName.
 	Open(
 		fs *FileSystemRef, name string,
 		createOptions, grantedAccess uint32,
@@ -154,21 +392,42 @@ func delegateOpen(
 	fileSystem, fileName uintptr,
 	createOptions, grantedAccess uint32,
 	file *uintptr, fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	result, err := ref.base.Open(
-		ref, utf16PtrToString(fileName),
-		createOptions, grantedAccess,
-		(*FSP_FSCTL_FILE_INFO)(
-			unsafe.Pointer(fileInfoAddr)),
-	)
+	b, op := ref.beginOperationArgs(
+		"Open", 0, fileName, 0, 0, createOptions)
+	defer ref.endOperation(b, op, &status)
+	defer ref.beginOpen(file, fileInfoAddr)()
+	var name string
+	if b.openRaw == nil || ref.namesRequired() {
+		name = utf16PtrToString(fileName)
+	}
+	if err := ref.checkProcessAccess(name, grantedAccess); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	if err := ref.checkSecurityAccess(name, false); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	info := (*FSP_FSCTL_FILE_INFO)(unsafe.Pointer(fileInfoAddr))
+	var result uintptr
+	var err error
+	if b.openRaw != nil {
+		result, err = b.openRaw.OpenRawName(
+			ref, (*uint16)(unsafe.Pointer(fileName)),
+			createOptions, grantedAccess, info)
+	} else {
+		result, err = b.base.Open(
+			ref, name, createOptions, grantedAccess, info)
+	}
 	if err != nil {
-		return convertNTStatus(err)
+		return ref.convertNTStatus(err)
 	}
-	*file = result
+	ref.trackFileName(result, name)
+	ref.openFiles.Store(result, struct{}{})
+	ref.setFileContext(file, result)
 	return windows.STATUS_SUCCESS
 }
 
@@ -189,7 +448,14 @@ func delegateClose(fileSystem, file uintptr) {
 	if ref == nil {
 		return
 	}
-	ref.base.Close(ref, file)
+	file = ref.fileContext(file)
+	b, op := ref.beginOperation("Close", file, 0)
+	defer ref.endOperation(b, op, nil)
+	defer ref.openFiles.Delete(file)
+	defer ref.releaseFile(file)
+	defer ref.untrackFileName(file)
+	defer ref.lockFile(file)()
+	b.base.Close(ref, file)
 }
 
 var go_delegateClose = syscall.NewCallbackCDecl(func(
@@ -208,12 +474,14 @@ type BehaviourGetVolumeInfo interface {
 
 func delegateGetVolumeInfo(
 	fileSystem, volumeInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.getVolumeInfo.GetVolumeInfo(
+	b, op := ref.beginOperation("GetVolumeInfo", 0, 0)
+	defer ref.endOperation(b, op, &status)
+	return ref.convertNTStatus(b.getVolumeInfo.GetVolumeInfo(
 		ref, (*FSP_FSCTL_VOLUME_INFO)(
 			unsafe.Pointer(volumeInfoAddr)),
 	))
@@ -237,12 +505,14 @@ type BehaviourSetVolumeLabel interface {
 
 func delegateSetVolumeLabel(
 	fileSystem, labelAddr, volumeInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.setVolumeLabel.SetVolumeLabel(
+	b, op := ref.beginOperation("SetVolumeLabel", 0, 0)
+	defer ref.endOperation(b, op, &status)
+	return ref.convertNTStatus(b.setVolumeLabel.SetVolumeLabel(
 		ref, utf16PtrToString(labelAddr),
 		(*FSP_FSCTL_VOLUME_INFO)(
 			unsafe.Pointer(volumeInfoAddr)),
@@ -260,15 +530,45 @@ var go_delegateSetVolumeLabel = syscall.NewCallbackCDecl(func(
 // GetSecurityByNameFlags indicates the content that the
 // caller cares about. The callee can return null value on
 // the item that is not interested in.
+//
+// The flags are a bitmask, where GetExistenceOnly is the
+// empty mask, and GetAttributesSecurity is the union of
+// GetAttributesByName and GetSecurityByName.
 type GetSecurityByNameFlags uint8
 
 const (
-	GetExistenceOnly = GetSecurityByNameFlags(iota)
-	GetAttributesByName
+	GetAttributesByName GetSecurityByNameFlags = 1 << iota
 	GetSecurityByName
-	GetAttributesSecurity
+
+	GetExistenceOnly      GetSecurityByNameFlags = 0
+	GetAttributesSecurity                        = GetAttributesByName | GetSecurityByName
 )
 
+// WantsAttributes tells whether the attributes are wanted.
+func (f GetSecurityByNameFlags) WantsAttributes() bool {
+	return f&GetAttributesByName != 0
+}
+
+// WantsSecurity tells whether the security descriptor is
+// wanted.
+func (f GetSecurityByNameFlags) WantsSecurity() bool {
+	return f&GetSecurityByName != 0
+}
+
+func (f GetSecurityByNameFlags) String() string {
+	switch f {
+	case GetExistenceOnly:
+		return "GetExistenceOnly"
+	case GetAttributesByName:
+		return "GetAttributesByName"
+	case GetSecurityByName:
+		return "GetSecurityByName"
+	case GetAttributesSecurity:
+		return "GetAttributesSecurity"
+	}
+	return fmt.Sprintf("GetSecurityByNameFlags(0x%x)", uint8(f))
+}
+
 // BehaviourGetSecurityByName retrieves file attributes and
 // security descriptor by file name.
 //
@@ -284,7 +584,7 @@ type BehaviourGetSecurityByName interface {
 func delegateGetSecurityByName(
 	fileSystem, fileName, attributesAddr uintptr,
 	securityDescAddr, securityDescSizeAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	flags := GetExistenceOnly
 	attributes := (*uint32)(unsafe.Pointer(attributesAddr))
 	if attributes != nil {
@@ -302,22 +602,34 @@ func delegateGetSecurityByName(
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	attr, sd, err := ref.getSecurityByName.GetSecurityByName(
-		ref, utf16PtrToString(fileName), flags)
+	b, op := ref.beginOperation("GetSecurityByName", 0, fileName)
+	defer ref.endOperation(b, op, &status)
+	var attr uint32
+	var sd *windows.SECURITY_DESCRIPTOR
+	var err error
+	if b.getSecurityByNameRaw != nil {
+		attr, sd, err = b.getSecurityByNameRaw.GetSecurityByNameRawName(
+			ref, (*uint16)(unsafe.Pointer(fileName)), flags)
+	} else {
+		attr, sd, err = b.getSecurityByName.GetSecurityByName(
+			ref, utf16PtrToString(fileName), flags)
+	}
 	if err != nil {
-		return convertNTStatus(err)
+		status := ref.convertNTStatus(err)
+		if status == windows.STATUS_REPARSE && attributes != nil {
+			// The attributes carry the reparse point index.
+			*attributes = attr
+		}
+		return status
 	}
 	if attributes != nil {
 		*attributes = attr
 	}
 	if size != nil {
-		length := int(sd.Length())
+		length, status := CopySecurityDescriptor(
+			enforceBytePtr(securityDescAddr, bufferSize), sd)
 		*size = uintptr(length)
-		source := enforceBytePtr(uintptr(unsafe.Pointer(sd)), length)
-		target := enforceBytePtr(securityDescAddr, bufferSize)
-		if copy(target, source) < length {
-			return windows.STATUS_BUFFER_OVERFLOW
-		}
+		return status
 	}
 	return windows.STATUS_SUCCESS
 }
@@ -347,13 +659,25 @@ func delegateCreate(
 	createOptions, grantedAccess, fileAttributes uint32,
 	securityDescriptor uintptr, allocationSize uint64,
 	file *uintptr, fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	result, err := ref.create.Create(
-		ref, utf16PtrToString(fileName),
+	b, op := ref.beginOperationArgs(
+		"Create", 0, fileName, allocationSize, 0, createOptions)
+	defer ref.endOperation(b, op, &status)
+	defer ref.beginOpen(file, fileInfoAddr)()
+	name := utf16PtrToString(fileName)
+	if err := ref.checkProcessAccess(
+		name, grantedAccess|windows.FILE_WRITE_DATA); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	if err := ref.checkSecurityAccess(name, true); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	result, err := b.create.Create(
+		ref, name,
 		createOptions, grantedAccess, fileAttributes,
 		(*windows.SECURITY_DESCRIPTOR)(
 			unsafe.Pointer(securityDescriptor)),
@@ -361,26 +685,14 @@ func delegateCreate(
 			unsafe.Pointer(fileInfoAddr)),
 	)
 	if err != nil {
-		return convertNTStatus(err)
+		return ref.convertNTStatus(err)
 	}
-	*file = result
+	ref.trackFileName(result, name)
+	ref.openFiles.Store(result, struct{}{})
+	ref.setFileContext(file, result)
 	return windows.STATUS_SUCCESS
 }
 
-var go_delegateCreate = syscall.NewCallbackCDecl(func(
-	fileSystem, fileName uintptr,
-	createOptions, grantedAccess, fileAttributes uint32,
-	securityDescriptor uintptr, allocationSize uint64,
-	file *uintptr, fileInfoAddr uintptr,
-) uintptr {
-	return uintptr(delegateCreate(
-		fileSystem, fileName,
-		createOptions, grantedAccess, fileAttributes,
-		securityDescriptor, allocationSize,
-		file, fileInfoAddr,
-	))
-})
-
 // BehaviourOverwrite overwrites a file's attribute.
 type BehaviourOverwrite interface {
 	Overwrite(
@@ -395,29 +707,63 @@ func delegateOverwrite(
 	fileSystem, file uintptr,
 	attributes uint32, replaceAttributes uint8,
 	allocationSize uint64, fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.overwrite.Overwrite(
+	file = ref.fileContext(file)
+	b, op := ref.beginOperationArgs(
+		"Overwrite", file, 0, allocationSize, 0, attributes)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(file)()
+	return ref.convertNTStatus(b.overwrite.Overwrite(
 		ref, file, attributes, replaceAttributes != 0,
 		allocationSize, (*FSP_FSCTL_FILE_INFO)(
 			unsafe.Pointer(fileInfoAddr)),
 	))
 }
 
-var go_delegateOverwrite = syscall.NewCallbackCDecl(func(
+// BehaviourOverwriteEx overwrites file with extended
+// attributes, which are supplied when the file is superseded
+// or overwritten by a caller carrying an EA buffer. The
+// extendedAttribute is nil when there's no EA buffer.
+//
+// Please notice this interface conflicts with
+// BehaviourOverwrite and is prioritized over it.
+type BehaviourOverwriteEx interface {
+	OverwriteEx(
+		fs *FileSystemRef, file uintptr,
+		attributes uint32, replaceAttributes bool,
+		allocationSize uint64,
+		extendedAttribute *FILE_FULL_EA_INFORMATION,
+		extendedAttributeLength uint32,
+		info *FSP_FSCTL_FILE_INFO,
+	) error
+}
+
+func delegateOverwriteEx(
 	fileSystem, file uintptr,
 	attributes uint32, replaceAttributes uint8,
-	allocationSize uint64, fileInfoAddr uintptr,
-) uintptr {
-	return uintptr(delegateOverwrite(
-		fileSystem, file,
-		attributes, replaceAttributes,
-		allocationSize, fileInfoAddr,
+	allocationSize uint64, ea uintptr, eaLength uint32,
+	fileInfoAddr uintptr,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	file = ref.fileContext(file)
+	b, op := ref.beginOperationArgs(
+		"OverwriteEx", file, 0, allocationSize, eaLength, attributes)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(file)()
+	return ref.convertNTStatus(b.overwriteEx.OverwriteEx(
+		ref, file, attributes, replaceAttributes != 0,
+		allocationSize,
+		(*FILE_FULL_EA_INFORMATION)(unsafe.Pointer(ea)), eaLength,
+		(*FSP_FSCTL_FILE_INFO)(unsafe.Pointer(fileInfoAddr)),
 	))
-})
+}
 
 // BehaviourCleanup performs the cleanup behaviour.
 type BehaviourCleanup interface {
@@ -435,7 +781,12 @@ func delegateCleanup(
 	if ref == nil {
 		return
 	}
-	ref.cleanup.Cleanup(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"Cleanup", fileContext, filename, 0, 0, cleanupFlags)
+	defer ref.endOperation(b, op, nil)
+	defer ref.lockFile(fileContext)()
+	b.cleanup.Cleanup(
 		ref, fileContext, utf16PtrToString(filename),
 		cleanupFlags,
 	)
@@ -463,33 +814,57 @@ type BehaviourRead interface {
 func delegateRead(
 	fileSystem, fileContext, buffer uintptr,
 	offset uint64, length uint32, bytesRead *uint32,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	*bytesRead = 0
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	n, err := ref.read.Read(ref, fileContext,
-		enforceBytePtr(buffer, int(length)), offset)
-	*bytesRead = uint32(n)
-	// XXX: this is required otherwise windows kernel render
-	// it as nothing read from the file instead.
-	if n > 0 && err == io.EOF {
-		err = nil
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"Read", fileContext, 0, offset, length, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	read := func(buf []byte) (int, error) {
+		n, err := b.read.Read(ref, fileContext, buf, offset)
+		// XXX: this is required otherwise windows kernel render
+		// it as nothing read from the file instead.
+		if n > 0 && err == io.EOF {
+			err = nil
+		}
+		if n > 0 && err == nil && ref.inspector != nil {
+			if err := ref.inspector.InspectRead(
+				ref, ref.fileName(fileContext), offset, buf[:n],
+			); err != nil {
+				return 0, err
+			}
+		}
+		return n, err
 	}
-	return convertNTStatus(err)
+	buf := enforceBytePtr(buffer, int(length))
+	commit := func(n int) {
+		if n > 0 && ref.stats != nil {
+			ref.stats.addRead(n)
+		}
+	}
+	if op != nil && op.deadline != nil {
+		private := make([]byte, len(buf))
+		if status, ok := ref.runDeadline(op,
+			func() (int, error) {
+				return read(private)
+			}, func(n int) {
+				copy(buf, private[:n])
+				commit(n)
+			}); ok {
+			return status
+		}
+	}
+	n, err := read(buf)
+	*bytesRead = uint32(n)
+	commit(n)
+	return ref.convertNTStatus(err)
 }
 
-var go_delegateRead = syscall.NewCallbackCDecl(func(
-	fileSystem, fileContext, buffer uintptr,
-	offset uint64, length uint32, bytesRead *uint32,
-) uintptr {
-	return uintptr(delegateRead(
-		fileSystem, fileContext, buffer,
-		offset, length, bytesRead,
-	))
-})
-
 // BehaviourWrite writes an open file.
 type BehaviourWrite interface {
 	Write(
@@ -505,40 +880,44 @@ func delegateWrite(
 	offset uint64, length uint32,
 	writeToEndOfFile, constrainedIo uint8,
 	bytesWritten *uint32, fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	*bytesWritten = 0
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	n, err := ref.write.Write(ref, fileContext,
-		enforceBytePtr(buffer, int(length)), offset,
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"Write", fileContext, 0, offset, length,
+		uint32(writeToEndOfFile)|uint32(constrainedIo)<<1)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	buf := enforceBytePtr(buffer, int(length))
+	if ref.inspector != nil {
+		if err := ref.inspector.InspectWrite(
+			ref, ref.fileName(fileContext), offset, buf,
+		); err != nil {
+			return ref.convertNTStatus(err)
+		}
+	}
+	n, err := b.write.Write(ref, fileContext,
+		buf, offset,
 		writeToEndOfFile != 0, constrainedIo != 0,
 		(*FSP_FSCTL_FILE_INFO)(
 			unsafe.Pointer(fileInfoAddr)),
 	)
 	*bytesWritten = uint32(n)
-	return convertNTStatus(err)
+	if n > 0 && ref.stats != nil {
+		ref.stats.addWritten(n)
+	}
+	return ref.convertNTStatus(err)
 }
 
-var go_delegateWrite = syscall.NewCallbackCDecl(func(
-	fileSystem, fileContext, buffer uintptr,
-	offset uint64, length uint32,
-	writeToEndOfFile, constrainedIo uint8,
-	bytesWritten *uint32, fileInfoAddr uintptr,
-) uintptr {
-	return uintptr(delegateWrite(
-		fileSystem, fileContext, buffer,
-		offset, length,
-		writeToEndOfFile, constrainedIo,
-		bytesWritten, fileInfoAddr,
-	))
-})
-
 // BehaviourFlush flushes a file or volume.
 //
 // When file is not NULL, the specific file will be flushed,
-// otherwise the whole volume will be flushed.
+// otherwise the whole volume will be flushed, unless the
+// BehaviourFlushVolume is also implemented.
 type BehaviourFlush interface {
 	Flush(
 		fs *FileSystemRef, file uintptr,
@@ -546,14 +925,34 @@ type BehaviourFlush interface {
 	) error
 }
 
+// BehaviourFlushVolume flushes the whole volume, e.g. syncing
+// the dirty state, uploading the pending buffers or making a
+// checkpoint of the journal.
+//
+// Once implemented, it takes over the flush of volume from
+// BehaviourFlush, which will only be called with files.
+type BehaviourFlushVolume interface {
+	FlushVolume(fs *FileSystemRef) error
+}
+
 func delegateFlush(
 	fileSystem, fileContext, infoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.flush.Flush(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("Flush", fileContext, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	if fileContext == 0 && b.flushVolume != nil {
+		return ref.convertNTStatus(b.flushVolume.FlushVolume(ref))
+	}
+	if b.flush == nil {
+		return windows.STATUS_SUCCESS
+	}
+	return ref.convertNTStatus(b.flush.Flush(
 		ref, fileContext, (*FSP_FSCTL_FILE_INFO)(
 			unsafe.Pointer(infoAddr)),
 	))
@@ -577,12 +976,16 @@ type BehaviourGetFileInfo interface {
 
 func delegateGetFileInfo(
 	fileSystem, fileContext, infoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.getFileInfo.GetFileInfo(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("GetFileInfo", fileContext, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.getFileInfo.GetFileInfo(
 		ref, fileContext, (*FSP_FSCTL_FILE_INFO)(
 			unsafe.Pointer(infoAddr)),
 	))
@@ -623,11 +1026,16 @@ func delegateSetBasicInfo(
 	attributes uint32,
 	creationTime, lastAccessTime, lastWriteTime, changeTime uint64,
 	fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"SetBasicInfo", fileContext, 0, 0, 0, attributes)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
 	var flags SetBasicInfoFlags
 	if attributes != windows.INVALID_FILE_ATTRIBUTES {
 		flags |= SetBasicInfoAttributes
@@ -639,31 +1047,18 @@ func delegateSetBasicInfo(
 		flags |= SetBasicInfoLastAccessTime
 	}
 	if lastWriteTime != 0 {
-		flags |= SetBasicInfoLastAccessTime
+		flags |= SetBasicInfoLastWriteTime
 	}
 	if changeTime != 0 {
 		flags |= SetBasicInfoChangeTime
 	}
-	return convertNTStatus(ref.setBasicInfo.SetBasicInfo(
+	return ref.convertNTStatus(b.setBasicInfo.SetBasicInfo(
 		ref, fileContext, flags, attributes,
 		creationTime, lastAccessTime, lastWriteTime, changeTime,
 		(*FSP_FSCTL_FILE_INFO)(unsafe.Pointer(fileInfoAddr)),
 	))
 }
 
-var go_delegateSetBasicInfo = syscall.NewCallbackCDecl(func(
-	fileSystem, fileContext uintptr,
-	attributes uint32,
-	creationTime, lastAccessTime, lastWriteTime, changeTime uint64,
-	fileInfoAddr uintptr,
-) uintptr {
-	return uintptr(delegateSetBasicInfo(
-		fileSystem, fileContext, attributes,
-		creationTime, lastAccessTime, lastWriteTime, changeTime,
-		fileInfoAddr,
-	))
-})
-
 // BehaviourSetFileSize sets file's size or allocation size.
 type BehaviourSetFileSize interface {
 	SetFileSize(
@@ -677,29 +1072,23 @@ func delegateSetFileSize(
 	fileSystem, fileContext uintptr,
 	newSize uint64, setAllocationSize uint8,
 	fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.setFileSize.SetFileSize(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"SetFileSize", fileContext, 0, newSize, 0,
+		uint32(setAllocationSize))
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.setFileSize.SetFileSize(
 		ref, fileContext, newSize, setAllocationSize != 0,
 		(*FSP_FSCTL_FILE_INFO)(unsafe.Pointer(fileInfoAddr)),
 	))
 }
 
-var go_delegateSetFileSize = syscall.NewCallbackCDecl(func(
-	fileSystem, fileContext uintptr,
-	newSize uint64, setAllocationSize uint8,
-	fileInfoAddr uintptr,
-) uintptr {
-	return uintptr(delegateSetFileSize(
-		fileSystem, fileContext,
-		newSize, setAllocationSize,
-		fileInfoAddr,
-	))
-})
-
 // BehaviourCanDelete detects whether the file can be deleted.
 type BehaviourCanDelete interface {
 	CanDelete(
@@ -709,12 +1098,16 @@ type BehaviourCanDelete interface {
 
 func delegateCanDelete(
 	fileSystem, fileContext, filename uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.canDelete.CanDelete(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("CanDelete", fileContext, filename)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.canDelete.CanDelete(
 		ref, fileContext, utf16PtrToString(filename),
 	))
 }
@@ -727,6 +1120,50 @@ var go_delegateCanDelete = syscall.NewCallbackCDecl(func(
 	))
 })
 
+// BehaviourSetDelete sets or clears the delete disposition
+// of the file, which is prioritized over BehaviourCanDelete
+// by WinFSP, so that the file system is able to undelete
+// the file before it is cleaned up.
+//
+// The file must be deleted at the cleanup of the last open
+// handle with FspCleanupDelete flag, when the disposition
+// has been set. The dispositions unnecessary to the file
+// system are no longer posted when this is implemented.
+type BehaviourSetDelete interface {
+	SetDelete(
+		fs *FileSystemRef, file uintptr, name string,
+		deleteFile bool,
+	) error
+}
+
+func delegateSetDelete(
+	fileSystem, fileContext, filename uintptr,
+	deleteFile uint8,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"SetDelete", fileContext, filename, 0, 0, uint32(deleteFile))
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.setDelete.SetDelete(
+		ref, fileContext, utf16PtrToString(filename),
+		deleteFile != 0,
+	))
+}
+
+var go_delegateSetDelete = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, filename uintptr,
+	deleteFile uint8,
+) uintptr {
+	return uintptr(delegateSetDelete(
+		fileSystem, fileContext, filename, deleteFile,
+	))
+})
+
 // BehaviourRename renames a file or directory.
 type BehaviourRename interface {
 	Rename(
@@ -738,16 +1175,30 @@ type BehaviourRename interface {
 func delegateRename(
 	fileSystem, fileContext uintptr,
 	source, target uintptr, replaceIfExists uint8,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.rename.Rename(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"Rename", fileContext, source, 0, 0, uint32(replaceIfExists))
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	targetName := utf16PtrToString(target)
+	if err := ref.checkProcessAccess(
+		targetName, windows.DELETE); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	if err := b.rename.Rename(
 		ref, fileContext,
-		utf16PtrToString(source), utf16PtrToString(target),
+		utf16PtrToString(source), targetName,
 		replaceIfExists != 0,
-	))
+	); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	ref.trackFileName(fileContext, targetName)
+	return windows.STATUS_SUCCESS
 }
 
 var go_delegateRename = syscall.NewCallbackCDecl(func(
@@ -770,7 +1221,7 @@ type BehaviourGetSecurity interface {
 func delegateGetSecurity(
 	fileSystem, fileContext uintptr,
 	securityDescAddr, securityDescSizeAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	size := (*uintptr)(unsafe.Pointer(securityDescSizeAddr))
 	var bufferSize int
 	if size != nil {
@@ -781,23 +1232,28 @@ func delegateGetSecurity(
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	sd, err := ref.getSecurity.GetSecurity(ref, fileContext)
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("GetSecurity", fileContext, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	sd, err := b.getSecurity.GetSecurity(ref, fileContext)
 	if err != nil {
-		return convertNTStatus(err)
+		return ref.convertNTStatus(err)
 	}
-	length := int(sd.Length())
-	*size = uintptr(length)
 	// XXX: though the API document says so, I haven't seen
 	// under any circumstances will the security descriptor's
 	// buffer address be NULL.
-	if securityDescAddr != 0 {
-		source := enforceBytePtr(uintptr(unsafe.Pointer(sd)), length)
-		target := enforceBytePtr(securityDescAddr, bufferSize)
-		if copy(target, source) < length {
-			return windows.STATUS_BUFFER_OVERFLOW
+	if securityDescAddr == 0 {
+		if sd == nil {
+			return windows.STATUS_INVALID_SECURITY_DESCR
 		}
+		*size = uintptr(sd.Length())
+		return windows.STATUS_SUCCESS
 	}
-	return windows.STATUS_SUCCESS
+	length, status := CopySecurityDescriptor(
+		enforceBytePtr(securityDescAddr, bufferSize), sd)
+	*size = uintptr(length)
+	return status
 }
 
 var go_delegateGetSecurity = syscall.NewCallbackCDecl(func(
@@ -822,12 +1278,17 @@ type BehaviourSetSecurity interface {
 func delegateSetSecurity(
 	fileSystem, fileContext uintptr,
 	info windows.SECURITY_INFORMATION, securityDescSizeAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.setSecurity.SetSecurity(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"SetSecurity", fileContext, 0, 0, 0, uint32(info))
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.setSecurity.SetSecurity(
 		ref, fileContext, info,
 		(*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(
 			securityDescSizeAddr))))
@@ -873,13 +1334,17 @@ func (buf *DirBuffer) ReadDirectory(
 	marker *uint16, buffer []byte,
 ) int {
 	var bytesTransferred uint32
-	slice := (*reflect.SliceHeader)(unsafe.Pointer(&buffer))
+	var bufferAddr uintptr
+	if len(buffer) > 0 {
+		bufferAddr = uintptr(unsafe.Pointer(&buffer[0]))
+	}
 	_, _, _ = readDirectoryBuffer.Call(
 		uintptr(unsafe.Pointer(&buf.ptr)),
 		uintptr(unsafe.Pointer(marker)),
-		slice.Data, uintptr(slice.Len),
+		bufferAddr, uintptr(len(buffer)),
 		uintptr(unsafe.Pointer(&bytesTransferred)),
 	)
+	runtime.KeepAlive(buffer)
 	return int(bytesTransferred)
 }
 
@@ -926,30 +1391,13 @@ func (buf *DirBuffer) Acquire(reset bool) (*DirBufferFiller, error) {
 func (b *DirBufferFiller) Fill(
 	name string, fileInfo *FSP_FSCTL_FILE_INFO,
 ) (bool, error) {
-	utf16, err := windows.UTF16FromString(name)
+	encoder := dirInfoEncoders.Get().(*dirInfoEncoder)
+	defer dirInfoEncoders.Put(encoder)
+	alignedBuffer, err := encoder.encode(name, fileInfo)
 	if err != nil {
 		return false, err
 	}
-	if len(utf16) > 0 && utf16[len(utf16)-1] == 0 {
-		// Prune the trailing NUL, since it is not need
-		// while copying to the directory buffer.
-		utf16 = utf16[:len(utf16)-1]
-	}
-	length := int(unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}) +
-		uintptr(len(utf16))*SIZEOF_WCHAR)
-	alignedBuffer := make([]uint64, (length+7)/8)
 	alignedAddr := uintptr(unsafe.Pointer(&alignedBuffer[0]))
-	dirInfo := (*FSP_FSCTL_DIR_INFO)(unsafe.Pointer(alignedAddr))
-	dirInfo.Size = uint16(length)
-	if fileInfo != nil {
-		dirInfo.FileInfo = *fileInfo
-	}
-	target := *((*[]uint16)(unsafe.Pointer(&reflect.SliceHeader{
-		Data: alignedAddr + unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}),
-		Len:  len(utf16),
-		Cap:  len(utf16),
-	})))
-	copy(target, utf16)
 	var status windows.NTStatus
 	copyOk, _, _ := fillDirectoryBuffer.Call(
 		uintptr(unsafe.Pointer(&b.buf.ptr)), alignedAddr,
@@ -963,6 +1411,73 @@ func (b *DirBufferFiller) Fill(
 	return uint8(copyOk) != 0, err
 }
 
+// dirInfoEncoder encodes the directory entries with its
+// scratch buffers reused, since the directory buffer and
+// the FSP_FSCTL_DIR_INFO consumers copy the entry out.
+type dirInfoEncoder struct {
+	utf16   []uint16
+	aligned []uint64
+}
+
+// maxPooledDirInfo is the maximum number of words that an
+// encoder might retain when it is put back to the pool.
+const maxPooledDirInfo = 1024
+
+// dirInfoEncoders is the pool of the directory encoders, so
+// that listing huge directories does not allocate for each
+// of the directory entries.
+var dirInfoEncoders = sync.Pool{
+	New: func() interface{} {
+		return &dirInfoEncoder{}
+	},
+}
+
+// encode the directory entry into an aligned buffer of
+// FSP_FSCTL_DIR_INFO followed by the file name. The
+// returned buffer is only valid until the next encoding.
+func (e *dirInfoEncoder) encode(
+	name string, fileInfo *FSP_FSCTL_FILE_INFO,
+) ([]uint64, error) {
+	if strings.IndexByte(name, 0) >= 0 {
+		return nil, windows.STATUS_OBJECT_NAME_INVALID
+	}
+	e.utf16 = wtf8.AppendEncode(e.utf16[:0], name)
+	length := int(unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}) +
+		uintptr(len(e.utf16))*SIZEOF_WCHAR)
+	if length > math.MaxUint16 {
+		// The size of the entry will overflow otherwise.
+		return nil, windows.STATUS_OBJECT_NAME_INVALID
+	}
+	words := (length + 7) / 8
+	if cap(e.aligned) < words {
+		e.aligned = make([]uint64, words)
+	}
+	alignedBuffer := e.aligned[:words]
+	alignedPtr := unsafe.Pointer(&alignedBuffer[0])
+	dirInfo := (*FSP_FSCTL_DIR_INFO)(alignedPtr)
+	*dirInfo = FSP_FSCTL_DIR_INFO{}
+	dirInfo.Size = uint16(length)
+	if fileInfo != nil {
+		dirInfo.FileInfo = *fileInfo
+	}
+	copy(unsafe.Slice((*uint16)(unsafe.Add(alignedPtr,
+		unsafe.Sizeof(FSP_FSCTL_DIR_INFO{}))), len(e.utf16)), e.utf16)
+	if cap(e.aligned) > maxPooledDirInfo {
+		// Don't let a single long name pin the memory.
+		e.aligned, e.utf16 = nil, nil
+	}
+	return alignedBuffer, nil
+}
+
+// encodeDirInfo encodes the directory entry into a freshly
+// allocated buffer of FSP_FSCTL_DIR_INFO.
+func encodeDirInfo(
+	name string, fileInfo *FSP_FSCTL_FILE_INFO,
+) ([]uint64, error) {
+	var encoder dirInfoEncoder
+	return encoder.encode(name, fileInfo)
+}
+
 // Release the directory buffer filler.
 func (b *DirBufferFiller) Release() {
 	_, _, _ = releaseDirectoryBuffer.Call(
@@ -986,16 +1501,34 @@ func delegateReadDirectory(
 	fileSystem, fileContext uintptr,
 	pattern, marker *uint16,
 	buf uintptr, length uint32, numRead *uint32,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	n, err := ref.readDirRaw.ReadDirectoryRaw(
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"ReadDirectory", fileContext, 0, 0, length, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	if op != nil && op.deadline != nil {
+		pattern, marker := cloneUTF16Ptr(pattern), cloneUTF16Ptr(marker)
+		private := make([]byte, length)
+		if status, ok := ref.runDeadline(op,
+			func() (int, error) {
+				return b.readDirRaw.ReadDirectoryRaw(
+					ref, fileContext, pattern, marker, private)
+			}, func(n int) {
+				copy(enforceBytePtr(buf, int(length)), private[:n])
+			}); ok {
+			return status
+		}
+	}
+	n, err := b.readDirRaw.ReadDirectoryRaw(
 		ref, fileContext, pattern, marker,
 		enforceBytePtr(buf, int(length)))
 	*numRead = uint32(n)
-	return convertNTStatus(err)
+	return ref.convertNTStatus(err)
 }
 
 var go_delegateReadDirectory = syscall.NewCallbackCDecl(func(
@@ -1029,8 +1562,17 @@ type BehaviourReadDirectory interface {
 	) error
 }
 
+// BehaviourRewindDirectory is the optional interface of the
+// BehaviourReadDirectory, which is notified when the listing
+// of directory restarts from the beginning, so that the file
+// system may take a new snapshot of the directory.
+type BehaviourRewindDirectory interface {
+	RewindDirectory(fs *FileSystemRef, file uintptr) error
+}
+
 type behaviourReadDirectoryDelegate struct {
 	readDir BehaviourReadDirectory
+	rewind  BehaviourRewindDirectory
 }
 
 func (d *behaviourReadDirectoryDelegate) ReadDirectoryRaw(
@@ -1043,6 +1585,11 @@ func (d *behaviourReadDirectoryDelegate) ReadDirectoryRaw(
 	if err != nil {
 		return 0, err
 	}
+	if marker == nil && d.rewind != nil {
+		if err := d.rewind.RewindDirectory(fs, file); err != nil {
+			return 0, err
+		}
+	}
 	filler, err := dirBuf.Acquire(marker == nil)
 	if err != nil {
 		return 0, err
@@ -1052,7 +1599,8 @@ func (d *behaviourReadDirectoryDelegate) ReadDirectoryRaw(
 			defer filler.Release()
 			var readPattern string
 			if pattern != nil {
-				readPattern = windows.UTF16PtrToString(pattern)
+				readPattern = utf16PtrToString(
+					uintptr(unsafe.Pointer(pattern)))
 			}
 			return d.readDir.ReadDirectory(
 				fs, file, readPattern, filler.Fill)
@@ -1075,12 +1623,16 @@ type BehaviourGetDirInfoByName interface {
 func delegateGetDirInfoByName(
 	fileSystem, parentDirFile uintptr,
 	fileName, dirInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
-	return convertNTStatus(ref.getDirInfoByName.GetDirInfoByName(
+	parentDirFile = ref.fileContext(parentDirFile)
+	b, op := ref.beginOperation("GetDirInfoByName", parentDirFile, fileName)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(parentDirFile)()
+	return ref.convertNTStatus(b.getDirInfoByName.GetDirInfoByName(
 		ref, parentDirFile, utf16PtrToString(fileName),
 		(*FSP_FSCTL_DIR_INFO)(unsafe.Pointer(dirInfoAddr)),
 	))
@@ -1109,23 +1661,29 @@ func delegateDeviceIoControl(
 	inputBuffer uintptr, inputBufferLength uint32,
 	outputBuffer uintptr, outputBufferLength uint32,
 	bytesWritten *uint32,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	*bytesWritten = 0
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperationArgs(
+		"DeviceIoControl", fileContext, 0, 0, inputBufferLength,
+		controlCode)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
 	input := enforceBytePtr(inputBuffer, int(inputBufferLength))
-	result, err := ref.deviceIoControl.DeviceIoControl(
+	result, err := b.deviceIoControl.DeviceIoControl(
 		ref, fileContext, controlCode, input,
 	)
 	if err != nil {
-		return convertNTStatus(err)
+		return ref.convertNTStatus(err)
 	}
 	output := enforceBytePtr(outputBuffer, int(outputBufferLength))
 	copied := copy(output, result)
 	*bytesWritten = uint32(copied)
-	if copied < len(output) {
+	if copied < len(result) {
 		return windows.STATUS_BUFFER_OVERFLOW
 	}
 	return windows.STATUS_SUCCESS
@@ -1173,15 +1731,27 @@ func delegateCreateEx(
 	securityDescriptor uintptr, allocationSize uint64,
 	extraBuffer uintptr, extraLength uint32, isReparse uint8,
 	file *uintptr, fileInfoAddr uintptr,
-) windows.NTStatus {
+) (status windows.NTStatus) {
 	ref := loadFileSystemRef(fileSystem)
 	if ref == nil {
 		return ntStatusNoRef
 	}
+	b, op := ref.beginOperationArgs(
+		"CreateEx", 0, fileName, allocationSize, 0, createOptions)
+	defer ref.endOperation(b, op, &status)
+	defer ref.beginOpen(file, fileInfoAddr)()
+	name := utf16PtrToString(fileName)
+	if err := ref.checkProcessAccess(
+		name, grantedAccess|windows.FILE_WRITE_DATA); err != nil {
+		return ref.convertNTStatus(err)
+	}
+	if err := ref.checkSecurityAccess(name, true); err != nil {
+		return ref.convertNTStatus(err)
+	}
 	result, err := func() (uintptr, error) {
 		if isReparse != 0 {
-			return ref.createEx.CreateExWithReparsePointData(
-				ref, utf16PtrToString(fileName),
+			return b.createEx.CreateExWithReparsePointData(
+				ref, name,
 				createOptions, grantedAccess, fileAttributes,
 				(*windows.SECURITY_DESCRIPTOR)(
 					unsafe.Pointer(securityDescriptor)),
@@ -1191,8 +1761,8 @@ func delegateCreateEx(
 					unsafe.Pointer(fileInfoAddr)),
 			)
 		} else {
-			return ref.createEx.CreateExWithExtendedAttribute(
-				ref, utf16PtrToString(fileName),
+			return b.createEx.CreateExWithExtendedAttribute(
+				ref, name,
 				createOptions, grantedAccess, fileAttributes,
 				(*windows.SECURITY_DESCRIPTOR)(
 					unsafe.Pointer(securityDescriptor)),
@@ -1204,42 +1774,84 @@ func delegateCreateEx(
 		}
 	}()
 	if err != nil {
-		return convertNTStatus(err)
+		return ref.convertNTStatus(err)
 	}
-	*file = result
+	ref.trackFileName(result, name)
+	ref.openFiles.Store(result, struct{}{})
+	ref.setFileContext(file, result)
 	return windows.STATUS_SUCCESS
 }
 
-var go_delegateCreateEx = syscall.NewCallbackCDecl(func(
-	fileSystem, fileName uintptr,
-	createOptions, grantedAccess, fileAttributes uint32,
-	securityDescriptor uintptr, allocationSize uint64,
-	extraBuffer uintptr, extraLength uint32, isReparse uint8,
-	file *uintptr, fileInfoAddr uintptr,
-) uintptr {
-	return uintptr(delegateCreateEx(
-		fileSystem, fileName,
-		createOptions, grantedAccess, fileAttributes,
-		securityDescriptor, allocationSize,
-		extraBuffer, extraLength, isReparse,
-		file, fileInfoAddr,
-	))
-})
-
 type option struct {
 	caseSensitive  bool
+	casePreserved  bool
 	volumePrefix   string
 	fileSystemName string
 	passPattern    bool
 	creationTime   time.Time
+
+	flushAndPurgeOnCleanup      bool
+	postCleanupWhenModifiedOnly bool
+	wslFeatures                 bool
+
+	serializePerFile bool
+	processAccess    ProcessAccessPolicy
+	inspector        ContentInspector
+	debugLog         uint32
+	debugLogWriter   io.Writer
+	dllPath          string
+	dllAppDir        bool
+	slowThreshold    time.Duration
+	slowHandler      OperationHandler
+	logOperations    bool
+	statistics       bool
+	operationLogger  OperationHandler
+	recoverPanic     bool
+	panicHandler     PanicHandler
+	bundleDir        string
+	bundleSize       int
+	driveIcon        string
+	driveLabel       string
+	removedHandler   RemovedHandler
+	minimalSecurity  bool
+	fsextControlCode uint32
+
+	volumeSerialNumber uint32
+	mountPointSecurity *windows.SECURITY_DESCRIPTOR
+	maxComponentLength uint16
+
+	fileSystemAttribute  uint32
+	fileSystemAttribute2 uint32
+	fileInfoTimeout      uint32
+	dirInfoTimeout       uint32
+	volumeInfoTimeout    uint32
+	securityTimeout      uint32
+	streamInfoTimeout    uint32
+	eaTimeout            uint32
+	irpTimeout           uint32
+	irpCapacity          uint32
+	transactTimeout      uint32
+
+	concurrencyLimit       int
+	kindConcurrencyLimits  map[string]int
+	operationDeadline      time.Duration
+	kindOperationDeadlines map[string]time.Duration
+	traceSize              int
+	posixUnlinkRename      bool
+	securitySource         SecuritySource
+	errorMappers           []ErrorMapperFunc
+	fullContext            bool
+	clock                  clock.Clock
 }
 
 func newOption() *option {
 	return &option{
 		caseSensitive:  false,
+		casePreserved:  true,
 		volumePrefix:   "",
 		fileSystemName: "WinFSP",
-		creationTime:   time.Now(),
+
+		flushAndPurgeOnCleanup: true,
 	}
 }
 
@@ -1259,6 +1871,23 @@ func CaseSensitive(value bool) Option {
 	}
 }
 
+// CasePreservedNames is used to indicate whether the case
+// of the names is preserved when the files are created, so
+// that the names listed are identical to the names used on
+// creation. It is set to true by default.
+func CasePreservedNames(value bool) Option {
+	return func(o *option) {
+		o.casePreserved = value
+	}
+}
+
+// CaseInsensitivePreserving declares the file system to be
+// case insensitive while preserving the case of the names,
+// which is the semantics of NTFS and of most backends.
+func CaseInsensitivePreserving() Option {
+	return Options(CaseSensitive(false), CasePreservedNames(true))
+}
+
 // VolumePrefix sets the volume prefix on mounting.
 //
 // Specifying volume prefix will turn the filesystem into
@@ -1284,6 +1913,29 @@ func CreationTime(value time.Time) Option {
 	}
 }
 
+// Clock sets the clock of the file system, which provides the
+// default creation time of the volume and the time deciding
+// the expiry of the cached entries, e.g. the entries of the
+// SecurityByNameCache. The system clock is used by default.
+func Clock(value clock.Clock) Option {
+	return func(o *option) {
+		o.clock = value
+	}
+}
+
+// FsextControlCode sets the control code of the kernel mode
+// fsext provider serving the file system, which is zero by
+// default, meaning no fsext provider is used.
+//
+// The provider must have been registered to the WinFSP driver
+// with the same control code before mounting, and then the
+// FileSystem.FsextControl transacts with the provider.
+func FsextControlCode(value uint32) Option {
+	return func(o *option) {
+		o.fsextControlCode = value
+	}
+}
+
 // PassPattern specifies whether the pattern for read
 // directory should be passed.
 func PassPattern(value bool) Option {
@@ -1292,6 +1944,52 @@ func PassPattern(value bool) Option {
 	}
 }
 
+// FlushAndPurgeOnCleanup specifies whether the cache of a
+// file should be flushed and purged when its last handle is
+// closed, which is enabled by default.
+//
+// Purging the cache keeps it coherent with the changes made
+// to the backing store behind the file system, but also
+// penalizes read heavy workloads which reopen files often.
+func FlushAndPurgeOnCleanup(value bool) Option {
+	return func(o *option) {
+		o.flushAndPurgeOnCleanup = value
+	}
+}
+
+// PostCleanupWhenModifiedOnly specifies whether the Cleanup
+// should be called only when the file has been modified or
+// is going to be deleted, saving a round trip for closing
+// the files opened only for reading.
+func PostCleanupWhenModifiedOnly(value bool) Option {
+	return func(o *option) {
+		o.postCleanupWhenModifiedOnly = value
+	}
+}
+
+// PosixUnlinkRename specifies whether the file system supports
+// the POSIX semantics of removing and renaming files, which
+// are requested by FILE_DISPOSITION_POSIX_SEMANTICS and
+// FILE_RENAME_POSIX_SEMANTICS. Under such semantics, the open
+// files could be removed, or replaced by renaming.
+func PosixUnlinkRename(value bool) Option {
+	return func(o *option) {
+		o.posixUnlinkRename = value
+	}
+}
+
+// SerializePerFile specifies whether the operations
+// targeting the same file context should be serialized.
+//
+// Operations on different files are still executed in
+// parallel. This is useful for the simple file systems
+// whose file objects are not thread safe.
+func SerializePerFile(value bool) Option {
+	return func(o *option) {
+		o.serializePerFile = value
+	}
+}
+
 // Options is used to aggregate a bundle of options.
 func Options(opts ...Option) Option {
 	return func(o *option) {
@@ -1301,6 +1999,10 @@ func Options(opts ...Option) Option {
 	}
 }
 
+// AutoDriveLetter is the mount point that requests WinFSP
+// to pick the first free drive letter.
+const AutoDriveLetter = "*"
+
 const (
 	fspNetDeviceName  = "WinFSP.Net"
 	fspDiskDeviceName = "WinFSP.Disk"
@@ -1310,142 +2012,334 @@ var (
 	fileSystemCreate *syscall.Proc
 	fileSystemDelete *syscall.Proc
 	setMountPoint    *syscall.Proc
+	setMountPointEx  *syscall.Proc
 	startDispatcher  *syscall.Proc
 	stopDispatcher   *syscall.Proc
 )
 
-// Mount attempts to mount a file system to specified mount
-// point, returning the handle to the real filesystem.
-func Mount(
-	fs BehaviourBase, mountpoint string, opts ...Option,
-) (*FileSystem, error) {
-	if fs == nil {
-		return nil, errors.New("invalid nil fs parameter")
-	}
-	if err := tryLoadWinFSP(); err != nil {
-		return nil, err
-	}
-	option := newOption()
-	Options(opts...)(option)
-	created := false
-
-	// Place the reference map right now.
-	result := &FileSystem{}
-	fileSystemRef := &result.FileSystemRef
-	fileSystemAddr := uintptr(unsafe.Pointer(fileSystemRef))
-	_, loaded := refMap.LoadOrStore(fileSystemAddr, fileSystemRef)
-	if loaded {
-		return nil, errors.New("out of memory")
-	}
-	defer func() {
-		if !created {
-			refMap.Delete(fileSystemAddr)
-		}
-	}()
+// bind interprets the behaviours implemented by the file
+// system, filling the delegates into the interface and
+// returning the file system attributes implied by them.
+func (b *behaviours) bind(
+	fs BehaviourBase, fileSystemOps *FSP_FILE_SYSTEM_INTERFACE,
+) uint32 {
 	attributes := uint32(0)
-	if option.caseSensitive {
-		attributes |= FspFSAttributeCaseSensitive
-	}
-	attributes |= FspFSAttributeCasePreservedNames
-	attributes |= FspFSAttributeUnicodeOnDisk
-	attributes |= FspFSAttributePersistentAcls
-	attributes |= FspFSAttributeFlushAndPurgeOnCleanup
-	if option.passPattern {
-		attributes |= FspFSAttributePassQueryDirectoryPattern
-	}
-	attributes |= FspFSAttributeUmFileContextIsUserContext2
-
-	// Intepret the behaviours to convert interface.
-	//
-	// XXX: we will also need to store the fileSystemOps into
-	// the fileSystemRef, since the FspFileSystemCreate will
-	// create reference to this object, which might be GC-ed
-	// and reused by the golang's runtime.
-	fileSystemOps := &FSP_FILE_SYSTEM_INTERFACE{}
-	fileSystemRef.base = fs
-	fileSystemRef.fileSystemOps = fileSystemOps
+	b.base = fs
 	fileSystemOps.Open = go_delegateOpen
 	fileSystemOps.Close = go_delegateClose
 	if inner, ok := fs.(BehaviourGetVolumeInfo); ok {
-		fileSystemRef.getVolumeInfo = inner
+		b.getVolumeInfo = inner
 		fileSystemOps.GetVolumeInfo = go_delegateGetVolumeInfo
 	}
 	if inner, ok := fs.(BehaviourSetVolumeLabel); ok {
-		fileSystemRef.setVolumeLabel = inner
+		b.setVolumeLabel = inner
 		fileSystemOps.SetVolumeLabel = go_delegateSetVolumeLabel
 	}
 	if inner, ok := fs.(BehaviourGetSecurityByName); ok {
-		fileSystemRef.getSecurityByName = inner
+		b.getSecurityByName = inner
 		fileSystemOps.GetSecurityByName = go_delegateGetSecurityByName
 	}
+	if inner, ok := fs.(BehaviourGetSecurityByNameRaw); ok {
+		b.getSecurityByNameRaw = inner
+		fileSystemOps.GetSecurityByName = go_delegateGetSecurityByName
+	}
+	if inner, ok := fs.(BehaviourOpenRaw); ok {
+		b.openRaw = inner
+	}
 	if inner, ok := fs.(BehaviourCreateEx); ok {
-		fileSystemRef.createEx = inner
+		b.createEx = inner
 		fileSystemOps.CreateEx = go_delegateCreateEx
 	} else if inner, ok := fs.(BehaviourCreate); ok {
-		fileSystemRef.create = inner
+		b.create = inner
 		fileSystemOps.Create = go_delegateCreate
 	}
-	if inner, ok := fs.(BehaviourOverwrite); ok {
-		fileSystemRef.overwrite = inner
+	if inner, ok := fs.(BehaviourOverwriteEx); ok {
+		b.overwriteEx = inner
+		fileSystemOps.OverwriteEx = go_delegateOverwriteEx
+	} else if inner, ok := fs.(BehaviourOverwrite); ok {
+		b.overwrite = inner
 		fileSystemOps.Overwrite = go_delegateOverwrite
 	}
 	if inner, ok := fs.(BehaviourCleanup); ok {
-		fileSystemRef.cleanup = inner
+		b.cleanup = inner
 		fileSystemOps.Cleanup = go_delegateCleanup
 	}
 	if inner, ok := fs.(BehaviourRead); ok {
-		fileSystemRef.read = inner
+		b.read = inner
 		fileSystemOps.Read = go_delegateRead
 	}
 	if inner, ok := fs.(BehaviourWrite); ok {
-		fileSystemRef.write = inner
+		b.write = inner
 		fileSystemOps.Write = go_delegateWrite
 	}
 	if inner, ok := fs.(BehaviourFlush); ok {
-		fileSystemRef.flush = inner
+		b.flush = inner
+		fileSystemOps.Flush = go_delegateFlush
+	}
+	if inner, ok := fs.(BehaviourFlushVolume); ok {
+		b.flushVolume = inner
 		fileSystemOps.Flush = go_delegateFlush
 	}
 	if inner, ok := fs.(BehaviourGetFileInfo); ok {
-		fileSystemRef.getFileInfo = inner
+		b.getFileInfo = inner
 		fileSystemOps.GetFileInfo = go_delegateGetFileInfo
 	}
+	if inner, ok := fs.(BehaviourSetBasicInfo); ok {
+		b.setBasicInfo = inner
+		fileSystemOps.SetBasicInfo = go_delegateSetBasicInfo
+	}
 	if inner, ok := fs.(BehaviourSetFileSize); ok {
-		fileSystemRef.setFileSize = inner
+		b.setFileSize = inner
 		fileSystemOps.SetFileSize = go_delegateSetFileSize
 	}
 	if inner, ok := fs.(BehaviourCanDelete); ok {
-		fileSystemRef.canDelete = inner
+		b.canDelete = inner
 		fileSystemOps.CanDelete = go_delegateCanDelete
 	}
+	if inner, ok := fs.(BehaviourSetDelete); ok {
+		b.setDelete = inner
+		fileSystemOps.SetDelete = go_delegateSetDelete
+		attributes |= FspFSAttributePostDispositionWhenNecessaryOnly
+	}
 	if inner, ok := fs.(BehaviourRename); ok {
-		fileSystemRef.rename = inner
+		b.rename = inner
 		fileSystemOps.Rename = go_delegateRename
 	}
 	if inner, ok := fs.(BehaviourGetSecurity); ok {
-		fileSystemRef.getSecurity = inner
+		b.getSecurity = inner
 		fileSystemOps.GetSecurity = go_delegateGetSecurity
 	}
 	if inner, ok := fs.(BehaviourSetSecurity); ok {
-		fileSystemRef.setSecurity = inner
+		b.setSecurity = inner
 		fileSystemOps.SetSecurity = go_delegateSetSecurity
 	}
 	if inner, ok := fs.(BehaviourReadDirectoryRaw); ok {
-		fileSystemRef.readDirRaw = inner
+		b.readDirRaw = inner
 		fileSystemOps.ReadDirectory = go_delegateReadDirectory
 	} else if inner, ok := fs.(BehaviourReadDirectory); ok {
-		fileSystemRef.readDirRaw = &behaviourReadDirectoryDelegate{
-			readDir: inner,
-		}
+		delegate := &behaviourReadDirectoryDelegate{readDir: inner}
+		delegate.rewind, _ = fs.(BehaviourRewindDirectory)
+		b.readDirRaw = delegate
 		fileSystemOps.ReadDirectory = go_delegateReadDirectory
 	}
 	if inner, ok := fs.(BehaviourGetDirInfoByName); ok {
-		fileSystemRef.getDirInfoByName = inner
+		b.getDirInfoByName = inner
 		fileSystemOps.GetDirInfoByName = go_delegateGetDirInfoByName
 	}
 	if inner, ok := fs.(BehaviourDeviceIoControl); ok {
-		fileSystemRef.deviceIoControl = inner
+		b.deviceIoControl = inner
 		fileSystemOps.Control = go_delegateDeviceIoControl
 	}
+	if fileSystemOps.Control != 0 {
+		attributes |= FspFSAttributeDeviceControl
+	}
+	if inner, ok := fs.(BehaviourGetStreamInfo); ok {
+		b.getStreamInfo = inner
+		fileSystemOps.GetStreamInfo = go_delegateGetStreamInfo
+		attributes |= FspFSAttributeNamedStreams
+	}
+	if inner, ok := fs.(BehaviourDispatcherStopped); ok {
+		b.dispatcherStopped = inner
+		fileSystemOps.DispatcherStopped = go_delegateDispatcherStopped
+	}
+	if inner, ok := fs.(BehaviourGetReparsePointByName); ok {
+		b.getReparsePointByName = inner
+		fileSystemOps.ResolveReparsePoints = go_delegateResolveReparsePoints
+		attributes |= FspFSAttributeReparsePoints
+	}
+	if inner, ok := fs.(BehaviourGetReparsePoint); ok {
+		b.getReparsePoint = inner
+		fileSystemOps.GetReparsePoint = go_delegateGetReparsePoint
+	}
+	if inner, ok := fs.(BehaviourSetReparsePoint); ok {
+		b.setReparsePoint = inner
+		fileSystemOps.SetReparsePoint = go_delegateSetReparsePoint
+	}
+	if inner, ok := fs.(BehaviourDeleteReparsePoint); ok {
+		b.deleteReparsePoint = inner
+		fileSystemOps.DeleteReparsePoint = go_delegateDeleteReparsePoint
+	}
+	if inner, ok := fs.(BehaviourGetEa); ok {
+		b.getEa = inner
+		fileSystemOps.GetEa = go_delegateGetEa
+		attributes |= FspFSAttributeExtendedAttributes
+	}
+	if inner, ok := fs.(BehaviourSetEa); ok {
+		b.setEa = inner
+		fileSystemOps.SetEa = go_delegateSetEa
+		attributes |= FspFSAttributeExtendedAttributes
+	}
+	return attributes
+}
+
+// applyMinimalSecurity replaces the security behaviours with
+// the minimal security.
+//
+// WinFSP skips the access check when there's no
+// GetSecurityByName, so we only need to report the
+// descriptor to the querying processes.
+func (b *behaviours) applyMinimalSecurity(
+	security *minimalSecurity,
+	fileSystemOps *FSP_FILE_SYSTEM_INTERFACE,
+) {
+	b.getSecurityByName = nil
+	b.getSecurityByNameRaw = nil
+	fileSystemOps.GetSecurityByName = 0
+	b.getSecurity = security
+	fileSystemOps.GetSecurity = go_delegateGetSecurity
+	b.setSecurity = nil
+	fileSystemOps.SetSecurity = 0
+}
+
+// Mount attempts to mount a file system to specified mount
+// point, returning the handle to the real filesystem.
+//
+// The mount point is either a drive letter like "X:", or a
+// directory in a NTFS volume which must be absent or empty,
+// or AutoDriveLetter to pick the first free drive letter.
+//
+// At most 1024 file systems could be mounted in a process at
+// the same time, and mounting more fails until some of them
+// are unmounted.
+func Mount(
+	fs BehaviourBase, mountpoint string, opts ...Option,
+) (*FileSystem, error) {
+	if fs == nil {
+		return nil, errors.New("invalid nil fs parameter")
+	}
+	option := newOption()
+	Options(opts...)(option)
+	if err := applyDLLOptions(option); err != nil {
+		return nil, err
+	}
+	if err := tryLoadWinFSP(); err != nil {
+		return nil, err
+	}
+	if option.creationTime.IsZero() {
+		option.creationTime = clock.Now(option.clock)
+	}
+	shellDrive := option.driveIcon != "" || option.driveLabel != ""
+	if _, ok := driveLetter(mountpoint); shellDrive && !ok &&
+		mountpoint != AutoDriveLetter {
+		return nil, errors.Errorf(
+			"drive icon requires drive letter mountpoint %q", mountpoint)
+	}
+	created := false
+	result := &FileSystem{}
+	if isDirectoryMountPoint(mountpoint) {
+		dir, err := prepareMountDirectory(mountpoint)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if !created {
+				_ = dir.cleanup()
+			}
+		}()
+		result.mountDir = dir
+	}
+	if option.debugLogWriter != nil {
+		closer, err := DebugLogSetWriter(option.debugLogWriter)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if !created {
+				_ = closer.Close()
+			}
+		}()
+		result.debugLogCloser = closer
+	}
+
+	// Place the reference map right now.
+	fileSystemRef := &result.FileSystemRef
+	fileSystemHandle, err := refMap.register(fileSystemRef)
+	if err != nil {
+		return nil, err
+	}
+	fileSystemRef.handle = fileSystemHandle
+	fileSystemRef.ctx, fileSystemRef.cancel = context.WithCancel(
+		context.Background())
+	defer func() {
+		if !created {
+			refMap.unregister(fileSystemHandle)
+			fileSystemRef.cancel()
+		}
+	}()
+	attributes := option.attributes()
+
+	// Intepret the behaviours to convert interface.
+	//
+	// XXX: we will also need to store the fileSystemOps into
+	// the fileSystemRef, since the FspFileSystemCreate will
+	// create reference to this object, which might be GC-ed
+	// and reused by the golang's runtime.
+	fileSystemOps := &FSP_FILE_SYSTEM_INTERFACE{}
+	fileSystemRef.fileSystemOps = fileSystemOps
+	fileSystemRef.serializePerFile = option.serializePerFile
+	fileSystemRef.clock = option.clock
+	fileSystemRef.fullContext = option.fullContext
+	fileSystemRef.posixRename = option.posixUnlinkRename
+	fileSystemRef.processAccess = option.processAccess
+	fileSystemRef.securitySource = option.securitySource
+	fileSystemRef.errorMappers = option.errorMappers
+	fileSystemRef.inspector = option.inspector
+	fileSystemRef.slowThreshold = option.slowThreshold
+	fileSystemRef.slowHandler = option.slowHandler
+	if fileSystemRef.slowHandler == nil {
+		fileSystemRef.slowHandler = logSlowOperation
+	}
+	if option.logOperations {
+		fileSystemRef.operationLogger = option.operationLogger
+		if fileSystemRef.operationLogger == nil {
+			fileSystemRef.operationLogger = logOperation
+		}
+	}
+	if option.statistics {
+		fileSystemRef.stats = newStatsCollector()
+	}
+	fileSystemRef.recoverPanic = option.recoverPanic
+	fileSystemRef.panicHandler = option.panicHandler
+	if option.bundleDir != "" {
+		fileSystemRef.bundleDir = option.bundleDir
+		fileSystemRef.recentOps = newOperationRing(option.bundleSize)
+		fileSystemRef.mountSummary = fmt.Sprintf(
+			"mountpoint: %s\noptions: %+v", mountpoint, *option)
+	}
+	fileSystemRef.limiter = newConcurrencyLimiter(
+		option.concurrencyLimit, option.kindConcurrencyLimits)
+	fileSystemRef.deadlines = newDeadlineEnforcer(
+		option.operationDeadline, option.kindOperationDeadlines)
+	if option.traceSize != 0 {
+		fileSystemRef.trace = newOperationRing(option.traceSize)
+	}
+	fileSystemRef.instrumented = option.slowThreshold > 0 ||
+		fileSystemRef.recentOps != nil ||
+		fileSystemRef.limiter != nil ||
+		fileSystemRef.deadlines != nil ||
+		fileSystemRef.trace != nil ||
+		fileSystemRef.operationLogger != nil ||
+		fileSystemRef.stats != nil
+	fileSystemRef.trackNames = option.inspector != nil ||
+		fileSystemRef.instrumented
+	current := newBehaviourSet()
+	attributes |= current.bind(fs, fileSystemOps)
+	fileSystemRef.current.Store(current)
+	if option.wslFeatures {
+		if attributes&FspFSAttributeExtendedAttributes == 0 {
+			return nil, errors.New(
+				"wsl features requires extended attributes")
+		}
+		attributes |= FspFSAttributeWslFeatures
+	}
+	if option.minimalSecurity {
+		security, err := newMinimalSecurity()
+		if err != nil {
+			return nil, err
+		}
+		fileSystemRef.minimalSecurity = security
+		current.applyMinimalSecurity(security, fileSystemOps)
+	}
 
 	// Convert the file system names into their wchar types.
 	convertError := func(err error, content string) error {
@@ -1459,10 +2353,6 @@ func Mount(
 	if err != nil {
 		return nil, convertError(err, option.fileSystemName)
 	}
-	utf16MountPoint, err := windows.UTF16PtrFromString(mountpoint)
-	if err != nil {
-		return nil, convertError(err, mountpoint)
-	}
 	driverName := fspDiskDeviceName
 	if option.volumePrefix != "" {
 		driverName = fspNetDeviceName
@@ -1483,7 +2373,9 @@ func Mount(
 		option.creationTime.UnixNano())
 	volumeParams.VolumeCreationTime =
 		*(*uint64)(unsafe.Pointer(&nowFiletime))
+	attributes |= option.fileSystemAttribute &^ fileContextAttributes
 	volumeParams.FileSystemAttribute = attributes
+	option.fillVolumeParams(volumeParams)
 	copy(volumeParams.Prefix[:], utf16Prefix)
 	copy(volumeParams.FileSystemName[:], utf16Name)
 
@@ -1511,23 +2403,14 @@ func Mount(
 				uintptr(unsafe.Pointer(result.fileSystem)))
 		}
 	}()
-	result.fileSystem.UserContext = fileSystemAddr
+	result.fileSystem.UserContext = fileSystemHandle
+	result.captureVolume()
+	result.SetDebugLog(option.debugLog)
 
 	// Attempt to mount the file system at mount point.
-	mountResult, _, err := setMountPoint.Call(
-		uintptr(unsafe.Pointer(result.fileSystem)),
-		uintptr(unsafe.Pointer(utf16MountPoint)),
-	)
-	runtime.KeepAlive(utf16MountPoint)
-	mountStatus := windows.NTStatus(mountResult)
-	if err == syscall.Errno(0) {
-		err = nil
-	}
-	if err == nil && mountStatus != windows.STATUS_SUCCESS {
-		err = mountStatus
-	}
-	if err != nil && err != windows.STATUS_SUCCESS {
-		return nil, errors.Wrap(err, "mount file system")
+	result.mountPointSecurity = option.mountPointSecurity
+	if err := result.attachMountPoint(mountpoint); err != nil {
+		return nil, err
 	}
 
 	// Attempt to start the file system dispatcher.
@@ -1550,15 +2433,28 @@ func Mount(
 				uintptr(unsafe.Pointer(result.fileSystem)))
 		}
 	}()
+	if shellDrive {
+		if err := RegisterDriveIcon(
+			result.mountPoint, option.driveIcon,
+			option.driveLabel); err != nil {
+			return nil, err
+		}
+		result.shellDrive = result.mountPoint
+	}
+	result.fsextControlCode = option.fsextControlCode
+	if err := result.watchRemoval(option.removedHandler); err != nil {
+		if shellDrive {
+			_ = UnregisterDriveIcon(result.shellDrive)
+		}
+		return nil, err
+	}
 	created = true
 	return result, nil
 }
 
 // Unmount destroy the created file system.
 func (f *FileSystem) Unmount() {
-	fileSystem := uintptr(unsafe.Pointer(f.fileSystem))
-	_, _, _ = stopDispatcher.Call(fileSystem)
-	_, _, _ = fileSystemDelete.Call(fileSystem)
+	_ = f.UnmountContext(context.Background())
 }
 
 // loadWinFSPDLL attempts to locate and load the DLL, the
@@ -1579,6 +2475,15 @@ func loadWinFSPDLL() (*syscall.DLL, error) {
 		return nil, errors.Errorf(
 			"winfsp unsupported arch %q", runtime.GOARCH)
 	}
+	dllPath, appDir := settleDLLPolicy()
+	if dllPath != "" {
+		return loadDLLFromPath(dllPath, dllName)
+	}
+	if appDir {
+		if dll := loadDLLFromAppDir(dllName); dll != nil {
+			return dll, nil
+		}
+	}
 	dll, _ := syscall.LoadDLL(dllName)
 	if dll != nil {
 		return dll, nil
@@ -1605,14 +2510,24 @@ func loadWinFSPDLL() (*syscall.DLL, error) {
 	if err != nil {
 		return nil, findInstallError(err)
 	}
-	var pathBuf [syscall.MAX_PATH]uint16
+	// The install directory might be longer than MAX_PATH, so
+	// the buffer is grown until the value fits into it.
+	pathBuf := make([]uint16, syscall.MAX_PATH)
 	var valueType, valueSize uint32
-	valueSize = uint32(len(pathBuf)) * SIZEOF_WCHAR
-	if err := syscall.RegQueryValueEx(
-		keyReg, valueName, nil, &valueType,
-		(*byte)(unsafe.Pointer(&pathBuf)), &valueSize,
-	); err != nil {
-		return nil, findInstallError(err)
+	for {
+		valueSize = uint32(len(pathBuf)) * SIZEOF_WCHAR
+		err := syscall.RegQueryValueEx(
+			keyReg, valueName, nil, &valueType,
+			(*byte)(unsafe.Pointer(&pathBuf[0])), &valueSize,
+		)
+		if err == syscall.ERROR_MORE_DATA {
+			pathBuf = make([]uint16, (valueSize+1)/SIZEOF_WCHAR+1)
+			continue
+		}
+		if err != nil {
+			return nil, findInstallError(err)
+		}
+		break
 	}
 	if valueType != syscall.REG_SZ {
 		return nil, findInstallError(syscall.ERROR_MOD_NOT_FOUND)
@@ -1642,6 +2557,16 @@ func findProc(name string, target **syscall.Proc) error {
 	return nil
 }
 
+// callNTStatus invokes the proc returning NTSTATUS, and
+// converts the unsuccessful status into error.
+func callNTStatus(proc *syscall.Proc, args ...uintptr) error {
+	result, _, _ := proc.Call(args...)
+	if status := windows.NTStatus(result); status != windows.STATUS_SUCCESS {
+		return status
+	}
+	return nil
+}
+
 func loadProcs(procs map[string]**syscall.Proc) error {
 	for name, proc := range procs {
 		if err := findProc(name, proc); err != nil {
@@ -1651,24 +2576,64 @@ func loadProcs(procs map[string]**syscall.Proc) error {
 	return nil
 }
 
+func loadOptionalProcs(procs map[string]**syscall.Proc) {
+	for name, proc := range procs {
+		_ = findProc(name, proc)
+	}
+}
+
 func initWinFSP() error {
 	dll, err := loadWinFSPDLL()
 	if err != nil {
 		return err
 	}
 	winFSPDLL = dll
-	return loadProcs(map[string]**syscall.Proc{
+	if err := loadProcs(map[string]**syscall.Proc{
 		"FspFileSystemDeleteDirectoryBuffer":  &deleteDirectoryBuffer,
 		"FspFileSystemAcquireDirectoryBuffer": &acquireDirectoryBuffer,
 		"FspFileSystemReleaseDirectoryBuffer": &releaseDirectoryBuffer,
 		"FspFileSystemReadDirectoryBuffer":    &readDirectoryBuffer,
 		"FspFileSystemFillDirectoryBuffer":    &fillDirectoryBuffer,
+		"FspFileSystemAddStreamInfo":          &addStreamInfo,
+		"FspFileSystemAddDirInfo":             &addDirInfo,
+		"FspFileSystemResolveReparsePoints":   &resolveReparsePoints,
+		"FspFileSystemFindReparsePoint":       &findReparsePoint,
+		"FspFileSystemSendResponse":           &sendResponse,
+		"FspAccessCheckEx":                    &accessCheckEx,
+		"FspCreateSecurityDescriptor":         &createSecurityDescriptor,
 		"FspFileSystemCreate":                 &fileSystemCreate,
+		"FspDebugLogSetHandle":                &debugLogSetHandle,
 		"FspFileSystemDelete":                 &fileSystemDelete,
 		"FspFileSystemSetMountPoint":          &setMountPoint,
+		"FspFileSystemRemoveMountPoint":       &removeMountPoint,
 		"FspFileSystemStartDispatcher":        &startDispatcher,
 		"FspFileSystemStopDispatcher":         &stopDispatcher,
+		"FspFileSystemGetOperationContext":    &getOperationContext,
+		"FspPosixMapUidToSid":                 &posixMapUidToSid,
+		"FspDeleteSid":                        &deleteSid,
+		"FspPosixDeletePath":                  &posixDeletePath,
+		"FspServiceRun":                       &serviceRun,
+		"FspServiceStop":                      &serviceStop,
+		"FspDeleteSecurityDescriptor":         &deleteSecurityDescriptor,
+
+		"FspPosixMapPermissionsToSecurityDescriptor": &posixMapPermissionsToSecurityDescriptor,
+	}); err != nil {
+		return err
+	}
+	// The optional procs are missing from the older releases
+	// of WinFSP, whose absence is probed by the callers.
+	loadOptionalProcs(map[string]**syscall.Proc{
+		"FspVersion":                      &fspVersion,
+		"FspFileSystemSetMountPointEx":    &setMountPointEx,
+		"FspNtStatusFromWin32":            &ntStatusFromWin32,
+		"FspWin32FromNtStatus":            &win32FromNtStatus,
+		"FspFileSystemNotifyBegin":        &notifyBegin,
+		"FspFileSystemNotifyEnd":          &notifyEnd,
+		"FspFileSystemNotify":             &notify,
+		"FspPosixMapWindowsToPosixPathEx": &posixMapWindowsToPosixPathEx,
+		"FspPosixMapPosixToWindowsPathEx": &posixMapPosixToWindowsPathEx,
 	})
+	return nil
 }
 
 var (
@@ -1684,3 +2649,17 @@ func tryLoadWinFSP() error {
 	})
 	return tryLoadErr
 }
+
+// LoadProc loads the WinFSP DLL and finds the proc inside,
+// so that the APIs not bound by this package, e.g. those of
+// the launcher, can be invoked by the other packages.
+func LoadProc(name string) (*syscall.Proc, error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return nil, err
+	}
+	var proc *syscall.Proc
+	if err := findProc(name, &proc); err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
@@ -0,0 +1,246 @@
+package winfsp
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+// delegateTestRef registers the file system ref bound to the
+// behaviours, returning the FSP_FILE_SYSTEM address which is
+// passed to the delegates by WinFSP.
+func delegateTestRef(t *testing.T, fs BehaviourBase) (*FileSystemRef, uintptr) {
+	t.Helper()
+	ref := &FileSystemRef{fileSystemOps: &FSP_FILE_SYSTEM_INTERFACE{}}
+	current := newBehaviourSet()
+	current.bind(fs, ref.fileSystemOps)
+	ref.current.Store(current)
+	handle, err := refMap.register(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { refMap.unregister(handle) })
+	fileSystem := &FSP_FILE_SYSTEM{UserContext: handle}
+	ref.fileSystem = fileSystem
+	return ref, uintptr(unsafe.Pointer(fileSystem))
+}
+
+type ioctlBase struct{ swapBase }
+
+func (ioctlBase) DeviceIoControl(
+	fs *FileSystemRef, file uintptr,
+	code uint32, data []byte,
+) ([]byte, error) {
+	return append([]byte(nil), data...), nil
+}
+
+func TestDeviceIoControl(t *testing.T) {
+	assert := assert.New(t)
+	_, fileSystem := delegateTestRef(t, ioctlBase{})
+	input := []byte("reply")
+	call := func(output []byte) (windows.NTStatus, []byte) {
+		var written uint32
+		var outputAddr uintptr
+		if len(output) > 0 {
+			outputAddr = uintptr(unsafe.Pointer(&output[0]))
+		}
+		status := delegateDeviceIoControl(fileSystem, 1, 0,
+			uintptr(unsafe.Pointer(&input[0])), uint32(len(input)),
+			outputAddr, uint32(len(output)), &written)
+		return status, output[:written]
+	}
+
+	// The reply shorter than the output buffer is complete.
+	status, output := call(make([]byte, 16))
+	assert.Equal(windows.STATUS_SUCCESS, status)
+	assert.Equal(input, output)
+	status, output = call(make([]byte, len(input)))
+	assert.Equal(windows.STATUS_SUCCESS, status)
+	assert.Equal(input, output)
+
+	// The reply longer than the output buffer is truncated.
+	status, output = call(make([]byte, 2))
+	assert.Equal(windows.STATUS_BUFFER_OVERFLOW, status)
+	assert.Equal(input[:2], output)
+}
+
+type blockingFlush struct {
+	swapBase
+	entered chan uintptr
+	release chan struct{}
+}
+
+func (b blockingFlush) Flush(
+	fs *FileSystemRef, file uintptr, info *FSP_FSCTL_FILE_INFO,
+) error {
+	b.entered <- file
+	<-b.release
+	return nil
+}
+
+func TestSerializePerFile(t *testing.T) {
+	assert := assert.New(t)
+	fs := blockingFlush{
+		entered: make(chan uintptr),
+		release: make(chan struct{}),
+	}
+	ref, fileSystem := delegateTestRef(t, fs)
+	ref.serializePerFile = true
+	done := make(chan windows.NTStatus)
+	flush := func(file uintptr) {
+		go func() { done <- delegateFlush(fileSystem, file, 0) }()
+	}
+	flush(1)
+	assert.Equal(uintptr(1), <-fs.entered)
+
+	// The operation on the same file waits for the former one,
+	// while the operation on another file is not blocked.
+	flush(1)
+	flush(2)
+	assert.Equal(uintptr(2), <-fs.entered)
+	select {
+	case file := <-fs.entered:
+		t.Fatalf("file %d entered concurrently", file)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fs.release <- struct{}{}
+	fs.release <- struct{}{}
+	assert.Equal(uintptr(1), <-fs.entered)
+	fs.release <- struct{}{}
+	for i := 0; i < 3; i++ {
+		assert.Equal(windows.STATUS_SUCCESS, <-done)
+	}
+
+	// The lock is dropped with the file context.
+	ref.releaseFile(1)
+	ref.releaseFile(2)
+	_, ok := ref.fileLocks.Load(uintptr(1))
+	assert.False(ok)
+}
+
+type overwriteBase struct {
+	swapBase
+	ea       chan []byte
+	attrs    chan uint32
+	replaced chan bool
+}
+
+func (b overwriteBase) Overwrite(
+	fs *FileSystemRef, file uintptr,
+	attributes uint32, replaceAttributes bool,
+	allocationSize uint64,
+	info *FSP_FSCTL_FILE_INFO,
+) error {
+	return windows.STATUS_INVALID_DEVICE_REQUEST
+}
+
+func (b overwriteBase) OverwriteEx(
+	fs *FileSystemRef, file uintptr,
+	attributes uint32, replaceAttributes bool,
+	allocationSize uint64,
+	extendedAttribute *FILE_FULL_EA_INFORMATION,
+	extendedAttributeLength uint32,
+	info *FSP_FSCTL_FILE_INFO,
+) error {
+	var ea []byte
+	if extendedAttribute != nil {
+		ea = append(ea, unsafe.Slice((*byte)(unsafe.Pointer(
+			extendedAttribute)), extendedAttributeLength)...)
+	}
+	b.attrs <- attributes
+	b.replaced <- replaceAttributes
+	b.ea <- ea
+	return nil
+}
+
+func TestOverwriteEx(t *testing.T) {
+	assert := assert.New(t)
+	fs := overwriteBase{
+		ea:       make(chan []byte, 1),
+		attrs:    make(chan uint32, 1),
+		replaced: make(chan bool, 1),
+	}
+	ref, fileSystem := delegateTestRef(t, fs)
+
+	// The OverwriteEx is prioritized over the Overwrite.
+	assert.NotZero(ref.fileSystemOps.OverwriteEx)
+	assert.Zero(ref.fileSystemOps.Overwrite)
+
+	// The EA buffer is passed through to the file system.
+	buf := make([]byte, 16)
+	ea := (*FILE_FULL_EA_INFORMATION)(unsafe.Pointer(&buf[0]))
+	ea.EaNameLength = 1
+	ea.EaValueLength = 1
+	copy(buf[8:], "a\x00b")
+	var info FSP_FSCTL_FILE_INFO
+	assert.Equal(windows.STATUS_SUCCESS, delegateOverwriteEx(
+		fileSystem, 1, windows.FILE_ATTRIBUTE_HIDDEN, 1, 0,
+		uintptr(unsafe.Pointer(&buf[0])), 11,
+		uintptr(unsafe.Pointer(&info))))
+	assert.Equal(uint32(windows.FILE_ATTRIBUTE_HIDDEN), <-fs.attrs)
+	assert.True(<-fs.replaced)
+	assert.Equal(buf[:11], <-fs.ea)
+
+	// The EA buffer is nil when the caller carries none.
+	assert.Equal(windows.STATUS_SUCCESS, delegateOverwriteEx(
+		fileSystem, 1, 0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&info))))
+	assert.Zero(<-fs.attrs)
+	assert.False(<-fs.replaced)
+	assert.Nil(<-fs.ea)
+}
+
+type setDeleteBase struct {
+	swapBase
+	names   chan string
+	deletes chan bool
+}
+
+func (b setDeleteBase) SetDelete(
+	fs *FileSystemRef, file uintptr, name string,
+	deleteFile bool,
+) error {
+	b.names <- name
+	b.deletes <- deleteFile
+	if name == `\busy` {
+		return windows.STATUS_DIRECTORY_NOT_EMPTY
+	}
+	return nil
+}
+
+func TestSetDelete(t *testing.T) {
+	assert := assert.New(t)
+	fs := setDeleteBase{
+		names:   make(chan string, 1),
+		deletes: make(chan bool, 1),
+	}
+	var ops FSP_FILE_SYSTEM_INTERFACE
+	attributes := newBehaviourSet().bind(fs, &ops)
+	assert.NotZero(ops.SetDelete)
+	assert.NotZero(attributes & FspFSAttributePostDispositionWhenNecessaryOnly)
+	attributes = newBehaviourSet().bind(swapBase{}, &ops)
+	assert.Zero(attributes & FspFSAttributePostDispositionWhenNecessaryOnly)
+
+	// The disposition is both set and cleared by SetDelete.
+	_, fileSystem := delegateTestRef(t, fs)
+	name, err := windows.UTF16PtrFromString(`\file`)
+	assert.NoError(err)
+	assert.Equal(windows.STATUS_SUCCESS, delegateSetDelete(
+		fileSystem, 1, uintptr(unsafe.Pointer(name)), 1))
+	assert.Equal(`\file`, <-fs.names)
+	assert.True(<-fs.deletes)
+	assert.Equal(windows.STATUS_SUCCESS, delegateSetDelete(
+		fileSystem, 1, uintptr(unsafe.Pointer(name)), 0))
+	assert.Equal(`\file`, <-fs.names)
+	assert.False(<-fs.deletes)
+
+	name, err = windows.UTF16PtrFromString(`\busy`)
+	assert.NoError(err)
+	assert.Equal(windows.STATUS_DIRECTORY_NOT_EMPTY, delegateSetDelete(
+		fileSystem, 2, uintptr(unsafe.Pointer(name)), 1))
+	<-fs.names
+	<-fs.deletes
+}
@@ -0,0 +1,34 @@
+package winfsp
+
+// ContentInspector inspects the content of files while
+// they are being read or written, and is able to veto the
+// operation by returning an error.
+//
+// The name is the one the file is opened or lastly renamed
+// to. The offset is meaningless when the data is appended
+// to the end of file.
+type ContentInspector interface {
+	// InspectRead is called with the data read from the
+	// file before returning it to the caller. The data
+	// might be modified in place for redaction.
+	InspectRead(
+		fs *FileSystemRef, name string,
+		offset uint64, data []byte,
+	) error
+
+	// InspectWrite is called with the data to write into
+	// the file before passing it to BehaviourWrite. The
+	// data must not be modified.
+	InspectWrite(
+		fs *FileSystemRef, name string,
+		offset uint64, data []byte,
+	) error
+}
+
+// InspectContent installs the content inspector which is
+// called on every read and write operation.
+func InspectContent(inspector ContentInspector) Option {
+	return func(o *option) {
+		o.inspector = inspector
+	}
+}
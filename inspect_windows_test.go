@@ -0,0 +1,87 @@
+package winfsp
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+type contentBase struct {
+	swapBase
+	data *[]byte
+}
+
+func (b contentBase) Read(
+	fs *FileSystemRef, file uintptr, buf []byte, offset uint64,
+) (int, error) {
+	return copy(buf, (*b.data)[offset:]), nil
+}
+
+func (b contentBase) Write(
+	fs *FileSystemRef, file uintptr, buf []byte, offset uint64,
+	writeToEndOfFile, constrainedIo bool,
+	info *FSP_FSCTL_FILE_INFO,
+) (int, error) {
+	*b.data = append((*b.data)[:offset], buf...)
+	return len(buf), nil
+}
+
+type redactInspector struct {
+	names []string
+}
+
+func (r *redactInspector) InspectRead(
+	fs *FileSystemRef, name string, offset uint64, data []byte,
+) error {
+	r.names = append(r.names, name)
+	copy(data, bytes.ReplaceAll(data, []byte("secret"), []byte("******")))
+	return nil
+}
+
+func (r *redactInspector) InspectWrite(
+	fs *FileSystemRef, name string, offset uint64, data []byte,
+) error {
+	r.names = append(r.names, name)
+	if bytes.Contains(data, []byte("virus")) {
+		return windows.STATUS_VIRUS_INFECTED
+	}
+	return nil
+}
+
+func TestInspectContent(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte("the secret")
+	ref, fileSystem := delegateTestRef(t, contentBase{data: &data})
+	inspector := &redactInspector{}
+	ref.inspector = inspector
+	ref.trackNames = true
+	ref.trackFileName(1, `\file.txt`)
+	write := func(content string) windows.NTStatus {
+		var written uint32
+		var info FSP_FSCTL_FILE_INFO
+		buf := []byte(content)
+		return delegateWrite(fileSystem, 1,
+			uintptr(unsafe.Pointer(&buf[0])), 4, uint32(len(buf)),
+			0, 0, &written, uintptr(unsafe.Pointer(&info)))
+	}
+
+	// The data read is redacted before returning to caller,
+	// while the backing data is left untouched.
+	buf := make([]byte, 16)
+	var read uint32
+	assert.Equal(windows.STATUS_SUCCESS, delegateRead(fileSystem, 1,
+		uintptr(unsafe.Pointer(&buf[0])), 0, uint32(len(buf)), &read))
+	assert.Equal("the ******", string(buf[:read]))
+	assert.Equal("the secret", string(data))
+
+	// The vetoed writes never reach the behaviours.
+	assert.Equal(windows.STATUS_VIRUS_INFECTED, write("virus"))
+	assert.Equal("the secret", string(data))
+	assert.Equal(windows.STATUS_SUCCESS, write("note"))
+	assert.Equal("the note", string(data))
+	assert.Equal([]string{`\file.txt`, `\file.txt`, `\file.txt`},
+		inspector.names)
+}
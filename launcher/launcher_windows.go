@@ -0,0 +1,237 @@
+package launcher
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+)
+
+// Command is the command sent to the launcher pipe.
+type Command uint32
+
+const (
+	CmdStart           Command = 'S'
+	CmdStartWithSecret Command = 'X'
+	CmdStop            Command = 'T'
+	CmdGetInfo         Command = 'I'
+	CmdGetNameList     Command = 'L'
+	CmdDefineDosDevice Command = 'D'
+	CmdQuit            Command = 'Q'
+)
+
+// bufferSize is the size of the response buffer, which is
+// the maximum size of the launcher pipe transaction.
+const bufferSize = 4096
+
+var (
+	loadOnce         sync.Once
+	loadErr          error
+	callLauncherPipe *syscall.Proc
+	launchStart      *syscall.Proc
+	launchStop       *syscall.Proc
+	launchGetInfo    *syscall.Proc
+	launchGetNames   *syscall.Proc
+)
+
+func load() error {
+	loadOnce.Do(func() {
+		for name, target := range map[string]**syscall.Proc{
+			"FspLaunchCallLauncherPipe": &callLauncherPipe,
+			"FspLaunchStart":            &launchStart,
+			"FspLaunchStop":             &launchStop,
+			"FspLaunchGetInfo":          &launchGetInfo,
+			"FspLaunchGetNameList":      &launchGetNames,
+		} {
+			proc, err := winfsp.LoadProc(name)
+			if err != nil {
+				loadErr = err
+				return
+			}
+			*target = proc
+		}
+	})
+	return loadErr
+}
+
+// call invokes the launcher API, converting both the status
+// of the transaction and the error of the launcher.
+func call(proc *syscall.Proc, args ...uintptr) error {
+	var launcherError uint32
+	args = append(args, uintptr(unsafe.Pointer(&launcherError)))
+	result, _, _ := proc.Call(args...)
+	if status := windows.NTStatus(result); status != windows.STATUS_SUCCESS {
+		return status
+	}
+	if launcherError != 0 {
+		return syscall.Errno(launcherError)
+	}
+	return nil
+}
+
+// utf16Args converts the arguments into the argument vector.
+func utf16Args(args []string) ([]*uint16, error) {
+	var result []*uint16
+	for _, arg := range args {
+		ptr, err := windows.UTF16PtrFromString(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "argument %q", arg)
+		}
+		result = append(result, ptr)
+	}
+	return result, nil
+}
+
+func argvPtr(argv []*uint16) uintptr {
+	if len(argv) == 0 {
+		return 0
+	}
+	return uintptr(unsafe.Pointer(&argv[0]))
+}
+
+// splitResponse splits the NUL separated strings of the
+// response, whose size is in bytes.
+func splitResponse(buf []uint16, size uint32) []string {
+	text := string(utf16.Decode(buf[:size/2]))
+	text = strings.TrimRight(text, "\x00")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\x00")
+}
+
+// CallLauncherPipe sends the command with the arguments to
+// the launcher, returning the NUL separated strings of the
+// response.
+func CallLauncherPipe(command Command, args []string) ([]string, error) {
+	if err := load(); err != nil {
+		return nil, err
+	}
+	argv, err := utf16Args(args)
+	if err != nil {
+		return nil, err
+	}
+	argl := make([]uint32, len(argv))
+	for i, arg := range argv {
+		argl[i] = uint32(len(windows.UTF16PtrToString(arg)))
+	}
+	var arglPtr uintptr
+	if len(argl) > 0 {
+		arglPtr = uintptr(unsafe.Pointer(&argl[0]))
+	}
+	buf := make([]uint16, bufferSize/2)
+	size := uint32(bufferSize)
+	if err := call(callLauncherPipe,
+		uintptr(command), uintptr(len(argv)), argvPtr(argv), arglPtr,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	); err != nil {
+		return nil, errors.Wrapf(err, "launcher command %q", rune(command))
+	}
+	return splitResponse(buf, size), nil
+}
+
+// Start starts the instance of the file system class with
+// the arguments. When hasSecret is true, the last argument
+// is a secret, e.g. the password, which is passed to the
+// file system through its standard input instead.
+func Start(
+	className, instanceName string, args []string, hasSecret bool,
+) error {
+	if err := load(); err != nil {
+		return err
+	}
+	names, err := utf16Args([]string{className, instanceName})
+	if err != nil {
+		return err
+	}
+	argv, err := utf16Args(args)
+	if err != nil {
+		return err
+	}
+	var hasSecretVal uintptr
+	if hasSecret {
+		hasSecretVal = 1
+	}
+	return errors.Wrapf(call(launchStart,
+		uintptr(unsafe.Pointer(names[0])),
+		uintptr(unsafe.Pointer(names[1])),
+		uintptr(len(argv)), argvPtr(argv), hasSecretVal,
+	), "launcher start %s\\%s", className, instanceName)
+}
+
+// Stop stops the instance of the file system class.
+func Stop(className, instanceName string) error {
+	if err := load(); err != nil {
+		return err
+	}
+	names, err := utf16Args([]string{className, instanceName})
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(call(launchStop,
+		uintptr(unsafe.Pointer(names[0])),
+		uintptr(unsafe.Pointer(names[1])),
+	), "launcher stop %s\\%s", className, instanceName)
+}
+
+// GetInfo retrieves the information of the instance of the
+// file system class, which are the class name, the instance
+// name and the arguments it is started with.
+func GetInfo(className, instanceName string) ([]string, error) {
+	if err := load(); err != nil {
+		return nil, err
+	}
+	names, err := utf16Args([]string{className, instanceName})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]uint16, bufferSize/2)
+	size := uint32(bufferSize)
+	if err := call(launchGetInfo,
+		uintptr(unsafe.Pointer(names[0])),
+		uintptr(unsafe.Pointer(names[1])),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	); err != nil {
+		return nil, errors.Wrapf(err,
+			"launcher get info %s\\%s", className, instanceName)
+	}
+	return splitResponse(buf, size), nil
+}
+
+// Instance identifies a running instance of the launcher.
+type Instance struct {
+	ClassName    string
+	InstanceName string
+}
+
+// List lists the running instances of the launcher.
+func List() ([]Instance, error) {
+	if err := load(); err != nil {
+		return nil, err
+	}
+	buf := make([]uint16, bufferSize/2)
+	size := uint32(bufferSize)
+	if err := call(launchGetNames,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	); err != nil {
+		return nil, errors.Wrap(err, "launcher get name list")
+	}
+	names := splitResponse(buf, size)
+	var result []Instance
+	for i := 0; i+1 < len(names); i += 2 {
+		result = append(result, Instance{
+			ClassName:    names[i],
+			InstanceName: names[i+1],
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,16 @@
+package launcher
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitResponse(t *testing.T) {
+	assert := assert.New(t)
+	buf := utf16.Encode([]rune("memfs\x00inst\x00-m\x00X:\x00\x00garbage"))
+	assert.Equal([]string{"memfs", "inst", "-m", "X:"},
+		splitResponse(buf, uint32(2*len("memfs\x00inst\x00-m\x00X:\x00"))))
+	assert.Nil(splitResponse(buf, 0))
+}
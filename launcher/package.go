@@ -0,0 +1,13 @@
+// Package launcher is the binding of the WinFSP launcher
+// API, with which the file systems registered with the
+// launcher service can be started, stopped and queried.
+//
+// The file systems are registered with the launcher under
+// the registry key HKLM\SOFTWARE\WinFsp\Services, where the
+// key name is the class name, and each running file system
+// is identified by the class name and its instance name.
+// The launcher starts the registered executable with the
+// arguments supplied here, which enables mounting the file
+// systems on demand and per user, e.g. through the network
+// provider of WinFSP.
+package launcher
@@ -0,0 +1,303 @@
+package winfsp
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// ConcurrencyLimit caps the number of behaviour invocations
+// executing at the same time, protecting the backends with
+// strict connection limits from being overwhelmed when the
+// driver dispatches many requests at once. The invocations
+// exceeding the limit wait in the dispatcher threads until
+// the others complete, and the invocations completed
+// asynchronously hold their slots until they are completed.
+//
+// The time spent waiting is not counted in the duration of
+// the operation records.
+func ConcurrencyLimit(limit int) Option {
+	return func(o *option) {
+		o.concurrencyLimit = limit
+	}
+}
+
+// KindConcurrencyLimit caps the number of invocations of the
+// behaviour of the kind, which is the name of the behaviour's
+// method, e.g. "Read". It is applied in addition to the limit
+// set by ConcurrencyLimit.
+func KindConcurrencyLimit(kind string, limit int) Option {
+	return func(o *option) {
+		if o.kindConcurrencyLimits == nil {
+			o.kindConcurrencyLimits = make(map[string]int)
+		}
+		o.kindConcurrencyLimits[kind] = limit
+	}
+}
+
+// concurrencyLimiter is the semaphores limiting invocations.
+type concurrencyLimiter struct {
+	global chan struct{}
+	kinds  map[string]chan struct{}
+}
+
+func newConcurrencyLimiter(
+	global int, kinds map[string]int,
+) *concurrencyLimiter {
+	limiter := &concurrencyLimiter{
+		kinds: make(map[string]chan struct{}),
+	}
+	if global > 0 {
+		limiter.global = make(chan struct{}, global)
+	}
+	for kind, limit := range kinds {
+		if limit > 0 {
+			limiter.kinds[kind] = make(chan struct{}, limit)
+		}
+	}
+	if limiter.global == nil && len(limiter.kinds) == 0 {
+		return nil
+	}
+	return limiter
+}
+
+// acquire waits for the slots of the kind, the slot of the
+// kind is acquired first so that the invocations waiting for
+// their kinds won't occupy the global slots.
+func (l *concurrencyLimiter) acquire(kind string) {
+	if sem := l.kinds[kind]; sem != nil {
+		sem <- struct{}{}
+	}
+	if l.global != nil {
+		l.global <- struct{}{}
+	}
+}
+
+func (l *concurrencyLimiter) release(kind string) {
+	if l.global != nil {
+		<-l.global
+	}
+	if sem := l.kinds[kind]; sem != nil {
+		<-sem
+	}
+}
+
+// OperationDeadline bounds the time of each behaviour
+// invocation. The context returned by Operation carries the
+// deadline, and the failures of the invocations overrunning
+// the deadline are reported as STATUS_IO_TIMEOUT, so that
+// the callers see a timeout instead of whatever error the
+// interrupted backend returns.
+//
+// The bounded Read and ReadDirectory are run on other
+// goroutines and completed asynchronously, so that they are
+// replied with STATUS_IO_TIMEOUT once the deadline fires, even
+// if the backend hangs, and the dispatcher thread is never
+// pinned. Their buffers are copied, the per file serialization
+// no longer applies to them, and the behaviours must not call
+// BeginAsync for them. The other behaviours, including Write,
+// are only released when they return, so they must honor the
+// context for the deadline to protect the dispatcher from a
+// hung backend. Write is never abandoned this way, since the
+// data might still be written after the timeout is replied.
+// The Read and ReadDirectory replied with timeout still hold
+// their slots of the ConcurrencyLimit until they return, so
+// the limit also caps the goroutines and buffers held by the
+// hung backend.
+//
+// The time spent waiting for the ConcurrencyLimit is not
+// counted towards the deadline.
+func OperationDeadline(timeout time.Duration) Option {
+	return func(o *option) {
+		o.operationDeadline = timeout
+	}
+}
+
+// KindOperationDeadline bounds the time of the invocations
+// of the behaviour of the kind, overriding the deadline set
+// by OperationDeadline for the kind.
+func KindOperationDeadline(kind string, timeout time.Duration) Option {
+	return func(o *option) {
+		if o.kindOperationDeadlines == nil {
+			o.kindOperationDeadlines = make(map[string]time.Duration)
+		}
+		o.kindOperationDeadlines[kind] = timeout
+	}
+}
+
+// deadlineEnforcer tracks the contexts of the invocations
+// with deadlines, keyed by the threads running them.
+type deadlineEnforcer struct {
+	global  time.Duration
+	kinds   map[string]time.Duration
+	running sync.Map
+}
+
+// deadlineContext is the context of an invocation.
+type deadlineContext struct {
+	context.Context
+	cancel context.CancelFunc
+}
+
+func newDeadlineEnforcer(
+	global time.Duration, kinds map[string]time.Duration,
+) *deadlineEnforcer {
+	enforcer := &deadlineEnforcer{
+		global: global,
+		kinds:  make(map[string]time.Duration),
+	}
+	for kind, timeout := range kinds {
+		enforcer.kinds[kind] = timeout
+	}
+	if global <= 0 && len(enforcer.kinds) == 0 {
+		return nil
+	}
+	return enforcer
+}
+
+func (d *deadlineEnforcer) timeout(kind string) time.Duration {
+	if timeout, ok := d.kinds[kind]; ok {
+		return timeout
+	}
+	return d.global
+}
+
+// begin starts the deadline of the invocation on current
+// thread, returning nil when the kind is not bounded.
+func (d *deadlineEnforcer) begin(
+	parent context.Context, kind string,
+) *deadlineContext {
+	timeout := d.timeout(kind)
+	if timeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	result := &deadlineContext{Context: ctx, cancel: cancel}
+	d.running.Store(windows.GetCurrentThreadId(), result)
+	return result
+}
+
+// end stops the deadline of the invocation, converting the
+// failure of the overrunning invocation into a timeout.
+func (d *deadlineEnforcer) end(
+	ctx *deadlineContext, status *windows.NTStatus,
+) {
+	d.running.Delete(windows.GetCurrentThreadId())
+	defer ctx.cancel()
+	if status == nil || *status == windows.STATUS_SUCCESS ||
+		*status == windows.STATUS_PENDING {
+		return
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		*status = windows.STATUS_IO_TIMEOUT
+	}
+}
+
+// context returns the context of the invocation on current
+// thread, or nil if there's none.
+func (d *deadlineEnforcer) context() context.Context {
+	if d == nil {
+		return nil
+	}
+	value, ok := d.running.Load(windows.GetCurrentThreadId())
+	if !ok {
+		return nil
+	}
+	return value.(*deadlineContext)
+}
+
+// deadlineRequest is the request bounded by the deadline,
+// which is completed by either the behaviour or the deadline,
+// whichever comes first.
+type deadlineRequest struct {
+	mtx       sync.Mutex
+	request   AsyncRequest
+	completed bool
+}
+
+// complete completes the request unless it has been done,
+// and the commit is invoked right before responding, e.g. to
+// copy the data into the buffer of the request, which is only
+// valid until the request is completed.
+func (r *deadlineRequest) complete(
+	ref *FileSystemRef, n int, err error, commit func(),
+) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.completed {
+		return
+	}
+	r.completed = true
+	if commit != nil {
+		commit()
+	}
+	_ = ref.CompleteAsync(r.request, n, nil, err)
+}
+
+// runDeadline runs the invocation bounded by the deadline of
+// the operation on another goroutine, completing the request
+// asynchronously with its result, or STATUS_IO_TIMEOUT when
+// the deadline fires first. The invocation must only access
+// the buffers owned by itself, and the commit is invoked with
+// its result to hand them over to the request.
+//
+// It returns false when the request cannot be completed
+// asynchronously, and the invocation must be run in place.
+func (ref *FileSystemRef) runDeadline(
+	op *Operation,
+	run func() (int, error),
+	commit func(n int),
+) (windows.NTStatus, bool) {
+	request, err := ref.BeginAsync()
+	if err != nil {
+		return 0, false
+	}
+	ref.startDeadline(op, request, run, commit)
+	return windows.STATUS_PENDING, true
+}
+
+// startDeadline runs the invocation of the request begun by
+// runDeadline. The slot of the ConcurrencyLimit is detached
+// from the operation and released once the invocation returns,
+// instead of when the request is completed, so that the hung
+// invocations replied with timeout are still capped.
+func (ref *FileSystemRef) startDeadline(
+	op *Operation, request AsyncRequest,
+	run func() (int, error),
+	commit func(n int),
+) {
+	ctx := op.deadline
+	op.deadline = nil
+	op.detached = true
+	ref.deadlines.running.Delete(windows.GetCurrentThreadId())
+	pending := &deadlineRequest{request: request}
+	go func() {
+		<-ctx.Done()
+		pending.complete(ref, 0, windows.STATUS_IO_TIMEOUT, nil)
+	}()
+	go func() {
+		if ref.limiter != nil {
+			defer ref.limiter.release(op.Kind)
+		}
+		defer ctx.cancel()
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		thread := windows.GetCurrentThreadId()
+		ref.deadlines.running.Store(thread, ctx)
+		defer ref.deadlines.running.Delete(thread)
+		if ref.recoverPanic {
+			defer func() {
+				if value := recover(); value != nil {
+					pending.complete(ref, 0,
+						windows.STATUS_INTERNAL_ERROR, nil)
+					ref.handlePanic(nil, value)
+				}
+			}()
+		}
+		n, err := run()
+		pending.complete(ref, n, err, func() { commit(n) })
+	}()
+}
@@ -0,0 +1,187 @@
+package winfsp
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newConcurrencyLimiter(0, map[string]int{"Read": 0}))
+	limiter := newConcurrencyLimiter(3, map[string]int{"Read": 2})
+
+	var running, reads, maxRunning, maxReads int64
+	update := func(max *int64, value int64) {
+		for {
+			old := atomic.LoadInt64(max)
+			if value <= old || atomic.CompareAndSwapInt64(max, old, value) {
+				return
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		kind := "Read"
+		if i%2 == 0 {
+			kind = "Write"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.acquire(kind)
+			defer limiter.release(kind)
+			update(&maxRunning, atomic.AddInt64(&running, 1))
+			defer atomic.AddInt64(&running, -1)
+			if kind == "Read" {
+				update(&maxReads, atomic.AddInt64(&reads, 1))
+				defer atomic.AddInt64(&reads, -1)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(maxRunning, int64(3))
+	assert.LessOrEqual(maxReads, int64(2))
+	assert.Len(limiter.global, 0)
+	assert.Len(limiter.kinds["Read"], 0)
+}
+
+func TestDeadlineEnforcer(t *testing.T) {
+	assert := assert.New(t)
+
+	// The invocations are tracked by their threads, which
+	// the dispatcher threads are in the callbacks.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	assert.Nil(newDeadlineEnforcer(0, nil))
+	var nilEnforcer *deadlineEnforcer
+	assert.Nil(nilEnforcer.context())
+
+	enforcer := newDeadlineEnforcer(time.Hour, map[string]time.Duration{
+		"Read": time.Millisecond, "Flush": 0,
+	})
+	assert.Nil(enforcer.begin(context.Background(), "Flush"))
+
+	// The failures of overrunning invocations are timeouts.
+	ctx := enforcer.begin(context.Background(), "Read")
+	assert.Equal(context.Context(ctx), enforcer.context())
+	<-enforcer.context().Done()
+	status := windows.STATUS_CANCELLED
+	enforcer.end(ctx, &status)
+	assert.Equal(windows.STATUS_IO_TIMEOUT, status)
+	assert.Nil(enforcer.context())
+
+	// The invocations succeeded late are left intact.
+	ctx = enforcer.begin(context.Background(), "Read")
+	<-ctx.Done()
+	status = windows.STATUS_SUCCESS
+	enforcer.end(ctx, &status)
+	assert.Equal(windows.STATUS_SUCCESS, status)
+
+	// The invocations within deadlines are left intact.
+	ctx = enforcer.begin(context.Background(), "Write")
+	status = windows.STATUS_ACCESS_DENIED
+	enforcer.end(ctx, &status)
+	assert.Equal(windows.STATUS_ACCESS_DENIED, status)
+	assert.Equal(context.Canceled, ctx.Err())
+}
+
+// hungWrite is the write hanging until the deadline of the
+// operation fires, counting the writes still running.
+type hungWrite struct {
+	swapBase
+	running *int32
+}
+
+func (w hungWrite) Write(
+	fs *FileSystemRef, file uintptr,
+	buf []byte, offset uint64,
+	writeToEndOfFile, constrainedIo bool,
+	info *FSP_FSCTL_FILE_INFO,
+) (int, error) {
+	atomic.AddInt32(w.running, 1)
+	defer atomic.AddInt32(w.running, -1)
+	ctx := fs.Operation()
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestOperationDeadlineWrite(t *testing.T) {
+	assert := assert.New(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var running int32
+	ref, fileSystem := instrumentedTestRef(t, hungWrite{running: &running})
+	ref.limiter = newConcurrencyLimiter(1, nil)
+	ref.deadlines = newDeadlineEnforcer(0, map[string]time.Duration{
+		"Write": 50 * time.Millisecond,
+	})
+
+	// The hung write is replied with timeout in place, so it
+	// is no longer running to apply the data after the reply,
+	// and its slot is released with the reply.
+	var written uint32
+	var info FSP_FSCTL_FILE_INFO
+	buf := []byte("content")
+	assert.Equal(windows.STATUS_IO_TIMEOUT, delegateWrite(fileSystem, 1,
+		uintptr(unsafe.Pointer(&buf[0])), 0, uint32(len(buf)),
+		0, 0, &written, uintptr(unsafe.Pointer(&info))))
+	assert.Zero(written)
+	assert.Zero(atomic.LoadInt32(&running))
+	assert.Len(ref.limiter.global, 0)
+}
+
+func TestOperationDeadlineDetached(t *testing.T) {
+	assert := assert.New(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	ref, _ := instrumentedTestRef(t, swapBase{})
+	ref.limiter = newConcurrencyLimiter(1, nil)
+	ref.deadlines = newDeadlineEnforcer(0, map[string]time.Duration{
+		"Read": 50 * time.Millisecond,
+	})
+
+	// The read hangs ignoring the context, and is replied
+	// with timeout while it still runs.
+	hung := make(chan struct{})
+	b, op := ref.beginOperationArgs("Read", 1, 0, 0, 0, 0)
+	request := AsyncRequest{
+		kind: FspFsctlTransactReadKind,
+		hint: 1,
+		hold: &asyncHold{},
+	}
+	ref.startDeadline(op, request, func() (int, error) {
+		<-hung
+		return 0, nil
+	}, func(int) {})
+	finished := make(chan struct{})
+	request.hold.attach(func(status windows.NTStatus) {
+		ref.finishOperation(b, op, status)
+		close(finished)
+	})
+	<-finished
+	assert.Equal(windows.STATUS_IO_TIMEOUT, op.Status)
+
+	// The slot is kept by the hung read, so no more reads
+	// could pile up behind it.
+	assert.Len(ref.limiter.global, 1)
+	select {
+	case ref.limiter.global <- struct{}{}:
+		t.Error("slot released before the read returns")
+		<-ref.limiter.global
+	default:
+	}
+	close(hung)
+	assert.Eventually(func() bool {
+		return len(ref.limiter.global) == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,154 @@
+package winfsp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// mountDirectory records a directory mount point, which is
+// a reparse point created by WinFSP under a NTFS volume.
+//
+// WinFSP requires the directory not to exist when it sets
+// the mount point, and removes it when the file system is
+// deleted. So an existing empty directory is removed before
+// mounting and restored after unmounting.
+type mountDirectory struct {
+	path    string
+	restore bool
+}
+
+// isDirectoryMountPoint tells whether the mount point is a
+// directory instead of a drive letter.
+func isDirectoryMountPoint(mountpoint string) bool {
+	if mountpoint == "" || mountpoint == AutoDriveLetter {
+		return false
+	}
+	_, ok := driveLetter(trimLongPathPrefix(mountpoint))
+	return !ok
+}
+
+// trimLongPathPrefix removes the \\?\ prefix of the path.
+func trimLongPathPrefix(path string) string {
+	return strings.TrimPrefix(path, `\\?\`)
+}
+
+// reparseFileSystems are the file systems supporting the
+// mount point reparse points.
+var reparseFileSystems = map[string]struct{}{
+	"NTFS": {},
+	"ReFS": {},
+}
+
+// volumeFileSystem retrieves the name of the file system
+// of the volume where the path resides.
+func volumeFileSystem(path string) (string, error) {
+	utf16Path, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	var volume [windows.MAX_PATH + 1]uint16
+	if err := windows.GetVolumePathName(
+		utf16Path, &volume[0], uint32(len(volume))); err != nil {
+		return "", errors.Wrapf(err, "get volume of %q", path)
+	}
+	var name [windows.MAX_PATH + 1]uint16
+	if err := windows.GetVolumeInformation(
+		&volume[0], nil, 0, nil, nil, nil,
+		&name[0], uint32(len(name))); err != nil {
+		return "", errors.Wrapf(err, "get volume information of %q", path)
+	}
+	return windows.UTF16ToString(name[:]), nil
+}
+
+// checkMountDirectory validates the directory mount point,
+// which must reside in a NTFS volume and must be either
+// absent or empty, returning its absolute path and whether
+// it exists.
+func checkMountDirectory(mountpoint string) (string, bool, error) {
+	path, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return "", false, errors.Wrapf(
+			err, "resolve mount point %q", mountpoint)
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return "", false, errors.Errorf(
+			"invalid mount point %q", mountpoint)
+	}
+	fsName, err := volumeFileSystem(parent)
+	if err != nil {
+		return "", false, err
+	}
+	if _, ok := reparseFileSystems[fsName]; !ok {
+		return "", false, errors.Errorf(
+			"mount point %q resides in unsupported %s volume",
+			mountpoint, fsName)
+	}
+	stat, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return path, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !stat.IsDir() {
+		return "", false, errors.Errorf(
+			"mount point %q is not a directory", mountpoint)
+	}
+	if err := checkEmptyDirectory(path); err != nil {
+		return "", false, err
+	}
+	return path, true, nil
+}
+
+// prepareMountDirectory validates the directory mount point
+// and removes it if it is an existing empty directory.
+func prepareMountDirectory(mountpoint string) (*mountDirectory, error) {
+	path, exists, err := checkMountDirectory(mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	result := &mountDirectory{path: path}
+	if !exists {
+		return result, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, errors.Wrapf(err, "remove mount point %q", mountpoint)
+	}
+	result.restore = true
+	return result, nil
+}
+
+// checkEmptyDirectory ensures the directory is empty.
+func checkEmptyDirectory(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dir.Close() }()
+	names, err := dir.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(names) > 0 {
+		return errors.Errorf("mount point %q is not empty", path)
+	}
+	return nil
+}
+
+// cleanup restores the mount point directory if it has been
+// removed before mounting.
+func (d *mountDirectory) cleanup() error {
+	if d == nil || !d.restore {
+		return nil
+	}
+	if err := os.Mkdir(d.path, 0o755); err != nil && !os.IsExist(err) {
+		return errors.Wrapf(err, "restore mount point %q", d.path)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package winfsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDirectoryMountPoint(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(isDirectoryMountPoint(""))
+	assert.False(isDirectoryMountPoint(AutoDriveLetter))
+	assert.False(isDirectoryMountPoint("X:"))
+	assert.False(isDirectoryMountPoint(`x:\`))
+	assert.False(isDirectoryMountPoint(`\\?\X:`))
+	assert.True(isDirectoryMountPoint(`C:\mnt\winfsp`))
+	assert.True(isDirectoryMountPoint(`mnt`))
+}
+
+func TestPrepareMountDirectory(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+
+	absent := filepath.Join(root, "absent")
+	dir, err := prepareMountDirectory(absent)
+	assert.NoError(err)
+	assert.False(dir.restore)
+	assert.NoError(dir.cleanup())
+	_, err = os.Stat(absent)
+	assert.True(os.IsNotExist(err))
+
+	empty := filepath.Join(root, "empty")
+	assert.NoError(os.Mkdir(empty, 0o755))
+	dir, err = prepareMountDirectory(empty)
+	assert.NoError(err)
+	assert.True(dir.restore)
+	_, err = os.Stat(empty)
+	assert.True(os.IsNotExist(err))
+	assert.NoError(dir.cleanup())
+	stat, err := os.Stat(empty)
+	assert.NoError(err)
+	assert.True(stat.IsDir())
+
+	full := filepath.Join(root, "full")
+	assert.NoError(os.Mkdir(full, 0o755))
+	assert.NoError(os.WriteFile(
+		filepath.Join(full, "file"), nil, 0o644))
+	_, err = prepareMountDirectory(full)
+	assert.Error(err)
+
+	file := filepath.Join(root, "file")
+	assert.NoError(os.WriteFile(file, nil, 0o644))
+	_, err = prepareMountDirectory(file)
+	assert.Error(err)
+}
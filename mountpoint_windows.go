@@ -0,0 +1,100 @@
+package winfsp
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var removeMountPoint *syscall.Proc
+
+// attachMountPoint sets the mount point of the file system
+// and records the resolved one.
+func (f *FileSystem) attachMountPoint(mountpoint string) error {
+	var utf16MountPoint *uint16
+	if mountpoint != AutoDriveLetter {
+		var err error
+		utf16MountPoint, err = windows.UTF16PtrFromString(mountpoint)
+		if err != nil {
+			return errors.Wrapf(err, "string %q convert utf16", mountpoint)
+		}
+	}
+	var mountResult uintptr
+	var err error
+	if f.mountPointSecurity != nil {
+		if setMountPointEx == nil {
+			return errors.Wrap(errUnsupported,
+				"mount point security descriptor")
+		}
+		mountResult, _, err = setMountPointEx.Call(
+			uintptr(unsafe.Pointer(f.fileSystem)),
+			uintptr(unsafe.Pointer(utf16MountPoint)),
+			uintptr(unsafe.Pointer(f.mountPointSecurity)),
+		)
+		runtime.KeepAlive(f.mountPointSecurity)
+	} else {
+		mountResult, _, err = setMountPoint.Call(
+			uintptr(unsafe.Pointer(f.fileSystem)),
+			uintptr(unsafe.Pointer(utf16MountPoint)),
+		)
+	}
+	runtime.KeepAlive(utf16MountPoint)
+	mountStatus := windows.NTStatus(mountResult)
+	if err == syscall.Errno(0) {
+		err = nil
+	}
+	if err == nil && mountStatus != windows.STATUS_SUCCESS {
+		err = mountStatus
+	}
+	if err != nil && err != windows.STATUS_SUCCESS {
+		return errors.Wrap(err, "mount file system")
+	}
+	f.mountPoint = windows.UTF16PtrToString(f.fileSystem.MountPoint)
+	return nil
+}
+
+// RemoveMountPoint detaches the file system from its mount
+// point, while the dispatcher keeps running, so that it can
+// be attached to another mount point by SetMountPoint.
+//
+// The icon and label registered for the drive letter are
+// left untouched, since they are keyed by the drive letter.
+func (f *FileSystem) RemoveMountPoint() error {
+	f.mountPointMutex.Lock()
+	defer f.mountPointMutex.Unlock()
+	if f.mountPoint == "" {
+		return errors.New("mount point not set")
+	}
+	_, _, _ = removeMountPoint.Call(uintptr(unsafe.Pointer(f.fileSystem)))
+	f.mountPoint = ""
+	err := f.mountDir.cleanup()
+	f.mountDir = nil
+	return err
+}
+
+// SetMountPoint attaches the file system detached by the
+// RemoveMountPoint to the mount point, which is resolved
+// in the same way as Mount.
+func (f *FileSystem) SetMountPoint(mountpoint string) error {
+	f.mountPointMutex.Lock()
+	defer f.mountPointMutex.Unlock()
+	if f.mountPoint != "" {
+		return errors.Errorf("mount point %q already set", f.mountPoint)
+	}
+	var dir *mountDirectory
+	if isDirectoryMountPoint(mountpoint) {
+		var err error
+		if dir, err = prepareMountDirectory(mountpoint); err != nil {
+			return err
+		}
+	}
+	if err := f.attachMountPoint(mountpoint); err != nil {
+		_ = dir.cleanup()
+		return err
+	}
+	f.mountDir = dir
+	return nil
+}
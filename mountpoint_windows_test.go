@@ -0,0 +1,42 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestMountPointSecurityUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;WD)")
+	if !assert.NoError(err) {
+		return
+	}
+	option := newOption()
+	MountPointSecurity(sd)(option)
+	assert.Equal(sd, option.mountPointSecurity)
+
+	// The early releases of WinFSP lacking the procedure are
+	// reported instead of mounting without the descriptor.
+	previous := setMountPointEx
+	setMountPointEx = nil
+	defer func() { setMountPointEx = previous }()
+	f := &FileSystem{mountPointSecurity: sd}
+	err = f.attachMountPoint("X:")
+	assert.Equal(errUnsupported, errors.Cause(err))
+	assert.Empty(f.mountPoint)
+}
+
+func TestMountPointState(t *testing.T) {
+	assert := assert.New(t)
+
+	// The mount point cannot be removed before it is set, or
+	// be set again before it is removed.
+	f := &FileSystem{}
+	assert.Error(f.RemoveMountPoint())
+	f.mountPoint = "X:"
+	assert.Error(f.SetMountPoint("Y:"))
+	assert.Equal("X:", f.MountPoint())
+}
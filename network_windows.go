@@ -0,0 +1,125 @@
+package winfsp
+
+import (
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// winFspNetworkProvider is the name of the network provider
+// installed by WinFSP, which also asks the launcher to start
+// the file system service registered for the UNC prefix.
+const winFspNetworkProvider = "WinFsp.Np"
+
+var (
+	mpr                   = windows.NewLazySystemDLL("mpr.dll")
+	wnetAddConnection2    = mpr.NewProc("WNetAddConnection2W")
+	wnetCancelConnection2 = mpr.NewProc("WNetCancelConnection2W")
+)
+
+const (
+	resourceTypeDisk     = 0x00000001
+	connectUpdateProfile = 0x00000001
+	connectTemporary     = 0x00000004
+)
+
+// netResource is the NETRESOURCEW structure.
+type netResource struct {
+	Scope       uint32
+	Type        uint32
+	DisplayType uint32
+	Usage       uint32
+	LocalName   *uint16
+	RemoteName  *uint16
+	Comment     *uint16
+	Provider    *uint16
+}
+
+// uncPath converts the volume prefix in the form of
+// "\server\share" into the UNC path "\\server\share".
+func uncPath(prefix string) string {
+	return `\\` + strings.TrimLeft(prefix, `\`)
+}
+
+// AddNetworkConnection registers the connection to the volume
+// prefix of a network file system with the system, so that it
+// is listed among the network connections, and maps it to the
+// drive letter unless drive is empty.
+//
+// When persistent is true, the connection is remembered in
+// the user profile and restored after logging on again, which
+// requires the file system to be registered to the WinFSP
+// launcher under the volume prefix, so that it is started by
+// the launcher when the connection is restored.
+func AddNetworkConnection(prefix, drive string, persistent bool) error {
+	if err := wnetAddConnection2.Find(); err != nil {
+		return errors.Wrap(err, "load mpr")
+	}
+	remote := uncPath(prefix)
+	utf16Remote, err := windows.UTF16PtrFromString(remote)
+	if err != nil {
+		return errors.Wrapf(err, "string %q convert utf16", remote)
+	}
+	utf16Provider, err := windows.UTF16PtrFromString(winFspNetworkProvider)
+	if err != nil {
+		return err
+	}
+	resource := &netResource{
+		Type:       resourceTypeDisk,
+		RemoteName: utf16Remote,
+		Provider:   utf16Provider,
+	}
+	if drive != "" {
+		letter, ok := driveLetter(drive)
+		if !ok {
+			return errors.Errorf("invalid drive %q", drive)
+		}
+		if resource.LocalName, err = windows.UTF16PtrFromString(
+			letter + ":"); err != nil {
+			return err
+		}
+	}
+	flags := uint32(connectTemporary)
+	if persistent {
+		flags = connectUpdateProfile
+	}
+	result, _, _ := wnetAddConnection2.Call(
+		uintptr(unsafe.Pointer(resource)), 0, 0, uintptr(flags))
+	if result != 0 {
+		return errors.Wrapf(windows.Errno(result),
+			"add network connection %q", remote)
+	}
+	return nil
+}
+
+// CancelNetworkConnection removes the connection added by
+// AddNetworkConnection, which is either the drive letter or
+// the volume prefix it is connected to. The connection is
+// also forgotten by the user profile if persistent is true.
+func CancelNetworkConnection(name string, persistent bool) error {
+	if err := wnetCancelConnection2.Find(); err != nil {
+		return errors.Wrap(err, "load mpr")
+	}
+	if letter, ok := driveLetter(name); ok {
+		name = letter + ":"
+	} else {
+		name = uncPath(name)
+	}
+	utf16Name, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return errors.Wrapf(err, "string %q convert utf16", name)
+	}
+	flags := uint32(0)
+	if persistent {
+		flags = connectUpdateProfile
+	}
+	result, _, _ := wnetCancelConnection2.Call(
+		uintptr(unsafe.Pointer(utf16Name)), uintptr(flags), 1)
+	if result != 0 {
+		return errors.Wrapf(windows.Errno(result),
+			"cancel network connection %q", name)
+	}
+	return nil
+}
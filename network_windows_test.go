@@ -0,0 +1,30 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestUncPath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`\\server\share`, uncPath(`\server\share`))
+	assert.Equal(`\\server\share`, uncPath(`\\server\share`))
+	assert.Equal(`\\server\share`, uncPath(`server\share`))
+}
+
+func TestNetworkConnection(t *testing.T) {
+	assert := assert.New(t)
+	assert.Error(AddNetworkConnection(`\server\share`, `C:\dir`, false))
+
+	// Cancelling the connection that is not connected fails,
+	// whether it is specified by drive letter or prefix.
+	const prefix = `\go-winfsp-test\nonexistent`
+	err := CancelNetworkConnection(prefix, false)
+	if assert.Error(err) {
+		assert.Equal(windows.ERROR_NOT_CONNECTED, errors.Cause(err))
+		assert.Contains(err.Error(), `\\go-winfsp-test\nonexistent`)
+	}
+}
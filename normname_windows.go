@@ -0,0 +1,48 @@
+package winfsp
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// SetNormalizedName sets the normalized name of the file
+// being opened or created, which is the full path of the
+// file in the case stored by the file system, e.g. the
+// "\Foo\Bar" for the file opened as "\FOO\bar".
+//
+// The case insensitive file systems should report it so
+// that the names seen by the applications and the cache
+// of the driver are consistent, while the name used by
+// the caller is taken when it is not set.
+//
+// This must only be called inside the Open, Create and
+// CreateEx behaviours, and on the goroutine which the
+// behaviour is invoked, since the file being opened is
+// tracked by the dispatcher thread.
+func (ref *FileSystemRef) SetNormalizedName(name string) error {
+	opening := ref.opening.current()
+	if opening == nil {
+		return errors.New("no file being opened or created")
+	}
+	info := opening.info
+	if info.NormalizedName == nil {
+		return errors.New("normalized name unsupported")
+	}
+	encoded, err := utf16FromName(name)
+	if err != nil {
+		return err
+	}
+	size := 2 * len(encoded)
+	if size > int(info.NormalizedNameSize) {
+		return errors.Errorf("normalized name %q too long", name)
+	}
+	buf := enforceBytePtr(
+		uintptr(unsafe.Pointer(info.NormalizedName)), size)
+	for i, c := range encoded {
+		binary.LittleEndian.PutUint16(buf[2*i:], c)
+	}
+	info.NormalizedNameSize = uint16(size)
+	return nil
+}
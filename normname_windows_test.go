@@ -0,0 +1,37 @@
+package winfsp
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetNormalizedName(t *testing.T) {
+	assert := assert.New(t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ref := &FileSystemRef{}
+	assert.Error(ref.SetNormalizedName(`\Foo`))
+
+	var buf [8]uint16
+	info := FSP_FSCTL_OPEN_FILE_INFO{
+		NormalizedName:     &buf[0],
+		NormalizedNameSize: uint16(2 * len(buf)),
+	}
+	var file uintptr
+	end := ref.beginOpen(&file, uintptr(unsafe.Pointer(&info)))
+	defer end()
+	assert.Error(ref.SetNormalizedName(`\TooLongName`))
+	assert.NoError(ref.SetNormalizedName(`\Foo\Bar`))
+	assert.Equal(uint16(16), info.NormalizedNameSize)
+	assert.Equal(`\Foo\Bar`, syscall.UTF16ToString(buf[:]))
+
+	// The unpaired surrogates are restored as they are.
+	assert.NoError(ref.SetNormalizedName("\\\xed\xa0\x80"))
+	assert.Equal(uint16(4), info.NormalizedNameSize)
+	assert.Equal([]uint16{'\\', 0xd800}, buf[:2])
+}
@@ -0,0 +1,173 @@
+package winfsp
+
+import (
+	"encoding/binary"
+	"math"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	notifyBegin *syscall.Proc
+	notifyEnd   *syscall.Proc
+	notify      *syscall.Proc
+)
+
+// notifyBeginTimeout is the time in milliseconds to wait
+// for the rename lock of the file system while notifying.
+const notifyBeginTimeout = 1000
+
+// alignUp aligns the size of the info entries to the
+// default alignment of the WinFSP's transact buffers.
+func alignUp(size int) int {
+	return (size + FSP_FSCTL_DEFAULT_ALIGNMENT - 1) &^
+		(FSP_FSCTL_DEFAULT_ALIGNMENT - 1)
+}
+
+// appendNotifyInfo appends a notify info entry to the end
+// of the buffer, imitating FspFileSystemAddNotifyInfo.
+func appendNotifyInfo(
+	buf []byte, filter, action uint32, name string,
+) ([]byte, error) {
+	utf16, err := utf16FromName(name)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := int(unsafe.Sizeof(FSP_FSCTL_NOTIFY_INFO{}))
+	size := headerSize + len(utf16)*SIZEOF_WCHAR
+	if size > math.MaxUint16 {
+		return nil, windows.STATUS_OBJECT_NAME_INVALID
+	}
+	offset := len(buf)
+	buf = append(buf, make([]byte, alignUp(size))...)
+	entry := buf[offset:]
+	var info FSP_FSCTL_NOTIFY_INFO
+	binary.LittleEndian.PutUint16(
+		entry[unsafe.Offsetof(info.Size):], uint16(size))
+	binary.LittleEndian.PutUint32(
+		entry[unsafe.Offsetof(info.Filter):], filter)
+	binary.LittleEndian.PutUint32(
+		entry[unsafe.Offsetof(info.Action):], action)
+	for i, c := range utf16 {
+		binary.LittleEndian.PutUint16(
+			entry[headerSize+i*SIZEOF_WCHAR:], c)
+	}
+	return buf, nil
+}
+
+// notifyRaw sends the buffer of notify info entries to
+// the file system driver.
+func (ref *FileSystemRef) notifyRaw(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	if notify == nil || notifyBegin == nil || notifyEnd == nil {
+		return errors.Wrap(errUnsupported, "notify")
+	}
+	fileSystem := uintptr(unsafe.Pointer(ref.fileSystem))
+	if err := callNTStatus(
+		notifyBegin, fileSystem, uintptr(notifyBeginTimeout),
+	); err != nil {
+		return errors.Wrap(err, "notify begin")
+	}
+	defer func() {
+		_, _, _ = notifyEnd.Call(fileSystem)
+	}()
+	// XXX: the buffer is copied into a 8-byte aligned one,
+	// since the entries are required to be aligned.
+	aligned := make([]uint64, (len(buf)+7)/8)
+	alignedAddr := uintptr(unsafe.Pointer(&aligned[0]))
+	copy(enforceBytePtr(alignedAddr, len(buf)), buf)
+	err := callNTStatus(notify, fileSystem,
+		alignedAddr, uintptr(len(buf)))
+	runtime.KeepAlive(aligned)
+	return errors.Wrap(err, "notify")
+}
+
+// invalidateFilter is the set of changes reported while
+// invalidating the caches of a file.
+const invalidateFilter = windows.FILE_NOTIFY_CHANGE_ATTRIBUTES |
+	windows.FILE_NOTIFY_CHANGE_SIZE |
+	windows.FILE_NOTIFY_CHANGE_LAST_WRITE
+
+// InvalidateCache tells the kernel that the specified files
+// have been modified externally, so that their cached file
+// information and data will be discarded.
+//
+// This is only meaningful when the kernel is allowed to cache
+// file information, i.e. the file system is mounted with the
+// FileInfoTimeout or the timeouts of the specific caches like
+// DirInfoTimeout and SecurityTimeout, and the names must be
+// the normalized paths relative to the root of the volume,
+// e.g. `\dir\file.txt`.
+//
+// This method must not be called inside the behaviours, since
+// it acquires the rename lock of the file system.
+func (ref *FileSystemRef) InvalidateCache(names ...string) error {
+	var buf []byte
+	for _, name := range names {
+		var err error
+		buf, err = appendNotifyInfo(buf, invalidateFilter,
+			windows.FILE_ACTION_MODIFIED, name)
+		if err != nil {
+			return errors.Wrapf(err, "string %q convert utf16", name)
+		}
+	}
+	return ref.notifyRaw(buf)
+}
+
+// NotifyInfo is a change notification of a file, which is
+// delivered to the directory watchers and the shell.
+type NotifyInfo struct {
+	// Filter is the set of FILE_NOTIFY_CHANGE_* flags
+	// matched against the filters of the watchers.
+	Filter uint32
+
+	// Action is one of the FILE_ACTION_* values.
+	Action uint32
+
+	// Name is the normalized path of the file relative to
+	// the root of the volume, e.g. `\dir\file.txt`.
+	Name string
+}
+
+// AppendNotifyInfo appends the FSP_FSCTL_NOTIFY_INFO entry
+// of the notification to the buffer, which can be sent by
+// NotifyRaw later. The entries are padded to the alignment
+// required by WinFSP.
+func AppendNotifyInfo(buf []byte, info NotifyInfo) ([]byte, error) {
+	return appendNotifyInfo(buf, info.Filter, info.Action, info.Name)
+}
+
+// Notify pushes the change notifications to the kernel, so
+// that the changes made to the backing store out-of-band,
+// e.g. by the network or other processes, can be observed
+// by the Explorer and the directory watchers.
+//
+// This method must not be called inside the behaviours, since
+// it acquires the rename lock of the file system.
+func (ref *FileSystemRef) Notify(infos ...NotifyInfo) error {
+	var buf []byte
+	for _, info := range infos {
+		var err error
+		buf, err = AppendNotifyInfo(buf, info)
+		if err != nil {
+			return errors.Wrapf(err,
+				"string %q convert utf16", info.Name)
+		}
+	}
+	return ref.notifyRaw(buf)
+}
+
+// NotifyRaw pushes the buffer of FSP_FSCTL_NOTIFY_INFO
+// entries built by AppendNotifyInfo to the kernel.
+//
+// This method must not be called inside the behaviours, since
+// it acquires the rename lock of the file system.
+func (ref *FileSystemRef) NotifyRaw(buf []byte) error {
+	return ref.notifyRaw(buf)
+}
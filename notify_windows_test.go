@@ -0,0 +1,26 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendNotifyInfo(t *testing.T) {
+	assert := assert.New(t)
+	buf, err := appendNotifyInfo(nil, 0x1, 0x3, `\a`)
+	assert.NoError(err)
+	buf, err = appendNotifyInfo(buf, 0x2, 0x4, `\bc`)
+	assert.NoError(err)
+
+	// The name follows the 12 bytes header immediately, and
+	// the entries are aligned to 8 bytes.
+	assert.Equal([]byte{
+		16, 0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, '\\', 0, 'a', 0,
+		18, 0, 0, 0, 2, 0, 0, 0, 4, 0, 0, 0, '\\', 0, 'b', 0,
+		'c', 0, 0, 0, 0, 0, 0, 0,
+	}, buf)
+
+	_, err = appendNotifyInfo(buf, 0, 0, "a\x00b")
+	assert.Error(err)
+}
@@ -0,0 +1,56 @@
+package winfsp
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ntStatusFromWin32 *syscall.Proc
+	win32FromNtStatus *syscall.Proc
+)
+
+// applicationError is the base of the errnos invented by
+// golang, e.g. syscall.ENOENT, which are not win32 errors.
+const applicationError = 0x20000000
+
+// NtStatusFromWin32 converts the win32 error into NTSTATUS
+// with the conversion table of WinFSP.
+func NtStatusFromWin32(err syscall.Errno) windows.NTStatus {
+	if err == 0 {
+		return windows.STATUS_SUCCESS
+	}
+	if tryLoadWinFSP() != nil || ntStatusFromWin32 == nil {
+		return windows.STATUS_UNSUCCESSFUL
+	}
+	result, _, _ := ntStatusFromWin32.Call(uintptr(err))
+	return windows.NTStatus(result)
+}
+
+// Win32FromNtStatus converts the NTSTATUS into win32 error
+// with the conversion table of WinFSP.
+func Win32FromNtStatus(status windows.NTStatus) syscall.Errno {
+	if status == windows.STATUS_SUCCESS {
+		return 0
+	}
+	if tryLoadWinFSP() != nil || win32FromNtStatus == nil {
+		return windows.ERROR_GEN_FAILURE
+	}
+	result, _, _ := win32FromNtStatus.Call(uintptr(status))
+	return syscall.Errno(result)
+}
+
+// convertWin32 converts the win32 error which is not in the
+// conversion map, returning false for the invented errnos.
+func convertWin32(errno syscall.Errno) (windows.NTStatus, bool) {
+	if errno == 0 || errno >= applicationError {
+		return 0, false
+	}
+	status := NtStatusFromWin32(errno)
+	if status == windows.STATUS_SUCCESS ||
+		status == windows.STATUS_UNSUCCESSFUL {
+		return 0, false
+	}
+	return status, true
+}
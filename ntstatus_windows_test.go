@@ -0,0 +1,63 @@
+package winfsp
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestConvertErrno(t *testing.T) {
+	assert := assert.New(t)
+	for errno, status := range map[syscall.Errno]windows.NTStatus{
+		syscall.ENOENT:       windows.STATUS_OBJECT_NAME_NOT_FOUND,
+		syscall.ENOSPC:       windows.STATUS_DISK_FULL,
+		syscall.EROFS:        windows.STATUS_MEDIA_WRITE_PROTECTED,
+		syscall.ENAMETOOLONG: windows.STATUS_NAME_TOO_LONG,
+		syscall.ENOTEMPTY:    windows.STATUS_DIRECTORY_NOT_EMPTY,
+		syscall.EBUSY:        windows.STATUS_DEVICE_BUSY,
+		syscall.EMFILE:       windows.STATUS_TOO_MANY_OPENED_FILES,
+		syscall.ETIMEDOUT:    windows.STATUS_IO_TIMEOUT,
+		syscall.EXDEV:        windows.STATUS_NOT_SAME_DEVICE,
+	} {
+		assert.Equal(status, convertNTStatus(errno), errno.Error())
+		assert.Equal(status, convertNTStatus(
+			errors.Wrap(errno, "wrapped")), errno.Error())
+	}
+	assert.Equal(windows.STATUS_DISK_FULL, convertNTStatus(
+		&fs.PathError{Op: "write", Path: "file", Err: syscall.ENOSPC}))
+	assert.Equal(windows.STATUS_OBJECT_NAME_NOT_FOUND,
+		convertNTStatus(os.ErrNotExist))
+}
+
+func TestConvertWin32(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(windows.STATUS_SUCCESS, NtStatusFromWin32(0))
+	assert.Equal(syscall.Errno(0), Win32FromNtStatus(windows.STATUS_SUCCESS))
+
+	// The errnos invented by golang are not win32 errors.
+	_, ok := convertWin32(syscall.EROFS)
+	assert.False(ok)
+	_, ok = convertWin32(0)
+	assert.False(ok)
+
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+
+	// The win32 errors absent from the conversion map are
+	// converted by WinFSP instead of being internal errors.
+	errno := windows.ERROR_DISK_QUOTA_EXCEEDED
+	status := NtStatusFromWin32(errno)
+	assert.NotEqual(windows.STATUS_UNSUCCESSFUL, status)
+	assert.Equal(errno, Win32FromNtStatus(status))
+	converted, ok := convertWin32(errno)
+	assert.True(ok)
+	assert.Equal(status, converted)
+	assert.Equal(status, convertNTStatus(errno))
+	assert.Equal(status, convertNTStatus(errors.Wrap(errno, "wrapped")))
+}
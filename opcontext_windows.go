@@ -0,0 +1,79 @@
+package winfsp
+
+import (
+	"context"
+
+	"golang.org/x/sys/windows"
+)
+
+// OperationContext is the context of the request being
+// served by the behaviour.
+type OperationContext struct {
+	// Context is cancelled when the file system stops
+	// serving, so that the behaviours blocking on the
+	// backing store can be interrupted on unmounting.
+	context.Context
+
+	// Kind is the FspFsctlTransact*Kind of the request.
+	Kind uint32
+
+	// Hint is the opaque hint of the request, which is
+	// used to identify the request while completing it.
+	Hint uint64
+
+	// ProcessId is the originating process of the request,
+	// which is only available to Open, Create and Rename.
+	ProcessId uint32
+
+	// AccessToken is the access token of the originating
+	// process, which is only available to Open, Create and
+	// Rename. The token is owned by WinFSP and must not be
+	// closed by the behaviours.
+	AccessToken windows.Token
+
+	// PosixRename tells whether the rename request is under
+	// the POSIX semantics, i.e. the file system is mounted
+	// with PosixUnlinkRename and the request carries
+	// FILE_RENAME_POSIX_SEMANTICS, so that the target could
+	// be replaced while it is still open. It is only
+	// available to Rename.
+	PosixRename bool
+}
+
+// Operation retrieves the context of the request being
+// served by the current behaviour.
+//
+// This must only be called inside the behaviours, and on
+// the goroutine which the behaviour is invoked, since the
+// request is tracked by the dispatcher thread. The context
+// is still returned with only the Context field set when
+// there's no request being served.
+func (ref *FileSystemRef) Operation() *OperationContext {
+	result := &OperationContext{Context: ref.Context()}
+	if ctx := ref.deadlines.context(); ctx != nil {
+		result.Context = ctx
+	}
+	request := operationRequest()
+	if request == nil {
+		return result
+	}
+	result.Kind = request.Kind
+	result.Hint = request.Hint
+	if token, ok := operationAccessToken(); ok {
+		result.ProcessId = FSP_FSCTL_TRANSACT_REQ_TOKEN_PID(token)
+		result.AccessToken = FSP_FSCTL_TRANSACT_REQ_TOKEN_HANDLE(token)
+	}
+	result.PosixRename = ref.posixRename &&
+		operationRenameFlags()&windows.FILE_RENAME_POSIX_SEMANTICS != 0
+	return result
+}
+
+// Context returns the context which is cancelled when the
+// file system stops serving, either being unmounted or
+// removed externally.
+func (ref *FileSystemRef) Context() context.Context {
+	if ref.ctx == nil {
+		return context.Background()
+	}
+	return ref.ctx
+}
@@ -0,0 +1,281 @@
+package winfsp
+
+import (
+	"log"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var getOperationContext *syscall.Proc
+
+// operationRequest retrieves the transact request being
+// served by current dispatcher thread.
+//
+// This must only be called inside the behaviours, since
+// the context is stored in the thread local storage of
+// the dispatcher threads.
+func operationRequest() *FSP_FSCTL_TRANSACT_REQ_HEADER {
+	result, _, _ := getOperationContext.Call()
+	context := (*FSP_FILE_SYSTEM_OPERATION_CONTEXT)(
+		unsafe.Pointer(result))
+	if context == nil {
+		return nil
+	}
+	return context.Request
+}
+
+// operationCreateRequest retrieves the body of the current
+// request if it is a create request.
+func operationCreateRequest() *FSP_FSCTL_TRANSACT_REQ_CREATE {
+	request := operationRequest()
+	if request == nil || request.Kind != FspFsctlTransactCreateKind {
+		return nil
+	}
+	return (*FSP_FSCTL_TRANSACT_REQ_CREATE)(unsafe.Pointer(
+		uintptr(unsafe.Pointer(request)) +
+			unsafe.Sizeof(FSP_FSCTL_TRANSACT_REQ_HEADER{})))
+}
+
+// operationAccessToken retrieves the access token field of
+// the current request, which is only available to create
+// and rename requests, just like what the WinFSP's native
+// FspFileSystemOperationProcessId does.
+func operationAccessToken() (uint64, bool) {
+	request := operationRequest()
+	if request == nil {
+		return 0, false
+	}
+	body := uintptr(unsafe.Pointer(request)) +
+		unsafe.Sizeof(FSP_FSCTL_TRANSACT_REQ_HEADER{})
+	switch request.Kind {
+	case FspFsctlTransactCreateKind:
+		create := (*FSP_FSCTL_TRANSACT_REQ_CREATE)(
+			unsafe.Pointer(body))
+		return create.AccessToken, true
+	case FspFsctlTransactSetInformationKind:
+		rename := (*FSP_FSCTL_TRANSACT_REQ_SET_INFORMATION_RENAME)(
+			unsafe.Pointer(body))
+		if rename.FileInformationClass == FileRenameInformation ||
+			rename.FileInformationClass == FileRenameInformationEx {
+			return rename.AccessToken, true
+		}
+	}
+	return 0, false
+}
+
+// operationRenameFlags retrieves the FILE_RENAME_* flags of
+// the current request, which are only carried by the rename
+// requests of FileRenameInformationEx.
+func operationRenameFlags() uint32 {
+	request := operationRequest()
+	if request == nil ||
+		request.Kind != FspFsctlTransactSetInformationKind {
+		return 0
+	}
+	rename := (*FSP_FSCTL_TRANSACT_REQ_SET_INFORMATION_RENAME)(
+		unsafe.Pointer(uintptr(unsafe.Pointer(request)) +
+			unsafe.Sizeof(FSP_FSCTL_TRANSACT_REQ_HEADER{})))
+	if rename.FileInformationClass != FileRenameInformationEx {
+		return 0
+	}
+	return rename.Flags
+}
+
+// OperationProcessId returns the ID of the process which
+// originates the current operation.
+//
+// It is only available inside the behaviours of Open,
+// Create and Rename, and 0 will be returned under other
+// circumstances.
+func OperationProcessId() uint32 {
+	token, ok := operationAccessToken()
+	if !ok {
+		return 0
+	}
+	return FSP_FSCTL_TRANSACT_REQ_TOKEN_PID(token)
+}
+
+// Operation is the record of a behaviour invocation.
+type Operation struct {
+	// Kind is the name of the invoked behaviour, which is
+	// identical to the name of the behaviour's method.
+	Kind string
+
+	// File is the file context that the operation is
+	// performed on, which is 0 for Open and Create.
+	File uintptr
+
+	// Name is the file name that the operation is performed
+	// on, or the name that the file context is opened with.
+	Name string
+
+	// ProcessId is the originating process of the operation,
+	// which is only available to Open, Create and Rename.
+	ProcessId uint32
+
+	// Offset is the offset or size argument of the operation,
+	// e.g. the offset of Read and Write, the new size of
+	// SetFileSize and the allocation size of Create.
+	Offset uint64
+
+	// Length is the length of the buffer passed to the
+	// operation, e.g. Read, Write and ReadDirectory.
+	Length uint32
+
+	// Flags is the flags argument of the operation, e.g. the
+	// create options of Open and Create, the cleanup flags of
+	// Cleanup and the control code of DeviceIoControl.
+	Flags uint32
+
+	// Start is the time when the behaviour is invoked.
+	Start time.Time
+
+	// Duration is the time elapsed executing the behaviour.
+	Duration time.Duration
+
+	// Status is the result of the operation.
+	Status windows.NTStatus
+
+	deadline *deadlineContext
+	detached bool
+	exited   bool
+}
+
+// OperationHandler is the handler of operation records.
+type OperationHandler func(op *Operation)
+
+// SlowOperation reports the operations which take longer
+// than the threshold to the handler, so that the behaviour
+// hanging the caller can be spotted. The operations will be
+// printed to the standard logger if the handler is nil.
+func SlowOperation(
+	threshold time.Duration, handler OperationHandler,
+) Option {
+	return func(o *option) {
+		o.slowThreshold = threshold
+		o.slowHandler = handler
+	}
+}
+
+func logSlowOperation(op *Operation) {
+	log.Printf(
+		"winfsp: slow operation %s on %q (pid %d) took %s: %s",
+		op.Kind, op.Name, op.ProcessId, op.Duration, op.Status)
+}
+
+// beginOperation snapshots the behaviours serving the
+// operation, and creates the record of the operation when
+// the file system is instrumented, or returns nil. The
+// behaviours are held until the operation ends, so that
+// SwapBehaviour waits for it.
+func (ref *FileSystemRef) beginOperation(
+	kind string, file, name uintptr,
+) (*behaviourSet, *Operation) {
+	return ref.beginOperationArgs(kind, file, name, 0, 0, 0)
+}
+
+// beginOperationArgs is beginOperation recording the
+// arguments of the operation.
+func (ref *FileSystemRef) beginOperationArgs(
+	kind string, file, name uintptr,
+	offset uint64, length, flags uint32,
+) (*behaviourSet, *Operation) {
+	if !ref.instrumented {
+		return ref.acquireBehaviours(), nil
+	}
+	if ref.limiter != nil {
+		ref.limiter.acquire(kind)
+	}
+	b := ref.acquireBehaviours()
+	op := &Operation{
+		Kind:   kind,
+		File:   file,
+		Start:  time.Now(),
+		Offset: offset,
+		Length: length,
+		Flags:  flags,
+	}
+	if name != 0 {
+		op.Name = utf16PtrToString(name)
+	} else if file != 0 {
+		op.Name = ref.fileName(file)
+	}
+	op.ProcessId = OperationProcessId()
+	if ref.deadlines != nil {
+		op.deadline = ref.deadlines.begin(ref.Context(), kind)
+	}
+	if ref.trace != nil {
+		ref.trace.add(op)
+	}
+	return b, op
+}
+
+// endOperation completes the record of the operation and
+// dispatches it to the handlers. The operation completed
+// asynchronously remains open until its request is completed,
+// so that it is still counted by the limits and recorded with
+// the status it is completed with.
+//
+// It must be deferred directly by the delegates, so that it
+// is able to recover the panics raised by the behaviours.
+func (ref *FileSystemRef) endOperation(
+	b *behaviourSet, op *Operation, status *windows.NTStatus,
+) {
+	if ref.recoverPanic {
+		if value := recover(); value != nil {
+			if status != nil {
+				*status = windows.STATUS_INTERNAL_ERROR
+			}
+			defer ref.handlePanic(op, value)
+		}
+	}
+	if op != nil && op.deadline != nil {
+		ref.deadlines.end(op.deadline, status)
+	}
+	if hold := ref.pendingOperation(status); hold != nil {
+		hold.attach(func(result windows.NTStatus) {
+			ref.finishOperation(b, op, result)
+		})
+		return
+	}
+	var result windows.NTStatus
+	if status != nil {
+		result = *status
+	}
+	ref.finishOperation(b, op, result)
+}
+
+// finishOperation records the operation with its final
+// status, and releases the behaviours and limits held by it.
+func (ref *FileSystemRef) finishOperation(
+	b *behaviourSet, op *Operation, status windows.NTStatus,
+) {
+	defer b.release()
+	if op == nil {
+		return
+	}
+	if ref.limiter != nil && !op.detached {
+		defer ref.limiter.release(op.Kind)
+	}
+	op.Duration = time.Since(op.Start)
+	op.Status = status
+	if ref.recentOps != nil {
+		ref.recentOps.add(op)
+	}
+	if ref.trace != nil {
+		op.exited = true
+		ref.trace.add(op)
+	}
+	if ref.stats != nil {
+		ref.stats.addOperation(op)
+	}
+	if ref.operationLogger != nil {
+		ref.operationLogger(op)
+	}
+	if ref.slowThreshold > 0 && op.Duration >= ref.slowThreshold {
+		ref.slowHandler(op)
+	}
+}
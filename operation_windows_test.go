@@ -0,0 +1,48 @@
+package winfsp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+// sleepFlush sleeps for the milliseconds numbered by the
+// file contexts.
+type sleepFlush struct{ swapBase }
+
+func (sleepFlush) Flush(
+	fs *FileSystemRef, file uintptr, info *FSP_FSCTL_FILE_INFO,
+) error {
+	time.Sleep(time.Duration(file) * time.Millisecond)
+	return nil
+}
+
+func instrumentedTestRef(t *testing.T, fs BehaviourBase) (*FileSystemRef, uintptr) {
+	t.Helper()
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+	ref, fileSystem := delegateTestRef(t, fs)
+	ref.instrumented = true
+	return ref, fileSystem
+}
+
+func TestSlowOperation(t *testing.T) {
+	assert := assert.New(t)
+	ref, fileSystem := instrumentedTestRef(t, sleepFlush{})
+	var slow []Operation
+	ref.slowThreshold = 50 * time.Millisecond
+	ref.slowHandler = func(op *Operation) { slow = append(slow, *op) }
+
+	assert.Equal(windows.STATUS_SUCCESS, delegateFlush(fileSystem, 1, 0))
+	assert.Empty(slow)
+	assert.Equal(windows.STATUS_SUCCESS, delegateFlush(fileSystem, 60, 0))
+	if assert.Len(slow, 1) {
+		assert.Equal("Flush", slow[0].Kind)
+		assert.Equal(uintptr(60), slow[0].File)
+		assert.GreaterOrEqual(slow[0].Duration, ref.slowThreshold)
+		assert.Equal(windows.STATUS_SUCCESS, slow[0].Status)
+	}
+}
@@ -0,0 +1,39 @@
+package winfsp
+
+import (
+	"log"
+)
+
+// OperationLogger reports every invocation of the behaviours
+// to the handler after it returns, with the operation name,
+// the file name and context, the duration and the resulting
+// NTSTATUS, which is helpful when developing new backends.
+// The operations will be printed to the standard logger if
+// the handler is nil.
+//
+// The handler is called on the dispatcher threads, so it
+// must be fast and safe for concurrent use.
+func OperationLogger(handler OperationHandler) Option {
+	return func(o *option) {
+		o.logOperations = true
+		o.operationLogger = handler
+	}
+}
+
+// LogOperation creates the handler printing the operations
+// to the logger.
+func LogOperation(logger *log.Logger) OperationHandler {
+	return func(op *Operation) {
+		logger.Printf(
+			"%s %q file=%#x pid=%d took=%s status=%s",
+			op.Kind, op.Name, op.File, op.ProcessId,
+			op.Duration, op.Status)
+	}
+}
+
+func logOperation(op *Operation) {
+	log.Printf(
+		"winfsp: %s %q file=%#x pid=%d took=%s status=%s",
+		op.Kind, op.Name, op.File, op.ProcessId,
+		op.Duration, op.Status)
+}
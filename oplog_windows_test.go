@@ -0,0 +1,58 @@
+package winfsp
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+type diskFullFlush struct{ swapBase }
+
+func (diskFullFlush) Flush(
+	fs *FileSystemRef, file uintptr, info *FSP_FSCTL_FILE_INFO,
+) error {
+	return windows.STATUS_DISK_FULL
+}
+
+func TestOperationLogger(t *testing.T) {
+	assert := assert.New(t)
+	ref, fileSystem := instrumentedTestRef(t, diskFullFlush{})
+	var logged []Operation
+	option := newOption()
+	OperationLogger(func(op *Operation) {
+		logged = append(logged, *op)
+	})(option)
+	assert.True(option.logOperations)
+	ref.operationLogger = option.operationLogger
+	ref.trackNames = true
+	ref.trackFileName(1, `\file`)
+
+	// Every invocation is logged with its resulting status.
+	assert.Equal(windows.STATUS_DISK_FULL, delegateFlush(fileSystem, 1, 0))
+	assert.Equal(windows.STATUS_DISK_FULL, delegateFlush(fileSystem, 1, 0))
+	if assert.Len(logged, 2) {
+		assert.Equal("Flush", logged[0].Kind)
+		assert.Equal(uintptr(1), logged[0].File)
+		assert.Equal(`\file`, logged[0].Name)
+		assert.Equal(windows.STATUS_DISK_FULL, logged[0].Status)
+	}
+}
+
+func TestLogOperation(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	LogOperation(log.New(&buf, "", 0))(&Operation{
+		Kind:      "Read",
+		File:      0x10,
+		Name:      `\file`,
+		ProcessId: 42,
+		Duration:  time.Millisecond,
+		Status:    windows.STATUS_END_OF_FILE,
+	})
+	assert.Equal(`Read "\\file" file=0x10 pid=42 took=1ms status=`+
+		windows.STATUS_END_OF_FILE.Error()+"\n", buf.String())
+}
@@ -6,4 +6,13 @@
 //
 // The API interfaces are only usable on windows, since
 // they refers to the native API on winfsp.dll.
+//
+// Oplocks are granted and broken by the WinFSP's file system
+// driver on behalf of the user mode file systems, and there
+// is no FspFileSystemOplock* API in winfsp.dll to bind to.
+// The oplocks only enable the client side caching when the
+// kernel is allowed to cache the file information and data,
+// and the file systems whose backing store changes outside
+// the mount should break them by notifying the changes, e.g.
+// with FileSystemRef.Notify or FileSystemRef.InvalidateCache.
 package winfsp
@@ -13,6 +13,9 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/aegistudio/go-winfsp/clock"
 )
 
 // pool for integers in the path locker.
@@ -30,8 +33,56 @@ var pool = &sync.Pool{
 //
 // The locking process is nonblocking, it releases and returns
 // immediately when it fails to lock the path.
+//
+// A continuous stream of readers might starve the writer
+// forever, since the writer fails whenever there's a reader.
+// When FairWindow is positive, the writer failing due to the
+// readers marks its intent to write the path, and new readers
+// of the path or its descendants will fail until the writer
+// succeeds or the window elapses, so that the writer retrying
+// within the window will eventually succeed. The window is
+// measured by the Clock, or the system clock if it is nil.
 type PathLocker struct {
-	m sync.Map
+	m       sync.Map
+	intents sync.Map
+
+	FairWindow time.Duration
+	Clock      clock.Clock
+}
+
+// intended checks whether there's a writer intending to
+// write the path, removing the mark once it expires.
+func (l *PathLocker) intended(p string) bool {
+	if l.FairWindow <= 0 {
+		return false
+	}
+	obj, ok := l.intents.Load(p)
+	if !ok {
+		return false
+	}
+	deadline := obj.(int64)
+	if clock.Now(l.Clock).UnixNano() < deadline {
+		return true
+	}
+	l.intents.Delete(p)
+	return false
+}
+
+// markIntent marks the intent to write the path, after the
+// writer has failed due to the readers.
+func (l *PathLocker) markIntent(p string) {
+	if l.FairWindow <= 0 {
+		return
+	}
+	l.intents.Store(p, clock.Now(l.Clock).Add(l.FairWindow).UnixNano())
+}
+
+// CancelIntent withdraws the intent to write the path marked
+// by the writer failed due to the readers, when the writer
+// gives up instead of retrying, so that the readers of the
+// path are no longer rejected until the window elapses.
+func (l *PathLocker) CancelIntent(p string) {
+	l.intents.Delete(cleanFilePath(p))
 }
 
 // readUnlock performs the unlock operation on specified path.
@@ -53,6 +104,10 @@ func (l *PathLocker) readUnlock(p string) {
 // on the specified path, or it reaches the upper limit of the
 // integer's pointer.
 func (l *PathLocker) readLock(p string) bool {
+	if l.intended(p) {
+		// Yield to the writer waiting for the path.
+		return false
+	}
 	for {
 		newer := pool.Get().(*uintptr)
 		atomic.StoreUintptr(newer, 2)
@@ -108,13 +163,22 @@ func (l *PathLocker) writeLock(p string) bool {
 		obj, loaded := l.m.LoadOrStore(p, newer)
 		if !loaded {
 			// We have simply locked it here now.
+			if l.FairWindow > 0 {
+				l.intents.Delete(p)
+			}
 			return true
 		}
 		pool.Put(newer)
 		before := atomic.LoadUintptr(obj.(*uintptr))
-		if before == 0 || before > 1 {
-			// If there's any reader locks or writer locks
-			// prior to this operation, it must fail.
+		if before > 1 {
+			// The writer must wait for the readers to leave,
+			// and it will not wait forever in fair mode.
+			l.markIntent(p)
+			return false
+		}
+		if before == 0 {
+			// If there's any writer locks prior to this
+			// operation, it must fail.
 			return false
 		}
 		// So before is the empty counter, all we need to
@@ -259,6 +323,13 @@ func cleanFilePath(p string) string {
 	return cleanSlashPath(p)
 }
 
+// CleanPath returns the slash separated path that the file
+// path will be locked as, which is identical to the Path of
+// the lock acquired on it.
+func CleanPath(p string) string {
+	return cleanFilePath(p)
+}
+
 // RLock attempt to perform the reader lock on the path.
 func (l *PathLocker) RLock(p string) *Lock {
 	return l.readLockCleanPath(cleanFilePath(p))
@@ -2,8 +2,11 @@ package pathlock
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aegistudio/go-winfsp/clock"
 )
 
 func assertEmpty(assert *assert.Assertions, locker *PathLocker) {
@@ -76,3 +79,79 @@ func TestReadWriteLock(t *testing.T) {
 	assert.Nil(locker.RLockPath("./a/c/d"))
 	assert.Nil(locker.RLockPath("//a/c/d"))
 }
+
+func TestFairWriter(t *testing.T) {
+	assert := assert.New(t)
+	locker := &PathLocker{FairWindow: time.Hour}
+	defer assertEmpty(assert, locker)
+	reader := locker.RLockPath("/a/b")
+	assert.NotNil(reader)
+
+	// The writer failing due to the reader stops newcomers
+	// from reading the path and its descendants.
+	assert.Nil(locker.LockPath("/a"))
+	assert.Nil(locker.RLockPath("/a"))
+	assert.Nil(locker.RLockPath("/a/c"))
+	sibling := locker.RLockPath("/d")
+	assert.NotNil(sibling)
+	sibling.Unlock()
+
+	reader.Unlock()
+	writer := locker.LockPath("/a")
+	if assert.NotNil(writer) {
+		writer.Unlock()
+	}
+	reader = locker.RLockPath("/a/b")
+	if assert.NotNil(reader) {
+		reader.Unlock()
+	}
+}
+
+func TestFairWindowElapsed(t *testing.T) {
+	assert := assert.New(t)
+	fake := clock.NewFake(time.Unix(0, 0))
+	locker := &PathLocker{FairWindow: time.Second, Clock: fake}
+	defer assertEmpty(assert, locker)
+	reader := locker.RLockPath("/a")
+	assert.NotNil(reader)
+	defer reader.Unlock()
+	assert.Nil(locker.LockPath("/a"))
+	assert.Nil(locker.RLockPath("/a"))
+	fake.Advance(2 * time.Second)
+
+	// The writer has given up, readers must not wait for it.
+	another := locker.RLockPath("/a")
+	if assert.NotNil(another) {
+		another.Unlock()
+	}
+}
+
+func TestCancelIntent(t *testing.T) {
+	assert := assert.New(t)
+	locker := &PathLocker{FairWindow: time.Hour}
+	defer assertEmpty(assert, locker)
+	reader := locker.RLockPath("/a")
+	assert.NotNil(reader)
+	assert.Nil(locker.Lock("/a"))
+	assert.Nil(locker.RLockPath("/a"))
+
+	// The writer has given up, readers must not wait for it.
+	locker.CancelIntent("/a")
+	another := locker.RLockPath("/a")
+	if assert.NotNil(another) {
+		another.Unlock()
+	}
+	reader.Unlock()
+}
+
+func TestCleanPath(t *testing.T) {
+	assert := assert.New(t)
+	locker := &PathLocker{}
+	defer assertEmpty(assert, locker)
+	lock := locker.RLock("a/b/../c")
+	if assert.NotNil(lock) {
+		assert.Equal("/a/c", CleanPath("a/b/../c"))
+		assert.Equal(lock.Path(), CleanPath("a/b/../c"))
+		lock.Unlock()
+	}
+}
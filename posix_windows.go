@@ -0,0 +1,144 @@
+package winfsp
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	posixMapUidToSid                        *syscall.Proc
+	posixMapPermissionsToSecurityDescriptor *syscall.Proc
+	deleteSid                               *syscall.Proc
+	deleteSecurityDescriptor                *syscall.Proc
+)
+
+// PosixMapUidToSid maps the POSIX uid into the SID with the
+// mapping rules of WinFSP, e.g. the uid of a remote user from
+// an SMB or NFS server, or a well-known SID.
+func PosixMapUidToSid(uid uint32) (*windows.SID, error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return nil, err
+	}
+	var sid *windows.SID
+	if err := callNTStatus(posixMapUidToSid,
+		uintptr(uid), uintptr(unsafe.Pointer(&sid))); err != nil {
+		return nil, errors.Wrapf(err, "map uid %d to sid", uid)
+	}
+	defer func() {
+		_, _, _ = deleteSid.Call(uintptr(unsafe.Pointer(sid)),
+			posixMapUidToSid.Addr())
+	}()
+	return sid.Copy()
+}
+
+// PosixMapPermissionsToSecurityDescriptor builds the security
+// descriptor of a file owned by the uid and gid, whose access
+// control list is mapped from the POSIX permission bits.
+//
+// The returned security descriptor is self-relative and is
+// allocated by Go.
+func PosixMapPermissionsToSecurityDescriptor(
+	uid, gid, mode uint32,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return nil, err
+	}
+	var sd *windows.SECURITY_DESCRIPTOR
+	if err := callNTStatus(posixMapPermissionsToSecurityDescriptor,
+		uintptr(uid), uintptr(gid), uintptr(mode),
+		uintptr(unsafe.Pointer(&sd))); err != nil {
+		return nil, errors.Wrapf(err,
+			"map permissions %o of %d:%d", mode, uid, gid)
+	}
+	defer func() {
+		_, _, _ = deleteSecurityDescriptor.Call(uintptr(unsafe.Pointer(sd)),
+			posixMapPermissionsToSecurityDescriptor.Addr())
+	}()
+	buf := make([]byte, int(sd.Length()))
+	copy(buf, enforceBytePtr(uintptr(unsafe.Pointer(sd)), len(buf)))
+	return (*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(&buf[0])), nil
+}
+
+var (
+	posixMapWindowsToPosixPathEx *syscall.Proc
+	posixMapPosixToWindowsPathEx *syscall.Proc
+	posixDeletePath              *syscall.Proc
+)
+
+// PosixMapWindowsToPosixPath maps the windows path into the
+// POSIX path with the conventions of WinFSP, converting the
+// backslashes into slashes and the characters in the private
+// use area U+F000 to U+F0FF back into the characters invalid
+// on windows when translate is true, or converting only the
+// encoding otherwise.
+func PosixMapWindowsToPosixPath(
+	windowsPath string, translate bool,
+) (string, error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return "", err
+	}
+	if posixMapWindowsToPosixPathEx == nil {
+		return "", errors.Wrap(errUnsupported, "map path")
+	}
+	utf16, err := utf16FromName(windowsPath)
+	if err != nil {
+		return "", err
+	}
+	utf16 = append(utf16, 0)
+	var translateVal uintptr
+	if translate {
+		translateVal = 1
+	}
+	var posixPath *byte
+	if err := callNTStatus(posixMapWindowsToPosixPathEx,
+		uintptr(unsafe.Pointer(&utf16[0])),
+		uintptr(unsafe.Pointer(&posixPath)), translateVal,
+	); err != nil {
+		return "", errors.Wrapf(err,
+			"map windows path %q to posix", windowsPath)
+	}
+	defer func() {
+		_, _, _ = posixDeletePath.Call(uintptr(unsafe.Pointer(posixPath)))
+	}()
+	return windows.BytePtrToString(posixPath), nil
+}
+
+// PosixMapPosixToWindowsPath maps the POSIX path into the
+// windows path with the conventions of WinFSP, converting the
+// slashes into backslashes and the characters invalid on
+// windows into the private use area U+F000 to U+F0FF when
+// translate is true, or converting only the encoding
+// otherwise.
+func PosixMapPosixToWindowsPath(
+	posixPath string, translate bool,
+) (string, error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return "", err
+	}
+	if posixMapPosixToWindowsPathEx == nil {
+		return "", errors.Wrap(errUnsupported, "map path")
+	}
+	posixPathPtr, err := windows.BytePtrFromString(posixPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "posix path %q", posixPath)
+	}
+	var translateVal uintptr
+	if translate {
+		translateVal = 1
+	}
+	var windowsPath *uint16
+	if err := callNTStatus(posixMapPosixToWindowsPathEx,
+		uintptr(unsafe.Pointer(posixPathPtr)),
+		uintptr(unsafe.Pointer(&windowsPath)), translateVal,
+	); err != nil {
+		return "", errors.Wrapf(err,
+			"map posix path %q to windows", posixPath)
+	}
+	defer func() {
+		_, _, _ = posixDeletePath.Call(uintptr(unsafe.Pointer(windowsPath)))
+	}()
+	return utf16PtrToString(uintptr(unsafe.Pointer(windowsPath))), nil
+}
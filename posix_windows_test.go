@@ -0,0 +1,31 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosixMapPath(t *testing.T) {
+	assert := assert.New(t)
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+	if posixMapWindowsToPosixPathEx == nil {
+		t.Skip("path mapping unsupported by installed winfsp")
+	}
+
+	// The characters invalid on windows are mapped into and
+	// out of the private use area.
+	windowsPath, err := PosixMapPosixToWindowsPath("/dir/a:b*", true)
+	assert.NoError(err)
+	assert.Equal("\\dir\\a\uf03ab\uf02a", windowsPath)
+	posixPath, err := PosixMapWindowsToPosixPath(windowsPath, true)
+	assert.NoError(err)
+	assert.Equal("/dir/a:b*", posixPath)
+
+	// The non-ASCII characters are kept across the encodings.
+	posixPath, err = PosixMapWindowsToPosixPath(`\目录\文件`, true)
+	assert.NoError(err)
+	assert.Equal("/目录/文件", posixPath)
+}
@@ -0,0 +1,104 @@
+package winfsp
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// The errors reported by the Preflight, which can be told
+// apart with errors.Cause.
+var (
+	ErrDLLNotFound           = errors.New("winfsp dll not found")
+	ErrDriverNotInstalled    = errors.New("winfsp driver not installed")
+	ErrDriverNotRunning      = errors.New("winfsp driver not running")
+	ErrMountPointUnavailable = errors.New("mount point unavailable")
+)
+
+// driverServiceName is the name of the service under which
+// the WinFSP driver is installed.
+const driverServiceName = "WinFsp"
+
+// Preflight verifies the WinFSP installation, which checks
+// that the DLL can be loaded, that the driver is installed
+// and running, and that the mount point is available when it
+// is specified. Nothing is started or modified by the checks.
+//
+// This reports the problems that would otherwise surface
+// from Mount as opaque errors, so that the applications can
+// e.g. guide the users to install WinFSP.
+func Preflight(mountpoint ...string) error {
+	if err := tryLoadWinFSP(); err != nil {
+		return errors.Wrap(ErrDLLNotFound, err.Error())
+	}
+	if err := checkDriver(); err != nil {
+		return err
+	}
+	for _, point := range mountpoint {
+		if err := checkMountPoint(point); err != nil {
+			return errors.Wrap(ErrMountPointUnavailable, err.Error())
+		}
+	}
+	return nil
+}
+
+// checkDriver ensures the driver is installed and running,
+// by querying its service state from the service manager.
+func checkDriver() error {
+	scm, err := windows.OpenSCManager(
+		nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return errors.Wrap(err, "open service control manager")
+	}
+	defer func() { _ = windows.CloseServiceHandle(scm) }()
+	name, err := windows.UTF16PtrFromString(driverServiceName)
+	if err != nil {
+		return err
+	}
+	service, err := windows.OpenService(
+		scm, name, windows.SERVICE_QUERY_STATUS)
+	if err != nil {
+		return driverError(err, 0)
+	}
+	defer func() { _ = windows.CloseServiceHandle(service) }()
+	var status windows.SERVICE_STATUS
+	err = windows.QueryServiceStatus(service, &status)
+	return driverError(err, status.CurrentState)
+}
+
+// driverError maps the result of querying the state of the
+// driver service into the errors reported by Preflight.
+func driverError(err error, state uint32) error {
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return ErrDriverNotInstalled
+	}
+	if err != nil {
+		return errors.Wrap(err, "query winfsp driver service")
+	}
+	if state != windows.SERVICE_RUNNING {
+		return errors.Wrapf(ErrDriverNotRunning, "service state %d", state)
+	}
+	return nil
+}
+
+// checkMountPoint ensures the mount point is available.
+func checkMountPoint(mountpoint string) error {
+	drives, err := windows.GetLogicalDrives()
+	if err != nil {
+		return errors.Wrap(err, "get logical drives")
+	}
+	if mountpoint == AutoDriveLetter {
+		if drives&((1<<26)-1) == (1<<26)-1 {
+			return errors.New("no free drive letter")
+		}
+		return nil
+	}
+	if !isDirectoryMountPoint(mountpoint) {
+		letter, _ := driveLetter(trimLongPathPrefix(mountpoint))
+		if drives&(1<<(letter[0]-'A')) != 0 {
+			return errors.Errorf("drive %s: in use", letter)
+		}
+		return nil
+	}
+	_, _, err = checkMountDirectory(mountpoint)
+	return err
+}
@@ -0,0 +1,31 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestDriverError(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(driverError(nil, windows.SERVICE_RUNNING))
+	assert.Equal(ErrDriverNotInstalled,
+		driverError(windows.ERROR_SERVICE_DOES_NOT_EXIST, 0))
+
+	// The stopped or transitioning driver is not started by
+	// the check, but reported as not running.
+	for _, state := range []uint32{
+		windows.SERVICE_STOPPED,
+		windows.SERVICE_START_PENDING,
+		windows.SERVICE_STOP_PENDING,
+	} {
+		assert.Equal(ErrDriverNotRunning,
+			errors.Cause(driverError(nil, state)), state)
+	}
+
+	// The other failures are neither of the errors above.
+	err := driverError(windows.ERROR_ACCESS_DENIED, 0)
+	assert.Equal(windows.ERROR_ACCESS_DENIED, errors.Cause(err))
+}
@@ -0,0 +1,113 @@
+package winfsp
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// ProcessAccessPolicy decides whether the process is allowed
+// to open the file with the granted access.
+//
+// The image is the full path to the executable of the process,
+// which will be empty if it cannot be resolved. Creating files
+// is considered as opening them with FILE_WRITE_DATA, and
+// renaming files is considered as opening the target with
+// DELETE.
+type ProcessAccessPolicy func(
+	pid uint32, image, name string, grantedAccess uint32,
+) bool
+
+// ProcessAccess restricts the processes that are able to
+// open, create or rename files on the file system, and the
+// operations will fail with STATUS_ACCESS_DENIED when the
+// policy denies them.
+func ProcessAccess(policy ProcessAccessPolicy) Option {
+	return func(o *option) {
+		o.processAccess = policy
+	}
+}
+
+// writeAccessMask are the access rights regarded as writing.
+const writeAccessMask = windows.FILE_WRITE_DATA |
+	windows.FILE_APPEND_DATA |
+	windows.FILE_WRITE_ATTRIBUTES |
+	windows.FILE_WRITE_EA |
+	windows.DELETE |
+	windows.WRITE_DAC |
+	windows.WRITE_OWNER
+
+func matchProcessImage(image string, patterns []string) bool {
+	if image == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, `\/`) {
+			if strings.EqualFold(
+				filepath.Clean(pattern), filepath.Clean(image)) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, filepath.Base(image)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowProcessImages creates the policy which allows only
+// the readers to open files for reading, and the writers
+// to open files for both reading and writing.
+//
+// The images are full paths to the executables, or their
+// base names if they contain no path separator, which are
+// both compared case insensitively.
+func AllowProcessImages(readers, writers []string) ProcessAccessPolicy {
+	return func(
+		pid uint32, image, name string, grantedAccess uint32,
+	) bool {
+		if matchProcessImage(image, writers) {
+			return true
+		}
+		if grantedAccess&writeAccessMask != 0 {
+			return false
+		}
+		return matchProcessImage(image, readers)
+	}
+}
+
+// processImage resolves the full path to the executable of
+// the process, returning empty string on failure.
+func processImage(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	process, err := windows.OpenProcess(
+		windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = windows.CloseHandle(process) }()
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(
+		process, 0, &buf[0], &size); err != nil {
+		return ""
+	}
+	return windows.UTF16ToString(buf[:size])
+}
+
+// checkProcessAccess evaluates the process access policy
+// against the process originating current operation.
+func (ref *FileSystemRef) checkProcessAccess(
+	name string, grantedAccess uint32,
+) error {
+	if ref.processAccess == nil {
+		return nil
+	}
+	pid := OperationProcessId()
+	if !ref.processAccess(pid, processImage(pid), name, grantedAccess) {
+		return windows.STATUS_ACCESS_DENIED
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package winfsp
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestAllowProcessImages(t *testing.T) {
+	assert := assert.New(t)
+	policy := AllowProcessImages(
+		[]string{"reader.exe"},
+		[]string{`C:\Program Files\App\writer.exe`})
+	read := uint32(windows.FILE_READ_DATA)
+	write := uint32(windows.FILE_READ_DATA | windows.FILE_WRITE_DATA)
+
+	assert.True(policy(1, `C:\bin\READER.EXE`, `\file`, read))
+	assert.False(policy(1, `C:\bin\reader.exe`, `\file`, write))
+	assert.False(policy(1, `C:\bin\reader.exe`, `\file`, windows.DELETE))
+	assert.True(policy(1, `c:\program files\app\writer.exe`, `\file`, write))
+	assert.True(policy(1, `C:\Program Files\App\.\writer.exe`, `\file`, read))
+
+	// The writers are matched by the full paths only.
+	assert.False(policy(1, `C:\Temp\writer.exe`, `\file`, read))
+	assert.False(policy(1, `C:\bin\other.exe`, `\file`, read))
+	assert.False(policy(0, "", `\file`, read))
+}
+
+type processBase struct {
+	swapBase
+	opened *[]string
+}
+
+func (b processBase) Open(
+	fs *FileSystemRef, name string,
+	createOptions, grantedAccess uint32,
+	info *FSP_FSCTL_FILE_INFO,
+) (uintptr, error) {
+	*b.opened = append(*b.opened, name)
+	return 1, nil
+}
+
+func TestProcessAccess(t *testing.T) {
+	assert := assert.New(t)
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+	var opened []string
+	ref, fileSystem := delegateTestRef(t, processBase{opened: &opened})
+	type request struct {
+		pid    uint32
+		image  string
+		name   string
+		access uint32
+	}
+	var requests []request
+	ref.processAccess = func(
+		pid uint32, image, name string, grantedAccess uint32,
+	) bool {
+		requests = append(requests, request{pid, image, name, grantedAccess})
+		return name != `\secret`
+	}
+	open := func(name string) windows.NTStatus {
+		var file uintptr
+		var info FSP_FSCTL_OPEN_FILE_INFO
+		return delegateOpen(fileSystem,
+			uintptr(unsafe.Pointer(windows.StringToUTF16Ptr(name))),
+			0, windows.FILE_READ_DATA, &file,
+			uintptr(unsafe.Pointer(&info)))
+	}
+
+	// The denied opens never reach the behaviours, and the
+	// process is unknown outside the dispatcher.
+	assert.Equal(windows.STATUS_ACCESS_DENIED, open(`\secret`))
+	assert.Equal(windows.STATUS_SUCCESS, open(`\public`))
+	assert.Equal([]string{`\public`}, opened)
+	assert.Equal([]request{
+		{0, "", `\secret`, windows.FILE_READ_DATA},
+		{0, "", `\public`, windows.FILE_READ_DATA},
+	}, requests)
+}
@@ -0,0 +1,62 @@
+package winfsp
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// BehaviourOpenRaw opens the file specified by the name in
+// UTF-16, which is prioritized over the Open of the base.
+//
+// The name is not converted into string before calling it,
+// so that the file systems whose backends take UTF-16 names
+// could save the conversions on the hot path. The name is
+// only valid during the call, and can be viewed by the
+// RawNameSlice or converted by the RawNameString.
+type BehaviourOpenRaw interface {
+	OpenRawName(
+		fs *FileSystemRef, name *uint16,
+		createOptions, grantedAccess uint32,
+		info *FSP_FSCTL_FILE_INFO,
+	) (uintptr, error)
+}
+
+// BehaviourGetSecurityByNameRaw is the GetSecurityByName
+// taking the name in UTF-16, which is prioritized over the
+// BehaviourGetSecurityByName. See BehaviourOpenRaw for the
+// validity of the name.
+type BehaviourGetSecurityByNameRaw interface {
+	GetSecurityByNameRawName(
+		fs *FileSystemRef, name *uint16,
+		flags GetSecurityByNameFlags,
+	) (uint32, *windows.SECURITY_DESCRIPTOR, error)
+}
+
+// RawNameSlice views the NUL terminated UTF-16 name as a
+// slice without copying, which is only valid while the
+// name is valid.
+func RawNameSlice(name *uint16) []uint16 {
+	if name == nil {
+		return nil
+	}
+	n := 0
+	for ptr := unsafe.Pointer(name); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return unsafe.Slice(name, n)
+}
+
+// RawNameString converts the UTF-16 name into string, in
+// the same way as the names passed to the behaviours.
+func RawNameString(name *uint16) string {
+	return utf16PtrToString(uintptr(unsafe.Pointer(name)))
+}
+
+// namesRequired tells whether the names of the files being
+// opened are required by the checks or the tracking, which
+// must be converted even if the behaviour takes raw names.
+func (ref *FileSystemRef) namesRequired() bool {
+	return ref.trackNames || ref.processAccess != nil ||
+		ref.securitySource != nil
+}
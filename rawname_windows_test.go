@@ -0,0 +1,23 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestRawName(t *testing.T) {
+	assert := assert.New(t)
+	name, err := windows.UTF16PtrFromString(`\dir\file`)
+	assert.NoError(err)
+	slice := RawNameSlice(name)
+	assert.Len(slice, 9)
+	assert.Equal(uint16('\\'), slice[0])
+	assert.Equal(`\dir\file`, RawNameString(name))
+
+	empty, err := windows.UTF16PtrFromString("")
+	assert.NoError(err)
+	assert.Empty(RawNameSlice(empty))
+	assert.Nil(RawNameSlice(nil))
+}
@@ -0,0 +1,78 @@
+package winfsp
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// maxFileSystems is the maximum number of file systems
+// mounted at the same time in a process, as documented on
+// the Mount.
+const maxFileSystems = 1024
+
+// refEntry is the file system registered in a slot, with
+// the handle stored in the UserContext of FSP_FILE_SYSTEM.
+type refEntry struct {
+	handle uintptr
+	ref    *FileSystemRef
+}
+
+// refTable maps the handles stored in the UserContext to
+// the file systems, which is looked up by every callback.
+//
+// The handle is made of the index of the slot and the
+// generation of the slot, so the lookup is a load of the
+// slot plus a comparison, while a stale handle of the file
+// system unmounted will never resolve to the one mounted
+// later in the same slot.
+type refTable struct {
+	mtx         sync.Mutex
+	slots       [maxFileSystems]unsafe.Pointer
+	generations [maxFileSystems]uintptr
+}
+
+var refMap refTable
+
+// register allocates a slot for the file system.
+func (t *refTable) register(ref *FileSystemRef) (uintptr, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for index := range t.slots {
+		if t.slots[index] != nil {
+			continue
+		}
+		t.generations[index]++
+		handle := t.generations[index]*maxFileSystems + uintptr(index)
+		atomic.StorePointer(&t.slots[index], unsafe.Pointer(&refEntry{
+			handle: handle,
+			ref:    ref,
+		}))
+		return handle, nil
+	}
+	return 0, errors.Errorf(
+		"too many file systems, at most %d", maxFileSystems)
+}
+
+// unregister releases the slot of the file system.
+func (t *refTable) unregister(handle uintptr) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	index := handle % maxFileSystems
+	entry := (*refEntry)(t.slots[index])
+	if entry != nil && entry.handle == handle {
+		atomic.StorePointer(&t.slots[index], nil)
+	}
+}
+
+// load resolves the handle into the file system.
+func (t *refTable) load(handle uintptr) *FileSystemRef {
+	entry := (*refEntry)(atomic.LoadPointer(
+		&t.slots[handle%maxFileSystems]))
+	if entry == nil || entry.handle != handle {
+		return nil
+	}
+	return entry.ref
+}
@@ -0,0 +1,71 @@
+package winfsp
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefTable(t *testing.T) {
+	assert := assert.New(t)
+	var table refTable
+	first, second := &FileSystemRef{}, &FileSystemRef{}
+	handle, err := table.register(first)
+	assert.NoError(err)
+	assert.Same(first, table.load(handle))
+	assert.Nil(table.load(handle + 1))
+
+	// The stale handle must not resolve to the file system
+	// registered later in the same slot.
+	table.unregister(handle)
+	assert.Nil(table.load(handle))
+	reused, err := table.register(second)
+	assert.NoError(err)
+	assert.NotEqual(handle, reused)
+	assert.Equal(handle%maxFileSystems, reused%maxFileSystems)
+	assert.Nil(table.load(handle))
+	assert.Same(second, table.load(reused))
+	table.unregister(handle)
+	assert.Same(second, table.load(reused))
+}
+
+func TestRefTableFull(t *testing.T) {
+	assert := assert.New(t)
+	var table refTable
+	handles := make([]uintptr, maxFileSystems)
+	for i := range handles {
+		handle, err := table.register(&FileSystemRef{})
+		assert.NoError(err)
+		handles[i] = handle
+	}
+
+	// The table is full until some file system unregisters.
+	_, err := table.register(&FileSystemRef{})
+	assert.Error(err)
+	table.unregister(handles[0])
+	_, err = table.register(&FileSystemRef{})
+	assert.NoError(err)
+}
+
+func BenchmarkRefTableLoad(b *testing.B) {
+	var table refTable
+	handle, _ := table.register(&FileSystemRef{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = table.load(handle)
+	}
+}
+
+// BenchmarkSyncMapLoad is the baseline of the lookup by the
+// sync.Map keyed by the handle, which the refTable replaces.
+func BenchmarkSyncMapLoad(b *testing.B) {
+	var table sync.Map
+	handle := uintptr(1)
+	table.Store(handle, &FileSystemRef{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		value, _ := table.Load(handle)
+		_ = value.(*FileSystemRef)
+	}
+}
@@ -0,0 +1,131 @@
+package winfsp
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// RemovedHandler is called when the volume is removed without
+// calling Unmount, e.g. ejected by the user, dismounted through
+// "mountvol /d", or the driver being stopped. The error is the
+// result of the dispatcher, or nil if it stopped successfully.
+//
+// The file system must still be unmounted by calling Unmount,
+// which can be done inside the handler.
+type RemovedHandler func(fs *FileSystem, err error)
+
+// Removed sets the handler of the volume being removed.
+func Removed(handler RemovedHandler) Option {
+	return func(o *option) {
+		o.removedHandler = handler
+	}
+}
+
+// removalWatch waits for the dispatcher of the file system to
+// stop, which is the result of removing the volume.
+type removalWatch struct {
+	mtx        sync.Mutex
+	unmounting bool
+	done       chan struct{}
+	err        error
+}
+
+// watchRemoval starts waiting for the dispatcher thread, which
+// must be called after the dispatcher has been started.
+func (f *FileSystem) watchRemoval(handler RemovedHandler) error {
+	// The dispatcher thread handle will be closed when the
+	// dispatcher is stopped, so we must wait on a duplicate.
+	process := windows.CurrentProcess()
+	var thread windows.Handle
+	if err := windows.DuplicateHandle(
+		process, f.fileSystem.DispatcherThread,
+		process, &thread, 0, false, windows.DUPLICATE_SAME_ACCESS,
+	); err != nil {
+		return errors.Wrap(err, "duplicate dispatcher thread")
+	}
+	f.removal.done = make(chan struct{})
+	go func() {
+		defer close(f.removal.done)
+		defer f.cancel()
+		_, _ = windows.WaitForSingleObject(thread, windows.INFINITE)
+		_ = windows.CloseHandle(thread)
+		removed, err := f.removalResult()
+		if !removed {
+			return
+		}
+		f.removal.err = err
+		if handler != nil {
+			handler(f, err)
+		}
+	}()
+	return nil
+}
+
+// removalResult checks whether the dispatcher stopped due to
+// removal, and retrieves its result before it is unmounted.
+func (f *FileSystem) removalResult() (bool, error) {
+	f.removal.mtx.Lock()
+	defer f.removal.mtx.Unlock()
+	if f.removal.unmounting {
+		return false, nil
+	}
+	if status := f.fileSystem.DispatcherResult; status != windows.STATUS_SUCCESS {
+		return true, status
+	}
+	return true, nil
+}
+
+// beginUnmount marks the file system as being unmounted, so
+// that stopping the dispatcher is not reported as removal.
+func (f *FileSystem) beginUnmount() {
+	f.removal.mtx.Lock()
+	defer f.removal.mtx.Unlock()
+	f.removal.unmounting = true
+}
+
+// Done returns the channel closed when the file system stops
+// serving, either being unmounted or removed externally.
+func (f *FileSystem) Done() <-chan struct{} {
+	return f.removal.done
+}
+
+// Wait blocks until the file system stops serving, and
+// returns the error of the dispatcher if the volume has been
+// removed due to failure. Nil is returned when the file
+// system is unmounted or removed gracefully.
+func (f *FileSystem) Wait() error {
+	<-f.removal.done
+	return f.removal.err
+}
+
+// BehaviourDispatcherStopped is notified when the dispatcher
+// of the file system has stopped, normally being true when
+// it is stopped by unmounting, or false when it is stopped
+// due to failure, e.g. the WinFSP service being stopped.
+//
+// The notification might come from the dispatcher thread,
+// so the file system must not be unmounted inside it, which
+// should be done after FileSystem.Done is closed instead.
+type BehaviourDispatcherStopped interface {
+	DispatcherStopped(fs *FileSystemRef, normally bool)
+}
+
+func delegateDispatcherStopped(fileSystem uintptr, normally uint8) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return
+	}
+	b, op := ref.beginOperation("DispatcherStopped", 0, 0)
+	defer ref.endOperation(b, op, nil)
+	b.dispatcherStopped.DispatcherStopped(ref, normally != 0)
+}
+
+var go_delegateDispatcherStopped = syscall.NewCallbackCDecl(func(
+	fileSystem uintptr, normally uint8,
+) uintptr {
+	delegateDispatcherStopped(fileSystem, normally)
+	return 0
+})
@@ -0,0 +1,70 @@
+package winfsp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+// removalTestFS creates the file system whose dispatcher
+// thread is imitated by the returned event, which is signaled
+// to stop the dispatcher.
+func removalTestFS(t *testing.T) (*FileSystem, windows.Handle) {
+	t.Helper()
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	t.Cleanup(func() { _ = windows.CloseHandle(event) })
+	f := &FileSystem{}
+	f.fileSystem = &FSP_FILE_SYSTEM{DispatcherThread: event}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	return f, event
+}
+
+func TestRemoved(t *testing.T) {
+	assert := assert.New(t)
+	f, event := removalTestFS(t)
+	removed := make(chan error, 1)
+	if !assert.NoError(f.watchRemoval(func(fs *FileSystem, err error) {
+		assert.Same(f, fs)
+		removed <- err
+	})) {
+		return
+	}
+	select {
+	case <-f.Done():
+		assert.Fail("done before the dispatcher stops")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The result of the dispatcher is reported to the handler
+	// and by Wait after the volume is removed.
+	f.fileSystem.DispatcherResult = windows.STATUS_DEVICE_NOT_CONNECTED
+	assert.NoError(windows.SetEvent(event))
+	assert.Equal(windows.STATUS_DEVICE_NOT_CONNECTED, f.Wait())
+	assert.Equal(windows.STATUS_DEVICE_NOT_CONNECTED, <-removed)
+	assert.Error(f.ctx.Err())
+}
+
+func TestRemovedUnmounting(t *testing.T) {
+	assert := assert.New(t)
+	f, event := removalTestFS(t)
+	removed := false
+	if !assert.NoError(f.watchRemoval(func(*FileSystem, error) {
+		removed = true
+	})) {
+		return
+	}
+
+	// Stopping the dispatcher by unmounting is not removal.
+	f.beginUnmount()
+	f.fileSystem.DispatcherResult = windows.STATUS_CANCELLED
+	assert.NoError(windows.SetEvent(event))
+	assert.NoError(f.Wait())
+	assert.False(removed)
+	assert.Error(f.ctx.Err())
+}
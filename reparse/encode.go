@@ -0,0 +1,99 @@
+package reparse
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+
+	"github.com/aegistudio/go-winfsp/wtf8"
+)
+
+// MaxDataSize is the maximum size of the REPARSE_DATA_BUFFER,
+// i.e. MAXIMUM_REPARSE_DATA_BUFFER_SIZE.
+const MaxDataSize = 16 * 1024
+
+// Encode encodes the point into the REPARSE_DATA_BUFFER,
+// which is the reverse of the Decode.
+//
+// The names of the junctions are terminated by NUL as the
+// NTFS requires, while those of the symbolic links are not.
+func Encode(p Point) ([]byte, error) {
+	var body []byte
+	switch point := p.(type) {
+	case *Symlink:
+		flags := uint32(0)
+		if point.Relative {
+			flags |= symlinkFlagRelative
+		}
+		names, err := encodeNames(point.Target, point.PrintName, false)
+		if err != nil {
+			return nil, err
+		}
+		// The flags are placed between the header of the
+		// names and the path buffer.
+		body = make([]byte, 12, len(names)+4)
+		copy(body, names[:8])
+		binary.LittleEndian.PutUint32(body[8:12], flags)
+		body = append(body, names[8:]...)
+	case *Junction:
+		names, err := encodeNames(point.Target, point.PrintName, true)
+		if err != nil {
+			return nil, err
+		}
+		body = names
+	case *AppExecLink:
+		body = make([]byte, 4)
+		binary.LittleEndian.PutUint32(body, point.Version)
+		for _, s := range []string{
+			point.PackageID, point.AppID, point.Target,
+		} {
+			body = append(appendUTF16(body, s), 0, 0)
+		}
+	case *LxSymlink:
+		body = append([]byte{2, 0, 0, 0}, point.Target...)
+	case *Opaque:
+		body = point.Data
+	default:
+		return nil, errors.Errorf("unsupported reparse point %T", p)
+	}
+	if headerSize+len(body) > MaxDataSize {
+		return nil, errors.Errorf(
+			"reparse data size %d too large", headerSize+len(body))
+	}
+	data := make([]byte, headerSize, headerSize+len(body))
+	binary.LittleEndian.PutUint32(data[0:4], uint32(p.Tag()))
+	binary.LittleEndian.PutUint16(data[4:6], uint16(len(body)))
+	return append(data, body...), nil
+}
+
+// encodeNames encodes the substitute name and the print
+// name, returning the offsets and lengths header followed
+// by the path buffer.
+func encodeNames(substitute, printName string, nul bool) ([]byte, error) {
+	var terminator []byte
+	if nul {
+		terminator = []byte{0, 0}
+	}
+	buffer := append(appendUTF16(nil, substitute), terminator...)
+	substituteLength := len(buffer) - len(terminator)
+	printOffset := len(buffer)
+	buffer = append(appendUTF16(buffer, printName), terminator...)
+	printLength := len(buffer) - len(terminator) - printOffset
+	if len(buffer) > MaxDataSize {
+		return nil, errors.Errorf(
+			"reparse names size %d too large", len(buffer))
+	}
+	header := make([]byte, 8, 8+len(buffer))
+	binary.LittleEndian.PutUint16(header[0:2], 0)
+	binary.LittleEndian.PutUint16(header[2:4], uint16(substituteLength))
+	binary.LittleEndian.PutUint16(header[4:6], uint16(printOffset))
+	binary.LittleEndian.PutUint16(header[6:8], uint16(printLength))
+	return append(header, buffer...), nil
+}
+
+func appendUTF16(b []byte, s string) []byte {
+	for _, c := range wtf8.Encode(s) {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return b
+}
@@ -0,0 +1,45 @@
+//go:build go1.18
+// +build go1.18
+
+package reparse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzParseReparse(f *testing.F) {
+	relative := uint32(symlinkFlagRelative)
+	f.Add(reparseBuffer(TagSymlink,
+		linkBody(`..\target`, `..\target`, &relative)))
+	f.Add(reparseBuffer(TagMountPoint,
+		linkBody(`\??\C:\data`, `C:\data`, nil)))
+	f.Add(reparseBuffer(TagAppExecLink, append(appendUint32(nil, 3),
+		encodeUTF16("pkg\x00pkg!App\x00C:\\a.exe\x00")...)))
+	f.Add(reparseBuffer(TagLxSymlink, []byte("\x02\x00\x00\x00/bin")))
+	f.Add(reparseBuffer(TagCloud, []byte{1, 2, 3}))
+	f.Add(reparseBuffer(TagSymlink, []byte{
+		0xfe, 0xff, 0x02, 0x00, 0, 0, 0, 0, 0, 0, 0, 0,
+	}))
+	f.Add(reparseBuffer(TagSymlink, linkBody("\xed\xa0\x80", "a", &relative)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The buffer comes from the kernel, and resolving its
+		// name offsets must never panic.
+		point, err := Decode(data)
+		if err != nil {
+			return
+		}
+
+		// The decoded point must survive encoding, unless it
+		// is larger than any reparse point could be.
+		encoded, err := Encode(point)
+		if err != nil {
+			assert.Greater(t, len(data), MaxDataSize)
+			return
+		}
+		decoded, err := Decode(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, point, decoded)
+	})
+}
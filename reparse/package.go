@@ -0,0 +1,15 @@
+// Package reparse recognizes and decodes the reparse points
+// of windows, i.e. the REPARSE_DATA_BUFFER structures.
+//
+// Besides the symbolic links and junctions, the files might
+// carry reparse points of other kinds, e.g. the app execution
+// aliases under WindowsApps, the placeholders of cloud files
+// and the layers of windows containers. Only the tags marked
+// as name surrogates redirect the file to another name, while
+// the others should be surfaced as the ordinary files, so the
+// passthrough file systems should check Tag.IsNameSurrogate
+// instead of failing to open the files with unknown tags.
+//
+// The points can also be encoded with Encode, e.g. by the
+// file systems reporting the symbolic links they store.
+package reparse
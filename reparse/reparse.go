@@ -0,0 +1,315 @@
+package reparse
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/aegistudio/go-winfsp/wtf8"
+)
+
+// Tag is the reparse tag identifying the kind of the point.
+type Tag uint32
+
+const (
+	TagMountPoint      Tag = 0xA0000003
+	TagHSM             Tag = 0xC0000004
+	TagHSM2            Tag = 0x80000006
+	TagSIS             Tag = 0x80000007
+	TagWIM             Tag = 0x80000008
+	TagCSV             Tag = 0x80000009
+	TagDFS             Tag = 0x8000000A
+	TagSymlink         Tag = 0xA000000C
+	TagDFSR            Tag = 0x80000012
+	TagDedup           Tag = 0x80000013
+	TagNFS             Tag = 0x80000014
+	TagFilePlaceholder Tag = 0x80000015
+	TagWOF             Tag = 0x80000017
+	TagWCI             Tag = 0x80000018
+	TagWCI1            Tag = 0x90001018
+	TagGlobalReparse   Tag = 0xA0000019
+	TagCloud           Tag = 0x9000001A
+	TagAppExecLink     Tag = 0x8000001B
+	TagProjFS          Tag = 0x9000001C
+	TagLxSymlink       Tag = 0xA000001D
+	TagStorageSync     Tag = 0x8000001E
+	TagWCITombstone    Tag = 0xA000001F
+	TagUnhandled       Tag = 0x80000020
+	TagOneDrive        Tag = 0x80000021
+	TagProjFSTombstone Tag = 0xA0000022
+	TagAFUnix          Tag = 0x80000023
+	TagLxFIFO          Tag = 0x80000024
+	TagLxCHR           Tag = 0x80000025
+	TagLxBLK           Tag = 0x80000026
+	TagWCILink         Tag = 0xA0000027
+	TagWCILink1        Tag = 0xA0001027
+)
+
+const (
+	tagMicrosoft     = 0x80000000
+	tagNameSurrogate = 0x20000000
+	tagDirectory     = 0x10000000
+
+	// tagCloudMask extracts the cloud tag from its variants
+	// TagCloud1 through TagCloudF, which carry the provider
+	// specific bits in 12-15.
+	tagCloudMask = 0xFFFF0FFF
+)
+
+var tagNames = map[Tag]string{
+	TagMountPoint:      "MOUNT_POINT",
+	TagHSM:             "HSM",
+	TagHSM2:            "HSM2",
+	TagSIS:             "SIS",
+	TagWIM:             "WIM",
+	TagCSV:             "CSV",
+	TagDFS:             "DFS",
+	TagSymlink:         "SYMLINK",
+	TagDFSR:            "DFSR",
+	TagDedup:           "DEDUP",
+	TagNFS:             "NFS",
+	TagFilePlaceholder: "FILE_PLACEHOLDER",
+	TagWOF:             "WOF",
+	TagWCI:             "WCI",
+	TagWCI1:            "WCI_1",
+	TagGlobalReparse:   "GLOBAL_REPARSE",
+	TagCloud:           "CLOUD",
+	TagAppExecLink:     "APPEXECLINK",
+	TagProjFS:          "PROJFS",
+	TagLxSymlink:       "LX_SYMLINK",
+	TagStorageSync:     "STORAGE_SYNC",
+	TagWCITombstone:    "WCI_TOMBSTONE",
+	TagUnhandled:       "UNHANDLED",
+	TagOneDrive:        "ONEDRIVE",
+	TagProjFSTombstone: "PROJFS_TOMBSTONE",
+	TagAFUnix:          "AF_UNIX",
+	TagLxFIFO:          "LX_FIFO",
+	TagLxCHR:           "LX_CHR",
+	TagLxBLK:           "LX_BLK",
+	TagWCILink:         "WCI_LINK",
+	TagWCILink1:        "WCI_LINK_1",
+}
+
+func (t Tag) String() string {
+	if name, ok := tagNames[t]; ok {
+		return name
+	}
+	if t.IsCloud() {
+		return fmt.Sprintf("CLOUD_%X", (uint32(t)>>12)&0xf)
+	}
+	return fmt.Sprintf("0x%08X", uint32(t))
+}
+
+// IsMicrosoft reports whether the tag is defined by Microsoft.
+func (t Tag) IsMicrosoft() bool {
+	return t&tagMicrosoft != 0
+}
+
+// IsNameSurrogate reports whether the point redirects the file
+// to another name, which is the case of links.
+func (t Tag) IsNameSurrogate() bool {
+	return t&tagNameSurrogate != 0
+}
+
+// IsDirectory reports whether the point might be set on the
+// directories which are not empty.
+func (t Tag) IsDirectory() bool {
+	return t&tagDirectory != 0
+}
+
+// IsCloud reports whether the tag is the placeholder of cloud
+// files, including its provider specific variants.
+func (t Tag) IsCloud() bool {
+	return t&tagCloudMask == TagCloud
+}
+
+// IsContainer reports whether the tag belongs to the windows
+// container isolation, i.e. the WCI tags.
+func (t Tag) IsContainer() bool {
+	switch t {
+	case TagWCI, TagWCI1, TagWCITombstone, TagWCILink, TagWCILink1:
+		return true
+	}
+	return false
+}
+
+// IsPlaceholder reports whether the file is a placeholder of
+// the content stored elsewhere, which is hydrated on reading.
+func (t Tag) IsPlaceholder() bool {
+	switch {
+	case t.IsCloud(), t == TagFilePlaceholder, t == TagProjFS,
+		t == TagHSM, t == TagHSM2, t == TagStorageSync:
+		return true
+	}
+	return false
+}
+
+// Point is the decoded reparse point.
+type Point interface {
+	Tag() Tag
+}
+
+// Symlink is the symbolic link, i.e. IO_REPARSE_TAG_SYMLINK.
+type Symlink struct {
+	Target    string
+	PrintName string
+	Relative  bool
+}
+
+func (*Symlink) Tag() Tag { return TagSymlink }
+
+// Junction is the mount point, i.e. IO_REPARSE_TAG_MOUNT_POINT.
+type Junction struct {
+	Target    string
+	PrintName string
+}
+
+func (*Junction) Tag() Tag { return TagMountPoint }
+
+// AppExecLink is the app execution alias of the packaged apps,
+// i.e. IO_REPARSE_TAG_APPEXECLINK.
+type AppExecLink struct {
+	Version   uint32
+	PackageID string
+	AppID     string
+	Target    string
+}
+
+func (*AppExecLink) Tag() Tag { return TagAppExecLink }
+
+// LxSymlink is the symbolic link created by WSL, which holds
+// the POSIX target, i.e. IO_REPARSE_TAG_LX_SYMLINK.
+type LxSymlink struct {
+	Target string
+}
+
+func (*LxSymlink) Tag() Tag { return TagLxSymlink }
+
+// Opaque is the point whose data is not decoded, e.g. the
+// placeholders of cloud files and the WCI tags, whose formats
+// are private to their filters.
+type Opaque struct {
+	ReparseTag Tag
+	Data       []byte
+}
+
+func (p *Opaque) Tag() Tag { return p.ReparseTag }
+
+const (
+	headerSize = 8
+
+	// symlinkFlagRelative is SYMLINK_FLAG_RELATIVE.
+	symlinkFlagRelative = 0x00000001
+)
+
+var errTruncated = errors.New("truncated reparse data")
+
+// Decode decodes the REPARSE_DATA_BUFFER. The points with
+// tags not decoded by this package are returned as Opaque.
+func Decode(data []byte) (Point, error) {
+	if len(data) < headerSize {
+		return nil, errTruncated
+	}
+	tag := Tag(binary.LittleEndian.Uint32(data[0:4]))
+	length := int(binary.LittleEndian.Uint16(data[4:6]))
+	if len(data) < headerSize+length {
+		return nil, errTruncated
+	}
+	body := data[headerSize : headerSize+length]
+	switch tag {
+	case TagSymlink:
+		if len(body) < 12 {
+			return nil, errTruncated
+		}
+		target, printName, err := decodeNames(body[:8], body[12:])
+		if err != nil {
+			return nil, err
+		}
+		flags := binary.LittleEndian.Uint32(body[8:12])
+		return &Symlink{
+			Target:    target,
+			PrintName: printName,
+			Relative:  flags&symlinkFlagRelative != 0,
+		}, nil
+	case TagMountPoint:
+		if len(body) < 8 {
+			return nil, errTruncated
+		}
+		target, printName, err := decodeNames(body[:8], body[8:])
+		if err != nil {
+			return nil, err
+		}
+		return &Junction{Target: target, PrintName: printName}, nil
+	case TagAppExecLink:
+		if len(body) < 4 {
+			return nil, errTruncated
+		}
+		strings := splitStrings(body[4:])
+		if len(strings) < 3 {
+			return nil, errors.Errorf(
+				"appexeclink has %d strings", len(strings))
+		}
+		return &AppExecLink{
+			Version:   binary.LittleEndian.Uint32(body[0:4]),
+			PackageID: strings[0],
+			AppID:     strings[1],
+			Target:    strings[2],
+		}, nil
+	case TagLxSymlink:
+		if len(body) < 4 {
+			return nil, errTruncated
+		}
+		return &LxSymlink{Target: string(body[4:])}, nil
+	default:
+		return &Opaque{
+			ReparseTag: tag,
+			Data:       append([]byte(nil), body...),
+		}, nil
+	}
+}
+
+// decodeNames decodes the substitute name and the print name
+// referenced by the offsets and lengths in the header.
+func decodeNames(header, buffer []byte) (string, string, error) {
+	name := func(offset, length uint16) (string, error) {
+		if int(offset)+int(length) > len(buffer) || length%2 != 0 {
+			return "", errTruncated
+		}
+		return decodeUTF16(buffer[offset : offset+length]), nil
+	}
+	substitute, err := name(
+		binary.LittleEndian.Uint16(header[0:2]),
+		binary.LittleEndian.Uint16(header[2:4]))
+	if err != nil {
+		return "", "", err
+	}
+	printName, err := name(
+		binary.LittleEndian.Uint16(header[4:6]),
+		binary.LittleEndian.Uint16(header[6:8]))
+	if err != nil {
+		return "", "", err
+	}
+	return substitute, printName, nil
+}
+
+func decodeUTF16(b []byte) string {
+	s := make([]uint16, len(b)/2)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return wtf8.Decode(s)
+}
+
+// splitStrings splits the NUL terminated UTF-16 strings.
+func splitStrings(b []byte) []string {
+	var result []string
+	start := 0
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			result = append(result, decodeUTF16(b[start:i]))
+			start = i + 2
+		}
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package reparse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aegistudio/go-winfsp/wtf8"
+)
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return appendUint16(appendUint16(b, uint16(v)), uint16(v>>16))
+}
+
+func encodeUTF16(s string) []byte {
+	var b []byte
+	for _, c := range wtf8.Encode(s) {
+		b = appendUint16(b, c)
+	}
+	return b
+}
+
+func reparseBuffer(tag Tag, body []byte) []byte {
+	b := appendUint32(nil, uint32(tag))
+	b = appendUint16(b, uint16(len(body)))
+	b = appendUint16(b, 0)
+	return append(b, body...)
+}
+
+func linkBody(target, printName string, flags *uint32) []byte {
+	substitute, display := encodeUTF16(target), encodeUTF16(printName)
+	var b []byte
+	b = appendUint16(b, 0)
+	b = appendUint16(b, uint16(len(substitute)))
+	b = appendUint16(b, uint16(len(substitute)))
+	b = appendUint16(b, uint16(len(display)))
+	if flags != nil {
+		b = appendUint32(b, *flags)
+	}
+	b = append(b, substitute...)
+	return append(b, display...)
+}
+
+func TestDecodeLinks(t *testing.T) {
+	assert := assert.New(t)
+	relative := uint32(symlinkFlagRelative)
+	point, err := Decode(reparseBuffer(TagSymlink,
+		linkBody(`..\target`, `..\target`, &relative)))
+	assert.NoError(err)
+	assert.Equal(&Symlink{
+		Target: `..\target`, PrintName: `..\target`, Relative: true,
+	}, point)
+	assert.True(point.Tag().IsNameSurrogate())
+
+	point, err = Decode(reparseBuffer(TagMountPoint,
+		linkBody(`\??\C:\data`, `C:\data`, nil)))
+	assert.NoError(err)
+	assert.Equal(&Junction{
+		Target: `\??\C:\data`, PrintName: `C:\data`,
+	}, point)
+
+	point, err = Decode(reparseBuffer(TagLxSymlink,
+		append([]byte{2, 0, 0, 0}, "/usr/bin/env"...)))
+	assert.NoError(err)
+	assert.Equal(&LxSymlink{Target: "/usr/bin/env"}, point)
+
+	// The offsets must not exceed the path buffer.
+	broken := linkBody("target", "target", nil)
+	broken[2] = 0xff
+	_, err = Decode(reparseBuffer(TagMountPoint, broken))
+	assert.Error(err)
+	_, err = Decode(reparseBuffer(TagSymlink, nil)[:6])
+	assert.Error(err)
+}
+
+func TestDecodeAppExecLink(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte{3, 0, 0, 0}
+	for _, s := range []string{
+		"Microsoft.WindowsTerminal_8wekyb3d8bbwe",
+		"Microsoft.WindowsTerminal_8wekyb3d8bbwe!App",
+		`C:\Program Files\WindowsApps\wt.exe`,
+		"0",
+	} {
+		body = append(append(body, encodeUTF16(s)...), 0, 0)
+	}
+	point, err := Decode(reparseBuffer(TagAppExecLink, body))
+	assert.NoError(err)
+	assert.Equal(&AppExecLink{
+		Version:   3,
+		PackageID: "Microsoft.WindowsTerminal_8wekyb3d8bbwe",
+		AppID:     "Microsoft.WindowsTerminal_8wekyb3d8bbwe!App",
+		Target:    `C:\Program Files\WindowsApps\wt.exe`,
+	}, point)
+	assert.False(point.Tag().IsNameSurrogate())
+}
+
+func TestOpaqueTags(t *testing.T) {
+	assert := assert.New(t)
+	cloud := TagCloud | 0x3000
+	point, err := Decode(reparseBuffer(cloud, []byte{1, 2, 3}))
+	assert.NoError(err)
+	assert.Equal(&Opaque{ReparseTag: cloud, Data: []byte{1, 2, 3}}, point)
+	assert.Equal("CLOUD_3", cloud.String())
+	assert.True(cloud.IsCloud())
+	assert.True(cloud.IsPlaceholder())
+	assert.True(cloud.IsDirectory())
+	assert.False(cloud.IsNameSurrogate())
+
+	assert.True(TagWCI.IsContainer())
+	assert.Equal("WCI", TagWCI.String())
+	assert.True(TagWCILink.IsNameSurrogate())
+	assert.Equal("0x00001234", Tag(0x1234).String())
+	assert.False(Tag(0x1234).IsMicrosoft())
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	for _, point := range []Point{
+		&Symlink{Target: `..\target`, PrintName: `..\target`, Relative: true},
+		&Symlink{Target: `\??\C:\data`, PrintName: `C:\data`},
+		&Junction{Target: `\??\C:\data`, PrintName: `C:\data`},
+		&AppExecLink{Version: 3, PackageID: "pkg", AppID: "pkg!App", Target: `C:\a.exe`},
+		&LxSymlink{Target: "/usr/bin/env"},
+		&Opaque{ReparseTag: TagCloud, Data: []byte{1, 2, 3}},
+	} {
+		data, err := Encode(point)
+		assert.NoError(err)
+		decoded, err := Decode(data)
+		assert.NoError(err)
+		assert.Equal(point, decoded)
+	}
+
+	// The names of junctions are terminated by NUL.
+	data, err := Encode(&Junction{Target: "a", PrintName: "b"})
+	assert.NoError(err)
+	assert.Equal(reparseBuffer(TagMountPoint, []byte{
+		0, 0, 2, 0, 4, 0, 2, 0, 'a', 0, 0, 0, 'b', 0, 0, 0,
+	}), data)
+
+	_, err = Encode(&LxSymlink{Target: string(make([]byte, MaxDataSize))})
+	assert.Error(err)
+}
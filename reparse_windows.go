@@ -0,0 +1,257 @@
+package winfsp
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ReparseDataBytes returns the bytes of the reparse data
+// buffer, including its header, which can be decoded by
+// the reparse.Decode.
+//
+// The buffer must be the one passed by WinFSP, e.g. to the
+// CreateExWithReparsePointData, whose ReparseDataLength is
+// trusted to fit in the buffer.
+func ReparseDataBytes(buf *REPARSE_DATA_BUFFER_GENERIC) []byte {
+	if buf == nil {
+		return nil
+	}
+	size := int(unsafe.Offsetof(buf.DataBuffer)) +
+		int(buf.ReparseDataLength)
+	return enforceBytePtr(uintptr(unsafe.Pointer(buf)), size)
+}
+
+var (
+	resolveReparsePoints *syscall.Proc
+	findReparsePoint     *syscall.Proc
+)
+
+// BehaviourGetReparsePointByName retrieves the reparse point
+// of the file by its name, returning the REPARSE_DATA_BUFFER
+// encoded by reparse.Encode, or the error
+// windows.STATUS_NOT_A_REPARSE_POINT if the file is not.
+//
+// The volume is reported to support reparse points when this
+// interface is implemented, and the reparse points inside the
+// file names are resolved by WinFSP through it. The file
+// system should report them by returning
+// windows.STATUS_REPARSE in GetSecurityByName, with the index
+// found by FindReparsePoint as the attributes.
+type BehaviourGetReparsePointByName interface {
+	GetReparsePointByName(
+		fs *FileSystemRef, name string, isDirectory bool,
+	) ([]byte, error)
+}
+
+// BehaviourGetReparsePoint retrieves the reparse point of
+// the open file, in the same format as the one returned by
+// the BehaviourGetReparsePointByName.
+type BehaviourGetReparsePoint interface {
+	GetReparsePoint(
+		fs *FileSystemRef, file uintptr, name string,
+	) ([]byte, error)
+}
+
+// BehaviourSetReparsePoint sets the reparse point of the
+// open file, whose data can be decoded by reparse.Decode.
+type BehaviourSetReparsePoint interface {
+	SetReparsePoint(
+		fs *FileSystemRef, file uintptr, name string,
+		data []byte,
+	) error
+}
+
+// BehaviourDeleteReparsePoint removes the reparse point of
+// the open file, whose data carries the tag to remove.
+type BehaviourDeleteReparsePoint interface {
+	DeleteReparsePoint(
+		fs *FileSystemRef, file uintptr, name string,
+		data []byte,
+	) error
+}
+
+// copyReparseData copies the reparse data into the buffer
+// whose size is specified by the size, which might be nil
+// when only the existence of the reparse point is queried.
+func copyReparseData(
+	data []byte, buffer uintptr, size *uintptr,
+) windows.NTStatus {
+	if buffer == 0 || size == nil {
+		return windows.STATUS_SUCCESS
+	}
+	if uintptr(len(data)) > *size {
+		return windows.STATUS_BUFFER_TOO_SMALL
+	}
+	copy(enforceBytePtr(buffer, len(data)), data)
+	*size = uintptr(len(data))
+	return windows.STATUS_SUCCESS
+}
+
+// getReparsePointByName is called by WinFSP while resolving
+// the reparse points, inside the operations of the file
+// system, so it is not recorded as an operation itself.
+func getReparsePointByName(
+	fileSystem, context, fileName uintptr, isDirectory uint8,
+	buffer uintptr, size *uintptr,
+) windows.NTStatus {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	b := ref.loadBehaviours()
+	data, err := b.getReparsePointByName.GetReparsePointByName(
+		ref, utf16PtrToString(fileName), isDirectory != 0)
+	if err != nil {
+		return ref.convertNTStatus(err)
+	}
+	return copyReparseData(data, buffer, size)
+}
+
+var go_getReparsePointByName = syscall.NewCallbackCDecl(func(
+	fileSystem, context, fileName uintptr, isDirectory uint8,
+	buffer uintptr, size *uintptr,
+) uintptr {
+	return uintptr(getReparsePointByName(
+		fileSystem, context, fileName, isDirectory,
+		buffer, size,
+	))
+})
+
+// FindReparsePoint finds the first reparse point among the
+// components of the file name, returning its index which is
+// to be reported by GetSecurityByName along with the status
+// windows.STATUS_REPARSE.
+//
+// This must only be called inside the behaviours, and the
+// file system must implement BehaviourGetReparsePointByName.
+func (ref *FileSystemRef) FindReparsePoint(name string) (uint32, bool) {
+	if ref.loadBehaviours().getReparsePointByName == nil {
+		return 0, false
+	}
+	utf16, err := utf16FromName(name)
+	if err != nil {
+		return 0, false
+	}
+	utf16 = append(utf16, 0)
+	var index uint32
+	found, _, _ := findReparsePoint.Call(
+		uintptr(unsafe.Pointer(ref.fileSystem)),
+		go_getReparsePointByName, 0,
+		uintptr(unsafe.Pointer(&utf16[0])),
+		uintptr(unsafe.Pointer(&index)),
+	)
+	runtime.KeepAlive(utf16)
+	// BUG: same bug as the directory buffer acquisition.
+	return index, uint8(found) != 0
+}
+
+func delegateResolveReparsePoints(
+	fileSystem, fileName uintptr, reparsePointIndex uint32,
+	resolveLastPathComponent uint8,
+	ioStatus, buffer, size uintptr,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	b, op := ref.beginOperation("ResolveReparsePoints", 0, fileName)
+	defer ref.endOperation(b, op, &status)
+	result, _, _ := resolveReparsePoints.Call(
+		fileSystem, go_getReparsePointByName, 0,
+		fileName, uintptr(reparsePointIndex),
+		uintptr(resolveLastPathComponent),
+		ioStatus, buffer, size,
+	)
+	return windows.NTStatus(result)
+}
+
+var go_delegateResolveReparsePoints = syscall.NewCallbackCDecl(func(
+	fileSystem, fileName uintptr, reparsePointIndex uint32,
+	resolveLastPathComponent uint8,
+	ioStatus, buffer, size uintptr,
+) uintptr {
+	return uintptr(delegateResolveReparsePoints(
+		fileSystem, fileName, reparsePointIndex,
+		resolveLastPathComponent, ioStatus, buffer, size,
+	))
+})
+
+func delegateGetReparsePoint(
+	fileSystem, fileContext, fileName, buffer uintptr,
+	size *uintptr,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("GetReparsePoint", fileContext, fileName)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	data, err := b.getReparsePoint.GetReparsePoint(
+		ref, fileContext, utf16PtrToString(fileName))
+	if err != nil {
+		return ref.convertNTStatus(err)
+	}
+	return copyReparseData(data, buffer, size)
+}
+
+var go_delegateGetReparsePoint = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, fileName, buffer uintptr,
+	size *uintptr,
+) uintptr {
+	return uintptr(delegateGetReparsePoint(
+		fileSystem, fileContext, fileName, buffer, size,
+	))
+})
+
+func delegateSetReparsePoint(
+	fileSystem, fileContext, fileName, buffer, size uintptr,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("SetReparsePoint", fileContext, fileName)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.setReparsePoint.SetReparsePoint(
+		ref, fileContext, utf16PtrToString(fileName),
+		enforceBytePtr(buffer, int(size))))
+}
+
+var go_delegateSetReparsePoint = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, fileName, buffer, size uintptr,
+) uintptr {
+	return uintptr(delegateSetReparsePoint(
+		fileSystem, fileContext, fileName, buffer, size,
+	))
+})
+
+func delegateDeleteReparsePoint(
+	fileSystem, fileContext, fileName, buffer, size uintptr,
+) (status windows.NTStatus) {
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("DeleteReparsePoint", fileContext, fileName)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	return ref.convertNTStatus(b.deleteReparsePoint.DeleteReparsePoint(
+		ref, fileContext, utf16PtrToString(fileName),
+		enforceBytePtr(buffer, int(size))))
+}
+
+var go_delegateDeleteReparsePoint = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, fileName, buffer, size uintptr,
+) uintptr {
+	return uintptr(delegateDeleteReparsePoint(
+		fileSystem, fileContext, fileName, buffer, size,
+	))
+})
@@ -0,0 +1,33 @@
+package winfsp
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/reparse"
+)
+
+func TestCopyReparseData(t *testing.T) {
+	assert := assert.New(t)
+	data, err := reparse.Encode(&reparse.Symlink{
+		Target: "target", PrintName: "target", Relative: true,
+	})
+	assert.NoError(err)
+
+	// The existence only query carries no buffer.
+	assert.Equal(windows.STATUS_SUCCESS, copyReparseData(data, 0, nil))
+
+	buf := make([]byte, len(data)+8)
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+	size := uintptr(len(data) - 1)
+	assert.Equal(windows.STATUS_BUFFER_TOO_SMALL,
+		copyReparseData(data, addr, &size))
+	size = uintptr(len(buf))
+	assert.Equal(windows.STATUS_SUCCESS, copyReparseData(data, addr, &size))
+	assert.Equal(uintptr(len(data)), size)
+	assert.Equal(data, ReparseDataBytes(
+		(*REPARSE_DATA_BUFFER_GENERIC)(unsafe.Pointer(&buf[0]))))
+}
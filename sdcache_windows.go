@@ -0,0 +1,175 @@
+package winfsp
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// GetSecurityByNameFunc is the adapter to allow the use of
+// ordinary functions as BehaviourGetSecurityByName.
+type GetSecurityByNameFunc func(
+	fs *FileSystemRef, name string,
+	flags GetSecurityByNameFlags,
+) (uint32, *windows.SECURITY_DESCRIPTOR, error)
+
+func (f GetSecurityByNameFunc) GetSecurityByName(
+	fs *FileSystemRef, name string,
+	flags GetSecurityByNameFlags,
+) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
+	return f(fs, name, flags)
+}
+
+var _ BehaviourGetSecurityByName = GetSecurityByNameFunc(nil)
+
+type securityByNameEntry struct {
+	attributes uint32
+	sd         []byte
+	expiry     time.Time
+}
+
+// SecurityByNameCache caches the results of the inner
+// GetSecurityByName behaviour by the file name.
+//
+// Since GetSecurityByName is called on resolving every
+// path, caching it saves a lot of work if the behaviour
+// is expensive. The cache entries expire after the TTL,
+// and it is the caller's duty to invalidate the entries
+// when the files are created, removed, renamed or their
+// attributes or security descriptors are modified.
+//
+// The expiry is decided by the clock of the file system,
+// see the Clock option, and the expired entries are swept
+// once per TTL. Only successful results are cached, and the
+// names are keyed as is, so the names varying in case are
+// cached separately on case insensitive file systems.
+type SecurityByNameCache struct {
+	inner BehaviourGetSecurityByName
+	ttl   time.Duration
+
+	mtx        sync.RWMutex
+	entries    map[string]*securityByNameEntry
+	generation uint64
+	nextSweep  time.Time
+}
+
+// NewSecurityByNameCache creates the cache around the inner
+// behaviour, whose entries live no longer than the TTL.
+func NewSecurityByNameCache(
+	inner BehaviourGetSecurityByName, ttl time.Duration,
+) *SecurityByNameCache {
+	return &SecurityByNameCache{
+		inner:   inner,
+		ttl:     ttl,
+		entries: make(map[string]*securityByNameEntry),
+	}
+}
+
+// load retrieves the unexpired entry of the name, or nil,
+// with the generation of the cache it is loaded from.
+func (c *SecurityByNameCache) load(
+	name string, now time.Time,
+) (*securityByNameEntry, uint64) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	entry, ok := c.entries[name]
+	if !ok || now.After(entry.expiry) {
+		return nil, c.generation
+	}
+	return entry, c.generation
+}
+
+// store stores the entry unless the cache has been
+// invalidated since the generation that the entry is
+// retrieved in, and sweeps the expired entries.
+func (c *SecurityByNameCache) store(
+	name string, entry *securityByNameEntry,
+	generation uint64, now time.Time,
+) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if now.After(c.nextSweep) {
+		for key, value := range c.entries {
+			if now.After(value.expiry) {
+				delete(c.entries, key)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	if generation != c.generation {
+		return
+	}
+	c.entries[name] = entry
+}
+
+func (c *SecurityByNameCache) GetSecurityByName(
+	fs *FileSystemRef, name string,
+	flags GetSecurityByNameFlags,
+) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
+	now := fs.now()
+	entry, generation := c.load(name, now)
+	if entry == nil {
+		// XXX: both the attributes and security descriptor
+		// are retrieved, so that the entry can serve all
+		// kinds of later queries.
+		attributes, sd, err := c.inner.GetSecurityByName(
+			fs, name, GetAttributesSecurity)
+		if err != nil {
+			return 0, nil, err
+		}
+		entry = &securityByNameEntry{
+			attributes: attributes,
+			expiry:     now.Add(c.ttl),
+		}
+		if sd != nil {
+			entry.sd = make([]byte, int(sd.Length()))
+			copy(entry.sd, enforceBytePtr(
+				uintptr(unsafe.Pointer(sd)), len(entry.sd)))
+		}
+		c.store(name, entry, generation, now)
+	}
+	var sd *windows.SECURITY_DESCRIPTOR
+	if len(entry.sd) > 0 {
+		sd = (*windows.SECURITY_DESCRIPTOR)(
+			unsafe.Pointer(&entry.sd[0]))
+	}
+	return entry.attributes, sd, nil
+}
+
+var _ BehaviourGetSecurityByName = (*SecurityByNameCache)(nil)
+
+// Invalidate removes the cache entry of the specified name.
+// The lookups in flight when it is called won't cache their
+// results, since they might be retrieved before the change.
+func (c *SecurityByNameCache) Invalidate(name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.generation++
+	delete(c.entries, name)
+}
+
+// InvalidateTree removes the cache entries of the specified
+// name and all names under it, which should be called when
+// a directory is renamed or removed.
+func (c *SecurityByNameCache) InvalidateTree(name string) {
+	prefix := strings.TrimSuffix(name, `\`) + `\`
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.generation++
+	for key := range c.entries {
+		if key == name || strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Purge removes all entries from the cache.
+func (c *SecurityByNameCache) Purge() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.generation++
+	c.entries = make(map[string]*securityByNameEntry)
+}
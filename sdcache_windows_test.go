@@ -0,0 +1,165 @@
+package winfsp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp/clock"
+)
+
+func TestSecurityByNameCacheExpiry(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	cache := NewSecurityByNameCache(GetSecurityByNameFunc(func(
+		fs *FileSystemRef, name string, flags GetSecurityByNameFlags,
+	) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
+		calls++
+		return windows.FILE_ATTRIBUTE_NORMAL, nil, nil
+	}), time.Minute)
+	fake := clock.NewFake(time.Unix(0, 0))
+	ref := &FileSystemRef{clock: fake}
+
+	for i := 0; i < 3; i++ {
+		attributes, _, err := cache.GetSecurityByName(
+			ref, `\file`, GetExistenceOnly)
+		assert.NoError(err)
+		assert.Equal(uint32(windows.FILE_ATTRIBUTE_NORMAL), attributes)
+	}
+	assert.Equal(1, calls)
+
+	fake.Advance(time.Minute - time.Second)
+	_, _, err := cache.GetSecurityByName(ref, `\file`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Equal(1, calls)
+	fake.Advance(2 * time.Second)
+	_, _, err = cache.GetSecurityByName(ref, `\file`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Equal(2, calls)
+
+	// The expired entries are swept instead of kept forever.
+	_, _, err = cache.GetSecurityByName(ref, `\other`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Len(cache.entries, 2)
+	fake.Advance(2 * time.Minute)
+	_, _, err = cache.GetSecurityByName(ref, `\file`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Len(cache.entries, 1)
+	assert.Contains(cache.entries, `\file`)
+}
+
+func TestSecurityByNameCacheInvalidateInFlight(t *testing.T) {
+	assert := assert.New(t)
+	var cache *SecurityByNameCache
+	calls := 0
+	cache = NewSecurityByNameCache(GetSecurityByNameFunc(func(
+		fs *FileSystemRef, name string, flags GetSecurityByNameFlags,
+	) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
+		calls++
+		if calls == 1 {
+			// The file is modified while it is being looked up.
+			cache.Invalidate(name)
+			return windows.FILE_ATTRIBUTE_NORMAL, nil, nil
+		}
+		return windows.FILE_ATTRIBUTE_DIRECTORY, nil, nil
+	}), time.Hour)
+	ref := &FileSystemRef{clock: clock.NewFake(time.Unix(0, 0))}
+
+	// The result retrieved before the invalidation is
+	// returned, but not cached.
+	attributes, _, err := cache.GetSecurityByName(
+		ref, `\file`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Equal(uint32(windows.FILE_ATTRIBUTE_NORMAL), attributes)
+	attributes, _, err = cache.GetSecurityByName(
+		ref, `\file`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Equal(uint32(windows.FILE_ATTRIBUTE_DIRECTORY), attributes)
+	assert.Equal(2, calls)
+	_, _, err = cache.GetSecurityByName(ref, `\file`, GetExistenceOnly)
+	assert.NoError(err)
+	assert.Equal(2, calls)
+}
+
+func TestGetSecurityByNameFlags(t *testing.T) {
+	assert := assert.New(t)
+	flags := GetExistenceOnly
+	assert.False(flags.WantsAttributes())
+	assert.False(flags.WantsSecurity())
+	flags |= GetAttributesByName
+	assert.True(flags.WantsAttributes())
+	assert.False(flags.WantsSecurity())
+	flags |= GetSecurityByName
+	assert.Equal(GetAttributesSecurity, flags)
+	assert.True(flags.WantsAttributes())
+	assert.True(flags.WantsSecurity())
+	assert.Equal("GetAttributesSecurity", flags.String())
+	assert.Equal("GetSecurityByNameFlags(0x4)",
+		GetSecurityByNameFlags(4).String())
+}
+
+func TestSecurityByNameCacheInvalidate(t *testing.T) {
+	assert := assert.New(t)
+	sd, err := windows.SecurityDescriptorFromString("O:BAG:BAD:(A;;FA;;;WD)")
+	if !assert.NoError(err) {
+		return
+	}
+	calls := make(map[string]int)
+	fail := true
+	cache := NewSecurityByNameCache(GetSecurityByNameFunc(func(
+		fs *FileSystemRef, name string, flags GetSecurityByNameFlags,
+	) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
+		calls[name]++
+		assert.Equal(GetAttributesSecurity, flags)
+		if name == `\missing` && fail {
+			return 0, nil, windows.STATUS_OBJECT_NAME_NOT_FOUND
+		}
+		return windows.FILE_ATTRIBUTE_DIRECTORY, sd, nil
+	}), time.Hour)
+	ref := &FileSystemRef{clock: clock.NewFake(time.Unix(0, 0))}
+	query := func(name string) {
+		_, _, _ = cache.GetSecurityByName(ref, name, GetExistenceOnly)
+	}
+
+	// The security descriptor is copied out of the result.
+	attributes, cached, err := cache.GetSecurityByName(
+		ref, `\dir`, GetSecurityByName)
+	assert.NoError(err)
+	assert.Equal(uint32(windows.FILE_ATTRIBUTE_DIRECTORY), attributes)
+	if assert.NotNil(cached) {
+		assert.NotSame(sd, cached)
+		assert.Equal(sd.String(), cached.String())
+	}
+
+	// The failures are not cached.
+	_, _, err = cache.GetSecurityByName(ref, `\missing`, GetExistenceOnly)
+	assert.Equal(windows.STATUS_OBJECT_NAME_NOT_FOUND, err)
+	fail = false
+	query(`\missing`)
+	query(`\missing`)
+	assert.Equal(2, calls[`\missing`])
+
+	for _, name := range []string{`\dir\a`, `\dir\a\b`, `\dirx`} {
+		query(name)
+	}
+	cache.Invalidate(`\dirx`)
+	query(`\dirx`)
+	assert.Equal(2, calls[`\dirx`])
+
+	// The tree invalidation does not touch the siblings
+	// sharing the prefix of the name.
+	cache.InvalidateTree(`\dir`)
+	for _, name := range []string{`\dir`, `\dir\a`, `\dir\a\b`, `\dirx`} {
+		query(name)
+	}
+	assert.Equal(2, calls[`\dir`])
+	assert.Equal(2, calls[`\dir\a`])
+	assert.Equal(2, calls[`\dir\a\b`])
+	assert.Equal(2, calls[`\dirx`])
+
+	cache.Purge()
+	query(`\dirx`)
+	assert.Equal(3, calls[`\dirx`])
+}
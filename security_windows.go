@@ -0,0 +1,177 @@
+package winfsp
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// minimalSecuritySDDL is the descriptor of all files under
+// the minimal security mode, which is owned by administrators
+// and grants full access to everyone.
+const minimalSecuritySDDL = "O:BAG:BAD:P(A;;FA;;;SY)(A;;FA;;;BA)(A;;FA;;;WD)"
+
+// MinimalSecurity specifies whether the file system should be
+// mounted without persistent ACLs.
+//
+// Under the minimal security mode, no access check will be
+// performed, and all files report a permissive descriptor
+// granting full access to everyone. The security behaviours
+// of the file system are ignored, so that trivial file systems
+// don't have to implement security at all.
+func MinimalSecurity(value bool) Option {
+	return func(o *option) {
+		o.minimalSecurity = value
+	}
+}
+
+// minimalSecurity is the GetSecurity behaviour under the
+// minimal security mode.
+type minimalSecurity struct {
+	sd *windows.SECURITY_DESCRIPTOR
+}
+
+func newMinimalSecurity() (*minimalSecurity, error) {
+	sd, err := windows.SecurityDescriptorFromString(minimalSecuritySDDL)
+	if err != nil {
+		return nil, errors.Wrap(err, "minimal security descriptor")
+	}
+	return &minimalSecurity{sd: sd}, nil
+}
+
+func (m *minimalSecurity) GetSecurity(
+	fs *FileSystemRef, file uintptr,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	return m.sd, nil
+}
+
+var _ BehaviourGetSecurity = (*minimalSecurity)(nil)
+
+// CopySecurityDescriptor copies the self-relative security
+// descriptor into the buffer, returning the length of the
+// descriptor. STATUS_BUFFER_OVERFLOW is returned without
+// copying when the buffer is too small, and the returned
+// length is the size of the buffer required then.
+func CopySecurityDescriptor(
+	dst []byte, sd *windows.SECURITY_DESCRIPTOR,
+) (int, windows.NTStatus) {
+	if sd == nil {
+		return 0, windows.STATUS_INVALID_SECURITY_DESCR
+	}
+	length := int(sd.Length())
+	if len(dst) < length {
+		return length, windows.STATUS_BUFFER_OVERFLOW
+	}
+	copy(dst, enforceBytePtr(uintptr(unsafe.Pointer(sd)), length))
+	return length, windows.STATUS_SUCCESS
+}
+
+// ModifySecurityDescriptor applies the parts of the modification
+// descriptor selected by info onto the self-relative descriptor,
+// and returns the modified self-relative descriptor, which is
+// what a BehaviourSetSecurity is expected to persist. A nil sd is
+// considered to be an empty descriptor.
+func ModifySecurityDescriptor(
+	sd *windows.SECURITY_DESCRIPTOR, info windows.SECURITY_INFORMATION,
+	modification *windows.SECURITY_DESCRIPTOR,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	var result *windows.SECURITY_DESCRIPTOR
+	var err error
+	if sd != nil {
+		result, err = sd.ToAbsolute()
+	} else {
+		result, err = windows.NewSecurityDescriptor()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "absolute security descriptor")
+	}
+	control, _, err := modification.Control()
+	if err != nil {
+		return nil, errors.Wrap(err, "security descriptor control")
+	}
+	if info&windows.OWNER_SECURITY_INFORMATION != 0 {
+		owner, defaulted, err := modification.Owner()
+		if err != nil {
+			return nil, errors.Wrap(err, "security descriptor owner")
+		}
+		if err := result.SetOwner(owner, defaulted); err != nil {
+			return nil, errors.Wrap(err, "set owner")
+		}
+	}
+	if info&windows.GROUP_SECURITY_INFORMATION != 0 {
+		group, defaulted, err := modification.Group()
+		if err != nil {
+			return nil, errors.Wrap(err, "security descriptor group")
+		}
+		if err := result.SetGroup(group, defaulted); err != nil {
+			return nil, errors.Wrap(err, "set group")
+		}
+	}
+	if info&windows.DACL_SECURITY_INFORMATION != 0 {
+		if err := modifyACL(
+			modification.DACL, result.SetDACL); err != nil {
+			return nil, errors.Wrap(err, "set dacl")
+		}
+		if err := modifyACLControl(result, control, info,
+			windows.SE_DACL_PROTECTED, windows.SE_DACL_AUTO_INHERITED,
+			windows.PROTECTED_DACL_SECURITY_INFORMATION,
+			windows.UNPROTECTED_DACL_SECURITY_INFORMATION,
+		); err != nil {
+			return nil, errors.Wrap(err, "set dacl control")
+		}
+	}
+	if info&windows.SACL_SECURITY_INFORMATION != 0 {
+		if err := modifyACL(
+			modification.SACL, result.SetSACL); err != nil {
+			return nil, errors.Wrap(err, "set sacl")
+		}
+		if err := modifyACLControl(result, control, info,
+			windows.SE_SACL_PROTECTED, windows.SE_SACL_AUTO_INHERITED,
+			windows.PROTECTED_SACL_SECURITY_INFORMATION,
+			windows.UNPROTECTED_SACL_SECURITY_INFORMATION,
+		); err != nil {
+			return nil, errors.Wrap(err, "set sacl control")
+		}
+	}
+	result, err = result.ToSelfRelative()
+	if err != nil {
+		return nil, errors.Wrap(err, "self relative security descriptor")
+	}
+	return result, nil
+}
+
+// modifyACL copies the ACL, which might be absent, from the
+// modification descriptor into the absolute descriptor.
+func modifyACL(
+	get func() (*windows.ACL, bool, error),
+	set func(*windows.ACL, bool, bool) error,
+) error {
+	acl, defaulted, err := get()
+	present := true
+	if err == windows.ERROR_OBJECT_NOT_FOUND {
+		present, err = false, nil
+	}
+	if err != nil {
+		return err
+	}
+	return set(acl, present, defaulted)
+}
+
+// modifyACLControl copies the inheritance control bits of the
+// ACL, while the protection might be overridden by the info.
+func modifyACLControl(
+	sd *windows.SECURITY_DESCRIPTOR,
+	control windows.SECURITY_DESCRIPTOR_CONTROL,
+	info windows.SECURITY_INFORMATION,
+	protectedBit, autoInheritedBit windows.SECURITY_DESCRIPTOR_CONTROL,
+	protectedInfo, unprotectedInfo windows.SECURITY_INFORMATION,
+) error {
+	bits := control & (protectedBit | autoInheritedBit)
+	if info&protectedInfo != 0 {
+		bits |= protectedBit
+	} else if info&unprotectedInfo != 0 {
+		bits &^= protectedBit
+	}
+	return sd.SetControl(protectedBit|autoInheritedBit, bits)
+}
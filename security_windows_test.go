@@ -0,0 +1,123 @@
+package winfsp
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestCopySecurityDescriptor(t *testing.T) {
+	assert := assert.New(t)
+	sd, err := windows.SecurityDescriptorFromString(minimalSecuritySDDL)
+	assert.NoError(err)
+	length := int(sd.Length())
+	expected := enforceBytePtr(uintptr(unsafe.Pointer(sd)), length)
+
+	// The buffer is left intact when it is too small.
+	small := make([]byte, length-1)
+	n, status := CopySecurityDescriptor(small, sd)
+	assert.Equal(windows.STATUS_BUFFER_OVERFLOW, status)
+	assert.Equal(length, n)
+	assert.Equal(make([]byte, length-1), small)
+	n, status = CopySecurityDescriptor(nil, sd)
+	assert.Equal(windows.STATUS_BUFFER_OVERFLOW, status)
+	assert.Equal(length, n)
+
+	buf := make([]byte, length+8)
+	n, status = CopySecurityDescriptor(buf, sd)
+	assert.Equal(windows.STATUS_SUCCESS, status)
+	assert.Equal(length, n)
+	assert.Equal(expected, buf[:n])
+
+	n, status = CopySecurityDescriptor(buf, nil)
+	assert.Equal(windows.STATUS_INVALID_SECURITY_DESCR, status)
+	assert.Zero(n)
+}
+
+func TestModifySecurityDescriptor(t *testing.T) {
+	assert := assert.New(t)
+	sd, err := windows.SecurityDescriptorFromString(
+		"O:BAG:BAD:P(A;;FA;;;SY)")
+	assert.NoError(err)
+	modification, err := windows.SecurityDescriptorFromString(
+		"O:SYG:SYD:(A;;FR;;;WD)")
+	assert.NoError(err)
+
+	// Only the parts selected by the info are modified.
+	result, err := ModifySecurityDescriptor(
+		sd, windows.DACL_SECURITY_INFORMATION, modification)
+	assert.NoError(err)
+	assert.Equal("O:BAG:BAD:(A;;FR;;;WD)", result.String())
+	result, err = ModifySecurityDescriptor(sd,
+		windows.OWNER_SECURITY_INFORMATION|
+			windows.DACL_SECURITY_INFORMATION|
+			windows.PROTECTED_DACL_SECURITY_INFORMATION,
+		modification)
+	assert.NoError(err)
+	assert.Equal("O:SYG:BAD:P(A;;FR;;;WD)", result.String())
+
+	// The descriptor is built from scratch when there's none.
+	result, err = ModifySecurityDescriptor(
+		nil, windows.GROUP_SECURITY_INFORMATION, modification)
+	assert.NoError(err)
+	assert.Equal("G:SY", result.String())
+}
+
+type securityBase struct{ swapBase }
+
+func (securityBase) GetSecurityByName(
+	fs *FileSystemRef, name string,
+	flags GetSecurityByNameFlags,
+) (uint32, *windows.SECURITY_DESCRIPTOR, error) {
+	return 0, nil, windows.STATUS_ACCESS_DENIED
+}
+
+func (securityBase) GetSecurity(
+	fs *FileSystemRef, file uintptr,
+) (*windows.SECURITY_DESCRIPTOR, error) {
+	return nil, windows.STATUS_ACCESS_DENIED
+}
+
+func (securityBase) SetSecurity(
+	fs *FileSystemRef, file uintptr,
+	info windows.SECURITY_INFORMATION,
+	desc *windows.SECURITY_DESCRIPTOR,
+) error {
+	return windows.STATUS_ACCESS_DENIED
+}
+
+func TestMinimalSecurity(t *testing.T) {
+	assert := assert.New(t)
+	option := newOption()
+	MinimalSecurity(true)(option)
+	assert.True(option.minimalSecurity)
+
+	ref, fileSystem := delegateTestRef(t, securityBase{})
+	security, err := newMinimalSecurity()
+	if !assert.NoError(err) {
+		return
+	}
+	ref.minimalSecurity = security
+	ref.loadBehaviours().applyMinimalSecurity(security, ref.fileSystemOps)
+
+	// The security behaviours of the file system are replaced,
+	// so no access check is performed by WinFSP.
+	assert.Zero(ref.fileSystemOps.GetSecurityByName)
+	assert.Zero(ref.fileSystemOps.SetSecurity)
+	assert.NotZero(ref.fileSystemOps.GetSecurity)
+	buf := make([]byte, 256)
+	size := uintptr(len(buf))
+	assert.Equal(windows.STATUS_SUCCESS, delegateGetSecurity(
+		fileSystem, 1, uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size))))
+	sd := (*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(&buf[0]))
+	assert.Equal(uintptr(sd.Length()), size)
+	assert.Equal(minimalSecuritySDDL, sd.String())
+
+	// The file system without security behaviours can be
+	// swapped in, since they are ignored anyway.
+	assert.NoError(ref.SwapBehaviour(swapBase{"new"}))
+	assert.Equal(swapBase{"new"}, ref.loadBehaviours().base)
+}
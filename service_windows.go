@@ -0,0 +1,114 @@
+package winfsp
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	serviceRun  *syscall.Proc
+	serviceStop *syscall.Proc
+)
+
+// ServiceStartFunc starts the service with the arguments
+// it is started with, e.g. mounting the file system.
+type ServiceStartFunc func(args []string) error
+
+// ServiceStopFunc stops the service, e.g. unmounting the
+// file system.
+type ServiceStopFunc func() error
+
+// serviceState is the state of the running service, since
+// there can only be one service run by a process.
+var serviceState struct {
+	mtx     sync.Mutex
+	service uintptr
+	onStart ServiceStartFunc
+	onStop  ServiceStopFunc
+}
+
+var go_serviceStart = syscall.NewCallbackCDecl(func(
+	service uintptr, argc uint32, argv uintptr,
+) uintptr {
+	serviceState.mtx.Lock()
+	serviceState.service = service
+	onStart := serviceState.onStart
+	serviceState.mtx.Unlock()
+	var args []string
+	for i := 0; i < int(argc); i++ {
+		arg := *(*uintptr)(unsafe.Pointer(
+			argv + uintptr(i)*unsafe.Sizeof(uintptr(0))))
+		args = append(args, utf16PtrToString(arg))
+	}
+	return uintptr(convertNTStatus(onStart(args)))
+})
+
+var go_serviceStop = syscall.NewCallbackCDecl(func(
+	service uintptr,
+) uintptr {
+	serviceState.mtx.Lock()
+	onStop := serviceState.onStop
+	serviceState.mtx.Unlock()
+	return uintptr(convertNTStatus(onStop()))
+})
+
+// RunService runs the process as the windows service of the
+// name, which is integrated with the service control manager
+// through FspServiceRun, until the service is stopped.
+//
+// The onStart is called with the arguments the service is
+// started with, and the onStop is called when the service
+// is requested to stop. When the process is started from
+// the console instead, it runs in the console mode, where
+// the service is stopped by CTRL+C.
+func RunService(
+	name string, onStart ServiceStartFunc, onStop ServiceStopFunc,
+) error {
+	if err := tryLoadWinFSP(); err != nil {
+		return err
+	}
+	serviceName, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return errors.Wrapf(err, "service name %q", name)
+	}
+	serviceState.mtx.Lock()
+	if serviceState.onStart != nil {
+		serviceState.mtx.Unlock()
+		return errors.New("service already running")
+	}
+	serviceState.onStart = onStart
+	serviceState.onStop = onStop
+	serviceState.mtx.Unlock()
+	defer func() {
+		serviceState.mtx.Lock()
+		defer serviceState.mtx.Unlock()
+		serviceState.service = 0
+		serviceState.onStart = nil
+		serviceState.onStop = nil
+	}()
+	exitCode, _, _ := serviceRun.Call(
+		uintptr(unsafe.Pointer(serviceName)),
+		go_serviceStart, go_serviceStop, 0,
+	)
+	if exitCode != 0 {
+		return errors.Wrapf(syscall.Errno(exitCode), "run service %q", name)
+	}
+	return nil
+}
+
+// StopService requests the service run by RunService to
+// stop, e.g. when the file system has been removed.
+func StopService() {
+	// The lock must not be held while stopping, since the
+	// FspServiceStop calls the onStop on the same thread.
+	serviceState.mtx.Lock()
+	service := serviceState.service
+	serviceState.mtx.Unlock()
+	if service != 0 {
+		_, _, _ = serviceStop.Call(service)
+	}
+}
@@ -0,0 +1,74 @@
+package winfsp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestRunServiceStartFailed(t *testing.T) {
+	assert := assert.New(t)
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+
+	// The process is run in the console mode by the test,
+	// where the service is started with the command line.
+	var started [][]string
+	stopped := false
+	err := RunService("go-winfsp-test", func(args []string) error {
+		started = append(started, args)
+		assert.Error(RunService("go-winfsp-test",
+			func([]string) error { return nil },
+			func() error { return nil }))
+		return windows.STATUS_ACCESS_DENIED
+	}, func() error {
+		stopped = true
+		return nil
+	})
+	assert.Error(err)
+	if assert.Len(started, 1) {
+		assert.NotEmpty(started[0])
+	}
+	assert.False(stopped)
+
+	// Another service could be run after the former one.
+	serviceState.mtx.Lock()
+	assert.Nil(serviceState.onStart)
+	assert.Zero(serviceState.service)
+	serviceState.mtx.Unlock()
+}
+
+func TestStopService(t *testing.T) {
+	assert := assert.New(t)
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+
+	// The service stops itself after being started, which
+	// calls the onStop without deadlocking.
+	stopped := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- RunService("go-winfsp-test", func([]string) error {
+			go StopService()
+			return nil
+		}, func() error {
+			close(stopped)
+			return nil
+		})
+	}()
+	select {
+	case err := <-result:
+		assert.NoError(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("service not stopped")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("onStop not called")
+	}
+}
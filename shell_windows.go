@@ -0,0 +1,119 @@
+package winfsp
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// driveShellKey is the key under HKEY_CURRENT_USER where the
+// explorer looks up the icon and label of each drive letter.
+const driveShellKey = `Software\Classes\Applications\Explorer.exe\Drives\`
+
+var (
+	shell32        = windows.NewLazySystemDLL("shell32.dll")
+	shChangeNotify = shell32.NewProc("SHChangeNotify")
+)
+
+const (
+	shcneAssocChanged = 0x08000000
+	shcnfIDList       = 0x0000
+)
+
+// driveLetter extracts the drive letter from the mount point
+// in the form of "X:" or "X:\".
+func driveLetter(mountpoint string) (string, bool) {
+	mountpoint = strings.TrimSuffix(mountpoint, `\`)
+	if len(mountpoint) != 2 || mountpoint[1] != ':' {
+		return "", false
+	}
+	letter := mountpoint[0]
+	if letter >= 'a' && letter <= 'z' {
+		letter -= 'a' - 'A'
+	}
+	if letter < 'A' || letter > 'Z' {
+		return "", false
+	}
+	return string(letter), true
+}
+
+// notifyShellChanged asks the explorer to reload the icons.
+func notifyShellChanged() {
+	if shChangeNotify.Find() == nil {
+		_, _, _ = shChangeNotify.Call(shcneAssocChanged, shcnfIDList, 0, 0)
+	}
+}
+
+func setDefaultValue(key registry.Key, path, value string) error {
+	subkey, _, err := registry.CreateKey(key, path, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = subkey.Close() }()
+	return subkey.SetStringValue("", value)
+}
+
+// RegisterDriveIcon registers the icon and the label that the
+// explorer displays for the drive, for the current user.
+//
+// The icon is in the form of "path.ico" or "path.dll,index",
+// and the label is the friendly name replacing the volume
+// label. Either of them will be left intact if it is empty.
+//
+// For directory mount points, the file system should serve
+// a desktop.ini in its root directory instead.
+func RegisterDriveIcon(drive, icon, label string) error {
+	letter, ok := driveLetter(drive)
+	if !ok {
+		return errors.Errorf("invalid drive %q", drive)
+	}
+	path := driveShellKey + letter
+	if icon != "" {
+		if err := setDefaultValue(registry.CURRENT_USER,
+			path+`\DefaultIcon`, icon); err != nil {
+			return errors.Wrapf(err, "register drive %s icon", letter)
+		}
+	}
+	if label != "" {
+		if err := setDefaultValue(registry.CURRENT_USER,
+			path+`\DefaultLabel`, label); err != nil {
+			return errors.Wrapf(err, "register drive %s label", letter)
+		}
+	}
+	notifyShellChanged()
+	return nil
+}
+
+// UnregisterDriveIcon removes the icon and the label of the
+// drive registered by RegisterDriveIcon.
+func UnregisterDriveIcon(drive string) error {
+	letter, ok := driveLetter(drive)
+	if !ok {
+		return errors.Errorf("invalid drive %q", drive)
+	}
+	path := driveShellKey + letter
+	for _, key := range []string{
+		path + `\DefaultIcon`, path + `\DefaultLabel`, path,
+	} {
+		err := registry.DeleteKey(registry.CURRENT_USER, key)
+		if err != nil && err != windows.ERROR_FILE_NOT_FOUND {
+			return errors.Wrapf(err, "unregister drive %s", letter)
+		}
+	}
+	notifyShellChanged()
+	return nil
+}
+
+// DriveIcon registers the icon and the label of the drive
+// after mounting, which are removed after unmounting.
+//
+// The mount point must be a drive letter when this option
+// is specified. See RegisterDriveIcon for the format.
+func DriveIcon(icon, label string) Option {
+	return func(o *option) {
+		o.driveIcon = icon
+		o.driveLabel = label
+	}
+}
@@ -0,0 +1,63 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+func TestDriveLetter(t *testing.T) {
+	assert := assert.New(t)
+	for mountpoint, expected := range map[string]string{
+		"X:":   "X",
+		`x:\`:  "X",
+		"Z:":   "Z",
+		"":     "",
+		"X":    "",
+		`C:\a`: "",
+		"1:":   "",
+		`\\?\`: "",
+	} {
+		letter, ok := driveLetter(mountpoint)
+		assert.Equal(expected != "", ok, mountpoint)
+		assert.Equal(expected, letter, mountpoint)
+	}
+}
+
+func TestRegisterDriveIcon(t *testing.T) {
+	assert := assert.New(t)
+	assert.Error(RegisterDriveIcon(`C:\dir`, "icon.ico", "label"))
+	assert.Error(UnregisterDriveIcon(`C:\dir`))
+
+	const drive = "Y:"
+	path := driveShellKey + "Y"
+	if !assert.NoError(RegisterDriveIcon(
+		drive, `C:\icon.dll,1`, "Label")) {
+		return
+	}
+	defer func() { _ = UnregisterDriveIcon(drive) }()
+	for subkey, expected := range map[string]string{
+		`\DefaultIcon`:  `C:\icon.dll,1`,
+		`\DefaultLabel`: "Label",
+	} {
+		key, err := registry.OpenKey(registry.CURRENT_USER,
+			path+subkey, registry.QUERY_VALUE)
+		if !assert.NoError(err) {
+			continue
+		}
+		value, _, err := key.GetStringValue("")
+		assert.NoError(err)
+		assert.Equal(expected, value)
+		_ = key.Close()
+	}
+
+	// The keys are removed after unregistering, which is also
+	// fine when the drive has not been registered.
+	assert.NoError(UnregisterDriveIcon(drive))
+	_, err := registry.OpenKey(registry.CURRENT_USER,
+		path, registry.QUERY_VALUE)
+	assert.Equal(windows.ERROR_FILE_NOT_FOUND, err)
+	assert.NoError(UnregisterDriveIcon(drive))
+}
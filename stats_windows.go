@@ -0,0 +1,194 @@
+package winfsp
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Statistics enables collecting the statistics of the file
+// system, i.e. the counts, errors and latencies of the
+// operations and the bytes read and written, which could be
+// retrieved by FileSystemRef.Statistics.
+func Statistics(value bool) Option {
+	return func(o *option) {
+		o.statistics = value
+	}
+}
+
+// LatencyBuckets are the upper bounds of the latency
+// histogram buckets, with an extra bucket for the rest.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// OperationStats are the statistics of a kind of operation.
+type OperationStats struct {
+	// Count is the number of invocations.
+	Count uint64
+
+	// Errors is the number of invocations failed with an
+	// NTSTATUS of error severity.
+	Errors uint64
+
+	// Duration is the total time spent on the invocations.
+	Duration time.Duration
+
+	// Latency is the histogram of the durations, whose
+	// buckets are bounded by the LatencyBuckets.
+	Latency []uint64
+}
+
+// StatsSnapshot is the snapshot of the statistics.
+type StatsSnapshot struct {
+	Operations   map[string]OperationStats
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+// StatsCollector collects the statistics of the file system.
+type StatsCollector struct {
+	mtx          sync.Mutex
+	operations   map[string]*OperationStats
+	bytesRead    uint64
+	bytesWritten uint64
+}
+
+func newStatsCollector() *StatsCollector {
+	return &StatsCollector{
+		operations: make(map[string]*OperationStats),
+	}
+}
+
+// isErrorStatus tells whether the status is of the error
+// severity, excluding the warnings like buffer overflow.
+func isErrorStatus(status windows.NTStatus) bool {
+	return uint32(status)&0xC0000000 == 0xC0000000
+}
+
+func (s *StatsCollector) addOperation(op *Operation) {
+	bucket := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return op.Duration <= LatencyBuckets[i]
+	})
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	stats, ok := s.operations[op.Kind]
+	if !ok {
+		stats = &OperationStats{
+			Latency: make([]uint64, len(LatencyBuckets)+1),
+		}
+		s.operations[op.Kind] = stats
+	}
+	stats.Count++
+	if isErrorStatus(op.Status) {
+		stats.Errors++
+	}
+	stats.Duration += op.Duration
+	stats.Latency[bucket]++
+}
+
+func (s *StatsCollector) addRead(n int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.bytesRead += uint64(n)
+}
+
+func (s *StatsCollector) addWritten(n int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.bytesWritten += uint64(n)
+}
+
+// Snapshot takes the snapshot of the statistics.
+func (s *StatsCollector) Snapshot() StatsSnapshot {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	result := StatsSnapshot{
+		Operations:   make(map[string]OperationStats),
+		BytesRead:    s.bytesRead,
+		BytesWritten: s.bytesWritten,
+	}
+	for kind, stats := range s.operations {
+		value := *stats
+		value.Latency = append([]uint64(nil), stats.Latency...)
+		result.Operations[kind] = value
+	}
+	return result
+}
+
+// Publish exports the snapshots of the statistics through
+// the expvar under the name.
+func (s *StatsCollector) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return s.Snapshot()
+	}))
+}
+
+// WritePrometheus writes the statistics in the text format
+// of Prometheus, with the metric names prefixed by winfsp.
+func (s *StatsCollector) WritePrometheus(w io.Writer) error {
+	snapshot := s.Snapshot()
+	var kinds []string
+	for kind := range snapshot.Operations {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var lines []string
+	printf := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	printf("# TYPE winfsp_operations_total counter")
+	for _, kind := range kinds {
+		printf("winfsp_operations_total{kind=%q} %d",
+			kind, snapshot.Operations[kind].Count)
+	}
+	printf("# TYPE winfsp_operation_errors_total counter")
+	for _, kind := range kinds {
+		printf("winfsp_operation_errors_total{kind=%q} %d",
+			kind, snapshot.Operations[kind].Errors)
+	}
+	printf("# TYPE winfsp_operation_duration_seconds histogram")
+	for _, kind := range kinds {
+		stats := snapshot.Operations[kind]
+		var cumulative uint64
+		for i, count := range stats.Latency {
+			cumulative += count
+			le := "+Inf"
+			if i < len(LatencyBuckets) {
+				le = fmt.Sprint(LatencyBuckets[i].Seconds())
+			}
+			printf("winfsp_operation_duration_seconds_bucket"+
+				"{kind=%q,le=%q} %d", kind, le, cumulative)
+		}
+		printf("winfsp_operation_duration_seconds_sum{kind=%q} %g",
+			kind, stats.Duration.Seconds())
+		printf("winfsp_operation_duration_seconds_count{kind=%q} %d",
+			kind, stats.Count)
+	}
+	printf("# TYPE winfsp_read_bytes_total counter")
+	printf("winfsp_read_bytes_total %d", snapshot.BytesRead)
+	printf("# TYPE winfsp_written_bytes_total counter")
+	printf("winfsp_written_bytes_total %d", snapshot.BytesWritten)
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Statistics returns the statistics collector of the file
+// system, which is nil unless the Statistics option is set.
+func (ref *FileSystemRef) Statistics() *StatsCollector {
+	return ref.stats
+}
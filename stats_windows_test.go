@@ -0,0 +1,46 @@
+package winfsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestStatsCollector(t *testing.T) {
+	assert := assert.New(t)
+	stats := newStatsCollector()
+	stats.addOperation(&Operation{
+		Kind: "Read", Duration: 50 * time.Microsecond,
+	})
+	stats.addOperation(&Operation{
+		Kind: "Read", Duration: 5 * time.Millisecond,
+		Status: windows.STATUS_ACCESS_DENIED,
+	})
+	stats.addOperation(&Operation{
+		Kind: "DeviceIoControl", Duration: time.Minute,
+		Status: windows.STATUS_BUFFER_OVERFLOW,
+	})
+	stats.addRead(10)
+	stats.addWritten(3)
+
+	snapshot := stats.Snapshot()
+	assert.Equal(uint64(10), snapshot.BytesRead)
+	assert.Equal(uint64(3), snapshot.BytesWritten)
+	read := snapshot.Operations["Read"]
+	assert.Equal(uint64(2), read.Count)
+	assert.Equal(uint64(1), read.Errors)
+	assert.Equal([]uint64{1, 0, 1, 0, 0, 0, 0}, read.Latency)
+	control := snapshot.Operations["DeviceIoControl"]
+	assert.Equal(uint64(0), control.Errors)
+	assert.Equal(uint64(1), control.Latency[len(LatencyBuckets)])
+
+	var buf bytes.Buffer
+	assert.NoError(stats.WritePrometheus(&buf))
+	assert.Contains(buf.String(), `winfsp_operations_total{kind="Read"} 2`)
+	assert.Contains(buf.String(),
+		`winfsp_operation_duration_seconds_bucket{kind="Read",le="+Inf"} 2`)
+	assert.Contains(buf.String(), "winfsp_read_bytes_total 10")
+}
@@ -0,0 +1,129 @@
+package winfsp
+
+import (
+	"math"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var addStreamInfo *syscall.Proc
+
+// StreamInfo is the entry of a stream of the file.
+type StreamInfo struct {
+	// Name is the name of the stream, which is empty for
+	// the main stream, or the name of a named stream
+	// without the leading colon and stream type, that is,
+	// "stream" for the "file:stream:$DATA".
+	Name string
+
+	// Size is the size of the stream content.
+	Size uint64
+
+	// AllocationSize is the allocated size of the stream.
+	AllocationSize uint64
+}
+
+// encodeStreamInfo encodes the stream entry into an aligned
+// FSP_FSCTL_STREAM_INFO buffer followed by the stream name.
+func encodeStreamInfo(info *StreamInfo) ([]uint64, error) {
+	utf16, err := utf16FromName(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	length := int(unsafe.Sizeof(FSP_FSCTL_STREAM_INFO{}) +
+		uintptr(len(utf16))*SIZEOF_WCHAR)
+	if length > math.MaxUint16 {
+		return nil, windows.STATUS_OBJECT_NAME_INVALID
+	}
+	alignedBuffer := make([]uint64, (length+7)/8)
+	alignedPtr := unsafe.Pointer(&alignedBuffer[0])
+	streamInfo := (*FSP_FSCTL_STREAM_INFO)(alignedPtr)
+	streamInfo.Size = uint16(length)
+	streamInfo.StreamSize = info.Size
+	streamInfo.StreamAllocationSize = info.AllocationSize
+	copy(unsafe.Slice((*uint16)(unsafe.Add(alignedPtr,
+		unsafe.Sizeof(FSP_FSCTL_STREAM_INFO{}))), len(utf16)), utf16)
+	return alignedBuffer, nil
+}
+
+// FileSystemAddStreamInfo appends the stream entry into the
+// buffer of GetStreamInfo, advancing the bytesTransferred.
+//
+// The list of entries must be terminated by adding a nil
+// entry. When false is returned, the buffer is full and the
+// behaviour should return with the entries added so far.
+func FileSystemAddStreamInfo(
+	info *StreamInfo, buf []byte, bytesTransferred *int,
+) (bool, error) {
+	var streamInfo uintptr
+	if info != nil {
+		alignedBuffer, err := encodeStreamInfo(info)
+		if err != nil {
+			return false, err
+		}
+		defer runtime.KeepAlive(alignedBuffer)
+		streamInfo = uintptr(unsafe.Pointer(&alignedBuffer[0]))
+	}
+	var bufAddr uintptr
+	if len(buf) > 0 {
+		bufAddr = uintptr(unsafe.Pointer(&buf[0]))
+	}
+	transferred := uint32(*bytesTransferred)
+	addOk, _, _ := addStreamInfo.Call(
+		streamInfo, bufAddr, uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&transferred)),
+	)
+	*bytesTransferred = int(transferred)
+	// BUG: same bug as the directory buffer acquisition.
+	return uint8(addOk) != 0, nil
+}
+
+// BehaviourGetStreamInfo lists the streams of the file, so
+// that the file system is able to expose alternate data
+// streams. The entries are filled into the buffer by the
+// FileSystemAddStreamInfo, and the number of bytes filled
+// is returned.
+//
+// The volume is reported to support named streams when
+// this interface is implemented, and the file system must
+// handle the "file:stream" names in Open and Create then.
+type BehaviourGetStreamInfo interface {
+	GetStreamInfo(
+		fs *FileSystemRef, file uintptr, buf []byte,
+	) (int, error)
+}
+
+func delegateGetStreamInfo(
+	fileSystem, fileContext, buffer uintptr,
+	length uint32, bytesTransferred *uint32,
+) (status windows.NTStatus) {
+	*bytesTransferred = 0
+	ref := loadFileSystemRef(fileSystem)
+	if ref == nil {
+		return ntStatusNoRef
+	}
+	fileContext = ref.fileContext(fileContext)
+	b, op := ref.beginOperation("GetStreamInfo", fileContext, 0)
+	defer ref.endOperation(b, op, &status)
+	defer ref.lockFile(fileContext)()
+	n, err := b.getStreamInfo.GetStreamInfo(
+		ref, fileContext, enforceBytePtr(buffer, int(length)))
+	if err != nil {
+		return ref.convertNTStatus(err)
+	}
+	*bytesTransferred = uint32(n)
+	return windows.STATUS_SUCCESS
+}
+
+var go_delegateGetStreamInfo = syscall.NewCallbackCDecl(func(
+	fileSystem, fileContext, buffer uintptr,
+	length uint32, bytesTransferred *uint32,
+) uintptr {
+	return uintptr(delegateGetStreamInfo(
+		fileSystem, fileContext, buffer,
+		length, bytesTransferred,
+	))
+})
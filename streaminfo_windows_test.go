@@ -0,0 +1,28 @@
+package winfsp
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestEncodeStreamInfo(t *testing.T) {
+	assert := assert.New(t)
+	header := unsafe.Sizeof(FSP_FSCTL_STREAM_INFO{})
+	buf, err := encodeStreamInfo(&StreamInfo{
+		Name: "stream", Size: 5, AllocationSize: 4096,
+	})
+	assert.NoError(err)
+	info := (*FSP_FSCTL_STREAM_INFO)(unsafe.Pointer(&buf[0]))
+	assert.Equal(uint16(header+2*6), info.Size)
+	assert.Equal(uint64(5), info.StreamSize)
+	assert.Equal(uint64(4096), info.StreamAllocationSize)
+	name := unsafe.Slice((*uint16)(unsafe.Pointer(
+		uintptr(unsafe.Pointer(info))+header)), 6)
+	assert.Equal("stream", windows.UTF16ToString(name))
+
+	_, err = encodeStreamInfo(&StreamInfo{Name: "a\x00b"})
+	assert.Equal(windows.STATUS_OBJECT_NAME_INVALID, err)
+}
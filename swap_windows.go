@@ -0,0 +1,108 @@
+package winfsp
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// behaviourSet is a generation of the behaviours serving the
+// file system, which is snapshotted by every operation and
+// replaced by SwapBehaviour.
+//
+// The pending counts the operations and the asynchronous
+// requests served by the generation, and math.MinInt64 is
+// added to it once the generation is retired, so that no
+// operation is able to snapshot it anymore, and the drained
+// is closed after the pending ones are released.
+type behaviourSet struct {
+	behaviours
+	pending   int64
+	drainOnce sync.Once
+	drained   chan struct{}
+}
+
+func newBehaviourSet() *behaviourSet {
+	return &behaviourSet{drained: make(chan struct{})}
+}
+
+// hold counts another holder of the generation, which is
+// only valid when it has been held by the caller.
+func (b *behaviourSet) hold() {
+	atomic.AddInt64(&b.pending, 1)
+}
+
+func (b *behaviourSet) release() {
+	if atomic.AddInt64(&b.pending, -1) == math.MinInt64 {
+		b.drainOnce.Do(func() { close(b.drained) })
+	}
+}
+
+// retire prevents the generation from being snapshotted and
+// waits for its holders to release it.
+func (b *behaviourSet) retire() {
+	if atomic.AddInt64(&b.pending, math.MinInt64) == math.MinInt64 {
+		b.drainOnce.Do(func() { close(b.drained) })
+	}
+	<-b.drained
+}
+
+// loadBehaviours loads the current behaviours without
+// holding them, which is only used inside the operations or
+// after the dispatcher has been stopped.
+func (ref *FileSystemRef) loadBehaviours() *behaviourSet {
+	return ref.current.Load().(*behaviourSet)
+}
+
+// acquireBehaviours snapshots the current behaviours for
+// an operation, which must be released after it completes.
+func (ref *FileSystemRef) acquireBehaviours() *behaviourSet {
+	for {
+		b := ref.loadBehaviours()
+		if atomic.AddInt64(&b.pending, 1) > 0 {
+			return b
+		}
+		// The generation has been retired, and the next load
+		// is guaranteed to see the new generation.
+		b.release()
+	}
+}
+
+// SwapBehaviour replaces the behaviours serving the file
+// system with the ones implemented by fs, without unmounting
+// the file system. The operations arriving afterwards are
+// served by the new behaviours, and it waits for the ones
+// served by the old behaviours to complete, including the
+// requests completed asynchronously by CompleteAsync.
+//
+// The new file system must implement the same set of
+// behaviours as the mounted one, since the interface has
+// been handed to WinFSP while mounting. The file contexts
+// opened by the old behaviours are passed to the new ones,
+// which must be able to serve them, e.g. by sharing the
+// open file table with the old behaviours.
+//
+// This must not be called inside the behaviours, which
+// would otherwise wait for the operation itself.
+func (ref *FileSystemRef) SwapBehaviour(fs BehaviourBase) error {
+	if fs == nil {
+		return errors.New("invalid nil fs parameter")
+	}
+	next := newBehaviourSet()
+	var fileSystemOps FSP_FILE_SYSTEM_INTERFACE
+	_ = next.bind(fs, &fileSystemOps)
+	if ref.minimalSecurity != nil {
+		next.applyMinimalSecurity(ref.minimalSecurity, &fileSystemOps)
+	}
+	if fileSystemOps != *ref.fileSystemOps {
+		return errors.New("swapped behaviours mismatch mounted ones")
+	}
+	ref.swapMutex.Lock()
+	defer ref.swapMutex.Unlock()
+	previous := ref.loadBehaviours()
+	ref.current.Store(next)
+	previous.retire()
+	return nil
+}
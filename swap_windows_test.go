@@ -0,0 +1,137 @@
+package winfsp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+type swapBase struct{ name string }
+
+func (swapBase) Open(
+	fs *FileSystemRef, name string,
+	createOptions, grantedAccess uint32,
+	info *FSP_FSCTL_FILE_INFO,
+) (uintptr, error) {
+	return 0, nil
+}
+
+func (swapBase) Close(fs *FileSystemRef, file uintptr) {}
+
+type swapFlush struct{ swapBase }
+
+func (swapFlush) Flush(
+	fs *FileSystemRef, file uintptr, info *FSP_FSCTL_FILE_INFO,
+) error {
+	return nil
+}
+
+// swapped waits until the behaviours have been swapped.
+func swapped(ref *FileSystemRef, fs BehaviourBase) bool {
+	for i := 0; i < 100; i++ {
+		if ref.loadBehaviours().base == fs {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestSwapBehaviour(t *testing.T) {
+	assert := assert.New(t)
+	ref, _ := delegateTestRef(t, swapFlush{swapBase{"old"}})
+
+	// The set of behaviours must be identical.
+	assert.Error(ref.SwapBehaviour(nil))
+	assert.Error(ref.SwapBehaviour(swapBase{"new"}))
+	assert.Equal(swapFlush{swapBase{"old"}}, ref.loadBehaviours().base)
+
+	// The swapping waits for the operations in flight, while
+	// the operations arriving afterwards are served by the
+	// new behaviours without waiting for the swapping.
+	old, op := ref.beginOperation("Flush", 1, 0)
+	done := make(chan error)
+	go func() {
+		done <- ref.SwapBehaviour(swapFlush{swapBase{"new"}})
+	}()
+	assert.True(swapped(ref, swapFlush{swapBase{"new"}}))
+	next, nextOp := ref.beginOperation("Flush", 1, 0)
+	assert.Equal(swapFlush{swapBase{"new"}}, next.flush)
+	ref.endOperation(next, nextOp, nil)
+	select {
+	case <-done:
+		t.Fatal("swapped with operation in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Equal(swapFlush{swapBase{"old"}}, old.flush)
+	ref.endOperation(old, op, nil)
+	assert.NoError(<-done)
+}
+
+func TestSwapBehaviourAsync(t *testing.T) {
+	assert := assert.New(t)
+	ref, _ := delegateTestRef(t, swapFlush{swapBase{"old"}})
+
+	// The pending request holds the behaviours until it is
+	// completed, even if the operation has returned.
+	b, op := ref.beginOperation("Read", 1, 0)
+	hold := &asyncHold{}
+	hold.attach(func(status windows.NTStatus) {
+		ref.finishOperation(b, op, status)
+	})
+	done := make(chan error)
+	go func() {
+		done <- ref.SwapBehaviour(swapFlush{swapBase{"new"}})
+	}()
+	select {
+	case <-done:
+		t.Fatal("swapped with request pending")
+	case <-time.After(20 * time.Millisecond):
+	}
+	hold.complete(windows.STATUS_SUCCESS)
+	assert.NoError(<-done)
+
+	// The request completed before the operation returns
+	// releases the behaviours once it returns.
+	b, op = ref.beginOperation("Read", 1, 0)
+	hold = &asyncHold{}
+	hold.complete(windows.STATUS_SUCCESS)
+	hold.attach(func(status windows.NTStatus) {
+		ref.finishOperation(b, op, status)
+	})
+	assert.NoError(ref.SwapBehaviour(swapFlush{swapBase{"old"}}))
+}
+
+func TestSwapBehaviourLimited(t *testing.T) {
+	assert := assert.New(t)
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+	ref, _ := delegateTestRef(t, swapFlush{swapBase{"old"}})
+	ref.instrumented = true
+	ref.limiter = newConcurrencyLimiter(1, nil)
+
+	// The operation waiting for the limiter holds nothing,
+	// so the swapping only waits for the running one.
+	running, op := ref.beginOperation("Flush", 1, 0)
+	waiting := make(chan *behaviourSet)
+	release := make(chan struct{})
+	go func() {
+		b, op := ref.beginOperation("Flush", 1, 0)
+		waiting <- b
+		<-release
+		ref.endOperation(b, op, nil)
+	}()
+	done := make(chan error)
+	go func() {
+		done <- ref.SwapBehaviour(swapFlush{swapBase{"new"}})
+	}()
+	assert.True(swapped(ref, swapFlush{swapBase{"new"}}))
+	ref.endOperation(running, op, nil)
+	assert.NoError(<-done)
+	b := <-waiting
+	assert.Equal(swapFlush{swapBase{"new"}}, b.flush)
+	close(release)
+}
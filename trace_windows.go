@@ -0,0 +1,54 @@
+package winfsp
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Trace records the entry and the exit of every behaviour
+// invocation into a ring buffer of the size, which could be
+// dumped by DumpTrace at any time. This works as a cheap
+// flight recorder for the interactions that are hard to
+// reproduce, e.g. the ones made by the explorer.
+//
+// The entry records the kind, the file context, the file name,
+// the originating process and the arguments of the operation,
+// and the exit additionally records the duration and the
+// status.
+func Trace(size int) Option {
+	return func(o *option) {
+		o.traceSize = size
+	}
+}
+
+func formatTraceEvent(op *Operation) string {
+	if !op.exited {
+		return fmt.Sprintf(
+			"%s enter %s file=%#x name=%q pid=%d "+
+				"offset=%d length=%d flags=%#x",
+			op.Start.Format(time.RFC3339Nano), op.Kind, op.File,
+			op.Name, op.ProcessId, op.Offset, op.Length, op.Flags)
+	}
+	return fmt.Sprintf(
+		"%s exit  %s file=%#x name=%q pid=%d "+
+			"offset=%d length=%d flags=%#x took=%s status=%s",
+		op.Start.Add(op.Duration).Format(time.RFC3339Nano),
+		op.Kind, op.File, op.Name, op.ProcessId,
+		op.Offset, op.Length, op.Flags, op.Duration, op.Status)
+}
+
+// DumpTrace writes the recorded trace from the oldest event,
+// one event per line. Nothing is written if the file system
+// is not mounted with the Trace option.
+func (ref *FileSystemRef) DumpTrace(w io.Writer) error {
+	if ref.trace == nil {
+		return nil
+	}
+	for _, op := range ref.trace.snapshot() {
+		if _, err := fmt.Fprintln(w, formatTraceEvent(&op)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
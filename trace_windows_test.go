@@ -0,0 +1,43 @@
+package winfsp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestTraceRing(t *testing.T) {
+	assert := assert.New(t)
+	ref := &FileSystemRef{trace: newOperationRing(3)}
+	for _, kind := range []string{"Open", "Read", "Close"} {
+		op := &Operation{
+			Kind: kind, File: 1, Name: `\file`,
+			Offset: 4096, Length: 512, Flags: 0x3,
+		}
+		ref.trace.add(op)
+		op.exited = true
+		op.Status = windows.STATUS_END_OF_FILE
+		ref.trace.add(op)
+	}
+
+	// Only the latest events are kept, from the oldest one.
+	var buf bytes.Buffer
+	assert.NoError(ref.DumpTrace(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(lines, 3) {
+		assert.Contains(lines[0], `exit  Read file=0x1 name="\\file"`)
+		assert.Contains(lines[0], "offset=4096 length=512 flags=0x3")
+		assert.Contains(lines[1], "enter Close")
+		assert.Contains(lines[1], "offset=4096 length=512 flags=0x3")
+		assert.Contains(lines[2], "exit  Close")
+		assert.Contains(lines[2], "status="+
+			windows.STATUS_END_OF_FILE.Error())
+	}
+
+	buf.Reset()
+	assert.NoError((&FileSystemRef{}).DumpTrace(&buf))
+	assert.Empty(buf.String())
+}
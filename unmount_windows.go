@@ -0,0 +1,74 @@
+package winfsp
+
+import (
+	"context"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// UnmountContext unmounts the file system gracefully. The
+// volume is flushed first, then the dispatcher is stopped
+// after the in-flight operations complete, and the files
+// remaining open are closed, so that the resources held
+// by them, e.g. the DirBuffer, are released.
+//
+// The context of the file system is cancelled before the
+// dispatcher is stopped, so that the behaviours blocking on
+// the backing store can be interrupted. When the ctx is
+// done before the in-flight operations complete, its error
+// is returned, while the file system is still destroyed in
+// background after they complete.
+func (f *FileSystem) UnmountContext(ctx context.Context) error {
+	f.beginUnmount()
+	var result error
+	if b := f.loadBehaviours(); b.flushVolume != nil {
+		if err := b.flushVolume.FlushVolume(&f.FileSystemRef); err != nil {
+			result = errors.Wrap(err, "flush volume")
+		}
+	}
+	f.cancel()
+	if f.shellDrive != "" {
+		if err := UnregisterDriveIcon(f.shellDrive); err != nil && result == nil {
+			result = errors.Wrap(err, "unregister drive icon")
+		}
+	}
+	destroyed := make(chan error, 1)
+	go func() {
+		f.destroy()
+		err := f.mountDir.cleanup()
+		if f.debugLogCloser != nil {
+			_ = f.debugLogCloser.Close()
+		}
+		destroyed <- err
+	}()
+	select {
+	case err := <-destroyed:
+		if err != nil && result == nil {
+			result = err
+		}
+		return result
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "wait for in-flight operations")
+	}
+}
+
+// destroy stops the dispatcher and releases the resources
+// of the file system, which blocks until the in-flight
+// operations complete.
+func (f *FileSystem) destroy() {
+	fileSystem := uintptr(unsafe.Pointer(f.fileSystem))
+	_, _, _ = stopDispatcher.Call(fileSystem)
+	b := f.loadBehaviours()
+	f.openFiles.Range(func(key, _ interface{}) bool {
+		file := key.(uintptr)
+		b.base.Close(&f.FileSystemRef, file)
+		f.openFiles.Delete(file)
+		f.untrackFileName(file)
+		f.releaseFile(file)
+		return true
+	})
+	f.releaseVolume()
+	_, _, _ = fileSystemDelete.Call(fileSystem)
+	refMap.unregister(f.handle)
+}
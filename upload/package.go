@@ -0,0 +1,12 @@
+// Package upload provides a gofs.FileSystem layer for remote
+// backends, which stages the written files locally and uploads
+// them when they are flushed or closed.
+//
+// The upload is resumable, so that a hiccup of connection in
+// the middle of copying will be retried from where the remote
+// has received, instead of silently dropping the data. The
+// failure of upload is reported to the final Flush (which is
+// mapped to Sync) so that the applications saving the file
+// are aware of it, and the staged file is kept locally if it
+// still fails while closing.
+package upload
@@ -0,0 +1,508 @@
+package upload
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// Session is the resumable upload of a file to the remote.
+type Session interface {
+	// Upload sends the data of the file at the offset.
+	Upload(data []byte, offset int64) error
+
+	// Resume queries the offset that the remote has received,
+	// from which the upload continues after a failure.
+	Resume() (int64, error)
+
+	// Commit finishes the upload, replacing the remote file
+	// with the uploaded content.
+	Commit() error
+}
+
+// Backend is the remote file system to upload to. The files
+// are read and listed through the gofs.FileSystem interface,
+// while the written files are uploaded through sessions.
+type Backend interface {
+	gofs.FileSystem
+
+	// NewUpload starts the upload session of the file.
+	NewUpload(name string, size int64) (Session, error)
+}
+
+// ProgressFunc is called with the number of bytes uploaded
+// after each chunk is sent to the remote.
+type ProgressFunc func(name string, uploaded, total int64)
+
+type option struct {
+	chunkSize int
+	retries   int
+	backoff   time.Duration
+	progress  ProgressFunc
+}
+
+// Option is the option for creating the upload layer.
+type Option func(*option)
+
+// ChunkSize sets the size of the data sent in each call of
+// Session.Upload, which is also the granularity of progress.
+func ChunkSize(size int) Option {
+	return func(o *option) {
+		o.chunkSize = size
+	}
+}
+
+// Retry sets the number of retries after a failed attempt,
+// and the backoff which grows linearly with the attempts.
+func Retry(retries int, backoff time.Duration) Option {
+	return func(o *option) {
+		o.retries = retries
+		o.backoff = backoff
+	}
+}
+
+// Progress sets the callback for reporting the progress.
+func Progress(f ProgressFunc) Option {
+	return func(o *option) {
+		o.progress = f
+	}
+}
+
+// stagedFile is the local copy of a file opened for writing,
+// which is shared by all handles opening the same file.
+type stagedFile struct {
+	mtx        sync.Mutex
+	name       string
+	file       *os.File
+	refs       int
+	releasing  int
+	closed     bool
+	generation uint64
+	uploaded   uint64
+}
+
+func (s *stagedFile) dirty() bool {
+	return s.generation != s.uploaded
+}
+
+func (s *stagedFile) touch() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.generation++
+}
+
+type fileSystem struct {
+	option
+	backend Backend
+	dir     string
+	mtx     sync.Mutex
+	staged  map[string]*stagedFile
+	staging map[string]chan struct{}
+}
+
+// New creates the upload layer over the backend, whose
+// staged files are placed under the directory.
+func New(backend Backend, dir string, opts ...Option) gofs.FileSystem {
+	result := &fileSystem{
+		option: option{
+			chunkSize: 4 * 1024 * 1024,
+			retries:   3,
+			backoff:   time.Second,
+		},
+		backend: backend,
+		dir:     dir,
+		staged:  make(map[string]*stagedFile),
+		staging: make(map[string]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&result.option)
+	}
+	return result
+}
+
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_APPEND |
+	os.O_CREATE | os.O_TRUNC
+
+// waitStaging waits for the file being staged by another
+// opener, with lock held, which is released while waiting.
+func (fs *fileSystem) waitStaging(name string) {
+	for {
+		done, ok := fs.staging[name]
+		if !ok {
+			return
+		}
+		fs.mtx.Unlock()
+		<-done
+		fs.mtx.Lock()
+	}
+}
+
+// stage downloads the file from the remote into the staged
+// file unless it is to be truncated, without lock held, while
+// the other openers of the file wait for it to complete.
+func (fs *fileSystem) stage(name string, flag int) (*stagedFile, error) {
+	fileInfo, err := fs.backend.Stat(name)
+	exists := err == nil
+	switch {
+	case err != nil && !(os.IsNotExist(err) && flag&os.O_CREATE != 0):
+		return nil, err
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, os.ErrExist
+	case exists && fileInfo.IsDir():
+		return nil, syscall.EISDIR
+	}
+	file, err := os.CreateTemp(fs.dir, "staged-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "create staged file")
+	}
+	s := &stagedFile{name: name, file: file}
+	if !exists || flag&os.O_TRUNC != 0 {
+		// The file must be created or truncated on the remote
+		// even if nothing is written to it.
+		s.generation++
+	} else if err := fs.download(name, file); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return s, nil
+}
+
+func (fs *fileSystem) download(name string, file *os.File) error {
+	source, err := fs.backend.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = source.Close() }()
+	if _, err := io.Copy(file, source); err != nil {
+		return errors.Wrapf(err, "download %q", name)
+	}
+	return nil
+}
+
+// send uploads the staged file from the offset to its end.
+func (fs *fileSystem) send(
+	s *stagedFile, session Session, offset, size int64,
+) error {
+	buf := make([]byte, fs.chunkSize)
+	for offset < size {
+		n, err := s.file.ReadAt(buf, offset)
+		if n == 0 && err != nil {
+			return err
+		}
+		if err := session.Upload(buf[:n], offset); err != nil {
+			return err
+		}
+		offset += int64(n)
+		if fs.progress != nil {
+			fs.progress(s.name, offset, size)
+		}
+	}
+	return nil
+}
+
+// upload uploads the staged file if it is dirty, retrying
+// from the offset received by the remote upon failure.
+func (fs *fileSystem) upload(s *stagedFile) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed || !s.dirty() {
+		return nil
+	}
+	generation := s.generation
+	fileInfo, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := fileInfo.Size()
+	session, err := fs.backend.NewUpload(s.name, size)
+	if err != nil {
+		return errors.Wrapf(err, "upload %q", s.name)
+	}
+	var offset int64
+	for attempt := 0; ; attempt++ {
+		err = fs.send(s, session, offset, size)
+		if err == nil {
+			err = session.Commit()
+		}
+		if err == nil {
+			s.uploaded = generation
+			return nil
+		}
+		if attempt >= fs.retries {
+			return errors.Wrapf(err, "upload %q", s.name)
+		}
+
+		// The writers must not be blocked by the backoff, and
+		// the file might have been uploaded by others then.
+		s.mtx.Unlock()
+		time.Sleep(time.Duration(attempt+1) * fs.backoff)
+		s.mtx.Lock()
+		if s.closed || !s.dirty() {
+			return nil
+		}
+		if resumed, resumeErr := session.Resume(); resumeErr == nil {
+			offset = resumed
+		}
+	}
+}
+
+// release closes the staged file after the last handle is
+// closed, which is kept locally if it cannot be uploaded.
+func (fs *fileSystem) release(s *stagedFile) error {
+	fs.mtx.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last {
+		s.releasing++
+	}
+	fs.mtx.Unlock()
+	if !last {
+		return nil
+	}
+
+	// The staged file remains visible while uploading, so
+	// that it might be reopened before the upload completes.
+	err := fs.upload(s)
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	s.releasing--
+	if s.refs > 0 || s.releasing > 0 {
+		// Whoever releases it lastly will clean it up.
+		return err
+	}
+	delete(fs.staged, s.name)
+	s.mtx.Lock()
+	s.closed = true
+	s.mtx.Unlock()
+	_ = s.file.Close()
+	if err != nil {
+		return errors.Wrapf(err, "staged file kept at %q", s.file.Name())
+	}
+	return os.Remove(s.file.Name())
+}
+
+func (fs *fileSystem) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.waitStaging(name)
+	s, ok := fs.staged[name]
+	if !ok && flag&writeFlags == 0 {
+		return fs.backend.OpenFile(name, flag, perm)
+	}
+	if ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, os.ErrExist
+	}
+	if !ok {
+		// The file is downloaded without lock, so that the
+		// other files are not blocked by the download.
+		done := make(chan struct{})
+		fs.staging[name] = done
+		fs.mtx.Unlock()
+		staged, err := fs.stage(name, flag)
+		fs.mtx.Lock()
+		delete(fs.staging, name)
+		close(done)
+		if err != nil {
+			return nil, err
+		}
+		s = staged
+		fs.staged[name] = s
+	}
+	if ok && flag&os.O_TRUNC != 0 {
+		if err := s.file.Truncate(0); err != nil {
+			return nil, err
+		}
+		s.touch()
+	}
+	s.refs++
+	return &file{fs: fs, staged: s, flag: flag}, nil
+}
+
+func (fs *fileSystem) Mkdir(name string, perm os.FileMode) error {
+	return fs.backend.Mkdir(name, perm)
+}
+
+func (fs *fileSystem) Stat(name string) (os.FileInfo, error) {
+	fs.mtx.Lock()
+	s, ok := fs.staged[name]
+	fs.mtx.Unlock()
+	if ok {
+		return (&file{staged: s}).Stat()
+	}
+	return fs.backend.Stat(name)
+}
+
+// settle waits for the upload of the file in progress, which
+// might still be uploading after all of its handles are closed.
+func (fs *fileSystem) settle(name string) {
+	fs.mtx.Lock()
+	fs.waitStaging(name)
+	s, ok := fs.staged[name]
+	fs.mtx.Unlock()
+	if ok {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+	}
+}
+
+func (fs *fileSystem) Rename(source, target string) error {
+	fs.settle(source)
+	fs.settle(target)
+	return fs.backend.Rename(source, target)
+}
+
+func (fs *fileSystem) Remove(name string) error {
+	fs.settle(name)
+	return fs.backend.Remove(name)
+}
+
+// Sync uploads all staged files that have been modified, which
+// is called when the volume is flushed, reporting the first
+// failure of upload.
+func (fs *fileSystem) Sync() error {
+	fs.mtx.Lock()
+	staged := make([]*stagedFile, 0, len(fs.staged))
+	for _, s := range fs.staged {
+		staged = append(staged, s)
+	}
+	fs.mtx.Unlock()
+	var result error
+	for _, s := range staged {
+		if err := fs.upload(s); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// file is the handle of a staged file.
+type file struct {
+	fs     *fileSystem
+	staged *stagedFile
+	flag   int
+	mtx    sync.Mutex
+	offset int64
+	closed bool
+}
+
+func (f *file) ReadAt(b []byte, offset int64) (int, error) {
+	return f.staged.file.ReadAt(b, offset)
+}
+
+func (f *file) WriteAt(b []byte, offset int64) (int, error) {
+	defer f.staged.touch()
+	return f.staged.file.WriteAt(b, offset)
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *file) Write(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		fileInfo, err := f.staged.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		f.offset = fileInfo.Size()
+	}
+	n, err := f.WriteAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		fileInfo, err := f.staged.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fileInfo.Size()
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, syscall.ENOTDIR
+}
+
+// stagedFileInfo reports the name of the remote file.
+type stagedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i *stagedFileInfo) Name() string {
+	return i.name
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	fileInfo, err := f.staged.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	name := f.staged.name
+	for i := len(name) - 1; i >= 0; i-- {
+		if os.IsPathSeparator(name[i]) {
+			name = name[i+1:]
+			break
+		}
+	}
+	return &stagedFileInfo{FileInfo: fileInfo, name: name}, nil
+}
+
+// Sync uploads the staged file, reporting the failure of
+// upload to the Flush of the file.
+func (f *file) Sync() error {
+	if err := f.staged.file.Sync(); err != nil {
+		return err
+	}
+	return f.fs.upload(f.staged)
+}
+
+func (f *file) Truncate(size int64) error {
+	defer f.staged.touch()
+	return f.staged.file.Truncate(size)
+}
+
+func (f *file) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return f.fs.release(f.staged)
+}
+
+var (
+	_ gofs.FileSystemSync = (*fileSystem)(nil)
+	_ gofs.File           = (*file)(nil)
+)
@@ -0,0 +1,318 @@
+package upload_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+	"github.com/aegistudio/go-winfsp/upload"
+)
+
+var errHiccup = errors.New("connection hiccup")
+
+// flakyBackend is the backend storing the files under a local
+// directory, whose uploads fail after the configured bytes.
+type flakyBackend struct {
+	root string
+
+	mtx       sync.Mutex
+	failAfter int64
+	failures  int
+	sent      int64
+	hiccup    chan struct{}
+}
+
+func (b *flakyBackend) path(name string) string {
+	return filepath.Join(b.root, name)
+}
+
+func (b *flakyBackend) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	f, err := os.OpenFile(b.path(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (b *flakyBackend) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(b.path(name), perm)
+}
+
+func (b *flakyBackend) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(b.path(name))
+}
+
+func (b *flakyBackend) Rename(source, target string) error {
+	return os.Rename(b.path(source), b.path(target))
+}
+
+func (b *flakyBackend) Remove(name string) error {
+	return os.Remove(b.path(name))
+}
+
+type flakySession struct {
+	backend  *flakyBackend
+	name     string
+	received []byte
+}
+
+func (b *flakyBackend) NewUpload(
+	name string, size int64,
+) (upload.Session, error) {
+	return &flakySession{backend: b, name: name}, nil
+}
+
+func (s *flakySession) Upload(data []byte, offset int64) error {
+	b := s.backend
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.failures > 0 && offset+int64(len(data)) > b.failAfter {
+		b.failures--
+		if b.hiccup != nil {
+			close(b.hiccup)
+			b.hiccup = nil
+		}
+		return errHiccup
+	}
+	if offset != int64(len(s.received)) {
+		return errors.Errorf("unexpected offset %d", offset)
+	}
+	s.received = append(s.received, data...)
+	b.sent += int64(len(data))
+	return nil
+}
+
+func (s *flakySession) Resume() (int64, error) {
+	return int64(len(s.received)), nil
+}
+
+func (s *flakySession) Commit() error {
+	return os.WriteFile(s.backend.path(s.name), s.received, 0644)
+}
+
+func newLayer(t *testing.T, opts ...upload.Option) (
+	*flakyBackend, string, gofs.FileSystem,
+) {
+	backend := &flakyBackend{root: t.TempDir()}
+	staging := t.TempDir()
+	opts = append([]upload.Option{
+		upload.ChunkSize(4), upload.Retry(2, 0),
+	}, opts...)
+	return backend, staging, upload.New(backend, staging, opts...)
+}
+
+func TestResumeUpload(t *testing.T) {
+	assert := assert.New(t)
+	var progress []int64
+	backend, staging, fs := newLayer(t, upload.Progress(
+		func(name string, uploaded, total int64) {
+			assert.Equal("file", name)
+			assert.Equal(int64(26), total)
+			progress = append(progress, uploaded)
+		}))
+	backend.failAfter, backend.failures = 10, 1
+
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte("abcdefghijklmnopqrstuvwxyz"))
+	assert.NoError(err)
+	assert.NoError(f.Sync())
+	content, err := os.ReadFile(backend.path("file"))
+	assert.NoError(err)
+	assert.Equal("abcdefghijklmnopqrstuvwxyz", string(content))
+
+	// The upload is resumed from where the remote received,
+	// instead of starting over again.
+	assert.Equal(int64(26), backend.sent)
+	assert.Equal([]int64{4, 8, 12, 16, 20, 24, 26}, progress)
+
+	// Nothing is uploaded again if it is not modified.
+	assert.NoError(f.Close())
+	assert.Equal(int64(26), backend.sent)
+	entries, err := os.ReadDir(staging)
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestModifyExisting(t *testing.T) {
+	assert := assert.New(t)
+	backend, _, fs := newLayer(t)
+	assert.NoError(os.WriteFile(backend.path("file"), []byte("hello"), 0644))
+
+	f, err := fs.OpenFile("file", os.O_WRONLY|os.O_APPEND, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte(", world"))
+	assert.NoError(err)
+
+	// The staged content is visible to other handles.
+	info, err := fs.Stat("file")
+	assert.NoError(err)
+	assert.Equal("file", info.Name())
+	assert.Equal(int64(12), info.Size())
+	reader, err := fs.OpenFile("file", os.O_RDONLY, 0)
+	if assert.NoError(err) {
+		content, err := io.ReadAll(reader)
+		assert.NoError(err)
+		assert.Equal("hello, world", string(content))
+		assert.NoError(reader.Close())
+	}
+
+	assert.NoError(f.Close())
+	content, err := os.ReadFile(backend.path("file"))
+	assert.NoError(err)
+	assert.Equal("hello, world", string(content))
+}
+
+func TestUploadFailure(t *testing.T) {
+	assert := assert.New(t)
+	backend, staging, fs := newLayer(t)
+	backend.failAfter, backend.failures = 0, 100
+
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte("precious data"))
+	assert.NoError(err)
+	assert.True(errors.Is(f.Sync(), errHiccup))
+	assert.True(errors.Is(f.Close(), errHiccup))
+
+	// The data must be kept locally instead of being dropped.
+	entries, err := os.ReadDir(staging)
+	assert.NoError(err)
+	if assert.Len(entries, 1) {
+		content, err := os.ReadFile(
+			filepath.Join(staging, entries[0].Name()))
+		assert.NoError(err)
+		assert.Equal("precious data", string(content))
+	}
+	_, err = os.Stat(backend.path("file"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestSyncVolume(t *testing.T) {
+	assert := assert.New(t)
+	backend, _, fs := newLayer(t)
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	_, err = f.Write([]byte("pending"))
+	assert.NoError(err)
+
+	// Flushing the volume uploads the files still open.
+	assert.NoError(fs.(gofs.FileSystemSync).Sync())
+	content, err := os.ReadFile(backend.path("file"))
+	assert.NoError(err)
+	assert.Equal("pending", string(content))
+}
+
+// slowBackend is the flakyBackend whose downloads of the
+// file are blocked until the gate is opened.
+type slowBackend struct {
+	*flakyBackend
+	name    string
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (b *slowBackend) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	if name == b.name && flag == os.O_RDONLY {
+		close(b.started)
+		<-b.gate
+	}
+	return b.flakyBackend.OpenFile(name, flag, perm)
+}
+
+func TestSlowDownload(t *testing.T) {
+	assert := assert.New(t)
+	backend := &slowBackend{
+		flakyBackend: &flakyBackend{root: t.TempDir()},
+		name:         "slow",
+		started:      make(chan struct{}),
+		gate:         make(chan struct{}),
+	}
+	fs := upload.New(backend, t.TempDir())
+	assert.NoError(os.WriteFile(backend.path("slow"), []byte("slow"), 0644))
+	assert.NoError(os.WriteFile(backend.path("other"), []byte("other"), 0644))
+
+	opened := make(chan gofs.File, 2)
+	open := func() {
+		f, err := fs.OpenFile("slow", os.O_RDWR, 0)
+		assert.NoError(err)
+		opened <- f
+	}
+	go open()
+	<-backend.started
+	go open()
+
+	// The other files are served while downloading.
+	info, err := fs.Stat("other")
+	assert.NoError(err)
+	assert.Equal(int64(5), info.Size())
+	f, err := fs.OpenFile("other", os.O_RDWR, 0)
+	if assert.NoError(err) {
+		assert.NoError(f.Close())
+	}
+
+	// The openers of the same file share the download.
+	close(backend.gate)
+	first, second := <-opened, <-opened
+	if first == nil || second == nil {
+		return
+	}
+	_, err = first.WriteAt([]byte("SLOW"), 0)
+	assert.NoError(err)
+	content, err := io.ReadAll(second)
+	assert.NoError(err)
+	assert.Equal("SLOW", string(content))
+	assert.NoError(first.Close())
+	assert.NoError(second.Close())
+}
+
+func TestWriteDuringBackoff(t *testing.T) {
+	assert := assert.New(t)
+	backend, _, fs := newLayer(t, upload.Retry(1, time.Second))
+	backend.failAfter, backend.failures = 0, 1
+	hiccup := make(chan struct{})
+	backend.hiccup = hiccup
+	f, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0644)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte("first"))
+	assert.NoError(err)
+
+	// The writer is not blocked by the upload backing off.
+	synced := make(chan error, 1)
+	go func() { synced <- f.Sync() }()
+	<-hiccup
+	_, err = f.Write([]byte(" second"))
+	assert.NoError(err)
+	select {
+	case <-synced:
+		t.Error("write blocked by the backoff")
+	default:
+	}
+	assert.NoError(<-synced)
+	assert.NoError(f.Close())
+	content, err := os.ReadFile(backend.path("file"))
+	assert.NoError(err)
+	assert.Equal("first second", string(content))
+}
@@ -0,0 +1,73 @@
+package winfsp
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var fspVersion *syscall.Proc
+
+// errUnsupported is returned when the API is missing from
+// the installed release of WinFSP.
+var errUnsupported = errors.New("unsupported by installed winfsp")
+
+// Version returns the version of the installed WinFSP DLL,
+// e.g. 2.0 for WinFSP 2023, which is the version of the file
+// instead of the marketing name of the release.
+func Version() (major, minor uint16, err error) {
+	if err := tryLoadWinFSP(); err != nil {
+		return 0, 0, err
+	}
+	if fspVersion == nil {
+		return 0, 0, errors.Wrap(errUnsupported, "version")
+	}
+	var version uint32
+	if err := callNTStatus(fspVersion,
+		uintptr(unsafe.Pointer(&version))); err != nil {
+		return 0, 0, errors.Wrap(err, "version")
+	}
+	return uint16(version >> 16), uint16(version), nil
+}
+
+// versionAtLeast tells whether the installed WinFSP is no
+// older than the version.
+func versionAtLeast(major, minor uint16) bool {
+	actualMajor, actualMinor, err := Version()
+	if err != nil {
+		return false
+	}
+	if actualMajor != major {
+		return actualMajor > major
+	}
+	return actualMinor >= minor
+}
+
+// SupportsNotify tells whether the installed WinFSP supports
+// the change notifications, i.e. FileSystemRef.Notify and
+// FileSystemRef.InvalidateCache.
+func SupportsNotify() bool {
+	if err := tryLoadWinFSP(); err != nil {
+		return false
+	}
+	return notify != nil && notifyBegin != nil && notifyEnd != nil
+}
+
+// SupportsPosixPath tells whether the installed WinFSP
+// supports mapping the paths between windows and POSIX.
+func SupportsPosixPath() bool {
+	if err := tryLoadWinFSP(); err != nil {
+		return false
+	}
+	return posixMapWindowsToPosixPathEx != nil &&
+		posixMapPosixToWindowsPathEx != nil
+}
+
+// SupportsPosixUnlink tells whether the installed WinFSP
+// supports the POSIX semantics of unlink and rename, which
+// is required by the PosixUnlinkRename option. It is shipped
+// since WinFSP 2021 (version 1.9).
+func SupportsPosixUnlink() bool {
+	return versionAtLeast(1, 9)
+}
@@ -0,0 +1,26 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	assert := assert.New(t)
+	if err := tryLoadWinFSP(); err != nil {
+		t.Skipf("winfsp unavailable: %v", err)
+	}
+	major, minor, err := Version()
+	if err != nil {
+		t.Skipf("version unavailable: %v", err)
+	}
+	assert.GreaterOrEqual(major, uint16(1))
+
+	// The version is compared by the major version first.
+	assert.True(versionAtLeast(0, minor+1))
+	assert.True(versionAtLeast(major, minor))
+	assert.False(versionAtLeast(major, minor+1))
+	assert.False(versionAtLeast(major+1, 0))
+	assert.Equal(versionAtLeast(1, 9), SupportsPosixUnlink())
+}
@@ -0,0 +1,208 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// AutoSave is the writable in-memory file backed by a byte
+// slice, which tracks whether it has been modified, and hands
+// its content to the save callback on Sync and Close.
+//
+// This makes editing a generated file on the drive persist
+// into the application, without implementing a FileSystem.
+type AutoSave struct {
+	mtx     sync.RWMutex
+	data    []byte
+	modTime time.Time
+	dirty   bool
+	save    func(data []byte) error
+}
+
+// NewAutoSave creates the file with the initial content.
+func NewAutoSave(data []byte, save func(data []byte) error) *AutoSave {
+	return &AutoSave{
+		data:    append([]byte(nil), data...),
+		modTime: time.Now(),
+		save:    save,
+	}
+}
+
+// Bytes returns a copy of the current content.
+func (a *AutoSave) Bytes() []byte {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	return append([]byte(nil), a.data...)
+}
+
+// Set replaces the content from the application, which will
+// not be handed to the save callback.
+func (a *AutoSave) Set(data []byte) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.data = append([]byte(nil), data...)
+	a.modTime = time.Now()
+	a.dirty = false
+}
+
+// Save hands the content to the save callback if modified,
+// and the content remains modified if it fails.
+func (a *AutoSave) Save() error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if !a.dirty {
+		return nil
+	}
+	if err := a.save(append([]byte(nil), a.data...)); err != nil {
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+// modify updates the content with the lock held.
+func (a *AutoSave) modify(f func()) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	f()
+	a.modTime = time.Now()
+	a.dirty = true
+}
+
+func (a *AutoSave) info(name string) *fileInfo {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	return &fileInfo{
+		name:    name,
+		size:    int64(len(a.data)),
+		mode:    0666,
+		modTime: a.modTime,
+	}
+}
+
+func (a *AutoSave) stat(fs *FileSystem, name string) (os.FileInfo, error) {
+	return a.info(name), nil
+}
+
+func (a *AutoSave) open(
+	fs *FileSystem, name string, flag int,
+) (gofs.File, error) {
+	if flag&os.O_TRUNC != 0 {
+		a.modify(func() { a.data = nil })
+	}
+	return &autoSaveFile{file: a, name: name, flag: flag}, nil
+}
+
+// autoSaveFile is the open file of AutoSave.
+type autoSaveFile struct {
+	file   *AutoSave
+	name   string
+	flag   int
+	mtx    sync.Mutex
+	offset int64
+}
+
+func (f *autoSaveFile) ReadAt(b []byte, offset int64) (int, error) {
+	f.file.mtx.RLock()
+	defer f.file.mtx.RUnlock()
+	if offset >= int64(len(f.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.file.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *autoSaveFile) WriteAt(b []byte, offset int64) (int, error) {
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, os.ErrPermission
+	}
+	var n int
+	f.file.modify(func() {
+		if end := offset + int64(len(b)); end > int64(len(f.file.data)) {
+			data := make([]byte, end)
+			copy(data, f.file.data)
+			f.file.data = data
+		}
+		n = copy(f.file.data[offset:], b)
+	})
+	return n, nil
+}
+
+func (f *autoSaveFile) Read(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *autoSaveFile) Write(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = f.file.info(f.name).size
+	}
+	n, err := f.WriteAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *autoSaveFile) Seek(offset int64, whence int) (int64, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.file.info(f.name).size
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *autoSaveFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, syscall.ENOTDIR
+}
+
+func (f *autoSaveFile) Stat() (os.FileInfo, error) {
+	return f.file.info(f.name), nil
+}
+
+func (f *autoSaveFile) Sync() error {
+	return f.file.Save()
+}
+
+func (f *autoSaveFile) Truncate(size int64) error {
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return os.ErrPermission
+	}
+	f.file.modify(func() {
+		data := make([]byte, size)
+		copy(data, f.file.data)
+		f.file.data = data
+	})
+	return nil
+}
+
+func (f *autoSaveFile) Close() error {
+	return f.file.Save()
+}
+
+var (
+	_ Node      = (*AutoSave)(nil)
+	_ gofs.File = (*autoSaveFile)(nil)
+)
@@ -0,0 +1,18 @@
+// Package vfs provides the building blocks of synthetic file
+// systems, whose files and directories are declared as a tree
+// of Go values instead of being stored anywhere.
+//
+// The content of files comes from Go callbacks, which are
+// called when the files are opened or stated, so the size and
+// modification time are always derived from the content being
+// served. Directories are either static maps or generators,
+// which is the procfs-like building block for dashboards,
+// config views and device front-ends.
+//
+// The tree is read only except for the AutoSave files, which
+// are edited in memory and handed back to the application to
+// persist when they are flushed or closed.
+//
+// The tree is served as a gofs.FileSystem, which could be
+// mounted through the gofs package.
+package vfs
@@ -0,0 +1,414 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// Node is a file or directory in the virtual tree.
+type Node interface {
+	stat(fs *FileSystem, name string) (os.FileInfo, error)
+	open(fs *FileSystem, name string, flag int) (gofs.File, error)
+}
+
+// dirNode is the node whose children could be listed.
+type dirNode interface {
+	Node
+	children() (map[string]Node, error)
+}
+
+// Dir is the directory with a static set of children.
+type Dir map[string]Node
+
+// DirFunc is the directory whose children are generated by
+// the function each time it is looked up or listed.
+type DirFunc func() (map[string]Node, error)
+
+// BytesFunc is the file whose content is returned by the
+// function, which is called when it is opened or stated.
+type BytesFunc func() ([]byte, error)
+
+// ReaderAtFunc is the file whose content is read from the
+// returned reader with the size, which is closed after the
+// file is closed if it implements io.Closer.
+type ReaderAtFunc func() (io.ReaderAt, int64, error)
+
+// FileSystem is the gofs.FileSystem serving the tree.
+type FileSystem struct {
+	root    Node
+	created time.Time
+}
+
+// New creates the file system whose root is the node, which
+// is usually a Dir or a DirFunc.
+func New(root Node) *FileSystem {
+	return &FileSystem{
+		root:    root,
+		created: time.Now(),
+	}
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() os.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}   { return nil }
+
+func splitPath(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return r == '\\' || r == '/'
+	})
+}
+
+// lookupChild finds the child by name, falling back to case
+// insensitive match as the windows file systems do.
+func lookupChild(children map[string]Node, name string) (string, Node) {
+	if child, ok := children[name]; ok {
+		return name, child
+	}
+	for childName, child := range children {
+		if strings.EqualFold(childName, name) {
+			return childName, child
+		}
+	}
+	return "", nil
+}
+
+// lookup walks through the tree and returns the node with
+// its base name.
+func (fs *FileSystem) lookup(name string) (string, Node, error) {
+	base, node := "", fs.root
+	for _, part := range splitPath(name) {
+		dir, ok := node.(dirNode)
+		if !ok {
+			return "", nil, syscall.ENOTDIR
+		}
+		children, err := dir.children()
+		if err != nil {
+			return "", nil, err
+		}
+		if base, node = lookupChild(children, part); node == nil {
+			return "", nil, os.ErrNotExist
+		}
+	}
+	return base, node, nil
+}
+
+func (fs *FileSystem) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	base, node, err := fs.lookup(name)
+	if err != nil {
+		if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+			return nil, os.ErrPermission
+		}
+		return nil, err
+	}
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, os.ErrExist
+	}
+	return node.open(fs, base, flag)
+}
+
+func (fs *FileSystem) Mkdir(name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (fs *FileSystem) Stat(name string) (os.FileInfo, error) {
+	base, node, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return node.stat(fs, base)
+}
+
+func (fs *FileSystem) Rename(source, target string) error {
+	return os.ErrPermission
+}
+
+func (fs *FileSystem) Remove(name string) error {
+	return os.ErrPermission
+}
+
+var _ gofs.FileSystem = (*FileSystem)(nil)
+
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_APPEND | os.O_TRUNC
+
+func statDir(fs *FileSystem, name string) (os.FileInfo, error) {
+	return &fileInfo{
+		name:    name,
+		mode:    os.ModeDir | 0555,
+		modTime: fs.created,
+	}, nil
+}
+
+func openDir(
+	fs *FileSystem, name string, flag int, dir dirNode,
+) (gofs.File, error) {
+	if flag&writeFlags != 0 {
+		return nil, syscall.EISDIR
+	}
+	return &dirFile{fs: fs, name: name, dir: dir}, nil
+}
+
+func (d Dir) children() (map[string]Node, error) {
+	return d, nil
+}
+
+func (d Dir) stat(fs *FileSystem, name string) (os.FileInfo, error) {
+	return statDir(fs, name)
+}
+
+func (d Dir) open(fs *FileSystem, name string, flag int) (gofs.File, error) {
+	return openDir(fs, name, flag, d)
+}
+
+func (f DirFunc) children() (map[string]Node, error) {
+	return f()
+}
+
+func (f DirFunc) stat(fs *FileSystem, name string) (os.FileInfo, error) {
+	return statDir(fs, name)
+}
+
+func (f DirFunc) open(
+	fs *FileSystem, name string, flag int,
+) (gofs.File, error) {
+	return openDir(fs, name, flag, f)
+}
+
+func (f BytesFunc) stat(fs *FileSystem, name string) (os.FileInfo, error) {
+	data, err := f()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{
+		name:    name,
+		size:    int64(len(data)),
+		mode:    0444,
+		modTime: time.Now(),
+	}, nil
+}
+
+func (f BytesFunc) open(
+	fs *FileSystem, name string, flag int,
+) (gofs.File, error) {
+	if flag&writeFlags != 0 {
+		return nil, os.ErrPermission
+	}
+	data, err := f()
+	if err != nil {
+		return nil, err
+	}
+	return newContentFile(name, bytes.NewReader(data), int64(len(data))), nil
+}
+
+func (f ReaderAtFunc) stat(
+	fs *FileSystem, name string,
+) (os.FileInfo, error) {
+	reader, size, err := f()
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	return &fileInfo{
+		name:    name,
+		size:    size,
+		mode:    0444,
+		modTime: time.Now(),
+	}, nil
+}
+
+func (f ReaderAtFunc) open(
+	fs *FileSystem, name string, flag int,
+) (gofs.File, error) {
+	if flag&writeFlags != 0 {
+		return nil, os.ErrPermission
+	}
+	reader, size, err := f()
+	if err != nil {
+		return nil, err
+	}
+	return newContentFile(name, reader, size), nil
+}
+
+// contentFile is the open file of the generated content,
+// which is a snapshot taken when the file is opened.
+type contentFile struct {
+	info   fileInfo
+	reader io.ReaderAt
+	mtx    sync.Mutex
+	offset int64
+}
+
+func newContentFile(name string, reader io.ReaderAt, size int64) *contentFile {
+	return &contentFile{
+		info: fileInfo{
+			name:    name,
+			size:    size,
+			mode:    0444,
+			modTime: time.Now(),
+		},
+		reader: reader,
+	}
+}
+
+func (f *contentFile) ReadAt(b []byte, offset int64) (int, error) {
+	if offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if remaining := f.info.size - offset; int64(len(b)) > remaining {
+		n, err := f.reader.ReadAt(b[:remaining], offset)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return f.reader.ReadAt(b, offset)
+}
+
+func (f *contentFile) Read(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *contentFile) Seek(offset int64, whence int) (int64, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *contentFile) Write(b []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *contentFile) WriteAt(b []byte, offset int64) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *contentFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, syscall.ENOTDIR
+}
+
+func (f *contentFile) Stat() (os.FileInfo, error) {
+	info := f.info
+	return &info, nil
+}
+
+func (f *contentFile) Sync() error {
+	return nil
+}
+
+func (f *contentFile) Truncate(size int64) error {
+	return os.ErrPermission
+}
+
+func (f *contentFile) Close() error {
+	if closer, ok := f.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// dirFile is the open directory of the tree.
+type dirFile struct {
+	fs   *FileSystem
+	name string
+	dir  dirNode
+}
+
+func (f *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	children, err := f.dir.children()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]os.FileInfo, 0, len(children))
+	for name, child := range children {
+		info, err := child.stat(f.fs, name)
+		if err != nil {
+			// The file that could not be stated is just
+			// invisible in the listing.
+			continue
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+func (f *dirFile) Stat() (os.FileInfo, error) {
+	return statDir(f.fs, f.name)
+}
+
+func (f *dirFile) Read(b []byte) (int, error) {
+	return 0, syscall.EISDIR
+}
+
+func (f *dirFile) ReadAt(b []byte, offset int64) (int, error) {
+	return 0, syscall.EISDIR
+}
+
+func (f *dirFile) Write(b []byte) (int, error) {
+	return 0, syscall.EISDIR
+}
+
+func (f *dirFile) WriteAt(b []byte, offset int64) (int, error) {
+	return 0, syscall.EISDIR
+}
+
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (f *dirFile) Sync() error {
+	return nil
+}
+
+func (f *dirFile) Truncate(size int64) error {
+	return syscall.EISDIR
+}
+
+func (f *dirFile) Close() error {
+	return nil
+}
+
+var (
+	_ gofs.File = (*contentFile)(nil)
+	_ gofs.File = (*dirFile)(nil)
+)
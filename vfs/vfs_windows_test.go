@@ -0,0 +1,152 @@
+package vfs_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aegistudio/go-winfsp/vfs"
+)
+
+func TestTree(t *testing.T) {
+	assert := assert.New(t)
+	counter := 0
+	fs := vfs.New(vfs.Dir{
+		"counter": vfs.BytesFunc(func() ([]byte, error) {
+			counter++
+			return []byte(strings.Repeat("x", counter)), nil
+		}),
+		"config": vfs.Dir{
+			"reader.txt": vfs.ReaderAtFunc(
+				func() (io.ReaderAt, int64, error) {
+					return strings.NewReader("from reader, ignored"), 11, nil
+				}),
+		},
+		"devices": vfs.DirFunc(func() (map[string]vfs.Node, error) {
+			return map[string]vfs.Node{
+				"b": vfs.BytesFunc(func() ([]byte, error) {
+					return []byte("device b"), nil
+				}),
+				"a": vfs.BytesFunc(func() ([]byte, error) {
+					return []byte("device a"), nil
+				}),
+				"broken": vfs.BytesFunc(func() ([]byte, error) {
+					return nil, errors.New("broken")
+				}),
+			}, nil
+		}),
+	})
+
+	// The size is derived from the generated content.
+	info, err := fs.Stat(`\counter`)
+	assert.NoError(err)
+	assert.Equal(int64(1), info.Size())
+	f, err := fs.OpenFile(`\counter`, os.O_RDONLY, 0)
+	if assert.NoError(err) {
+		content, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal("xx", string(content))
+		assert.NoError(f.Close())
+	}
+
+	// The reader is limited to the declared size, and the
+	// lookup is case insensitive.
+	f, err = fs.OpenFile(`\CONFIG\Reader.TXT`, os.O_RDONLY, 0)
+	if assert.NoError(err) {
+		content, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal("from reader", string(content))
+		info, err := f.Stat()
+		assert.NoError(err)
+		assert.Equal("reader.txt", info.Name())
+		assert.NoError(f.Close())
+	}
+
+	// The generated directory lists its stated children.
+	f, err = fs.OpenFile(`\devices`, os.O_RDONLY, 0)
+	if assert.NoError(err) {
+		infos, err := f.Readdir(-1)
+		assert.NoError(err)
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		assert.Equal([]string{"a", "b"}, names)
+		assert.NoError(f.Close())
+	}
+	info, err = fs.Stat(`\devices`)
+	assert.NoError(err)
+	assert.True(info.IsDir())
+
+	_, err = fs.Stat(`\devices\missing`)
+	assert.True(os.IsNotExist(err))
+	_, err = fs.Stat(`\counter\child`)
+	assert.Error(err)
+}
+
+func TestReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	fs := vfs.New(vfs.Dir{
+		"file": vfs.BytesFunc(func() ([]byte, error) {
+			return []byte("content"), nil
+		}),
+	})
+	_, err := fs.OpenFile(`\file`, os.O_RDWR, 0)
+	assert.True(os.IsPermission(err))
+	_, err = fs.OpenFile(`\new`, os.O_RDWR|os.O_CREATE, 0644)
+	assert.True(os.IsPermission(err))
+	assert.True(os.IsPermission(fs.Mkdir(`\dir`, 0755)))
+	assert.True(os.IsPermission(fs.Remove(`\file`)))
+	assert.True(os.IsPermission(fs.Rename(`\file`, `\other`)))
+}
+
+func TestAutoSave(t *testing.T) {
+	assert := assert.New(t)
+	var saved []string
+	var saveErr error
+	config := vfs.NewAutoSave([]byte("key=value\n"), func(data []byte) error {
+		if saveErr != nil {
+			return saveErr
+		}
+		saved = append(saved, string(data))
+		return nil
+	})
+	fs := vfs.New(vfs.Dir{"config.ini": config})
+
+	// Closing an unmodified file does not save it.
+	f, err := fs.OpenFile(`\config.ini`, os.O_RDONLY, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.WriteAt([]byte("x"), 0)
+	assert.True(os.IsPermission(err))
+	assert.NoError(f.Close())
+	assert.Empty(saved)
+
+	f, err = fs.OpenFile(`\config.ini`, os.O_WRONLY|os.O_APPEND, 0)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = f.Write([]byte("other=1\n"))
+	assert.NoError(err)
+	assert.NoError(f.Sync())
+	assert.Equal([]string{"key=value\nother=1\n"}, saved)
+
+	// The content remains modified until it has been saved.
+	assert.NoError(f.Truncate(4))
+	saveErr = errors.New("disk full")
+	assert.Error(f.Close())
+	saveErr = nil
+	assert.NoError(config.Save())
+	assert.Equal([]string{"key=value\nother=1\n", "key="}, saved)
+	assert.Equal("key=", string(config.Bytes()))
+
+	info, err := fs.Stat(`\config.ini`)
+	assert.NoError(err)
+	assert.Equal(int64(4), info.Size())
+	assert.Equal(os.FileMode(0666), info.Mode())
+}
@@ -0,0 +1,242 @@
+package winfsp
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// VolumeSerialNumber sets the serial number of the volume,
+// which is zero by default.
+//
+// Backup and synchronization tools might identify volumes
+// by their serial numbers, so the file system should keep
+// it stable across mounts.
+func VolumeSerialNumber(value uint32) Option {
+	return func(o *option) {
+		o.volumeSerialNumber = value
+	}
+}
+
+// MaxComponentLength sets the maximum length of each path
+// component in characters, which is reported to callers of
+// GetVolumeInformation. The driver default of 255 is used
+// when it is zero.
+//
+// The file system backed by stores with shorter name limits
+// should advertise the limit, so that applications could
+// learn about it before their requests fail.
+func MaxComponentLength(value uint16) Option {
+	return func(o *option) {
+		o.maxComponentLength = value
+	}
+}
+
+// InfiniteTimeout is the cache timeout that never expires.
+const InfiniteTimeout = time.Duration(math.MaxInt64)
+
+// timeoutMillis converts the timeout into milliseconds, and
+// the timeout too long to be represented is saturated into
+// the infinite timeout of the driver.
+func timeoutMillis(value time.Duration) uint32 {
+	if value <= 0 {
+		return 0
+	}
+	millis := value / time.Millisecond
+	if millis >= math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(millis)
+}
+
+// FileInfoTimeout sets how long the file information is
+// cached by the kernel, which is zero by default so that
+// every query reaches the file system.
+//
+// It is also the default timeout of the other caches unless
+// they are specified explicitly. Slow network backends could
+// enable caching to reduce round trips, while InfiniteTimeout
+// makes the cache never expire.
+func FileInfoTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.fileInfoTimeout = timeoutMillis(value)
+	}
+}
+
+// DirInfoTimeout sets how long the directory listing is
+// cached by the kernel, overriding the FileInfoTimeout.
+func DirInfoTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.dirInfoTimeout = timeoutMillis(value)
+		o.fileSystemAttribute2 |= FspFSAttribute2DirInfoTimeoutValid
+	}
+}
+
+// VolumeInfoTimeout sets how long the volume information is
+// cached by the kernel, overriding the FileInfoTimeout.
+func VolumeInfoTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.volumeInfoTimeout = timeoutMillis(value)
+		o.fileSystemAttribute2 |= FspFSAttribute2VolumeInfoTimeoutValid
+	}
+}
+
+// SecurityTimeout sets how long the security descriptors
+// are cached by the kernel, overriding the FileInfoTimeout.
+func SecurityTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.securityTimeout = timeoutMillis(value)
+		o.fileSystemAttribute2 |= FspFSAttribute2SecurityTimeoutValid
+	}
+}
+
+// StreamInfoTimeout sets how long the stream information is
+// cached by the kernel, overriding the FileInfoTimeout.
+func StreamInfoTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.streamInfoTimeout = timeoutMillis(value)
+		o.fileSystemAttribute2 |= FspFSAttribute2StreamInfoTimeoutValid
+	}
+}
+
+// EaTimeout sets how long the extended attributes are
+// cached by the kernel, overriding the FileInfoTimeout.
+func EaTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.eaTimeout = timeoutMillis(value)
+		o.fileSystemAttribute2 |= FspFSAttribute2EaTimeoutValid
+	}
+}
+
+// IrpTimeout sets how long the driver waits for the file
+// system to respond to a request before cancelling it. The
+// driver clamps it between one and ten minutes, and uses
+// its default when it is zero.
+func IrpTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.irpTimeout = timeoutMillis(value)
+	}
+}
+
+// IrpCapacity sets how many requests could be pending in
+// the queue of the driver. The driver clamps it between 100
+// and 1000, and uses its default when it is zero.
+//
+// Deployments with high throughput could enlarge it to
+// keep more requests in flight.
+func IrpCapacity(value uint32) Option {
+	return func(o *option) {
+		o.irpCapacity = value
+	}
+}
+
+// TransactTimeout sets how long the dispatcher waits for
+// new requests from the driver in each transaction. The
+// driver clamps it between one and ten seconds, and uses
+// its default when it is zero.
+func TransactTimeout(value time.Duration) Option {
+	return func(o *option) {
+		o.transactTimeout = timeoutMillis(value)
+	}
+}
+
+// fillCacheTimeouts fills the cache timeouts and their valid
+// bits into the volume parameters.
+func (o *option) fillCacheTimeouts(params *FSP_FSCTL_VOLUME_PARAMS_V1) {
+	params.FileSystemAttribute2 = o.fileSystemAttribute2
+	params.FileInfoTimeout = o.fileInfoTimeout
+	params.DirInfoTimeout = o.dirInfoTimeout
+	params.VolumeInfoTimeout = o.volumeInfoTimeout
+	params.SecurityTimeout = o.securityTimeout
+	params.StreamInfoTimeout = o.streamInfoTimeout
+	params.EaTimeout = o.eaTimeout
+}
+
+// fillVolumeParams fills the volume parameters specified by
+// the options, other than the file system attributes.
+func (o *option) fillVolumeParams(params *FSP_FSCTL_VOLUME_PARAMS_V1) {
+	params.FsextControlCode = o.fsextControlCode
+	params.VolumeSerialNumber = o.volumeSerialNumber
+	params.MaxComponentLength = o.maxComponentLength
+	o.fillCacheTimeouts(params)
+	params.IrpTimeout = o.irpTimeout
+	params.IrpCapacity = o.irpCapacity
+	params.TransactTimeout = o.transactTimeout
+}
+
+// attributes derives the FileSystemAttribute bits of the
+// volume from the options.
+func (o *option) attributes() uint32 {
+	attributes := uint32(0)
+	if o.caseSensitive {
+		attributes |= FspFSAttributeCaseSensitive
+	}
+	if o.casePreserved {
+		attributes |= FspFSAttributeCasePreservedNames
+	}
+	attributes |= FspFSAttributeUnicodeOnDisk
+	if !o.minimalSecurity {
+		attributes |= FspFSAttributePersistentAcls
+	}
+	if o.flushAndPurgeOnCleanup {
+		attributes |= FspFSAttributeFlushAndPurgeOnCleanup
+	}
+	if o.postCleanupWhenModifiedOnly {
+		attributes |= FspFSAttributePostCleanupWhenModifiedOnly
+	}
+	if o.passPattern {
+		attributes |= FspFSAttributePassQueryDirectoryPattern
+	}
+	if o.fullContext {
+		attributes |= FspFSAttributeUmFileContextIsFullContext
+	} else {
+		attributes |= FspFSAttributeUmFileContextIsUserContext2
+	}
+	if o.posixUnlinkRename {
+		attributes |= FspFSAttributeSupportsPosixUnlinkRename
+	}
+	return attributes
+}
+
+// fileContextAttributes are the bits selecting the kind of
+// the file context, which the delegates depend on.
+const fileContextAttributes = FspFSAttributeUmFileContextIsUserContext2 |
+	FspFSAttributeUmFileContextIsFullContext
+
+// Attributes sets the raw FileSystemAttribute bits of the
+// volume, which are OR-ed with the ones derived from the
+// options and behaviours, e.g. the kernel and user mode
+// flags FspFSAttributeAllowOpenInKernelMode,
+// FspFSAttributeRejectIrpPriorToTransact0 and
+// FspFSAttributeUmNoReparsePointsDirCheck.
+//
+// The bits selecting the kind of the file context are
+// managed by FullContext and cannot be set here.
+func Attributes(value uint32) Option {
+	return func(o *option) {
+		o.fileSystemAttribute |= value
+	}
+}
+
+// Attributes2 sets the raw FileSystemAttribute2 bits of
+// the volume, which are OR-ed with the valid bits set by
+// the cache timeout options.
+func Attributes2(value uint32) Option {
+	return func(o *option) {
+		o.fileSystemAttribute2 |= value
+	}
+}
+
+// MountPointSecurity sets the security descriptor of the
+// mount point, which controls the accounts able to see and
+// use the mounted drive on multi-user machines. The mount
+// point is accessible to everyone by default.
+//
+// This requires FspFileSystemSetMountPointEx, which is
+// absent from the early releases of WinFSP.
+func MountPointSecurity(sd *windows.SECURITY_DESCRIPTOR) Option {
+	return func(o *option) {
+		o.mountPointSecurity = sd
+	}
+}
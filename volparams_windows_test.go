@@ -0,0 +1,167 @@
+package winfsp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutMillis(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint32(0), timeoutMillis(-time.Second))
+	assert.Equal(uint32(0), timeoutMillis(time.Microsecond))
+	assert.Equal(uint32(1500), timeoutMillis(1500*time.Millisecond))
+	assert.Equal(uint32(math.MaxUint32), timeoutMillis(InfiniteTimeout))
+}
+
+func TestCacheTimeoutOptions(t *testing.T) {
+	assert := assert.New(t)
+	o := newOption()
+	FileInfoTimeout(time.Second)(o)
+	assert.Equal(uint32(1000), o.fileInfoTimeout)
+	assert.Equal(uint32(0), o.fileSystemAttribute2)
+
+	DirInfoTimeout(0)(o)
+	VolumeInfoTimeout(time.Minute)(o)
+	assert.Equal(uint32(0), o.dirInfoTimeout)
+	assert.Equal(uint32(60000), o.volumeInfoTimeout)
+	assert.Equal(uint32(FspFSAttribute2DirInfoTimeoutValid|
+		FspFSAttribute2VolumeInfoTimeoutValid), o.fileSystemAttribute2)
+
+	SecurityTimeout(time.Second)(o)
+	StreamInfoTimeout(time.Second)(o)
+	EaTimeout(InfiniteTimeout)(o)
+	assert.Equal(uint32(1000), o.securityTimeout)
+	assert.Equal(uint32(1000), o.streamInfoTimeout)
+	assert.Equal(uint32(math.MaxUint32), o.eaTimeout)
+	assert.Equal(uint32(FspFSAttribute2DirInfoTimeoutValid|
+		FspFSAttribute2VolumeInfoTimeoutValid|
+		FspFSAttribute2SecurityTimeoutValid|
+		FspFSAttribute2StreamInfoTimeoutValid|
+		FspFSAttribute2EaTimeoutValid), o.fileSystemAttribute2)
+}
+
+func TestFillCacheTimeouts(t *testing.T) {
+	assert := assert.New(t)
+	o := newOption()
+	FileInfoTimeout(time.Second)(o)
+	DirInfoTimeout(InfiniteTimeout)(o)
+	EaTimeout(time.Minute)(o)
+	var params FSP_FSCTL_VOLUME_PARAMS_V1
+	o.fillCacheTimeouts(&params)
+	assert.Equal(uint32(1000), params.FileInfoTimeout)
+	assert.Equal(uint32(math.MaxUint32), params.DirInfoTimeout)
+	assert.Equal(uint32(60000), params.EaTimeout)
+	assert.Equal(uint32(0), params.SecurityTimeout)
+
+	// Only the specified caches override the FileInfoTimeout.
+	assert.Equal(uint32(FspFSAttribute2DirInfoTimeoutValid|
+		FspFSAttribute2EaTimeoutValid), params.FileSystemAttribute2)
+}
+
+func TestFillVolumeParams(t *testing.T) {
+	assert := assert.New(t)
+	var params FSP_FSCTL_VOLUME_PARAMS_V1
+	newOption().fillVolumeParams(&params)
+	assert.Zero(params.FsextControlCode)
+
+	o := newOption()
+	FsextControlCode(0x00094024)(o)
+	o.fillVolumeParams(&params)
+	assert.Equal(uint32(0x00094024), params.FsextControlCode)
+}
+
+func TestVolumeSerialNumber(t *testing.T) {
+	assert := assert.New(t)
+	var params FSP_FSCTL_VOLUME_PARAMS_V1
+	newOption().fillVolumeParams(&params)
+	assert.Zero(params.VolumeSerialNumber)
+
+	// The serial number is stable across the mounts.
+	for i := 0; i < 2; i++ {
+		o := newOption()
+		VolumeSerialNumber(0x1234abcd)(o)
+		o.fillVolumeParams(&params)
+		assert.Equal(uint32(0x1234abcd), params.VolumeSerialNumber)
+	}
+}
+
+func TestMaxComponentLength(t *testing.T) {
+	assert := assert.New(t)
+	var params FSP_FSCTL_VOLUME_PARAMS_V1
+	newOption().fillVolumeParams(&params)
+	assert.Zero(params.MaxComponentLength)
+	o := newOption()
+	MaxComponentLength(64)(o)
+	o.fillVolumeParams(&params)
+	assert.Equal(uint16(64), params.MaxComponentLength)
+}
+
+func TestIrpOptions(t *testing.T) {
+	assert := assert.New(t)
+	var params FSP_FSCTL_VOLUME_PARAMS_V1
+	newOption().fillVolumeParams(&params)
+	assert.Zero(params.IrpTimeout)
+	assert.Zero(params.IrpCapacity)
+	assert.Zero(params.TransactTimeout)
+
+	// The timeouts are converted into milliseconds, which the
+	// driver clamps into its own ranges.
+	o := newOption()
+	IrpTimeout(2 * time.Minute)(o)
+	IrpCapacity(500)(o)
+	TransactTimeout(1500 * time.Millisecond)(o)
+	o.fillVolumeParams(&params)
+	assert.Equal(uint32(120000), params.IrpTimeout)
+	assert.Equal(uint32(500), params.IrpCapacity)
+	assert.Equal(uint32(1500), params.TransactTimeout)
+}
+
+func TestCleanupAttributes(t *testing.T) {
+	assert := assert.New(t)
+	attributes := newOption().attributes()
+	assert.NotZero(attributes & FspFSAttributeFlushAndPurgeOnCleanup)
+	assert.Zero(attributes & FspFSAttributePostCleanupWhenModifiedOnly)
+
+	// Purging the cache could be disabled for read heavy
+	// workloads, independently of posting the cleanup.
+	o := newOption()
+	FlushAndPurgeOnCleanup(false)(o)
+	PostCleanupWhenModifiedOnly(true)(o)
+	attributes = o.attributes()
+	assert.Zero(attributes & FspFSAttributeFlushAndPurgeOnCleanup)
+	assert.NotZero(attributes & FspFSAttributePostCleanupWhenModifiedOnly)
+}
+
+func TestCaseAttributes(t *testing.T) {
+	assert := assert.New(t)
+	caseAttributes := func(opts ...Option) uint32 {
+		o := newOption()
+		Options(opts...)(o)
+		return o.attributes() & (FspFSAttributeCaseSensitive |
+			FspFSAttributeCasePreservedNames)
+	}
+
+	// The file system is case insensitive but preserving by
+	// default, which is the semantics of NTFS.
+	assert.Equal(uint32(FspFSAttributeCasePreservedNames), caseAttributes())
+	assert.Equal(uint32(FspFSAttributeCasePreservedNames), caseAttributes(
+		CaseSensitive(true), CaseInsensitivePreserving()))
+	assert.Equal(uint32(FspFSAttributeCaseSensitive|
+		FspFSAttributeCasePreservedNames), caseAttributes(CaseSensitive(true)))
+	assert.Zero(caseAttributes(CasePreservedNames(false)))
+}
+
+func TestAttributesOptions(t *testing.T) {
+	assert := assert.New(t)
+	o := newOption()
+	Attributes(FspFSAttributeAllowOpenInKernelMode)(o)
+	Attributes(FspFSAttributeRejectIrpPriorToTransact0)(o)
+	Attributes2(FspFSAttribute2EaTimeoutValid)(o)
+	assert.Equal(uint32(FspFSAttributeAllowOpenInKernelMode|
+		FspFSAttributeRejectIrpPriorToTransact0), o.fileSystemAttribute)
+	assert.Equal(uint32(FspFSAttribute2EaTimeoutValid),
+		o.fileSystemAttribute2)
+}
@@ -0,0 +1,77 @@
+package winfsp
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/sys/windows"
+)
+
+// MountPoint returns the resolved mount point of the file
+// system, which is the drive letter picked by WinFSP when
+// it is mounted at AutoDriveLetter, or empty when it has
+// been detached by RemoveMountPoint.
+func (ref *FileSystemRef) MountPoint() string {
+	ref.mountPointMutex.Lock()
+	defer ref.mountPointMutex.Unlock()
+	return ref.mountPoint
+}
+
+// VolumeName returns the name of the volume device created
+// by the driver, e.g. \Device\Volume{...}.
+//
+// The name is captured while mounting, and remains available
+// after the file system has been unmounted.
+func (ref *FileSystemRef) VolumeName() string {
+	return ref.volumeName
+}
+
+// VolumeHandle returns the handle to the volume device,
+// which is owned by the file system and must not be closed.
+//
+// The handle is closed while unmounting, and 0 is returned
+// after the file system has been unmounted.
+func (ref *FileSystemRef) VolumeHandle() windows.Handle {
+	ref.volumeMutex.RLock()
+	defer ref.volumeMutex.RUnlock()
+	if ref.destroyed {
+		return 0
+	}
+	return ref.volumeHandle
+}
+
+// DispatcherResult returns the error that stopped the
+// dispatcher, or nil while the dispatcher is running or
+// after it has been stopped normally. The result is kept
+// after the file system has been unmounted.
+func (ref *FileSystemRef) DispatcherResult() error {
+	ref.volumeMutex.RLock()
+	defer ref.volumeMutex.RUnlock()
+	result := ref.dispatcherResult
+	if !ref.destroyed {
+		result = windows.NTStatus(atomic.LoadUint32(
+			(*uint32)(&ref.fileSystem.DispatcherResult)))
+	}
+	if result == windows.STATUS_SUCCESS {
+		return nil
+	}
+	return result
+}
+
+// captureVolume captures the state of the volume created by
+// FspFileSystemCreate, so that they remain available after
+// the file system is deleted.
+func (ref *FileSystemRef) captureVolume() {
+	ref.volumeName = windows.UTF16ToString(ref.fileSystem.VolumeName[:])
+	ref.volumeHandle = ref.fileSystem.VolumeHandle
+}
+
+// releaseVolume captures the result of the dispatcher, and
+// marks the file system as destroyed. It must be called after
+// the dispatcher stops and before the file system is deleted.
+func (ref *FileSystemRef) releaseVolume() {
+	ref.volumeMutex.Lock()
+	defer ref.volumeMutex.Unlock()
+	ref.dispatcherResult = windows.NTStatus(atomic.LoadUint32(
+		(*uint32)(&ref.fileSystem.DispatcherResult)))
+	ref.destroyed = true
+}
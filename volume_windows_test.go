@@ -0,0 +1,28 @@
+package winfsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows"
+)
+
+func TestVolumeState(t *testing.T) {
+	assert := assert.New(t)
+	fileSystem := &FSP_FILE_SYSTEM{VolumeHandle: 42}
+	copy(fileSystem.VolumeName[:], windows.StringToUTF16(`\Device\Volume{1}`))
+	ref := &FileSystemRef{fileSystem: fileSystem}
+	ref.captureVolume()
+	assert.Equal(`\Device\Volume{1}`, ref.VolumeName())
+	assert.Equal(windows.Handle(42), ref.VolumeHandle())
+	assert.NoError(ref.DispatcherResult())
+	fileSystem.DispatcherResult = windows.STATUS_INSUFFICIENT_RESOURCES
+	assert.Equal(windows.STATUS_INSUFFICIENT_RESOURCES, ref.DispatcherResult())
+
+	// The accessors must not touch the deleted file system.
+	ref.releaseVolume()
+	ref.fileSystem = nil
+	assert.Equal(`\Device\Volume{1}`, ref.VolumeName())
+	assert.Equal(windows.Handle(0), ref.VolumeHandle())
+	assert.Equal(windows.STATUS_INSUFFICIENT_RESOURCES, ref.DispatcherResult())
+}
@@ -0,0 +1,8 @@
+// Package vss mounts the Volume Shadow Copy of a local path
+// as a read only drive, which provides a consistent view of
+// the files for backups through user space tooling.
+//
+// The snapshot is created when mounting, and released after
+// unmounting. Creating snapshots requires the administrator
+// privilege, and the Volume Shadow Copy service running.
+package vss
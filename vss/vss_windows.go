@@ -0,0 +1,200 @@
+package vss
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+
+	"github.com/aegistudio/go-winfsp"
+	"github.com/aegistudio/go-winfsp/gofs"
+)
+
+// Snapshot is the shadow copy of a volume.
+type Snapshot struct {
+	// ID is the identifier of the shadow copy.
+	ID string
+
+	// Volume is the path of the volume being copied.
+	Volume string
+
+	// DeviceObject is the device of the shadow copy, e.g.
+	// \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1.
+	DeviceObject string
+}
+
+// quote quotes the string literal of PowerShell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// powershell runs the script, returning its output lines.
+func powershell(script string) ([]string, error) {
+	cmd := exec.Command("powershell.exe",
+		"-NoProfile", "-NonInteractive", "-Command", script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "powershell: %s",
+			strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// Create creates a shadow copy of the volume, through the
+// Win32_ShadowCopy class of WMI.
+func Create(volume string) (*Snapshot, error) {
+	lines, err := powershell(`$ErrorActionPreference = 'Stop'
+$r = Invoke-CimMethod -ClassName Win32_ShadowCopy -MethodName Create ` +
+		`-Arguments @{Volume=` + quote(volume) + `; Context='ClientAccessible'}
+if ($r.ReturnValue -ne 0) { throw "create returned $($r.ReturnValue)" }
+$s = Get-CimInstance -ClassName Win32_ShadowCopy -Filter "ID='$($r.ShadowID)'"
+$s.ID
+$s.DeviceObject`)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create shadow copy of %q", volume)
+	}
+	if len(lines) != 2 {
+		return nil, errors.Errorf("unexpected output %q", lines)
+	}
+	return &Snapshot{
+		ID:           lines[0],
+		Volume:       volume,
+		DeviceObject: lines[1],
+	}, nil
+}
+
+// Release deletes the shadow copy.
+func (s *Snapshot) Release() error {
+	_, err := powershell(`$ErrorActionPreference = 'Stop'
+Get-CimInstance -ClassName Win32_ShadowCopy -Filter ` +
+		quote("ID='"+s.ID+"'") + ` | Remove-CimInstance`)
+	return errors.Wrapf(err, "release shadow copy %s", s.ID)
+}
+
+// Path maps the path under the volume into the snapshot.
+func (s *Snapshot) Path(path string) (string, error) {
+	rel, err := filepath.Rel(s.Volume, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, `..\`) {
+		return "", errors.Errorf("%q is not under %q", path, s.Volume)
+	}
+	if rel == "." {
+		return s.DeviceObject, nil
+	}
+	return s.DeviceObject + `\` + rel, nil
+}
+
+// volumeOf returns the mount point of the volume containing
+// the path, which might be a directory mount point.
+func volumeOf(path string) (string, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	if err := windows.GetVolumePathName(
+		pathPtr, &buf[0], uint32(len(buf))); err != nil {
+		return "", errors.Wrapf(err, "get volume of %q", path)
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// readOnlyFS is the read only gofs.FileSystem of the files
+// under the root directory.
+type readOnlyFS string
+
+func (fs readOnlyFS) path(name string) string {
+	return string(fs) + filepath.Clean(`\`+name)
+}
+
+func (fs readOnlyFS) OpenFile(
+	name string, flag int, perm os.FileMode,
+) (gofs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|
+		os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, os.ErrPermission
+	}
+	f, err := os.OpenFile(fs.path(name), flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs readOnlyFS) Mkdir(name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (fs readOnlyFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(fs.path(name))
+}
+
+func (fs readOnlyFS) Rename(source, target string) error {
+	return os.ErrPermission
+}
+
+func (fs readOnlyFS) Remove(name string) error {
+	return os.ErrPermission
+}
+
+// Mounted is the snapshot mounted as a read only drive.
+type Mounted struct {
+	*winfsp.FileSystem
+	Snapshot *Snapshot
+}
+
+// Mount creates the shadow copy of the volume containing the
+// path, and mounts the path inside the snapshot.
+func Mount(
+	path, mountpoint string, opts ...winfsp.Option,
+) (*Mounted, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	volume, err := volumeOf(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := Create(volume)
+	if err != nil {
+		return nil, err
+	}
+	mounted := false
+	defer func() {
+		if !mounted {
+			_ = snapshot.Release()
+		}
+	}()
+	root, err := snapshot.Path(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(root); err != nil {
+		if errors.Is(err, syscall.ERROR_PATH_NOT_FOUND) {
+			err = os.ErrNotExist
+		}
+		return nil, errors.Wrapf(err, "stat %q", root)
+	}
+	fs, err := winfsp.Mount(gofs.New(readOnlyFS(root)), mountpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	mounted = true
+	return &Mounted{FileSystem: fs, Snapshot: snapshot}, nil
+}
+
+// Unmount unmounts the drive and releases the snapshot.
+func (m *Mounted) Unmount() error {
+	m.FileSystem.Unmount()
+	return m.Snapshot.Release()
+}
@@ -0,0 +1,31 @@
+package vss
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotPath(t *testing.T) {
+	assert := assert.New(t)
+	s := &Snapshot{
+		Volume:       `C:\`,
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`,
+	}
+	path, err := s.Path(`C:\Users\data`)
+	assert.NoError(err)
+	assert.Equal(
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Users\data`, path)
+	path, err = s.Path(`C:\`)
+	assert.NoError(err)
+	assert.Equal(s.DeviceObject, path)
+	_, err = s.Path(`D:\data`)
+	assert.Error(err)
+
+	fs := readOnlyFS(s.DeviceObject)
+	assert.Equal(s.DeviceObject+`\etc`, fs.path(`\data\..\..\etc`))
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `'it''s'`, quote(`it's`))
+}
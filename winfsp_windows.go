@@ -117,3 +117,8 @@ type FSP_FILE_SYSTEM struct {
 	UmFileContextIsFullContext     uint8
 	UmDispatcherFlags              uint16
 }
+
+type FSP_FILE_SYSTEM_OPERATION_CONTEXT struct {
+	Request  *FSP_FSCTL_TRANSACT_REQ_HEADER
+	Response uintptr
+}
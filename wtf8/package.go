@@ -0,0 +1,10 @@
+// Package wtf8 converts between the UTF-16 names of windows
+// and the WTF-8 strings of golang.
+//
+// The file names on windows are arbitrary sequences of 16-bit
+// units, which might contain unpaired surrogates that cannot
+// be represented in UTF-8. WTF-8 encodes them as if they were
+// ordinary code points, so that such names could be converted
+// into golang strings and back without being mangled. This is
+// also the encoding used by the syscall package since go1.21.
+package wtf8
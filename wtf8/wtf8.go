@@ -0,0 +1,79 @@
+package wtf8
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	surrogateMin = 0xd800
+	surrogateMax = 0xdfff
+
+	// surrogateLead is the leading byte of the three-byte
+	// sequences encoding the surrogates.
+	surrogateLead = 0xed
+)
+
+// Decode converts the UTF-16 sequence into WTF-8 string,
+// where the unpaired surrogates are preserved.
+func Decode(s []uint16) string {
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		r := rune(s[i])
+		if utf16.IsSurrogate(r) && i+1 < len(s) {
+			if decoded := utf16.DecodeRune(
+				r, rune(s[i+1])); decoded != utf8.RuneError {
+				r = decoded
+				i++
+			}
+		}
+		if r >= surrogateMin && r <= surrogateMax {
+			// The unpaired surrogate is encoded as if it were
+			// an ordinary code point, which utf8 refuses to.
+			buf = append(buf, surrogateLead,
+				0x80|byte(r>>6)&0x3f, 0x80|byte(r)&0x3f)
+			continue
+		}
+		var encoded [utf8.UTFMax]byte
+		buf = append(buf, encoded[:utf8.EncodeRune(encoded[:], r)]...)
+	}
+	return string(buf)
+}
+
+// Encode converts the WTF-8 string into UTF-16 sequence, where
+// the encoded surrogates are restored. The invalid sequences
+// are replaced by U+FFFD.
+func Encode(s string) []uint16 {
+	return AppendEncode(make([]uint16, 0, len(s)+1), s)
+}
+
+// AppendEncode appends the UTF-16 encoding of the WTF-8 string
+// to the buffer and returns the extended buffer, so that the
+// caller is able to reuse the buffer across conversions.
+func AppendEncode(buf []uint16, s string) []uint16 {
+	for i := 0; i < len(s); {
+		if r, ok := decodeSurrogate(s[i:]); ok {
+			buf = append(buf, uint16(r))
+			i += 3
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			buf = append(buf, uint16(r1), uint16(r2))
+		} else {
+			buf = append(buf, uint16(r))
+		}
+	}
+	return buf
+}
+
+// decodeSurrogate decodes the surrogate encoded by WTF-8 at
+// the beginning of the string.
+func decodeSurrogate(s string) (rune, bool) {
+	if len(s) < 3 || s[0] != surrogateLead ||
+		s[1]&0xe0 != 0xa0 || s[2]&0xc0 != 0x80 {
+		return 0, false
+	}
+	return 0xd000 | rune(s[1]&0x3f)<<6 | rune(s[2]&0x3f), true
+}
@@ -0,0 +1,51 @@
+package wtf8
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidUTF16(t *testing.T) {
+	assert := assert.New(t)
+	for _, s := range []string{
+		"", "file.txt", "中文名称", "emoji-\U0001f600", "￿\u0080",
+	} {
+		encoded := Encode(s)
+		assert.Equal(utf16.Encode([]rune(s)), encoded)
+		assert.Equal(s, Decode(encoded))
+	}
+}
+
+func TestAppendEncode(t *testing.T) {
+	assert := assert.New(t)
+	buf := make([]uint16, 0, 16)
+	buf = AppendEncode(buf, "ab")
+	buf = AppendEncode(buf, "\U0001f600")
+	assert.Equal(utf16.Encode([]rune("ab\U0001f600")), buf)
+	assert.Equal(16, cap(buf))
+}
+
+func TestUnpairedSurrogates(t *testing.T) {
+	assert := assert.New(t)
+	for _, s := range [][]uint16{
+		{0xd800},
+		{0xdfff},
+		{'a', 0xdc00, 'b'},
+		{0xd83d, 'x', 0xde00},
+		{0xde00, 0xd83d},
+		{0xd83d, 0xd83d, 0xde00},
+	} {
+		decoded := Decode(s)
+		assert.NotContains(decoded, "�")
+		assert.Equal(s, Encode(decoded))
+	}
+	assert.Equal("a\xed\xb0\x80b", Decode([]uint16{'a', 0xdc00, 'b'}))
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]uint16{0xfffd, 'a'}, Encode("\xffa"))
+	assert.Equal([]uint16{0xfffd, 0xfffd}, Encode("\xed\xa0"))
+}